@@ -10,7 +10,9 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/base64"
+	"hash"
 	"io"
+	"io/ioutil"
 
 	"github.com/ProtonMail/go-crypto/openpgp/errors"
 )
@@ -40,24 +42,113 @@ type Block struct {
 
 var ArmorCorrupt error = errors.StructuralError("armor invalid")
 
+// ArmorChecksumMissing is returned at the end of a block without checksum
+// under the ChecksumRequire policy.
+var ArmorChecksumMissing error = errors.StructuralError("armor checksum missing")
+
+// ChecksumPolicy selects how the CRC-24 checksum of armored blocks is checked
+// by DecodeWithOptions. RFC 9580 deprecates the checksum, but it still
+// detects transport errors in many existing armored blocks.
+type ChecksumPolicy uint8
+
+const (
+	// ChecksumVerify rejects blocks whose checksum does not match, and
+	// accepts blocks without checksum. This is the policy of Decode.
+	ChecksumVerify ChecksumPolicy = iota
+	// ChecksumRequire rejects blocks whose checksum does not match or is
+	// missing.
+	ChecksumRequire
+	// ChecksumIgnore does not check the checksum.
+	ChecksumIgnore
+	// ChecksumWarn accepts blocks whose checksum does not match, and reports
+	// the mismatch to the Warn function of the DecodeOptions.
+	ChecksumWarn
+)
+
+// DecodeOptions are the options of DecodeWithOptions. A nil *DecodeOptions
+// is valid and results in the behavior of Decode.
+type DecodeOptions struct {
+	// ChecksumPolicy selects how the checksum of the block is checked.
+	ChecksumPolicy ChecksumPolicy
+	// Warn is called with ArmorCorrupt under the ChecksumWarn policy, if
+	// the checksum does not match. It may be nil.
+	Warn func(err error)
+}
+
 const crc24Init = 0xb704ce
 const crc24Poly = 0x1864cfb
 const crc24Mask = 0xffffff
 
-// crc24 calculates the OpenPGP checksum as specified in RFC 4880, section 6.1
-func crc24(crc uint32, d []byte) uint32 {
-	for _, b := range d {
-		crc ^= uint32(b) << 16
-		for i := 0; i < 8; i++ {
+// crc24Table holds the CRC-24 of each octet value, computed bit by bit.
+var crc24Table = func() (table [256]uint32) {
+	for i := range table {
+		crc := uint32(i) << 16
+		for j := 0; j < 8; j++ {
 			crc <<= 1
 			if crc&0x1000000 != 0 {
 				crc ^= crc24Poly
 			}
 		}
+		table[i] = crc
+	}
+	return
+}()
+
+// crc24 calculates the OpenPGP checksum as specified in RFC 4880, section 6.1
+func crc24(crc uint32, d []byte) uint32 {
+	for _, b := range d {
+		crc = (crc << 8 & crc24Mask) ^ crc24Table[byte(crc>>16)^b]
 	}
 	return crc
 }
 
+// CRC24 returns the CRC-24 checksum of data, as found at the end of armored
+// blocks. See RFC 4880, section 6.1.
+func CRC24(data []byte) uint32 {
+	return crc24(crc24Init, data) & crc24Mask
+}
+
+// NewCRC24 returns a hash.Hash32 computing the CRC-24 checksum of armored
+// blocks. Its Sum method appends the checksum in big-endian order, over
+// three octets.
+func NewCRC24() hash.Hash32 {
+	return &crc24Hash{crc: crc24Init}
+}
+
+type crc24Hash struct {
+	crc uint32
+}
+
+func (h *crc24Hash) Write(p []byte) (int, error) {
+	h.crc = crc24(h.crc, p)
+	return len(p), nil
+}
+
+func (h *crc24Hash) Sum32() uint32 {
+	return h.crc & crc24Mask
+}
+
+func (h *crc24Hash) Sum(b []byte) []byte {
+	crc := h.Sum32()
+	return append(b, byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+func (h *crc24Hash) Reset() {
+	h.crc = crc24Init
+}
+
+func (h *crc24Hash) Size() int {
+	return 3
+}
+
+func (h *crc24Hash) BlockSize() int {
+	return 1
+}
+
+// decodeBufferSize is the size of the buffer used to read armored blocks,
+// large enough to decode many lines at once.
+const decodeBufferSize = 1 << 15
+
 var armorStart = []byte("-----BEGIN ")
 var armorEnd = []byte("-----END ")
 var armorEndOfLine = []byte("-----")
@@ -77,65 +168,144 @@ func (l *lineReader) Read(p []byte) (n int, err error) {
 		return 0, io.EOF
 	}
 
-	if len(l.buf) > 0 {
-		n = copy(p, l.buf)
-		l.buf = l.buf[n:]
-		return
-	}
-
-	line, isPrefix, err := l.in.ReadLine()
-	if err != nil {
-		return
-	}
-	if isPrefix {
-		return 0, ArmorCorrupt
-	}
-
-	if bytes.HasPrefix(line, armorEnd) {
-		l.eof = true
-		return 0, io.EOF
-	}
-
-	if len(line) == 5 && line[0] == '=' {
-		// This is the checksum line
-		var expectedBytes [3]byte
-		var m int
-		m, err = base64.StdEncoding.Decode(expectedBytes[0:], line[1:])
-		if m != 3 || err != nil {
+	// Fill p with as many lines as possible, without blocking on the
+	// underlying reader once some data is available.
+	for n < len(p) {
+		if len(l.buf) > 0 {
+			m := copy(p[n:], l.buf)
+			l.buf = l.buf[m:]
+			n += m
+			continue
+		}
+		if n > 0 && l.in.Buffered() == 0 {
 			return
 		}
-		l.crc = uint32(expectedBytes[0])<<16 |
-			uint32(expectedBytes[1])<<8 |
-			uint32(expectedBytes[2])
 
-		line, _, err = l.in.ReadLine()
-		if err != nil && err != io.EOF {
+		var line []byte
+		var isPrefix bool
+		line, isPrefix, err = l.in.ReadLine()
+		if err != nil {
 			return
 		}
-		if !bytes.HasPrefix(line, armorEnd) {
-			return 0, ArmorCorrupt
+		if isPrefix {
+			return n, ArmorCorrupt
 		}
 
-		l.eof = true
-		l.crcSet = true
-		return 0, io.EOF
+		if bytes.HasPrefix(line, armorEnd) {
+			l.eof = true
+			if n > 0 {
+				return n, nil
+			}
+			return 0, io.EOF
+		}
+
+		if len(line) == 5 && line[0] == '=' {
+			// This is the checksum line
+			var expectedBytes [3]byte
+			var m int
+			m, err = base64.StdEncoding.Decode(expectedBytes[0:], line[1:])
+			if m != 3 || err != nil {
+				return
+			}
+			l.crc = uint32(expectedBytes[0])<<16 |
+				uint32(expectedBytes[1])<<8 |
+				uint32(expectedBytes[2])
+
+			line, _, err = l.in.ReadLine()
+			if err != nil && err != io.EOF {
+				return
+			}
+			if !bytes.HasPrefix(line, armorEnd) {
+				return n, ArmorCorrupt
+			}
+
+			l.eof = true
+			l.crcSet = true
+			if n > 0 {
+				return n, nil
+			}
+			return 0, io.EOF
+		}
+
+		if len(line) > 96 {
+			return n, ArmorCorrupt
+		}
+
+		m := copy(p[n:], line)
+		n += m
+		bytesToSave := len(line) - m
+		if bytesToSave > 0 {
+			if cap(l.buf) < bytesToSave {
+				l.buf = make([]byte, 0, bytesToSave)
+			}
+			l.buf = l.buf[0:bytesToSave]
+			copy(l.buf, line[m:])
+		}
 	}
 
-	if len(line) > 96 {
-		return 0, ArmorCorrupt
+	return
+}
+
+// blockDecoder decodes base64 data in large blocks. Its input, read from a
+// lineReader, contains no line breaks.
+type blockDecoder struct {
+	in      io.Reader
+	err     error
+	encoded []byte // encoded data, of which nbuf octets are pending
+	nbuf    int
+	decoded []byte // decoded data, of which out is not returned yet
+	out     []byte
+}
+
+func newBlockDecoder(in io.Reader) *blockDecoder {
+	return &blockDecoder{
+		in:      in,
+		encoded: make([]byte, decodeBufferSize),
+		decoded: make([]byte, decodeBufferSize/4*3),
 	}
+}
 
-	n = copy(p, line)
-	bytesToSave := len(line) - n
-	if bytesToSave > 0 {
-		if cap(l.buf) < bytesToSave {
-			l.buf = make([]byte, 0, bytesToSave)
+func (d *blockDecoder) Read(p []byte) (n int, err error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
 		}
-		l.buf = l.buf[0:bytesToSave]
-		copy(l.buf, line[n:])
+		var m int
+		m, d.err = d.in.Read(d.encoded[d.nbuf:])
+		d.nbuf += removeCR(d.encoded[d.nbuf : d.nbuf+m])
+		if d.err == io.EOF && d.nbuf%4 != 0 {
+			d.err = io.ErrUnexpectedEOF
+		}
+
+		// Decode all the complete quanta, and keep the others for the
+		// next call.
+		quanta := d.nbuf / 4 * 4
+		decoded, decodeErr := base64.StdEncoding.Decode(d.decoded, d.encoded[:quanta])
+		if decodeErr != nil {
+			d.err = decodeErr
+		}
+		d.out = d.decoded[:decoded]
+		d.nbuf = copy(d.encoded, d.encoded[quanta:d.nbuf])
 	}
+	n = copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
 
-	return
+// removeCR removes the carriage returns from b in place, as the base64
+// decoder of the standard library does, and returns the resulting length.
+func removeCR(b []byte) int {
+	if bytes.IndexByte(b, '\r') == -1 {
+		return len(b)
+	}
+	n := 0
+	for _, c := range b {
+		if c != '\r' {
+			b[n] = c
+			n++
+		}
+	}
+	return n
 }
 
 // openpgpReader passes Read calls to the underlying base64 decoder, but keeps
@@ -145,25 +315,97 @@ type openpgpReader struct {
 	lReader    *lineReader
 	b64Reader  io.Reader
 	currentCRC uint32
+	options    *DecodeOptions
 }
 
 func (r *openpgpReader) Read(p []byte) (n int, err error) {
 	n, err = r.b64Reader.Read(p)
 	r.currentCRC = crc24(r.currentCRC, p[:n])
 
-	if err == io.EOF && r.lReader.crcSet && r.lReader.crc != uint32(r.currentCRC&crc24Mask) {
-		return 0, ArmorCorrupt
+	if err == io.EOF {
+		if crcErr := r.checkCRC(); crcErr != nil {
+			return 0, crcErr
+		}
 	}
 
 	return
 }
 
+// checkCRC checks the checksum of the block according to the checksum policy.
+func (r *openpgpReader) checkCRC() error {
+	var policy ChecksumPolicy
+	if r.options != nil {
+		policy = r.options.ChecksumPolicy
+	}
+	mismatch := r.lReader.crcSet && r.lReader.crc != uint32(r.currentCRC&crc24Mask)
+	switch policy {
+	case ChecksumRequire:
+		if !r.lReader.crcSet {
+			return ArmorChecksumMissing
+		}
+	case ChecksumIgnore:
+		return nil
+	case ChecksumWarn:
+		if mismatch && r.options.Warn != nil {
+			r.options.Warn(ArmorCorrupt)
+		}
+		return nil
+	}
+	if mismatch {
+		return ArmorCorrupt
+	}
+	return nil
+}
+
 // Decode reads a PGP armored block from the given Reader. It will ignore
 // leading garbage. If it doesn't find a block, it will return nil, io.EOF. The
 // given Reader is not usable after calling this function: an arbitrary amount
 // of data may have been read past the end of the block.
 func Decode(in io.Reader) (p *Block, err error) {
-	r := bufio.NewReaderSize(in, 100)
+	return DecodeWithOptions(in, nil)
+}
+
+// DecodeWithOptions is like Decode, but checks the checksum of the block
+// according to the given options.
+func DecodeWithOptions(in io.Reader, options *DecodeOptions) (p *Block, err error) {
+	return decode(bufio.NewReaderSize(in, decodeBufferSize), options)
+}
+
+// A Decoder reads the successive armored blocks of a stream, such as a file
+// in which several armored blocks were concatenated.
+type Decoder struct {
+	r       *bufio.Reader
+	options *DecodeOptions
+	last    *Block
+}
+
+// NewDecoder returns a Decoder reading armored blocks from in, whose checksums
+// are checked according to the given options, which may be nil.
+func NewDecoder(in io.Reader, options *DecodeOptions) *Decoder {
+	return &Decoder{
+		r:       bufio.NewReaderSize(in, decodeBufferSize),
+		options: options,
+	}
+}
+
+// Next returns the next armored block, ignoring any data between blocks. The
+// unread contents of the previous block are skipped. It returns nil, io.EOF
+// if there are no more blocks.
+func (d *Decoder) Next() (p *Block, err error) {
+	if d.last != nil {
+		// Errors are reported to the reader of the previous block, if any.
+		io.Copy(ioutil.Discard, d.last.Body)
+		d.last = nil
+	}
+	p, err = decode(d.r, d.options)
+	if err != nil {
+		return nil, err
+	}
+	d.last = p
+	return p, nil
+}
+
+func decode(r *bufio.Reader, options *DecodeOptions) (p *Block, err error) {
 	var line []byte
 	ignoreNext := false
 
@@ -224,7 +466,8 @@ TryNextBlock:
 	p.lReader.in = r
 	p.oReader.currentCRC = crc24Init
 	p.oReader.lReader = &p.lReader
-	p.oReader.b64Reader = base64.NewDecoder(base64.StdEncoding, &p.lReader)
+	p.oReader.options = options
+	p.oReader.b64Reader = newBlockDecoder(&p.lReader)
 	p.Body = &p.oReader
 
 	return
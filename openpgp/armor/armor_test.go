@@ -6,9 +6,13 @@ package armor
 
 import (
 	"bytes"
+	"encoding/base64"
 	"hash/adler32"
+	"io"
 	"io/ioutil"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestDecodeEncode(t *testing.T) {
@@ -89,6 +93,208 @@ func TestLongHeader(t *testing.T) {
 	}
 }
 
+func TestCRC24(t *testing.T) {
+	data := []byte("123456789")
+	if crc := CRC24(data); crc != 0x21cf02 {
+		t.Errorf("CRC24: got %06x, want 21cf02", crc)
+	}
+	h := NewCRC24()
+	h.Write(data[:4])
+	h.Write(data[4:])
+	if crc := h.Sum32(); crc != 0x21cf02 {
+		t.Errorf("NewCRC24: got %06x, want 21cf02", crc)
+	}
+	if sum := h.Sum(nil); !bytes.Equal(sum, []byte{0x21, 0xcf, 0x02}) {
+		t.Errorf("NewCRC24 sum: got %x", sum)
+	}
+}
+
+func TestDecodeChecksumPolicy(t *testing.T) {
+	corrupt := strings.Replace(armorExample1, "=/teI", "=/teJ", 1)
+	missing := strings.Replace(armorExample1, "=/teI\n", "", 1)
+
+	var warnings []error
+	warn := func(err error) {
+		warnings = append(warnings, err)
+	}
+	tests := []struct {
+		armored string
+		policy  ChecksumPolicy
+		wantErr error
+	}{
+		{armorExample1, ChecksumVerify, nil},
+		{corrupt, ChecksumVerify, ArmorCorrupt},
+		{missing, ChecksumVerify, nil},
+		{armorExample1, ChecksumRequire, nil},
+		{corrupt, ChecksumRequire, ArmorCorrupt},
+		{missing, ChecksumRequire, ArmorChecksumMissing},
+		{corrupt, ChecksumIgnore, nil},
+		{missing, ChecksumIgnore, nil},
+		{corrupt, ChecksumWarn, nil},
+	}
+	for i, test := range tests {
+		result, err := DecodeWithOptions(strings.NewReader(test.armored), &DecodeOptions{
+			ChecksumPolicy: test.policy,
+			Warn:           warn,
+		})
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if _, err = ioutil.ReadAll(result.Body); err != test.wantErr {
+			t.Errorf("#%d: got error %v, want %v", i, err, test.wantErr)
+		}
+	}
+	if len(warnings) != 1 || warnings[0] != ArmorCorrupt {
+		t.Errorf("unexpected warnings: %v", warnings)
+	}
+}
+
+func TestEncodeDecodeLarge(t *testing.T) {
+	data := make([]byte, 100003)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var lines []string
+	for len(encoded) > 64 {
+		lines = append(lines, encoded[:64])
+		encoded = encoded[64:]
+	}
+	lines = append(lines, encoded)
+	crc := CRC24(data)
+	checksum := base64.StdEncoding.EncodeToString([]byte{byte(crc >> 16), byte(crc >> 8), byte(crc)})
+	want := "-----BEGIN PGP MESSAGE-----\n\n" + strings.Join(lines, "\n") + "\n=" + checksum + "\n-----END PGP MESSAGE-----"
+
+	for _, writeSize := range []int{1, 47, 48, 1000, len(data)} {
+		var buf bytes.Buffer
+		w, err := Encode(&buf, "PGP MESSAGE", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(data); i += writeSize {
+			end := i + writeSize
+			if end > len(data) {
+				end = len(data)
+			}
+			if _, err = w.Write(data[i:end]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want {
+			t.Fatalf("unexpected encoding with writes of %d octets", writeSize)
+		}
+
+		// Decode with CRLF line endings, as produced on some platforms.
+		crlf := strings.Replace(buf.String(), "\n", "\r\n", -1)
+		block, err := Decode(iotest.OneByteReader(strings.NewReader(crlf)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := ioutil.ReadAll(block.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Fatal("decoded data differs")
+		}
+	}
+}
+
+func TestEncodedLen(t *testing.T) {
+	headers := map[string]string{"Comment": "test", "Version": "1"}
+	for _, n := range []int{0, 1, 47, 48, 49, 96, 1000} {
+		var buf bytes.Buffer
+		w, err := Encode(&buf, "PGP MESSAGE", headers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write(make([]byte, n)); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := EncodedLen(int64(n), "PGP MESSAGE", headers); got != int64(buf.Len()) {
+			t.Errorf("EncodedLen(%d) = %d, want %d", n, got, buf.Len())
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	input := "garbage\n" + armorExample1 + "\n\n" + armorExampleEmptyVersion + "\ntrailing garbage\n"
+	d := NewDecoder(strings.NewReader(input), nil)
+
+	first, err := d.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Header["Version"] != "GnuPG v1.4.10 (GNU/Linux)" {
+		t.Errorf("unexpected first block headers: %#v", first.Header)
+	}
+	// The second block is read without reading the first one.
+	second, err := d.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := second.Header["Version"]; !ok || v != "" {
+		t.Errorf("unexpected second block headers: %#v", second.Header)
+	}
+	if _, err = ioutil.ReadAll(second.Body); err != nil {
+		t.Error(err)
+	}
+	if _, err = d.Next(); err != io.EOF {
+		t.Errorf("got %v, want io.EOF", err)
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	data := make([]byte, 1<<20)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		w, err := Encode(ioutil.Discard, "PGP MESSAGE", nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = w.Write(data); err != nil {
+			b.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	var buf bytes.Buffer
+	w, err := Encode(&buf, "PGP MESSAGE", nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := make([]byte, 1<<20)
+	if _, err = w.Write(data); err != nil {
+		b.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		b.Fatal(err)
+	}
+	armored := buf.Bytes()
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		block, err := Decode(bytes.NewReader(armored))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = io.Copy(ioutil.Discard, block.Body); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 const armorExample1 = `-----BEGIN PGP SIGNATURE-----
 Version: GnuPG v1.4.10 (GNU/Linux)
 
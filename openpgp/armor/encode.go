@@ -25,98 +25,97 @@ func writeSlices(out io.Writer, slices ...[]byte) (err error) {
 	return
 }
 
-// lineBreaker breaks data across several lines, all of the same byte length
-// (except possibly the last). Lines are broken with a single '\n'.
-type lineBreaker struct {
-	lineLength  int
-	line        []byte
-	used        int
+const (
+	// encodeLineLength is the number of octets encoded on each armored line,
+	// whose length is 64 characters.
+	encodeLineLength = 48
+	// encodeBufferLines is the number of lines encoded at once.
+	encodeBufferLines = 512
+)
+
+// encoding keeps track of a running CRC24 over the data which has been written
+// to it and outputs a OpenPGP checksum when closed, followed by an armor
+// trailer. The data is base64 encoded and broken across lines of 64
+// characters in large blocks, which are written to out at once.
+type encoding struct {
 	out         io.Writer
+	crc         uint32
+	blockType   []byte
+	pending     []byte // data of an incomplete line
+	encoded     []byte
 	haveWritten bool
 }
 
-func newLineBreaker(out io.Writer, lineLength int) *lineBreaker {
-	return &lineBreaker{
-		lineLength: lineLength,
-		line:       make([]byte, lineLength),
-		used:       0,
-		out:        out,
-	}
-}
-
-func (l *lineBreaker) Write(b []byte) (n int, err error) {
-	n = len(b)
-
-	if n == 0 {
-		return
-	}
+func (e *encoding) Write(data []byte) (n int, err error) {
+	n = len(data)
+	e.crc = crc24(e.crc, data)
 
-	if l.used == 0 && l.haveWritten {
-		_, err = l.out.Write([]byte{'\n'})
-		if err != nil {
+	// Complete the pending line first.
+	if len(e.pending) > 0 {
+		m := copy(e.pending[len(e.pending):encodeLineLength], data)
+		e.pending = e.pending[:len(e.pending)+m]
+		data = data[m:]
+		if len(e.pending) < encodeLineLength {
 			return
 		}
+		if err = e.encodeLines(e.pending); err != nil {
+			return
+		}
+		e.pending = e.pending[:0]
 	}
 
-	if l.used+len(b) < l.lineLength {
-		l.used += copy(l.line[l.used:], b)
-		return
-	}
-
-	l.haveWritten = true
-	_, err = l.out.Write(l.line[0:l.used])
-	if err != nil {
-		return
-	}
-	excess := l.lineLength - l.used
-	l.used = 0
-
-	_, err = l.out.Write(b[0:excess])
-	if err != nil {
-		return
-	}
-
-	_, err = l.Write(b[excess:])
-	return
-}
-
-func (l *lineBreaker) Close() (err error) {
-	if l.used > 0 {
-		_, err = l.out.Write(l.line[0:l.used])
-		if err != nil {
+	lines := len(data) / encodeLineLength
+	for lines > 0 {
+		batch := lines
+		if batch > encodeBufferLines {
+			batch = encodeBufferLines
+		}
+		if err = e.encodeLines(data[:batch*encodeLineLength]); err != nil {
 			return
 		}
+		data = data[batch*encodeLineLength:]
+		lines -= batch
 	}
 
+	e.pending = append(e.pending[:0], data...)
 	return
 }
 
-// encoding keeps track of a running CRC24 over the data which has been written
-// to it and outputs a OpenPGP checksum when closed, followed by an armor
-// trailer.
-//
-// It's built into a stack of io.Writers:
-//
-//	encoding -> base64 encoder -> lineBreaker -> out
-type encoding struct {
-	out       io.Writer
-	breaker   *lineBreaker
-	b64       io.WriteCloser
-	crc       uint32
-	blockType []byte
-}
-
-func (e *encoding) Write(data []byte) (n int, err error) {
-	e.crc = crc24(e.crc, data)
-	return e.b64.Write(data)
+// encodeLines writes data, whose length is a multiple of encodeLineLength
+// unless it is the last line, as base64 encoded lines to out.
+func (e *encoding) encodeLines(data []byte) error {
+	e.encoded = e.encoded[:0]
+	for len(data) > 0 {
+		line := data
+		if len(line) > encodeLineLength {
+			line = line[:encodeLineLength]
+		}
+		data = data[len(line):]
+		if e.haveWritten {
+			e.encoded = append(e.encoded, '\n')
+		}
+		e.haveWritten = true
+		start := len(e.encoded)
+		end := start + base64.StdEncoding.EncodedLen(len(line))
+		if cap(e.encoded) < end {
+			grown := make([]byte, start, 2*end)
+			copy(grown, e.encoded)
+			e.encoded = grown
+		}
+		e.encoded = e.encoded[:end]
+		base64.StdEncoding.Encode(e.encoded[start:], line)
+	}
+	_, err := e.out.Write(e.encoded)
+	return err
 }
 
 func (e *encoding) Close() (err error) {
-	err = e.b64.Close()
-	if err != nil {
-		return
+	if len(e.pending) > 0 {
+		if err = e.encodeLines(e.pending); err != nil {
+			return
+		}
+		e.pending = e.pending[:0]
 	}
-	e.breaker.Close()
 
 	var checksumBytes [3]byte
 	checksumBytes[0] = byte(e.crc >> 16)
@@ -152,10 +151,29 @@ func Encode(out io.Writer, blockType string, headers map[string]string) (w io.Wr
 
 	e := &encoding{
 		out:       out,
-		breaker:   newLineBreaker(out, 64),
 		crc:       crc24Init,
 		blockType: bType,
+		pending:   make([]byte, 0, encodeLineLength),
+		encoded:   make([]byte, 0, encodeBufferLines*(base64.StdEncoding.EncodedLen(encodeLineLength)+1)),
 	}
-	e.b64 = base64.NewEncoder(base64.StdEncoding, e.breaker)
 	return e, nil
 }
+
+// EncodedLen returns the length of the armor produced by Encode for n octets
+// of data with the given block type and headers.
+func EncodedLen(n int64, blockType string, headers map[string]string) int64 {
+	length := int64(len(armorStart)+len(blockType)+len(armorEndOfLineOut)) + int64(len(newline))
+	for k, v := range headers {
+		length += int64(len(k)+len(armorHeaderSep)+len(v)) + int64(len(newline))
+	}
+
+	lines := (n + encodeLineLength - 1) / encodeLineLength
+	length += n / encodeLineLength * int64(base64.StdEncoding.EncodedLen(encodeLineLength))
+	length += int64(base64.StdEncoding.EncodedLen(int(n % encodeLineLength)))
+	if lines > 1 {
+		length += (lines - 1) * int64(len(newline))
+	}
+
+	length += int64(len(blockEnd)+4+len(newline)) + int64(len(armorEnd)+len(blockType)+len(armorEndOfLine))
+	return length
+}
@@ -0,0 +1,149 @@
+package openpgp
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// An ArmoredBlockError reports that an armored block of a keyring file could
+// not be read.
+type ArmoredBlockError struct {
+	// Index is the position of the block in the file, starting from zero.
+	Index int
+	Err   error
+}
+
+func (e ArmoredBlockError) Error() string {
+	return "openpgp: armored block " + strconv.Itoa(e.Index) + ": " + e.Err.Error()
+}
+
+// ReadArmoredKeyRingBlocks reads the public/private keys of all the armored
+// blocks of a keyring file, such as the concatenation of several exports. The
+// entities found in several blocks, such as the public and private exports of
+// the same key, are merged. The blocks that could not be read, or are not
+// public or private key blocks, are reported in blockErrors, while the keys
+// of the other blocks are returned. err is only set if the file contains no
+// armored block at all.
+func ReadArmoredKeyRingBlocks(r io.Reader) (el EntityList, blockErrors []ArmoredBlockError, err error) {
+	decoder := armor.NewDecoder(r, nil)
+	byFingerprint := make(map[string]*Entity)
+	for i := 0; ; i++ {
+		block, err := decoder.Next()
+		if err == io.EOF {
+			if i == 0 {
+				return nil, nil, errors.InvalidArgumentError("no armored data found")
+			}
+			break
+		}
+		if err != nil {
+			if i == 0 {
+				return nil, nil, err
+			}
+			// The stream cannot be read any further.
+			blockErrors = append(blockErrors, ArmoredBlockError{i, err})
+			break
+		}
+		if block.Type != PublicKeyType && block.Type != PrivateKeyType {
+			blockErrors = append(blockErrors, ArmoredBlockError{i, errors.InvalidArgumentError("expected public or private key block, got: " + block.Type)})
+			continue
+		}
+
+		entities, err := ReadKeyRing(block.Body)
+		if err != nil {
+			blockErrors = append(blockErrors, ArmoredBlockError{i, err})
+			continue
+		}
+		for _, e := range entities {
+			fingerprint := string(e.PrimaryKey.Fingerprint)
+			if existing, ok := byFingerprint[fingerprint]; ok {
+				existing.merge(e)
+				continue
+			}
+			byFingerprint[fingerprint] = e
+			el = append(el, e)
+		}
+	}
+	return el, blockErrors, nil
+}
+
+// merge adds to e the identities, subkeys, signatures and private keys of
+// other, another copy of the same key, that e does not have. Of the
+// self-signatures of an identity, user attribute or subkey found in both,
+// the newer one is kept.
+func (e *Entity) merge(other *Entity) {
+	if e.PrivateKey == nil {
+		e.PrivateKey = other.PrivateKey
+	}
+	e.Revocations = appendMissingSignatures(e.Revocations, other.Revocations)
+	e.Signatures = appendMissingSignatures(e.Signatures, other.Signatures)
+	if e.SelfSignature == nil {
+		e.SelfSignature = other.SelfSignature
+	}
+
+	for name, ident := range other.Identities {
+		existing, ok := e.Identities[name]
+		if !ok {
+			e.Identities[name] = ident
+			continue
+		}
+		if ident.SelfSignature != nil && (existing.SelfSignature == nil ||
+			ident.SelfSignature.CreationTime.After(existing.SelfSignature.CreationTime)) {
+			existing.SelfSignature = ident.SelfSignature
+		}
+		existing.Revocations = appendMissingSignatures(existing.Revocations, ident.Revocations)
+		existing.Signatures = appendMissingSignatures(existing.Signatures, ident.Signatures)
+	}
+
+	for _, ua := range other.UserAttributes {
+		existing := e.findUserAttribute(ua.UserAttribute)
+		if existing == nil {
+			e.UserAttributes = append(e.UserAttributes, ua)
+			continue
+		}
+		if ua.SelfSignature != nil && (existing.SelfSignature == nil ||
+			ua.SelfSignature.CreationTime.After(existing.SelfSignature.CreationTime)) {
+			existing.SelfSignature = ua.SelfSignature
+		}
+		existing.Revocations = appendMissingSignatures(existing.Revocations, ua.Revocations)
+		existing.Signatures = appendMissingSignatures(existing.Signatures, ua.Signatures)
+	}
+
+	for _, subkey := range other.Subkeys {
+		merged := false
+		for i := range e.Subkeys {
+			existing := &e.Subkeys[i]
+			if !bytes.Equal(existing.PublicKey.Fingerprint, subkey.PublicKey.Fingerprint) {
+				continue
+			}
+			if existing.PrivateKey == nil {
+				existing.PrivateKey = subkey.PrivateKey
+			}
+			if subkey.Sig != nil && (existing.Sig == nil ||
+				subkey.Sig.CreationTime.After(existing.Sig.CreationTime)) {
+				existing.Sig = subkey.Sig
+			}
+			existing.Revocations = appendMissingSignatures(existing.Revocations, subkey.Revocations)
+			merged = true
+			break
+		}
+		if !merged {
+			e.Subkeys = append(e.Subkeys, subkey)
+		}
+	}
+}
+
+// appendMissingSignatures appends to sigs the signatures of others that it
+// does not contain.
+func appendMissingSignatures(sigs, others []*packet.Signature) []*packet.Signature {
+	for _, sig := range others {
+		if !containsSignature(sigs, sig) {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
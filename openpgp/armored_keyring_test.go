@@ -0,0 +1,128 @@
+package openpgp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func armorEntity(t *testing.T, buf *bytes.Buffer, e *Entity, private bool) {
+	blockType := PublicKeyType
+	if private {
+		blockType = PrivateKeyType
+	}
+	w, err := armor.Encode(buf, blockType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if private {
+		err = e.SerializePrivate(w, nil)
+	} else {
+		err = e.Serialize(w)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	buf.WriteString("\n")
+}
+
+func TestReadArmoredKeyRingBlocks(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	alice, err := NewEntity("Alice", "", "alice@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := NewEntity("Bob", "", "bob@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = bob.AddUserId("Robert", "", "bob@example.com", config); err != nil {
+		t.Fatal(err)
+	}
+
+	// Bob's second identity is only in its second export.
+	bobPublic := *bob
+	bobPublic.Identities = map[string]*Identity{"Bob <bob@example.com>": bob.Identities["Bob <bob@example.com>"]}
+
+	var buf bytes.Buffer
+	armorEntity(t, &buf, alice, false)
+	armorEntity(t, &buf, &bobPublic, false)
+	w, err := armor.Encode(&buf, SignatureType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte{0x01})
+	w.Close()
+	buf.WriteString("\n")
+	armorEntity(t, &buf, alice, true)
+	armorEntity(t, &buf, bob, false)
+
+	el, blockErrors, err := ReadArmoredKeyRingBlocks(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blockErrors) != 1 || blockErrors[0].Index != 2 {
+		t.Errorf("unexpected block errors: %v", blockErrors)
+	}
+	if len(el) != 2 {
+		t.Fatalf("expected 2 entities, got %d", len(el))
+	}
+	if el[0].PrimaryKey.KeyId != alice.PrimaryKey.KeyId || el[0].PrivateKey == nil || el[0].Subkeys[0].PrivateKey == nil {
+		t.Error("private key of the merged entity not found")
+	}
+	if el[1].PrimaryKey.KeyId != bob.PrimaryKey.KeyId || len(el[1].Identities) != 2 {
+		t.Error("identities of the merged entity not found")
+	}
+	if len(el[1].Subkeys) != 1 || len(el[1].Identities["Bob <bob@example.com>"].Signatures) != 1 {
+		t.Error("duplicate subkeys or signatures in the merged entity")
+	}
+
+	el, err = ReadArmoredKeyRing(bytes.NewReader(buf.Bytes()))
+	if err != nil || len(el) != 2 {
+		t.Errorf("ReadArmoredKeyRing: got %d entities, err %v", len(el), err)
+	}
+	if _, err = ReadArmoredKeyRing(bytes.NewReader([]byte("no armor"))); err == nil {
+		t.Error("expected an error without armored data")
+	}
+}
+
+func TestReadArmoredKeyRingBlocksSubkeyExpiry(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := NewEntity("Alice", "", "alice@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var older bytes.Buffer
+	armorEntity(t, &older, entity, false)
+	later := &packet.Config{Time: func() time.Time { return time.Now().Add(time.Hour) }}
+	if err = entity.UpdateSubkeyExpiry(&entity.Subkeys[0], 24*time.Hour, later); err != nil {
+		t.Fatal(err)
+	}
+	var newer bytes.Buffer
+	armorEntity(t, &newer, entity, false)
+
+	// The newer binding signature is kept in either order.
+	for _, blocks := range [][]*bytes.Buffer{{&older, &newer}, {&newer, &older}} {
+		var buf bytes.Buffer
+		for _, block := range blocks {
+			buf.Write(block.Bytes())
+		}
+		el, blockErrors, err := ReadArmoredKeyRingBlocks(&buf)
+		if err != nil || len(blockErrors) != 0 {
+			t.Fatalf("error reading blocks: %v, %v", err, blockErrors)
+		}
+		if len(el) != 1 || len(el[0].Subkeys) != 1 {
+			t.Fatal("expected a single entity with a single subkey")
+		}
+		sig := el[0].Subkeys[0].Sig
+		if sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs != 24*60*60 {
+			t.Error("expected the newer subkey binding signature")
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package openpgp
+
+import (
+	"crypto/rand"
+	"io"
+	"math/big"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// batchPrimesPerEntity is the number of prepopulated RSA primes leased to
+// each entity of a batch: enough for an RSA primary key and an RSA subkey,
+// the layout of NewEntity. Unused primes are returned to the pool.
+const batchPrimesPerEntity = 4
+
+// BatchOptions configures GenerateEntities.
+type BatchOptions struct {
+	// Workers is the number of entities generated concurrently. If zero,
+	// runtime.NumCPU() is used.
+	Workers int
+	// EntityOptions, if set, returns the options of the entity at the given
+	// index, such as its user ID, in addition to the options shared by all
+	// entities of the batch.
+	EntityOptions func(index int) []EntityOption
+	// Progress, if set, is called with the result of each entity as soon as
+	// it is generated, in completion order. Calls are serialized.
+	Progress func(BatchResult)
+}
+
+// A BatchResult is the outcome of generating one entity of a batch.
+type BatchResult struct {
+	// Index is the position of the entity in the batch.
+	Index int
+	// Entity is the generated entity, or nil if Err is set.
+	Entity *Entity
+	Err    error
+	// Duration is the time spent generating the entity, not including the
+	// time it waited for a worker.
+	Duration time.Duration
+}
+
+// GenerateEntities generates count entities with NewEntityWithOptions, using
+// a pool of workers, for test farms and provisioning systems that create many
+// keys at once. The options are applied to every entity, followed by those of
+// batch.EntityOptions, if any; batch may be nil.
+//
+// The RSA primes prepopulated in config.RSAPrimes, see GenerateRSAPrimes, are
+// shared by the workers and consumed as by NewEntity. If config.Rand is set,
+// the workers read from it in turn, so it does not need to be safe for
+// concurrent use; the order in which entities draw from it is unspecified.
+//
+// The results are ordered by index. The returned error is the error of the
+// first entity that could not be generated, if any; the other entities are
+// still generated.
+func GenerateEntities(count int, config *packet.Config, batch *BatchOptions, options ...EntityOption) ([]BatchResult, error) {
+	if count < 0 {
+		return nil, errors.InvalidArgumentError("negative entity count")
+	}
+	if batch == nil {
+		batch = new(BatchOptions)
+	}
+	workers := batch.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > count {
+		workers = count
+	}
+
+	// The workers copy a template of config, while the prepopulated primes
+	// are kept in a pool and stored back in config once all are done.
+	template := copyConfig(config)
+	if template.Rand != nil && template.Rand != rand.Reader {
+		template.Rand = &lockedReader{r: template.Rand}
+	}
+	pool := &rsaPrimePool{primes: template.RSAPrimes}
+	template.RSAPrimes = nil
+
+	results := make([]BatchResult, count)
+	jobs := make(chan int)
+	var progressMu sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				entityConfig := copyConfig(template)
+				entityConfig.RSAPrimes = pool.lease(batchPrimesPerEntity)
+				entityOptions := options
+				if batch.EntityOptions != nil {
+					entityOptions = append(append([]EntityOption(nil), options...), batch.EntityOptions(i)...)
+				}
+
+				start := time.Now()
+				e, err := NewEntityWithOptions(entityConfig, entityOptions...)
+				results[i] = BatchResult{Index: i, Entity: e, Err: err, Duration: time.Since(start)}
+				pool.release(entityConfig.RSAPrimes)
+
+				if batch.Progress != nil {
+					progressMu.Lock()
+					batch.Progress(results[i])
+					progressMu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if config != nil {
+		config.RSAPrimes = pool.primes
+	}
+
+	for _, result := range results {
+		if result.Err != nil {
+			return results, result.Err
+		}
+	}
+	return results, nil
+}
+
+// GenerateRSAPrimes generates count primes for RSA keys of the given size,
+// using up to workers goroutines, or runtime.NumCPU() if workers is zero. The
+// primes can be stored in Config.RSAPrimes ahead of time, e.g. while a
+// provisioning system is idle, and each pair of primes is used by one key.
+// The randomness is taken from config.
+func GenerateRSAPrimes(count, bits, workers int, config *packet.Config) ([]*big.Int, error) {
+	if count < 0 {
+		return nil, errors.InvalidArgumentError("negative prime count")
+	}
+	if bits < 1024 {
+		return nil, errors.InvalidArgumentError("bits must be >= 1024")
+	}
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > count {
+		workers = count
+	}
+	random := config.Random()
+	if random != rand.Reader {
+		random = &lockedReader{r: random}
+	}
+
+	primes := make([]*big.Int, count)
+	errs := make([]error, count)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				primes[i], errs[i] = rand.Prime(random, bits/2)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return primes, nil
+}
+
+// rsaPrimePool shares prepopulated RSA primes between the workers of a
+// batch.
+type rsaPrimePool struct {
+	mu     sync.Mutex
+	primes []*big.Int
+}
+
+// lease removes up to n primes from the pool.
+func (p *rsaPrimePool) lease(n int) []*big.Int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n > len(p.primes) {
+		n = len(p.primes)
+	}
+	if n == 0 {
+		return nil
+	}
+	primes := p.primes[:n:n]
+	p.primes = p.primes[n:]
+	return primes
+}
+
+// release returns the unused primes of a lease to the pool.
+func (p *rsaPrimePool) release(primes []*big.Int) {
+	if len(primes) == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.primes = append(append([]*big.Int(nil), primes...), p.primes...)
+}
+
+// lockedReader serializes reads from a reader that may not be safe for
+// concurrent use.
+type lockedReader struct {
+	mu sync.Mutex
+	r  io.Reader
+}
+
+func (l *lockedReader) Read(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Read(p)
+}
@@ -5,6 +5,7 @@
 package openpgp
 
 import (
+	"bufio"
 	"hash"
 	"io"
 )
@@ -30,8 +31,12 @@ func writeCanonical(cw io.Writer, buf []byte, s *int) (int, error) {
 			if c == '\r' {
 				*s = 1
 			} else if c == '\n' {
-				cw.Write(buf[start:i])
-				cw.Write(newline)
+				if _, err := cw.Write(buf[start:i]); err != nil {
+					return start, err
+				}
+				if _, err := cw.Write(newline); err != nil {
+					return i, err
+				}
 				start = i + 1
 			}
 		case 1:
@@ -39,10 +44,62 @@ func writeCanonical(cw io.Writer, buf []byte, s *int) (int, error) {
 		}
 	}
 
-	cw.Write(buf[start:])
+	if _, err := cw.Write(buf[start:]); err != nil {
+		return start, err
+	}
 	return len(buf), nil
 }
 
+// canonicalTextWriter converts the line endings of the text written to it
+// to CRLF, the canonical form.
+type canonicalTextWriter struct {
+	w io.WriteCloser
+	s int
+}
+
+func (ctw *canonicalTextWriter) Write(buf []byte) (int, error) {
+	return writeCanonical(ctw.w, buf, &ctw.s)
+}
+
+func (ctw *canonicalTextWriter) Close() error {
+	return ctw.w.Close()
+}
+
+// lfTextReader converts the CRLF line endings of the text read from it to
+// LF.
+type lfTextReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func newLFTextReader(r io.Reader) *lfTextReader {
+	return &lfTextReader{r: bufio.NewReader(r)}
+}
+
+func (ltr *lfTextReader) Read(buf []byte) (n int, err error) {
+	for n < len(buf) && ltr.err == nil {
+		var c byte
+		if c, ltr.err = ltr.r.ReadByte(); ltr.err != nil {
+			break
+		}
+		if c == '\r' {
+			if next, err := ltr.r.Peek(1); err == nil && next[0] == '\n' {
+				continue
+			}
+		}
+		buf[n] = c
+		n++
+		if ltr.r.Buffered() == 0 {
+			// Do not block if some text is available.
+			break
+		}
+	}
+	if n > 0 {
+		return n, nil
+	}
+	return 0, ltr.err
+}
+
 func (cth *canonicalTextHash) Write(buf []byte) (int, error) {
 	return writeCanonical(cth.h, buf, &cth.s)
 }
@@ -6,7 +6,10 @@ package openpgp
 
 import (
 	"bytes"
+	"io/ioutil"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 type recordingHash struct {
@@ -50,3 +53,21 @@ func TestCanonicalText(t *testing.T) {
 	testCanonicalText(t, "foo\r\nbar", "foo\r\nbar")
 	testCanonicalText(t, "foo\r\nbar\n\n", "foo\r\nbar\r\n\r\n")
 }
+
+func TestLFTextReader(t *testing.T) {
+	for input, expected := range map[string]string{
+		"foo\r\n":            "foo\n",
+		"foo\r\nbar\r\n\r\n": "foo\nbar\n\n",
+		"foo\rbar\n":         "foo\rbar\n",
+		"foo\r":              "foo\r",
+		"\r\r\n":             "\r\n",
+	} {
+		result, err := ioutil.ReadAll(newLFTextReader(iotest.OneByteReader(strings.NewReader(input))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected != string(result) {
+			t.Errorf("input: %x got: %x want: %x", input, result, expected)
+		}
+	}
+}
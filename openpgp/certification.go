@@ -0,0 +1,193 @@
+package openpgp
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// VerifyCertification checks that sig is a valid certification, or
+// certification revocation, made by certifier, of the binding between the
+// user ID id and the primary key target. It returns a StructuralError if sig
+// is not a certification, ErrUnknownIssuer if sig was not issued by
+// certifier, a SignatureError if the signature is invalid or was made by a
+// subkey, unless config allows subkey certifications, and
+// ErrSignatureExpired if it is expired or created in the future.
+// If config is nil, sensible defaults will be used.
+func VerifyCertification(certifier, target *packet.PublicKey, id string, sig *packet.Signature, config *packet.Config) error {
+	switch sig.SigType {
+	case packet.SigTypeGenericCert, packet.SigTypePersonaCert, packet.SigTypeCasualCert,
+		packet.SigTypePositiveCert, packet.SigTypeCertificationRevocation:
+	default:
+		return errors.StructuralError("signature is not a certification")
+	}
+	if !sig.CheckKeyIdOrFingerprint(certifier) {
+		return errors.ErrUnknownIssuer
+	}
+	if certifier.IsSubkey && !config.SubkeyCertificationsAllowed() {
+		return errors.SignatureError("certification made by a subkey")
+	}
+	if err := certifier.VerifyUserIdSignature(id, target, sig); err != nil {
+		if _, ok := err.(errors.SignatureError); ok {
+			return err
+		}
+		return errors.SignatureError(err.Error())
+	}
+	if sig.SigExpired(config.Now()) {
+		return errors.ErrSignatureExpired
+	}
+	return nil
+}
+
+// A CertificationResult is the outcome of the verification of a third-party
+// certification of an identity.
+type CertificationResult struct {
+	// Identity is the certified identity.
+	Identity *Identity
+	// Signature is the certification signature.
+	Signature *packet.Signature
+	// Certifier is the key that made the certification, if it was found.
+	Certifier *Key
+	// Err is nil if the certification is valid, and the reason why it is
+	// not otherwise, as returned by VerifyCertification.
+	Err error
+}
+
+// VerifyCertifications verifies all the third-party certifications of the
+// identities of e, with the certifier keys found in keyring. A result is
+// returned for each certification, ordered by identity name; certifications
+// whose issuer is not in keyring are reported with ErrUnknownIssuer.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) VerifyCertifications(keyring KeyRing, config *packet.Config) []CertificationResult {
+	names := make([]string, 0, len(e.Identities))
+	for name := range e.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var results []CertificationResult
+	for _, name := range names {
+		ident := e.Identities[name]
+		for _, sig := range ident.Signatures {
+			if sig.CheckKeyIdOrFingerprint(e.PrimaryKey) {
+				continue
+			}
+			result := CertificationResult{Identity: ident, Signature: sig, Err: errors.ErrUnknownIssuer}
+			if sig.IssuerKeyId != nil {
+				for _, key := range keyring.KeysByIdUsage(*sig.IssuerKeyId, packet.KeyFlagCertify) {
+					key := key
+					result.Certifier = &key
+					result.Err = VerifyCertification(key.PublicKey, e.PrimaryKey, ident.Name, sig, config)
+					if result.Err == nil {
+						break
+					}
+				}
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// TrustIdentity makes a trust signature, from e, on the identity of target,
+// stating that target is a trusted introducer: its certifications are trusted
+// as much as the certifications of e, up to the given level, and to the given
+// amount. A level of 1 trusts the certifications made by target, and a level
+// of 2 also trusts the introducers designated by target, and so on. An amount
+// of 120 denotes complete trust, and 60 partial trust. If scope is not empty,
+// it is a regular expression that limits the trust to the user IDs matching
+// it, such as "<[^>]+[@.]example\\.com>$" for the addresses of a domain. The
+// signature is attached to the identity of target and returned.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) TrustIdentity(target *Entity, identity string, level packet.TrustLevel, amount packet.TrustAmount, scope string, config *packet.Config) (*packet.Signature, error) {
+	if level == 0 {
+		return nil, errors.InvalidArgumentError("trust level must be at least 1")
+	}
+	if scope != "" {
+		if _, err := regexp.Compile(scope); err != nil {
+			return nil, errors.InvalidArgumentError("invalid trust regular expression: " + err.Error())
+		}
+	}
+	return e.certifyIdentity(target, identity, packet.SigTypeGenericCert, func(sig *packet.Signature) {
+		sig.TrustLevel = level
+		sig.TrustAmount = amount
+		if scope != "" {
+			sig.TrustRegularExpression = &scope
+		}
+	}, config)
+}
+
+// CheckTrustScope checks that the trust signature sig extends the trust to a
+// certification of the user ID userId, made depth introducers away from the
+// key that made sig: 1 for a certification made by the introducer certified
+// by sig, 2 for a certification made by an introducer designated by the
+// latter, and so on. It returns an InvalidArgumentError if sig is not a trust
+// signature, a StructuralError if its regular expression is invalid, and a
+// SignatureError if the certification is out of its scope.
+func CheckTrustScope(sig *packet.Signature, userId string, depth int) error {
+	if sig.TrustLevel == 0 {
+		return errors.InvalidArgumentError("signature is not a trust signature")
+	}
+	if depth < 1 || depth > int(sig.TrustLevel) {
+		return errors.SignatureError("trust signature does not extend to depth " + strconv.Itoa(depth))
+	}
+	if sig.TrustRegularExpression != nil {
+		scope, err := regexp.Compile(*sig.TrustRegularExpression)
+		if err != nil {
+			return errors.StructuralError("invalid trust regular expression: " + err.Error())
+		}
+		if !scope.MatchString(userId) {
+			return errors.SignatureError("user ID out of the scope of the trust signature")
+		}
+	}
+	return nil
+}
+
+// A CertificationRequest names an identity to certify with CertifyIdentities.
+type CertificationRequest struct {
+	// Target is the entity whose identity is certified.
+	Target *Entity
+	// Identity is the name of the identity, which must be an element of
+	// Target.Identities.
+	Identity string
+}
+
+// CertifyIdentities makes a certification of type certType, from e, for
+// each of the given requests, as CertifyIdentity does, and attaches it to
+// the identity of the target. All certifications are made with the same
+// certification key and config. A result is returned for each request, in
+// order; requests that could not be certified are reported in the Err field
+// of their result, and do not stop the others. If progress is not nil, it is
+// called after each request with the number of requests processed so far and
+// the result of the last one. An error is only returned if no certification
+// can be made at all, for instance because the private key of e is not
+// decrypted.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) CertifyIdentities(requests []CertificationRequest, certType packet.SignatureType, progress func(done, total int, result CertificationResult), config *packet.Config) ([]CertificationResult, error) {
+	switch certType {
+	case packet.SigTypeGenericCert, packet.SigTypePersonaCert, packet.SigTypeCasualCert, packet.SigTypePositiveCert:
+	default:
+		return nil, errors.InvalidArgumentError("signature type is not a certification")
+	}
+	certificationKey, err := e.signingCertificationKey(config)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]CertificationResult, len(requests))
+	for i, req := range requests {
+		result := &results[i]
+		result.Certifier = &certificationKey
+		result.Signature, result.Err = e.certifyIdentityWithKey(certificationKey, req.Target, req.Identity, certType, nil, config)
+		if result.Err == nil {
+			result.Identity = req.Target.Identities[req.Identity]
+		}
+		if progress != nil {
+			progress(i+1, len(requests), *result)
+		}
+	}
+	return results, nil
+}
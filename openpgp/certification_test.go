@@ -0,0 +1,267 @@
+package openpgp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestVerifyCertification(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	target, err := NewEntity("Golang Gopher", "Target", "target@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certifier, err := NewEntity("Golang Gopher", "Certifier", "certifier@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewEntity("Golang Gopher", "Other", "other@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const id = "Golang Gopher (Target) <target@golang.com>"
+	if err = target.SignIdentity(id, certifier, nil); err != nil {
+		t.Fatal(err)
+	}
+	ident := target.Identities[id]
+	sig := ident.Signatures[len(ident.Signatures)-1]
+
+	if err = VerifyCertification(certifier.PrimaryKey, target.PrimaryKey, id, sig, nil); err != nil {
+		t.Errorf("valid certification: %s", err)
+	}
+	if err = VerifyCertification(other.PrimaryKey, target.PrimaryKey, id, sig, nil); err != errors.ErrUnknownIssuer {
+		t.Errorf("other certifier: got %v, want ErrUnknownIssuer", err)
+	}
+	if _, ok := VerifyCertification(certifier.PrimaryKey, target.PrimaryKey, "someone else", sig, nil).(errors.SignatureError); !ok {
+		t.Error("other user ID: expected a SignatureError")
+	}
+	if _, ok := VerifyCertification(certifier.PrimaryKey, other.PrimaryKey, id, sig, nil).(errors.SignatureError); !ok {
+		t.Error("other target: expected a SignatureError")
+	}
+	if err = VerifyCertification(certifier.PrimaryKey, target.PrimaryKey, id, sig, &packet.Config{Time: func() time.Time { return sig.CreationTime.Add(-time.Hour) }}); err != errors.ErrSignatureExpired {
+		t.Errorf("future certification: got %v, want ErrSignatureExpired", err)
+	}
+	if _, ok := VerifyCertification(target.PrimaryKey, target.PrimaryKey, id, target.Subkeys[0].Sig, nil).(errors.StructuralError); !ok {
+		t.Error("subkey binding: expected a StructuralError")
+	}
+
+	results := target.VerifyCertifications(EntityList{certifier}, nil)
+	if len(results) != 1 || results[0].Signature != sig || results[0].Identity != ident ||
+		results[0].Certifier == nil || results[0].Certifier.Entity != certifier || results[0].Err != nil {
+		t.Errorf("unexpected results with the certifier: %+v", results)
+	}
+	results = target.VerifyCertifications(EntityList{other}, nil)
+	if len(results) != 1 || results[0].Certifier != nil || results[0].Err != errors.ErrUnknownIssuer {
+		t.Errorf("unexpected results without the certifier: %+v", results)
+	}
+}
+
+func TestSubkeyCertification(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	target, err := NewEntity("Golang Gopher", "Target", "target@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certifier, err := NewEntity("Golang Gopher", "Certifier", "certifier@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = certifier.generateSubkey(config, config.Now(), 0, packet.KeyFlagCertify); err != nil {
+		t.Fatal(err)
+	}
+	certifier.PrimaryIdentity().SelfSignature.FlagCertify = false
+	subkey := certifier.Subkeys[len(certifier.Subkeys)-1]
+	const id = "Golang Gopher (Target) <target@golang.com>"
+
+	if _, ok := certifier.CertificationKey(config.Now()); ok {
+		t.Error("CertificationKey returned a subkey")
+	}
+	if err = target.SignIdentity(id, certifier, nil); err == nil {
+		t.Fatal("certified with a subkey by default")
+	}
+
+	lenient := &packet.Config{AllowSubkeyCertifications: true}
+	if err = target.SignIdentity(id, certifier, lenient); err != nil {
+		t.Fatal(err)
+	}
+	ident := target.Identities[id]
+	sig := ident.Signatures[len(ident.Signatures)-1]
+	if *sig.IssuerKeyId != subkey.PublicKey.KeyId {
+		t.Fatal("certification not made by the subkey")
+	}
+
+	if _, ok := VerifyCertification(subkey.PublicKey, target.PrimaryKey, id, sig, nil).(errors.SignatureError); !ok {
+		t.Error("strict verification: expected a SignatureError")
+	}
+	if err = VerifyCertification(subkey.PublicKey, target.PrimaryKey, id, sig, lenient); err != nil {
+		t.Errorf("lenient verification: %s", err)
+	}
+	results := target.VerifyCertifications(EntityList{certifier}, nil)
+	if len(results) != 1 || results[0].Err == nil {
+		t.Errorf("unexpected strict results: %+v", results)
+	}
+	results = target.VerifyCertifications(EntityList{certifier}, lenient)
+	if len(results) != 1 || results[0].Err != nil {
+		t.Errorf("unexpected lenient results: %+v", results)
+	}
+}
+
+func TestCertifyIdentity(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	target, err := NewEntity("Golang Gopher", "Target", "target@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certifier, err := NewEntity("Golang Gopher", "Certifier", "certifier@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const id = "Golang Gopher (Target) <target@golang.com>"
+
+	for _, certType := range []packet.SignatureType{packet.SigTypeGenericCert, packet.SigTypePersonaCert, packet.SigTypeCasualCert, packet.SigTypePositiveCert} {
+		sig, err := certifier.CertifyIdentity(target, id, certType, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sig.SigType != certType {
+			t.Errorf("got signature type %x, want %x", sig.SigType, certType)
+		}
+	}
+	if _, err = certifier.CertifyIdentity(target, id, packet.SigTypeBinary, nil); err == nil {
+		t.Error("expected an error for a non-certification signature type")
+	}
+	if _, err = certifier.CertifyIdentity(target, "unknown", packet.SigTypeGenericCert, nil); err == nil {
+		t.Error("expected an error for an unknown identity")
+	}
+
+	// The certifications are kept when the target is serialized and read.
+	var buf bytes.Buffer
+	if err = target.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEntity(packet.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := read.VerifyCertifications(EntityList{certifier}, nil)
+	if len(results) != 4 {
+		t.Fatalf("expected 4 certifications, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.Err != nil || result.Certifier == nil || result.Certifier.Entity != certifier {
+			t.Errorf("#%d: unexpected result %+v", i, result)
+		}
+	}
+}
+
+func TestTrustSignature(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	ca, err := NewEntity("Example CA", "", "ca@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin, err := NewEntity("Example Admin", "", "admin@example.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const adminId = "Example Admin <admin@example.com>"
+	const scope = `<[^>]+[@.]example\.com>$`
+
+	sig, err := ca.TrustIdentity(admin, adminId, 1, 120, scope, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = VerifyCertification(ca.PrimaryKey, admin.PrimaryKey, adminId, sig, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The trust subpackets survive serialization.
+	var buf bytes.Buffer
+	if err = admin.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEntity(packet.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signatures := read.Identities[adminId].Signatures
+	sig = signatures[len(signatures)-1]
+	if sig.TrustLevel != 1 || sig.TrustAmount != 120 || sig.TrustRegularExpression == nil || *sig.TrustRegularExpression != scope {
+		t.Fatalf("unexpected trust signature: level %d, amount %d", sig.TrustLevel, sig.TrustAmount)
+	}
+
+	if err = CheckTrustScope(sig, "Bob <bob@example.com>", 1); err != nil {
+		t.Errorf("user ID in scope: %s", err)
+	}
+	if _, ok := CheckTrustScope(sig, "Carol <carol@example.org>", 1).(errors.SignatureError); !ok {
+		t.Error("user ID out of scope: expected a SignatureError")
+	}
+	if _, ok := CheckTrustScope(sig, "Bob <bob@example.com>", 2).(errors.SignatureError); !ok {
+		t.Error("depth beyond the trust level: expected a SignatureError")
+	}
+	if _, ok := CheckTrustScope(read.Identities[adminId].SelfSignature, "Bob <bob@example.com>", 1).(errors.InvalidArgumentError); !ok {
+		t.Error("signature without trust: expected an InvalidArgumentError")
+	}
+
+	if _, err = ca.TrustIdentity(admin, adminId, 0, 120, "", nil); err == nil {
+		t.Error("expected an error for a zero trust level")
+	}
+	if _, err = ca.TrustIdentity(admin, adminId, 1, 120, "(", nil); err == nil {
+		t.Error("expected an error for an invalid regular expression")
+	}
+}
+
+func TestCertifyIdentities(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	certifier, err := NewEntity("Golang Gopher", "Certifier", "certifier@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests []CertificationRequest
+	for _, name := range []string{"Alice", "Bob"} {
+		target, err := NewEntity(name, "", name+"@golang.com", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		requests = append(requests, CertificationRequest{Target: target, Identity: name + " <" + name + "@golang.com>"})
+	}
+	requests = append(requests, CertificationRequest{Target: requests[0].Target, Identity: "unknown"})
+
+	var calls int
+	progress := func(done, total int, result CertificationResult) {
+		calls++
+		if done != calls || total != len(requests) {
+			t.Errorf("unexpected progress %d/%d", done, total)
+		}
+	}
+	results, err := certifier.CertifyIdentities(requests, packet.SigTypeCasualCert, progress, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != len(requests) || len(results) != len(requests) {
+		t.Fatalf("got %d progress calls and %d results, want %d", calls, len(results), len(requests))
+	}
+	for i, result := range results[:2] {
+		if result.Err != nil {
+			t.Fatalf("#%d: %s", i, result.Err)
+		}
+		err = VerifyCertification(result.Certifier.PublicKey, requests[i].Target.PrimaryKey, requests[i].Identity, result.Signature, nil)
+		if err != nil {
+			t.Errorf("#%d: %s", i, err)
+		}
+		if sigs := result.Identity.Signatures; sigs[len(sigs)-1] != result.Signature {
+			t.Errorf("#%d: certification not attached to the identity", i)
+		}
+	}
+	if results[2].Err == nil || results[2].Signature != nil {
+		t.Error("expected an error for an unknown identity")
+	}
+
+	if _, err = certifier.CertifyIdentities(requests, packet.SigTypeBinary, nil, nil); err == nil {
+		t.Error("expected an error for a non-certification signature type")
+	}
+}
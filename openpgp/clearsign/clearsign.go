@@ -23,6 +23,7 @@ import (
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/ProtonMail/go-crypto/openpgp/armor"
 	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/algorithm"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
 )
 
@@ -340,12 +341,23 @@ func Encode(w io.Writer, privateKey *packet.PrivateKey, config *packet.Config) (
 // are used.
 func EncodeMulti(w io.Writer, privateKeys []*packet.PrivateKey, config *packet.Config) (plaintext io.WriteCloser, err error) {
 	for _, k := range privateKeys {
+		if k.Dummy() {
+			return nil, errors.ErrDummyPrivateKey(fmt.Sprintf("signing key %s is a dummy key", k.KeyIdString()))
+		}
 		if k.Encrypted {
 			return nil, errors.InvalidArgumentError(fmt.Sprintf("signing key %s is encrypted", k.KeyIdString()))
 		}
 	}
 
+	// All the signatures share the hash function, which is the strongest
+	// of the ones selected for the keys.
 	hashType := config.Hash()
+	for i, k := range privateKeys {
+		h := config.HashForSigner(&k.PublicKey)
+		if i == 0 || (h.Available() && (!hashType.Available() || h.Size() > hashType.Size())) {
+			hashType = h
+		}
+	}
 	name := nameOfHash(hashType)
 	if len(name) == 0 {
 		return nil, errors.UnsupportedError("unknown hash type: " + strconv.Itoa(int(hashType)))
@@ -357,7 +369,7 @@ func EncodeMulti(w io.Writer, privateKeys []*packet.PrivateKey, config *packet.C
 	var hashers []hash.Hash
 	var ws []io.Writer
 	for range privateKeys {
-		h := hashType.New()
+		h := algorithm.NewHash(hashType)
 		hashers = append(hashers, h)
 		ws = append(ws, h)
 	}
@@ -405,6 +417,16 @@ func EncodeMulti(w io.Writer, privateKeys []*packet.PrivateKey, config *packet.C
 // VerifySignature checks a clearsigned message signature, and checks that the
 // hash algorithm in the header matches the hash algorithm in the signature.
 func (b *Block) VerifySignature(keyring openpgp.KeyRing, config *packet.Config) (signer *openpgp.Entity, err error) {
+	expectedHashes, err := b.expectedHashes()
+	if err != nil {
+		return nil, err
+	}
+	return openpgp.CheckDetachedSignatureAndHash(keyring, bytes.NewBuffer(b.Bytes), b.ArmoredSignature.Body, expectedHashes, config)
+}
+
+// expectedHashes returns the hash algorithms announced in the Hash headers of
+// the message.
+func (b *Block) expectedHashes() ([]crypto.Hash, error) {
 	var expectedHashes []crypto.Hash
 	for _, v := range b.Headers {
 		for _, name := range v {
@@ -418,7 +440,7 @@ func (b *Block) VerifySignature(keyring openpgp.KeyRing, config *packet.Config)
 	if len(expectedHashes) == 0 {
 		expectedHashes = append(expectedHashes, crypto.MD5)
 	}
-	return openpgp.CheckDetachedSignatureAndHash(keyring, bytes.NewBuffer(b.Bytes), b.ArmoredSignature.Body, expectedHashes, config)
+	return expectedHashes, nil
 }
 
 // nameOfHash returns the OpenPGP name for the given hash, or the empty string
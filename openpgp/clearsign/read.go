@@ -0,0 +1,112 @@
+package clearsign
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// messageType is the armor type of an OpenPGP message.
+const messageType = "PGP MESSAGE"
+
+// ReadAnyMessage parses an OpenPGP message that may be cleartext-signed,
+// armored or binary, and returns the same details as openpgp.ReadMessage.
+//
+// Binary and armored messages are passed to openpgp.ReadMessage. For a
+// cleartext-signed message, the signature is checked against keyring
+// before returning, and UnverifiedBody returns the signed text. As with
+// openpgp.ReadMessage, the signature is only verified if SignedBy is
+// non-nil, in which case the result is in SignatureError.
+// If config is nil, sensible defaults will be used.
+func ReadAnyMessage(r io.Reader, keyring openpgp.KeyRing, prompt openpgp.PromptFunction, config *packet.Config) (*openpgp.MessageDetails, error) {
+	buffered := bufio.NewReader(r)
+	first, err := buffered.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	// The first byte of a binary OpenPGP packet has the high bit set.
+	if first[0]&0x80 != 0 {
+		return openpgp.ReadMessage(buffered, keyring, prompt, config)
+	}
+
+	data, err := ioutil.ReadAll(buffered)
+	if err != nil {
+		return nil, err
+	}
+	if b, _ := Decode(data); b != nil {
+		return readCleartextMessage(b, keyring, config)
+	}
+
+	block, err := armor.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != messageType {
+		return nil, errors.InvalidArgumentError("expected '" + messageType + "', got: " + block.Type)
+	}
+	return openpgp.ReadMessage(block.Body, keyring, prompt, config)
+}
+
+// readCleartextMessage verifies the cleartext-signed message b and returns its
+// details.
+func readCleartextMessage(b *Block, keyring openpgp.KeyRing, config *packet.Config) (*openpgp.MessageDetails, error) {
+	signature, err := ioutil.ReadAll(b.ArmoredSignature.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	md := &openpgp.MessageDetails{
+		IsSigned:       true,
+		LiteralData:    &packet.LiteralData{IsBinary: false},
+		UnverifiedBody: bytes.NewReader(b.Plaintext),
+	}
+
+	// Find the first signature, to report its issuer even if it is not in
+	// the keyring.
+	packets := packet.NewReaderWithConfig(bytes.NewReader(signature), config)
+	for md.Signature == nil {
+		p, err := packets.Next()
+		if err == io.EOF {
+			return nil, errors.StructuralError("cleartext message without signature")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if sig, ok := p.(*packet.Signature); ok {
+			md.Signature = sig
+		}
+	}
+	if md.Signature.IssuerKeyId != nil {
+		md.SignedByKeyId = *md.Signature.IssuerKeyId
+	}
+
+	expectedHashes, err := b.expectedHashes()
+	if err != nil {
+		return nil, err
+	}
+	sig, signer, err := openpgp.VerifyDetachedSignatureAndHash(keyring, bytes.NewReader(b.Bytes), bytes.NewReader(signature), expectedHashes, config)
+	if sig != nil {
+		md.Signature = sig
+		if sig.IssuerKeyId != nil {
+			md.SignedByKeyId = *sig.IssuerKeyId
+		}
+	}
+	if err == errors.ErrUnknownIssuer {
+		return md, nil
+	}
+	for _, key := range keyring.KeysByIdUsage(md.SignedByKeyId, packet.KeyFlagSign) {
+		if signer == nil || key.Entity == signer {
+			key := key
+			md.SignedBy = &key
+			break
+		}
+	}
+	md.SignatureError = err
+	return md, nil
+}
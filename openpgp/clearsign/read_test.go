@@ -0,0 +1,89 @@
+package clearsign
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+func TestReadAnyMessage(t *testing.T) {
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(signingKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const text = "Hello, world!\n"
+
+	var cleartext bytes.Buffer
+	plaintext, err := Encode(&cleartext, keyring[0].PrivateKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext.Write([]byte(text))
+	if err = plaintext.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var binary bytes.Buffer
+	w, err := openpgp.Sign(&binary, keyring[0], nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(text))
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var armored bytes.Buffer
+	aw, err := armor.Encode(&armored, messageType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aw.Write(binary.Bytes())
+	if err = aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, input := range map[string][]byte{
+		"cleartext": cleartext.Bytes(),
+		"binary":    binary.Bytes(),
+		"armored":   armored.Bytes(),
+	} {
+		md, err := ReadAnyMessage(bytes.NewReader(input), keyring, nil, nil)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		body, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if string(body) != text {
+			t.Errorf("%s: wrong body: %q", name, body)
+		}
+		if !md.IsSigned || md.SignedBy == nil || md.SignedByKeyId != keyring[0].PrimaryKey.KeyId {
+			t.Errorf("%s: signer not found", name)
+		}
+		if md.SignatureError != nil {
+			t.Errorf("%s: signature error: %s", name, md.SignatureError)
+		}
+	}
+
+	tampered := bytes.Replace(cleartext.Bytes(), []byte("Hello"), []byte("Howdy"), 1)
+	md, err := ReadAnyMessage(bytes.NewReader(tampered), keyring, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.SignatureError == nil {
+		t.Error("expected a signature error for a tampered message")
+	}
+
+	md, err = ReadAnyMessage(bytes.NewReader(cleartext.Bytes()), openpgp.EntityList{}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.SignedBy != nil || md.SignedByKeyId != keyring[0].PrimaryKey.KeyId {
+		t.Error("expected an unknown signer")
+	}
+}
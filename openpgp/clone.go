@@ -0,0 +1,126 @@
+package openpgp
+
+import (
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Clone returns a deep copy of e, including its private key material and
+// its signatures, which can be modified, e.g. to strip secret keys or add
+// subkeys, without affecting e. Private keys held elsewhere, such as those
+// of external signers, are shared between the copies.
+func (e *Entity) Clone() *Entity {
+	c := &entityCloner{sigs: make(map[*packet.Signature]*packet.Signature)}
+	clone := &Entity{
+		Revocations:   c.signatures(e.Revocations),
+		SelfSignature: c.signature(e.SelfSignature),
+		Signatures:    c.signatures(e.Signatures),
+	}
+	clone.PrimaryKey, clone.PrivateKey = c.keys(e.PrimaryKey, e.PrivateKey)
+
+	if e.Identities != nil {
+		clone.Identities = make(map[string]*Identity, len(e.Identities))
+		for name, ident := range e.Identities {
+			identity := &Identity{
+				Name:           ident.Name,
+				SelfSignature:  c.signature(ident.SelfSignature),
+				Revocations:    c.signatures(ident.Revocations),
+				Signatures:     c.signatures(ident.Signatures),
+				UnknownPackets: cloneOpaquePackets(ident.UnknownPackets),
+			}
+			if ident.UserId != nil {
+				userId := *ident.UserId
+				identity.UserId = &userId
+			}
+			clone.Identities[name] = identity
+		}
+	}
+
+	if e.Subkeys != nil {
+		clone.Subkeys = make([]Subkey, len(e.Subkeys))
+		for i, subkey := range e.Subkeys {
+			sub := Subkey{
+				Sig:            c.signature(subkey.Sig),
+				Revocations:    c.signatures(subkey.Revocations),
+				UnknownPackets: cloneOpaquePackets(subkey.UnknownPackets),
+			}
+			sub.PublicKey, sub.PrivateKey = c.keys(subkey.PublicKey, subkey.PrivateKey)
+			clone.Subkeys[i] = sub
+		}
+	}
+
+	if e.UserAttributes != nil {
+		clone.UserAttributes = make([]*UserAttribute, len(e.UserAttributes))
+		for i, ua := range e.UserAttributes {
+			clone.UserAttributes[i] = &UserAttribute{
+				UserAttribute: ua.UserAttribute.Clone(),
+				SelfSignature: c.signature(ua.SelfSignature),
+				Revocations:   c.signatures(ua.Revocations),
+				Signatures:    c.signatures(ua.Signatures),
+			}
+		}
+	}
+
+	clone.UnknownPackets = cloneOpaquePackets(e.UnknownPackets)
+	return clone
+}
+
+// entityCloner copies the signatures of an entity once each, so that
+// signatures referenced from several places, such as a self-signature that
+// is also listed in Signatures, are still shared within the copy.
+type entityCloner struct {
+	sigs map[*packet.Signature]*packet.Signature
+}
+
+func (c *entityCloner) signature(sig *packet.Signature) *packet.Signature {
+	if sig == nil {
+		return nil
+	}
+	if clone, ok := c.sigs[sig]; ok {
+		return clone
+	}
+	clone := sig.Clone()
+	c.sigs[sig] = clone
+	return clone
+}
+
+func (c *entityCloner) signatures(sigs []*packet.Signature) []*packet.Signature {
+	if sigs == nil {
+		return nil
+	}
+	clones := make([]*packet.Signature, len(sigs))
+	for i, sig := range sigs {
+		clones[i] = c.signature(sig)
+	}
+	return clones
+}
+
+// keys copies a public key and its private key, if any. If the public key
+// is the one embedded in the private key, as for generated and parsed keys,
+// so is its copy.
+func (c *entityCloner) keys(pub *packet.PublicKey, priv *packet.PrivateKey) (*packet.PublicKey, *packet.PrivateKey) {
+	if priv == nil {
+		if pub == nil {
+			return nil, nil
+		}
+		return pub.Clone(), nil
+	}
+	privClone := priv.Clone()
+	if pub == &priv.PublicKey {
+		return &privClone.PublicKey, privClone
+	}
+	if pub == nil {
+		return nil, privClone
+	}
+	return pub.Clone(), privClone
+}
+
+func cloneOpaquePackets(packets []*packet.OpaquePacket) []*packet.OpaquePacket {
+	if packets == nil {
+		return nil
+	}
+	clones := make([]*packet.OpaquePacket, len(packets))
+	for i, p := range packets {
+		clones[i] = p.Clone()
+	}
+	return clones
+}
@@ -0,0 +1,199 @@
+package openpgp
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"mime"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+const (
+	// compressionSampleSize is the number of bytes at the start of the
+	// plaintext that the adaptive compression mode inspects.
+	compressionSampleSize = 4096
+	// minEntropySampleSize is the size of the smallest sample whose byte
+	// entropy is significant.
+	minEntropySampleSize = 1024
+	// incompressibleEntropy is the byte entropy, in bits per byte, above
+	// which a sample is considered incompressible. Text is typically below 5
+	// bits per byte, while compressed and encrypted data is close to 8.
+	incompressibleEntropy = 7.5
+)
+
+// incompressibleSignatures lists the magic numbers of common compressed file
+// formats, and their offset from the start of the file.
+var incompressibleSignatures = []struct {
+	offset int
+	magic  string
+}{
+	{0, "\xff\xd8\xff"},                   // JPEG
+	{0, "\x89PNG\r\n\x1a\n"},              // PNG
+	{0, "GIF8"},                           // GIF
+	{8, "WEBP"},                           // WebP, in a RIFF container
+	{4, "ftyp"},                           // MP4, QuickTime, HEIF and AVIF
+	{0, "\x1a\x45\xdf\xa3"},               // Matroska and WebM
+	{0, "OggS"},                           // Ogg
+	{0, "fLaC"},                           // FLAC
+	{0, "ID3"},                            // MP3
+	{0, "PK\x03\x04"},                     // ZIP, and formats based on it
+	{0, "\x1f\x8b"},                       // gzip
+	{0, "BZh"},                            // bzip2
+	{0, "\xfd7zXZ\x00"},                   // xz
+	{0, "\x28\xb5\x2f\xfd"},               // Zstandard
+	{0, "7z\xbc\xaf\x27\x1c"},             // 7z
+	{0, "Rar!\x1a\x07"},                   // RAR
+	{0, "\x00\x00\x00\x0cjP  \r\n\x87\n"}, // JPEG 2000
+	{0, "wOF2"},                           // WOFF2
+}
+
+// compressibleContentType reports whether contents of the given MIME type
+// are worth compressing, and whether the type is known at all.
+func compressibleContentType(contentType string) (compressible, known bool) {
+	if contentType == "" {
+		return false, false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false, false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true, true
+	case mediaType == "audio/wav", mediaType == "audio/x-wav", mediaType == "audio/wave",
+		mediaType == "image/bmp", mediaType == "image/svg+xml":
+		return true, true
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasSuffix(mediaType, "+zip"),
+		strings.HasPrefix(mediaType, "application/vnd.openxmlformats-officedocument."),
+		strings.HasPrefix(mediaType, "application/vnd.oasis.opendocument."):
+		return false, true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/javascript", "application/x-tar":
+		return true, true
+	case "application/zip", "application/gzip", "application/x-gzip", "application/x-bzip2",
+		"application/x-xz", "application/zstd", "application/x-7z-compressed",
+		"application/vnd.rar", "application/x-rar-compressed", "application/java-archive",
+		"application/pgp-encrypted", "application/pdf":
+		return false, true
+	}
+	return false, false
+}
+
+// compressibleSample reports whether the plaintext starting with sample is
+// worth compressing: it is not if it starts with the signature of a
+// compressed file format, or if its bytes are close to uniformly distributed.
+func compressibleSample(sample []byte) bool {
+	for _, sig := range incompressibleSignatures {
+		if len(sample) >= sig.offset+len(sig.magic) && string(sample[sig.offset:sig.offset+len(sig.magic)]) == sig.magic {
+			return false
+		}
+	}
+	if len(sample) < minEntropySampleSize {
+		return true
+	}
+	var counts [256]int
+	for _, b := range sample {
+		counts[b]++
+	}
+	var entropy float64
+	for _, count := range counts {
+		if count > 0 {
+			p := float64(count) / float64(len(sample))
+			entropy -= p * math.Log2(p)
+		}
+	}
+	return entropy < incompressibleEntropy
+}
+
+// An adaptiveCompressor is the compressed layer of a message in adaptive
+// mode. It buffers the packets written to it until the plaintext has been
+// sampled, and then writes them to payload, compressed or not.
+type adaptiveCompressor struct {
+	payload io.WriteCloser
+	algo    packet.CompressionAlgo
+	config  *packet.CompressionConfig
+	buf     bytes.Buffer
+	w       io.WriteCloser
+}
+
+func (c *adaptiveCompressor) Write(p []byte) (int, error) {
+	if c.w == nil {
+		return c.buf.Write(p)
+	}
+	return c.w.Write(p)
+}
+
+// decide sets whether the message is compressed, and writes the packets
+// buffered until then.
+func (c *adaptiveCompressor) decide(compress bool) (err error) {
+	c.w = c.payload
+	if compress {
+		if c.w, err = packet.SerializeCompressed(c.payload, c.algo, c.config); err != nil {
+			return err
+		}
+	}
+	_, err = c.buf.WriteTo(c.w)
+	return err
+}
+
+func (c *adaptiveCompressor) Close() error {
+	if c.w == nil {
+		if err := c.decide(true); err != nil {
+			return err
+		}
+	}
+	return c.w.Close()
+}
+
+// sampleCompression returns plaintext, or a writer that samples the
+// plaintext to decide whether to compress it if the compressed layer of
+// the message, data, is an adaptiveCompressor.
+func sampleCompression(plaintext, data io.WriteCloser) io.WriteCloser {
+	compressor, ok := data.(*adaptiveCompressor)
+	if !ok {
+		return plaintext
+	}
+	return &compressionSampler{plaintext: plaintext, compressor: compressor}
+}
+
+// A compressionSampler passes the plaintext through, keeping its first
+// compressionSampleSize bytes to decide whether to compress the message.
+type compressionSampler struct {
+	plaintext  io.WriteCloser
+	compressor *adaptiveCompressor
+	sample     []byte
+}
+
+func (s *compressionSampler) Write(p []byte) (int, error) {
+	if s.compressor.w == nil {
+		n := compressionSampleSize - len(s.sample)
+		if n > len(p) {
+			n = len(p)
+		}
+		s.sample = append(s.sample, p[:n]...)
+		if len(s.sample) == compressionSampleSize {
+			if err := s.compressor.decide(compressibleSample(s.sample)); err != nil {
+				return 0, err
+			}
+			s.sample = nil
+		}
+	}
+	return s.plaintext.Write(p)
+}
+
+func (s *compressionSampler) Close() error {
+	if s.compressor.w == nil {
+		if err := s.compressor.decide(compressibleSample(s.sample)); err != nil {
+			return err
+		}
+	}
+	return s.plaintext.Close()
+}
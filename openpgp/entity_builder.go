@@ -0,0 +1,145 @@
+package openpgp
+
+import (
+	"crypto"
+	"strconv"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// An EntityBuilder describes the layout of an Entity to generate, such as
+//
+//	e, err := openpgp.NewEntityBuilder().
+//		Primary(openpgp.KeySpec{Algorithm: packet.PubKeyAlgoEdDSA}).
+//		UserID("Alice", "", "alice@example.com").
+//		AddSubkey(openpgp.KeySpec{Algorithm: packet.PubKeyAlgoECDH, Flags: packet.KeyFlagEncryptCommunications}).
+//		Expiry(365 * 24 * time.Hour).
+//		Build()
+//
+// Its methods record the layout and return the builder; errors are reported
+// by Build, which generates the entity with NewEntityWithOptions. All the keys
+// of the entity have the same version.
+type EntityBuilder struct {
+	config  *packet.Config
+	options []EntityOption
+	version int
+	err     error
+}
+
+// NewEntityBuilder returns an EntityBuilder for an entity with the default
+// primary key and encryption subkey of NewEntity. At least one identity must
+// be added with UserID, unless WithoutUserID is used.
+func NewEntityBuilder() *EntityBuilder {
+	return new(EntityBuilder)
+}
+
+// Config sets the config used to generate the entity. Its settings apply
+// unless overridden by other methods of the builder.
+func (b *EntityBuilder) Config(config *packet.Config) *EntityBuilder {
+	b.config = config
+	return b
+}
+
+// Version sets the version of the keys of the entity, overriding the
+// V5Keys setting of the config. Only versions 4 and 5 are supported.
+func (b *EntityBuilder) Version(version int) *EntityBuilder {
+	if version != 4 && version != 5 {
+		b.setError(errors.UnsupportedError("key version " + strconv.Itoa(version)))
+	}
+	b.version = version
+	return b
+}
+
+// Primary sets the algorithm, the size for RSA keys and the lifetime of the
+// primary key, see WithPrimaryKeySpec.
+func (b *EntityBuilder) Primary(spec KeySpec) *EntityBuilder {
+	return b.Option(WithPrimaryKeySpec(spec))
+}
+
+// PrimarySigner uses signer as the primary key, see WithPrimarySigner.
+func (b *EntityBuilder) PrimarySigner(signer crypto.Signer) *EntityBuilder {
+	return b.Option(WithPrimarySigner(signer))
+}
+
+// UserID adds an identity, see WithUserId. The first identity is marked as
+// primary.
+func (b *EntityBuilder) UserID(name, comment, email string) *EntityBuilder {
+	return b.Option(WithUserId(name, comment, email))
+}
+
+// WithoutUserID builds an entity without identity, see WithoutUserID.
+func (b *EntityBuilder) WithoutUserID() *EntityBuilder {
+	return b.Option(WithoutUserID())
+}
+
+// DirectKeySignature stores the properties of the primary key in a
+// direct-key self-signature, see WithDirectKeySignature.
+func (b *EntityBuilder) DirectKeySignature() *EntityBuilder {
+	return b.Option(WithDirectKeySignature())
+}
+
+// AddSubkey adds a subkey described by spec, see WithSubkeySpec. If no
+// subkey is added, a single encryption subkey is generated.
+func (b *EntityBuilder) AddSubkey(spec KeySpec) *EntityBuilder {
+	if spec.Flags == 0 {
+		b.setError(errors.InvalidArgumentError("subkey without key flags"))
+	}
+	return b.Option(WithSubkeySpec(spec))
+}
+
+// WithoutEncryptionSubkey builds an entity that cannot receive encrypted
+// messages, see WithoutEncryptionSubkey.
+func (b *EntityBuilder) WithoutEncryptionSubkey() *EntityBuilder {
+	return b.Option(WithoutEncryptionSubkey())
+}
+
+// Expiry sets the lifetime of the primary key, see WithExpiry.
+func (b *EntityBuilder) Expiry(lifetime time.Duration) *EntityBuilder {
+	if lifetime < 0 {
+		b.setError(errors.InvalidArgumentError("negative key lifetime"))
+	}
+	return b.Option(WithExpiry(lifetime))
+}
+
+// Notations adds notations to the self-signatures, see WithNotations.
+func (b *EntityBuilder) Notations(notations ...*packet.Notation) *EntityBuilder {
+	return b.Option(WithNotations(notations...))
+}
+
+// PolicyURI sets the policy URI of the self-signatures, see WithPolicyURI.
+func (b *EntityBuilder) PolicyURI(uri string) *EntityBuilder {
+	return b.Option(WithPolicyURI(uri))
+}
+
+// Option applies the given options of NewEntityWithOptions.
+func (b *EntityBuilder) Option(options ...EntityOption) *EntityBuilder {
+	b.options = append(b.options, options...)
+	return b
+}
+
+// Build generates the entity described by the builder. It returns the first
+// error recorded by the methods of the builder, if any, or the error of
+// NewEntityWithOptions.
+func (b *EntityBuilder) Build() (*Entity, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	config := b.config
+	if b.version != 0 {
+		config = copyConfig(b.config)
+		config.V5Keys = b.version == 5
+	}
+	e, err := NewEntityWithOptions(config, b.options...)
+	if config != b.config {
+		syncRSAPrimes(b.config, config)
+	}
+	return e, err
+}
+
+func (b *EntityBuilder) setError(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
@@ -33,6 +33,15 @@ func (i InvalidArgumentError) Error() string {
 	return "openpgp: invalid argument: " + string(i)
 }
 
+// InvalidConfigurationError indicates that the caller passed a configuration
+// whose options, such as a key version, algorithm and curve, cannot be used
+// together.
+type InvalidConfigurationError string
+
+func (i InvalidConfigurationError) Error() string {
+	return "openpgp: invalid configuration: " + string(i)
+}
+
 // SignatureError indicates that a syntactically valid signature failed to
 // validate.
 type SignatureError string
@@ -68,6 +77,18 @@ func (ki keyIncorrectError) Error() string {
 
 var ErrKeyIncorrect error = keyIncorrectError(0)
 
+type sessionKeyDecryptionError int
+
+func (sessionKeyDecryptionError) Error() string {
+	return "openpgp: cannot decrypt session key"
+}
+
+// ErrSessionKeyDecryption is returned when an encrypted session key cannot
+// be decrypted with a private key, whether its decryption, its cipher octet
+// or its checksum failed. These failures are deliberately not told apart, so
+// as not to give a decryption oracle.
+var ErrSessionKeyDecryption error = sessionKeyDecryptionError(0)
+
 // KeyInvalidError indicates that the public key parameters are invalid
 // as they do not match the private ones
 type KeyInvalidError string
@@ -0,0 +1,144 @@
+package openpgp
+
+import (
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// UpdateExpiry sets the lifetime of the primary key of e, measured from its
+// creation time, by re-issuing its self-signatures: the self-signature of
+// each identity that is not revoked, and the direct-key self-signature, if
+// any. A zero lifetime means that the key never expires. The other properties
+// of the self-signatures, such as key flags, preferences, notations and
+// policy URI, are preserved.
+// The private primary key must be decrypted.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) UpdateExpiry(lifetime time.Duration, config *packet.Config) error {
+	if err := checkPrimaryPrivateKey(e); err != nil {
+		return err
+	}
+	lifetimeSecs, err := lifetimeToSecs(lifetime)
+	if err != nil {
+		return err
+	}
+
+	now := config.Now()
+	for _, ident := range e.Identities {
+		if ident.SelfSignature == nil || ident.Revoked(now) {
+			continue
+		}
+		sig := createSignaturePacket(e.PrimaryKey, ident.SelfSignature.SigType, config)
+		sig.CreationTime = now
+		copySelfSignatureProperties(sig, ident.SelfSignature)
+		sig.KeyLifetimeSecs = &lifetimeSecs
+		sig.IsPrimaryId = ident.SelfSignature.IsPrimaryId
+		if err := sig.SignUserId(ident.Name, e.PrimaryKey, e.PrivateKey, config); err != nil {
+			return err
+		}
+		ident.SelfSignature = sig
+		ident.Signatures = append(ident.Signatures, sig)
+	}
+
+	if e.SelfSignature != nil {
+		sig := createSignaturePacket(e.PrimaryKey, packet.SigTypeDirectSignature, config)
+		sig.CreationTime = now
+		copySelfSignatureProperties(sig, e.SelfSignature)
+		sig.KeyLifetimeSecs = &lifetimeSecs
+		if err := sig.SignDirectKeySignature(e.PrimaryKey, e.PrivateKey, config); err != nil {
+			return err
+		}
+		e.SelfSignature = sig
+		e.Signatures = append(e.Signatures, sig)
+	}
+	return nil
+}
+
+// UpdateSubkeyExpiry sets the lifetime of the subkey sk of e, measured from
+// its creation time, by re-issuing its binding signature. A zero lifetime
+// means that the subkey does not expire before the primary key. The other
+// properties of the binding signature, such as key flags and notations, are
+// preserved. The embedded cross-signature of signing subkeys is re-issued if
+// the private subkey is available and decrypted, and kept otherwise. The
+// private primary key must be decrypted.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) UpdateSubkeyExpiry(sk *Subkey, lifetime time.Duration, config *packet.Config) error {
+	if err := e.PrimaryKey.VerifyKeySignature(sk.PublicKey, sk.Sig); err != nil {
+		return errors.InvalidArgumentError("given subkey is not associated with this key")
+	}
+	if err := checkPrimaryPrivateKey(e); err != nil {
+		return err
+	}
+	lifetimeSecs, err := lifetimeToSecs(lifetime)
+	if err != nil {
+		return err
+	}
+
+	now := config.Now()
+	sig := createSignaturePacket(e.PrimaryKey, packet.SigTypeSubkeyBinding, config)
+	sig.CreationTime = now
+	copySelfSignatureProperties(sig, sk.Sig)
+	sig.KeyLifetimeSecs = &lifetimeSecs
+	sig.EmbeddedSignature = sk.Sig.EmbeddedSignature
+	if sig.FlagSign && sk.PrivateKey != nil && !sk.PrivateKey.Dummy() && !sk.PrivateKey.Encrypted {
+		sig.EmbeddedSignature = createSignaturePacket(sk.PublicKey, packet.SigTypePrimaryKeyBinding, config)
+		sig.EmbeddedSignature.CreationTime = now
+		if err := sig.EmbeddedSignature.CrossSignKey(sk.PublicKey, e.PrimaryKey, sk.PrivateKey, config); err != nil {
+			return err
+		}
+	}
+	if err := sig.SignKey(sk.PublicKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+	sk.Sig = sig
+	return nil
+}
+
+// ExpirationTime returns the time at which k expires, and false if it never
+// expires. The expiration time of a subkey is the earliest of its own and the
+// one of its primary key, as a subkey cannot be used once its primary key has
+// expired. The lifetimes are read from the current self-signatures of the
+// keys.
+func (k *Key) ExpirationTime() (time.Time, bool) {
+	expiry, expires := keyExpirationTime(k.PublicKey, k.SelfSignature)
+	if k.Entity == nil || k.PublicKey == k.Entity.PrimaryKey {
+		return expiry, expires
+	}
+	selfSig, _ := k.Entity.primarySelfSignature()
+	primaryExpiry, primaryExpires := keyExpirationTime(k.Entity.PrimaryKey, selfSig)
+	if primaryExpires && (!expires || primaryExpiry.Before(expiry)) {
+		return primaryExpiry, true
+	}
+	return expiry, expires
+}
+
+// keyExpirationTime returns the expiration time of pk stated by its
+// self-signature sig, and false if it never expires.
+func keyExpirationTime(pk *packet.PublicKey, sig *packet.Signature) (time.Time, bool) {
+	if sig == nil || sig.KeyLifetimeSecs == nil || *sig.KeyLifetimeSecs == 0 {
+		return time.Time{}, false
+	}
+	return pk.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second), true
+}
+
+// copySelfSignatureProperties copies to sig, which re-issues the
+// self-signature from, the key properties of from, as copyKeyProperties
+// does, and its notations, policy URI and signer's user ID, which replace
+// those of the config.
+func copySelfSignatureProperties(sig, from *packet.Signature) {
+	copyKeyProperties(sig, from)
+	sig.Notations = from.Notations
+	sig.PolicyURI = from.PolicyURI
+	sig.SignerUserId = from.SignerUserId
+}
+
+// lifetimeToSecs converts a key lifetime to the number of seconds of the Key
+// Expiration Time subpacket.
+func lifetimeToSecs(lifetime time.Duration) (uint32, error) {
+	secs := lifetime / time.Second
+	if secs < 0 || secs > 1<<32-1 {
+		return 0, errors.InvalidArgumentError("key lifetime out of range")
+	}
+	return uint32(secs), nil
+}
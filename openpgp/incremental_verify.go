@@ -0,0 +1,122 @@
+package openpgp
+
+import (
+	"crypto"
+	"encoding"
+	"hash"
+	"io"
+	"strconv"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/algorithm"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// defaultIncrementalHashes are the hash functions tracked by an
+// IncrementalVerifier if none are given.
+var defaultIncrementalHashes = []crypto.Hash{crypto.SHA224, crypto.SHA256, crypto.SHA384, crypto.SHA512}
+
+// An IncrementalVerifier verifies detached signatures over a document that
+// only grows by appending, such as a transparency log or a journal, where
+// each signature covers the document as it was when the signature was
+// made. The data appended to the document is written to the verifier, which
+// hashes it once: checking a signature over the current document does not
+// require hashing it again.
+type IncrementalVerifier struct {
+	keyring KeyRing
+	config  *packet.Config
+	text    bool
+	length  int64
+	// hashes holds the hash of the document so far for each tracked hash
+	// function, and writers the writers feeding them, which convert line
+	// endings for text signatures.
+	hashes  map[crypto.Hash]hash.Hash
+	writers []io.Writer
+}
+
+// NewIncrementalVerifier returns a verifier of the detached signatures, made
+// by keys of keyring, of a document written to it. The signatures must be
+// text signatures if text is true, and binary signatures otherwise. Only
+// signatures using one of hashes can be verified; if hashes is empty, the
+// SHA-2 hash functions are tracked. The implementations of the hash
+// functions must implement encoding.BinaryMarshaler, as those of the
+// standard library do.
+func NewIncrementalVerifier(keyring KeyRing, text bool, hashes []crypto.Hash, config *packet.Config) (*IncrementalVerifier, error) {
+	if len(hashes) == 0 {
+		hashes = defaultIncrementalHashes
+	}
+	sigType := packet.SigTypeBinary
+	if text {
+		sigType = packet.SigTypeText
+	}
+	v := &IncrementalVerifier{
+		keyring: keyring,
+		config:  config,
+		text:    text,
+		hashes:  make(map[crypto.Hash]hash.Hash),
+	}
+	for _, hashFunc := range hashes {
+		if _, ok := v.hashes[hashFunc]; ok {
+			continue
+		}
+		h, wrappedHash, err := hashForSignature(hashFunc, sigType)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := h.(encoding.BinaryMarshaler); !ok {
+			return nil, errors.UnsupportedError("hash state cannot be saved: " + strconv.Itoa(int(hashFunc)))
+		}
+		v.hashes[hashFunc] = h
+		v.writers = append(v.writers, wrappedHash)
+	}
+	return v, nil
+}
+
+// Write appends p to the document.
+func (v *IncrementalVerifier) Write(p []byte) (int, error) {
+	for _, w := range v.writers {
+		if _, err := w.Write(p); err != nil {
+			return 0, err
+		}
+	}
+	v.length += int64(len(p))
+	return len(p), nil
+}
+
+// Len returns the length of the document written so far.
+func (v *IncrementalVerifier) Len() int64 {
+	return v.length
+}
+
+// Verify reads a detached signature from signature, and verifies that it
+// covers the document written so far. It returns the signature and its
+// signer, as VerifyDetachedSignature does. Writing to the verifier can then
+// continue.
+func (v *IncrementalVerifier) Verify(signature io.Reader) (sig *packet.Signature, signer *Entity, err error) {
+	sig, keys, err := readDetachedSignature(v.keyring, signature, nil, v.config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if (sig.SigType == packet.SigTypeText) != v.text {
+		return nil, nil, errors.SignatureError("unexpected signature type: " + strconv.Itoa(int(sig.SigType)))
+	}
+	h, ok := v.hashes[sig.Hash]
+	if !ok {
+		return nil, nil, errors.UnsupportedError("hash function not tracked: " + strconv.Itoa(int(sig.Hash)))
+	}
+	// The signature trailer is hashed into a copy of the state, which
+	// keeps the state of the document untouched.
+	state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, nil, err
+	}
+	clone := algorithm.NewHash(sig.Hash)
+	unmarshaler, ok := clone.(encoding.BinaryUnmarshaler)
+	if !ok {
+		return nil, nil, errors.UnsupportedError("hash state cannot be restored: " + strconv.Itoa(int(sig.Hash)))
+	}
+	if err := unmarshaler.UnmarshalBinary(state); err != nil {
+		return nil, nil, err
+	}
+	return verifyHashedSignature(keys, clone, sig, v.config)
+}
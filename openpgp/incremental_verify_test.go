@@ -0,0 +1,69 @@
+package openpgp
+
+import (
+	"bytes"
+	"crypto"
+	"testing"
+)
+
+func TestIncrementalVerifier(t *testing.T) {
+	entity, err := NewEntity("Golang Gopher", "", "no-reply@golang.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments := []string{"first entry\n", "second entry\r\n", "", "third entry"}
+	for _, text := range []bool{false, true} {
+		v, err := NewIncrementalVerifier(EntityList{entity}, text, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var document []byte
+		var previous []byte
+		for _, segment := range segments {
+			if _, err := v.Write([]byte(segment)); err != nil {
+				t.Fatal(err)
+			}
+			document = append(document, segment...)
+			if v.Len() != int64(len(document)) {
+				t.Errorf("Len() = %d, want %d", v.Len(), len(document))
+			}
+			sig := new(bytes.Buffer)
+			sign := DetachSign
+			if text {
+				sign = DetachSignText
+			}
+			if err := sign(sig, entity, bytes.NewReader(document), nil); err != nil {
+				t.Fatal(err)
+			}
+			_, signer, err := v.Verify(bytes.NewReader(sig.Bytes()))
+			if err != nil {
+				t.Fatalf("text %t, %d bytes: %s", text, len(document), err)
+			}
+			if signer != entity {
+				t.Error("unexpected signer")
+			}
+			if previous != nil && segment != "" {
+				if _, _, err := v.Verify(bytes.NewReader(previous)); err == nil {
+					t.Errorf("text %t: signature of a shorter prefix verified", text)
+				}
+			}
+			previous = sig.Bytes()
+		}
+		// The signature type must match.
+		sig := new(bytes.Buffer)
+		sign := DetachSignText
+		if text {
+			sign = DetachSign
+		}
+		if err := sign(sig, entity, bytes.NewReader(document), nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := v.Verify(sig); err == nil {
+			t.Errorf("text %t: signature of the wrong type verified", text)
+		}
+	}
+
+	if _, err := NewIncrementalVerifier(EntityList{entity}, false, []crypto.Hash{crypto.MD5}, nil); err == nil {
+		t.Error("expected an error tracking an unsupported hash")
+	}
+}
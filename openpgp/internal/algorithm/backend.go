@@ -0,0 +1,158 @@
+package algorithm
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/cipher"
+	"errors"
+	"hash"
+	"sync"
+	"sync/atomic"
+)
+
+// backends holds the alternative implementations of block ciphers and hash
+// functions registered process-wide. A backends value is never modified once
+// published, so that it can be read without locking.
+type backends struct {
+	ciphers map[CipherFunction]func(key []byte) (cipher.Block, error)
+	hashes  map[crypto.Hash]func() hash.Hash
+}
+
+var (
+	backendsMu      sync.Mutex
+	currentBackends atomic.Value // *backends
+)
+
+func loadBackends() *backends {
+	b, _ := currentBackends.Load().(*backends)
+	return b
+}
+
+// updateBackends publishes a copy of the current backends modified by
+// update.
+func updateBackends(update func(*backends)) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	b := &backends{
+		ciphers: make(map[CipherFunction]func(key []byte) (cipher.Block, error)),
+		hashes:  make(map[crypto.Hash]func() hash.Hash),
+	}
+	if current := loadBackends(); current != nil {
+		for c, newCipher := range current.ciphers {
+			b.ciphers[c] = newCipher
+		}
+		for h, newHash := range current.hashes {
+			b.hashes[h] = newHash
+		}
+	}
+	update(b)
+	currentBackends.Store(b)
+}
+
+// SetCipherBackend makes CipherFunction.New use newCipher for c, or the Go
+// implementation again if newCipher is nil.
+func SetCipherBackend(c CipherFunction, newCipher func(key []byte) (cipher.Block, error)) {
+	updateBackends(func(b *backends) {
+		if newCipher == nil {
+			delete(b.ciphers, c)
+		} else {
+			b.ciphers[c] = newCipher
+		}
+	})
+}
+
+// SetHashBackend makes NewHash use newHash for h, or the implementation
+// registered with the crypto package again if newHash is nil.
+func SetHashBackend(h crypto.Hash, newHash func() hash.Hash) {
+	updateBackends(func(b *backends) {
+		if newHash == nil {
+			delete(b.hashes, h)
+		} else {
+			b.hashes[h] = newHash
+		}
+	})
+}
+
+// NewHash returns a new hash.Hash calculating h, from the backend registered
+// for h, if any. It panics if h has no backend and is not linked into the
+// binary.
+func NewHash(h crypto.Hash) hash.Hash {
+	if b := loadBackends(); b != nil {
+		if newHash, ok := b.hashes[h]; ok {
+			return newHash()
+		}
+	}
+	return h.New()
+}
+
+// newBackendCipher returns an instance of c from the backend registered for
+// c, if any, and if it accepts key.
+func newBackendCipher(c CipherFunction, key []byte) cipher.Block {
+	b := loadBackends()
+	if b == nil {
+		return nil
+	}
+	newCipher, ok := b.ciphers[c]
+	if !ok {
+		return nil
+	}
+	block, err := newCipher(key)
+	if err != nil {
+		return nil
+	}
+	return block
+}
+
+// CheckCipherBackend checks that newCipher implements c: it must accept keys
+// of the size of c, have the block size of c, and encrypt and decrypt a
+// block as the Go implementation does.
+func CheckCipherBackend(c CipherFunction, newCipher func(key []byte) (cipher.Block, error)) error {
+	key := testPattern(c.KeySize())
+	block, err := newCipher(key)
+	if err != nil {
+		return err
+	}
+	reference := c.newGo(key)
+	if block.BlockSize() != reference.BlockSize() {
+		return errors.New("wrong block size")
+	}
+	plaintext := testPattern(reference.BlockSize())
+	want := make([]byte, len(plaintext))
+	reference.Encrypt(want, plaintext)
+	got := make([]byte, len(plaintext))
+	block.Encrypt(got, plaintext)
+	if !bytes.Equal(got, want) {
+		return errors.New("known-answer test failed for encryption")
+	}
+	block.Decrypt(got, want)
+	if !bytes.Equal(got, plaintext) {
+		return errors.New("known-answer test failed for decryption")
+	}
+	return nil
+}
+
+// CheckHashBackend checks that newHash implements h: its hashes must have
+// the size and block size of h, and compute the digest of a message as the
+// implementation registered with the crypto package does.
+func CheckHashBackend(h crypto.Hash, newHash func() hash.Hash) error {
+	backend, reference := newHash(), h.New()
+	if backend.Size() != reference.Size() || backend.BlockSize() != reference.BlockSize() {
+		return errors.New("wrong hash or block size")
+	}
+	message := testPattern(3*reference.BlockSize() + 1)
+	backend.Write(message)
+	reference.Write(message)
+	if !bytes.Equal(backend.Sum(nil), reference.Sum(nil)) {
+		return errors.New("known-answer test failed")
+	}
+	return nil
+}
+
+// testPattern returns n deterministic bytes for the known-answer tests.
+func testPattern(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i*7 + 1)
+	}
+	return b
+}
@@ -89,8 +89,18 @@ func (cipher CipherFunction) BlockSize() int {
 	return 0
 }
 
-// New returns a fresh instance of the given cipher.
+// New returns a fresh instance of the given cipher, from the backend set
+// with SetCipherBackend, if any, and otherwise from the Go implementation.
 func (cipher CipherFunction) New(key []byte) (block cipher.Block) {
+	if block = newBackendCipher(cipher, key); block != nil {
+		return block
+	}
+	return cipher.newGo(key)
+}
+
+// newGo returns a fresh instance of the given cipher from the Go
+// implementation.
+func (cipher CipherFunction) newGo(key []byte) (block cipher.Block) {
 	var err error
 	switch cipher {
 	case TripleDES:
@@ -66,6 +66,11 @@ func (h cryptoHash) Id() uint8 {
 	return h.id
 }
 
+// New returns a new hash.Hash calculating h, see NewHash.
+func (h cryptoHash) New() hash.Hash {
+	return NewHash(h.Hash)
+}
+
 var hashNames = map[uint8]string{
 	SHA256.Id():   "SHA256",
 	SHA384.Id():   "SHA384",
@@ -0,0 +1,175 @@
+package openpgp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/ecdh"
+	"github.com/ProtonMail/go-crypto/openpgp/eddsa"
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// A KeyCache keeps the private keys of entities decrypted for a limited
+// time, so that batch jobs using the same key many times only decrypt it
+// once. Entries expire when a timer fires after the TTL of the cache, when
+// they are accessed after the TTL according to the time of the config, or
+// when Wipe is called: the private keys of the entities returned by Unlock
+// are then encrypted again, and their decrypted secret material is discarded,
+// so that it does not outlive the cache entry. A KeyCache is safe for
+// concurrent use, but entities must not be used while their entry expires.
+type KeyCache struct {
+	ttl     time.Duration
+	config  *packet.Config
+	mu      sync.Mutex
+	entries map[string]*keyCacheEntry
+}
+
+type keyCacheEntry struct {
+	entity  *Entity
+	keys    []unlockedKey
+	expires time.Time
+	timer   *time.Timer
+}
+
+// An unlockedKey is a decrypted copy of a private key, and the encrypted
+// state it is restored to when its cache entry expires.
+type unlockedKey struct {
+	key    *packet.PrivateKey
+	locked packet.PrivateKey
+}
+
+// NewKeyCache returns a KeyCache whose entries expire after ttl. The time is
+// taken from config.
+// If config is nil, sensible defaults will be used.
+func NewKeyCache(ttl time.Duration, config *packet.Config) *KeyCache {
+	return &KeyCache{
+		ttl:     ttl,
+		config:  config,
+		entries: make(map[string]*keyCacheEntry),
+	}
+}
+
+// Unlock returns a copy of e whose private primary key and subkeys are
+// decrypted with passphrase. The copy is cached by the fingerprint of the
+// primary key until the TTL of the cache elapses, and returned again by
+// later calls with the same passphrase, without decrypting the keys again.
+// The passphrase of later calls is still checked with the S2K function of the
+// keys. e itself is not modified.
+func (c *KeyCache) Unlock(e *Entity, passphrase []byte) (*Entity, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.config.Now()
+	c.expire(now)
+	fingerprint := string(e.PrimaryKey.Fingerprint)
+	if entry, ok := c.entries[fingerprint]; ok {
+		if err := entry.checkPassphrase(passphrase); err != nil {
+			return nil, errors.InvalidArgumentError("wrong passphrase for cached key")
+		}
+		return entry.entity, nil
+	}
+
+	entry := &keyCacheEntry{expires: now.Add(c.ttl)}
+	unlocked := *e
+	if e.PrivateKey != nil {
+		unlocked.PrivateKey = entry.copyKey(e.PrivateKey)
+	}
+	unlocked.Subkeys = append([]Subkey(nil), e.Subkeys...)
+	for i := range unlocked.Subkeys {
+		if key := unlocked.Subkeys[i].PrivateKey; key != nil {
+			unlocked.Subkeys[i].PrivateKey = entry.copyKey(key)
+		}
+	}
+	if err := unlocked.DecryptPrivateKeys(passphrase); err != nil {
+		return nil, err
+	}
+	entry.entity = &unlocked
+	c.entries[fingerprint] = entry
+	entry.timer = time.AfterFunc(c.ttl, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.entries[fingerprint] == entry {
+			entry.wipe()
+			delete(c.entries, fingerprint)
+		}
+	})
+	return entry.entity, nil
+}
+
+// Wipe expires all the entries of the cache.
+func (c *KeyCache) Wipe() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for fingerprint, entry := range c.entries {
+		entry.wipe()
+		delete(c.entries, fingerprint)
+	}
+}
+
+// expire removes the entries of the cache that expired at time now.
+func (c *KeyCache) expire(now time.Time) {
+	for fingerprint, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			entry.wipe()
+			delete(c.entries, fingerprint)
+		}
+	}
+}
+
+// copyKey returns a copy of key to be decrypted, which is encrypted again
+// when the entry is wiped.
+func (entry *keyCacheEntry) copyKey(key *packet.PrivateKey) *packet.PrivateKey {
+	c := *key
+	entry.keys = append(entry.keys, unlockedKey{&c, *key})
+	return &c
+}
+
+// checkPassphrase checks that passphrase decrypts the entry, by decrypting a
+// copy of its first encrypted key with the S2K function of that key.
+func (entry *keyCacheEntry) checkPassphrase(passphrase []byte) error {
+	for _, k := range entry.keys {
+		if !k.locked.Encrypted || k.locked.Dummy() {
+			continue
+		}
+		key := k.locked
+		if err := key.Decrypt(passphrase); err != nil {
+			return err
+		}
+		zeroKey(&key)
+		return nil
+	}
+	return nil
+}
+
+// wipe zeroes the secret material of the keys decrypted by the entry that is
+// held in byte slices, restores the encrypted state of its keys and stops its
+// timer.
+func (entry *keyCacheEntry) wipe() {
+	if entry.timer != nil {
+		entry.timer.Stop()
+	}
+	for _, k := range entry.keys {
+		if k.locked.Encrypted {
+			zeroKey(k.key)
+		}
+		*k.key = k.locked
+	}
+}
+
+// zeroKey zeroes the secret material of a decrypted key that is held in byte
+// slices.
+func zeroKey(key *packet.PrivateKey) {
+	switch priv := key.PrivateKey.(type) {
+	case *eddsa.PrivateKey:
+		zero(priv.D)
+	case *ecdh.PrivateKey:
+		zero(priv.D)
+	}
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
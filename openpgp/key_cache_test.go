@@ -0,0 +1,99 @@
+package openpgp
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestKeyCache(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrase := []byte("passphrase")
+	if err = entity.EncryptPrivateKeys(passphrase, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	cache := NewKeyCache(time.Minute, &packet.Config{Time: func() time.Time { return now }})
+	if _, err = cache.Unlock(entity, []byte("wrong")); err == nil {
+		t.Fatal("expected an error with the wrong passphrase")
+	}
+	unlocked, err := cache.Unlock(entity, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !entity.PrivateKey.Encrypted || unlocked.PrivateKey.Encrypted || unlocked.Subkeys[0].PrivateKey.Encrypted {
+		t.Fatal("expected a decrypted copy of the entity")
+	}
+	if again, err := cache.Unlock(entity, passphrase); err != nil || again != unlocked {
+		t.Error("expected the cached entity")
+	}
+	if _, err = cache.Unlock(entity, []byte("wrong")); err == nil {
+		t.Error("expected an error with the wrong passphrase for a cached key")
+	}
+	buf := new(bytes.Buffer)
+	if err = DetachSign(buf, unlocked, bytes.NewBufferString("message"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The entry expires after the TTL.
+	now = now.Add(time.Minute)
+	again, err := cache.Unlock(entity, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == unlocked || !unlocked.PrivateKey.Encrypted || unlocked.PrivateKey.PrivateKey != nil {
+		t.Error("expected the expired entry to be wiped")
+	}
+	if err = DetachSign(buf, unlocked, bytes.NewBufferString("message"), nil); err == nil {
+		t.Error("expected an error when signing with a wiped entity")
+	}
+
+	cache.Wipe()
+	if !again.PrivateKey.Encrypted || !again.Subkeys[0].PrivateKey.Encrypted {
+		t.Error("expected the keys to be encrypted again")
+	}
+	if err = again.DecryptPrivateKeys(passphrase); err != nil {
+		t.Errorf("cannot decrypt the wiped keys: %v", err)
+	}
+}
+
+func TestKeyCacheTimer(t *testing.T) {
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrase := []byte("passphrase")
+	if err = entity.EncryptPrivateKeys(passphrase, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The entry expires after the TTL without being accessed again.
+	cache := NewKeyCache(10*time.Millisecond, nil)
+	unlocked, err := cache.Unlock(entity, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		cache.mu.Lock()
+		n := len(cache.entries)
+		cache.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the entry to expire")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !unlocked.PrivateKey.Encrypted || !unlocked.Subkeys[0].PrivateKey.Encrypted {
+		t.Error("expected the keys to be encrypted again")
+	}
+}
@@ -5,9 +5,13 @@
 package openpgp
 
 import (
+	"bytes"
 	"crypto"
+	goecdsa "crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha512"
 	goerrors "errors"
 	"io"
 	"math/big"
@@ -16,6 +20,7 @@ import (
 	"github.com/ProtonMail/go-crypto/openpgp/ecdh"
 	"github.com/ProtonMail/go-crypto/openpgp/ecdsa"
 	"github.com/ProtonMail/go-crypto/openpgp/eddsa"
+	"github.com/ProtonMail/go-crypto/openpgp/elgamal"
 	"github.com/ProtonMail/go-crypto/openpgp/errors"
 	"github.com/ProtonMail/go-crypto/openpgp/internal/algorithm"
 	"github.com/ProtonMail/go-crypto/openpgp/internal/ecc"
@@ -47,14 +52,15 @@ func NewEntity(name, comment, email string, config *packet.Config) (*Entity, err
 		Subkeys:    []Subkey{},
 	}
 
-	err = e.addUserId(name, comment, email, config, creationTime, keyLifetimeSecs)
+	err = e.addUserId(name, comment, email, config, creationTime, keyLifetimeSecs, true)
 	if err != nil {
 		return nil, err
 	}
 
-	// NOTE: No key expiry here, but we will not return this subkey in EncryptionKey()
-	// if the primary/master key has expired.
-	err = e.addEncryptionSubkey(config, creationTime, 0)
+	// NOTE: Unless SubkeyLifetimeSecs is set, no key expiry here, but we will
+	// not return this subkey in EncryptionKey() if the primary/master key has
+	// expired.
+	err = e.addEncryptionSubkey(config, creationTime, config.SubkeyLifetime())
 	if err != nil {
 		return nil, err
 	}
@@ -62,16 +68,31 @@ func NewEntity(name, comment, email string, config *packet.Config) (*Entity, err
 	return e, nil
 }
 
+// NewSigningEntity returns an Entity like NewEntity, but without encryption
+// subkey, for identities that must only sign, such as code-signing keys.
+// If config is nil, sensible defaults will be used.
+func NewSigningEntity(name, comment, email string, config *packet.Config) (*Entity, error) {
+	return NewEntityWithOptions(config, WithUserId(name, comment, email), WithoutEncryptionSubkey())
+}
+
 func (t *Entity) AddUserId(name, comment, email string, config *packet.Config) error {
 	creationTime := config.Now()
 	keyLifetimeSecs := config.KeyLifetime()
-	return t.addUserId(name, comment, email, config, creationTime, keyLifetimeSecs)
+	return t.addUserId(name, comment, email, config, creationTime, keyLifetimeSecs, true)
 }
 
-func (t *Entity) addUserId(name, comment, email string, config *packet.Config, creationTime time.Time, keyLifetimeSecs uint32) error {
-	uid := packet.NewUserId(name, comment, email)
-	if uid == nil {
-		return errors.InvalidArgumentError("user id field contained invalid characters")
+// addUserId adds a user ID with a positive self-certification. The
+// algorithm preferences and features are only set on the self-signature if
+// withPreferences is set; they are left out when the entity advertises them
+// on a direct-key self-signature created along with it.
+func (t *Entity) addUserId(name, comment, email string, config *packet.Config, creationTime time.Time, keyLifetimeSecs uint32, withPreferences bool) error {
+	validation := packet.UserIdValidationDefault
+	if config != nil {
+		validation = config.UserIdValidation
+	}
+	uid, err := packet.NewUserIdWithValidation(name, comment, email, validation)
+	if err != nil {
+		return err
 	}
 
 	if _, ok := t.Identities[uid.Id]; ok {
@@ -89,34 +110,103 @@ func (t *Entity) addUserId(name, comment, email string, config *packet.Config, c
 	selfSignature.FlagsValid = true
 	selfSignature.FlagSign = true
 	selfSignature.FlagCertify = true
+	if withPreferences {
+		if err := setSelfSignaturePreferences(selfSignature, &primary.PublicKey, config); err != nil {
+			return err
+		}
+	}
+
+	// User ID binding signature
+	err = selfSignature.SignUserId(uid.Id, &primary.PublicKey, primary, config)
+	if err != nil {
+		return err
+	}
+	t.Identities[uid.Id] = &Identity{
+		Name:          uid.Id,
+		UserId:        uid,
+		SelfSignature: selfSignature,
+		Signatures:    []*packet.Signature{selfSignature},
+	}
+	return nil
+}
+
+// setSelfSignaturePreferences sets the algorithm preferences and features
+// advertised by a self-signature of primary according to config. The
+// preference lists of config are used verbatim if they are set.
+func setSelfSignaturePreferences(selfSignature *packet.Signature, primary *packet.PublicKey, config *packet.Config) error {
+	if err := config.ValidatePreferences(); err != nil {
+		return err
+	}
 	selfSignature.SEIPDv1 = true // true by default, see 5.8 vs. 5.14
-	selfSignature.SEIPDv2 = config.AEAD() != nil
+	selfSignature.SEIPDv2 = config.AEAD() != nil || len(config.AEADCiphersuitePreferences()) > 0
 
-	// Set the PreferredHash for the SelfSignature from the packet.Config.
-	// If it is not the must-implement algorithm from rfc4880bis, append that.
-	hash, ok := algorithm.HashToHashId(config.Hash())
-	if !ok {
-		return errors.UnsupportedError("unsupported preferred hash function")
+	if hashes := config.HashPreferences(); len(hashes) > 0 {
+		selfSignature.PreferredHash = make([]uint8, len(hashes))
+		for i, h := range hashes {
+			selfSignature.PreferredHash[i] = hashToHashId(h)
+		}
+	} else {
+		// Set the PreferredHash for the SelfSignature from the packet.Config.
+		// If it is not the must-implement algorithm from rfc4880bis, append that.
+		if _, ok := algorithm.HashToHashId(config.Hash()); !ok {
+			return errors.UnsupportedError("unsupported preferred hash function")
+		}
+
+		hashes := []crypto.Hash{config.Hash()}
+		// Keys whose security level exceeds the one of SHA-256, such as Ed448
+		// keys, also advertise the hash function matching it.
+		keyHash := primary.DefaultSignatureHash()
+		if keyHash != config.Hash() && keyHash != crypto.SHA256 {
+			hashes = append(hashes, keyHash)
+		}
+		if config.Hash() != crypto.SHA256 {
+			hashes = append(hashes, crypto.SHA256)
+		}
+		// For such keys, hash functions weaker than the one of the key are
+		// left out, so that the key's own hash function comes first.
+		selfSignature.PreferredHash = nil
+		for _, h := range hashes {
+			if keyHash == crypto.SHA256 || h.Size() >= keyHash.Size() {
+				selfSignature.PreferredHash = append(selfSignature.PreferredHash, hashToHashId(h))
+			}
+		}
 	}
 
-	selfSignature.PreferredHash = []uint8{hash}
-	if config.Hash() != crypto.SHA256 {
-		selfSignature.PreferredHash = append(selfSignature.PreferredHash, hashToHashId(crypto.SHA256))
+	if ciphers := config.SymmetricPreferences(); len(ciphers) > 0 {
+		selfSignature.PreferredSymmetric = make([]uint8, len(ciphers))
+		for i, cipher := range ciphers {
+			selfSignature.PreferredSymmetric[i] = uint8(cipher)
+		}
+	} else {
+		// Likewise for DefaultCipher.
+		selfSignature.PreferredSymmetric = []uint8{uint8(config.Cipher())}
+		if config.Cipher() != packet.CipherAES128 {
+			selfSignature.PreferredSymmetric = append(selfSignature.PreferredSymmetric, uint8(packet.CipherAES128))
+		}
 	}
 
-	// Likewise for DefaultCipher.
-	selfSignature.PreferredSymmetric = []uint8{uint8(config.Cipher())}
-	if config.Cipher() != packet.CipherAES128 {
-		selfSignature.PreferredSymmetric = append(selfSignature.PreferredSymmetric, uint8(packet.CipherAES128))
+	if algos := config.CompressionPreferences(); len(algos) > 0 {
+		selfSignature.PreferredCompression = make([]uint8, len(algos))
+		for i, algo := range algos {
+			selfSignature.PreferredCompression[i] = uint8(algo)
+		}
+	} else {
+		// We set CompressionNone as the preferred compression algorithm because
+		// of compression side channel attacks, then append the configured
+		// DefaultCompressionAlgo if any is set (to signal support for cases
+		// where the application knows that using compression is safe).
+		selfSignature.PreferredCompression = []uint8{uint8(packet.CompressionNone)}
+		if config.Compression() != packet.CompressionNone {
+			selfSignature.PreferredCompression = append(selfSignature.PreferredCompression, uint8(config.Compression()))
+		}
 	}
 
-	// We set CompressionNone as the preferred compression algorithm because
-	// of compression side channel attacks, then append the configured
-	// DefaultCompressionAlgo if any is set (to signal support for cases
-	// where the application knows that using compression is safe).
-	selfSignature.PreferredCompression = []uint8{uint8(packet.CompressionNone)}
-	if config.Compression() != packet.CompressionNone {
-		selfSignature.PreferredCompression = append(selfSignature.PreferredCompression, uint8(config.Compression()))
+	if suites := config.AEADCiphersuitePreferences(); len(suites) > 0 {
+		selfSignature.PreferredCipherSuites = make([][2]uint8, len(suites))
+		for i, suite := range suites {
+			selfSignature.PreferredCipherSuites[i] = [2]uint8{uint8(suite.Cipher), uint8(suite.Mode)}
+		}
+		return nil
 	}
 
 	// And for DefaultMode.
@@ -131,77 +221,219 @@ func (t *Entity) addUserId(name, comment, email string, config *packet.Config, c
 			selfSignature.PreferredCipherSuites = append(selfSignature.PreferredCipherSuites, [2]uint8{cipher, mode})
 		}
 	}
-
-	// User ID binding signature
-	err := selfSignature.SignUserId(uid.Id, &primary.PublicKey, primary, config)
-	if err != nil {
-		return err
-	}
-	t.Identities[uid.Id] = &Identity{
-		Name:          uid.Id,
-		UserId:        uid,
-		SelfSignature: selfSignature,
-		Signatures:    []*packet.Signature{selfSignature},
-	}
 	return nil
 }
 
+// AddSubkey adds a keypair as a subkey to the Entity, with the given
+// combination of packet.KeyFlag* values, such as packet.KeyFlagAuthenticate
+// for an authentication-only subkey. Subkeys that can sign or authenticate use
+// the signing algorithm of config, and must use an algorithm that can also
+// encrypt if encryption flags are given. Signing subkeys are cross-signed.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AddSubkey(config *packet.Config, flags int) error {
+	creationTime := config.Now()
+	keyLifetimeSecs := addedSubkeyLifetime(config)
+	return e.generateSubkey(config, creationTime, keyLifetimeSecs, flags)
+}
+
 // AddSigningSubkey adds a signing keypair as a subkey to the Entity.
 // If config is nil, sensible defaults will be used.
 func (e *Entity) AddSigningSubkey(config *packet.Config) error {
 	creationTime := config.Now()
-	keyLifetimeSecs := config.KeyLifetime()
+	keyLifetimeSecs := addedSubkeyLifetime(config)
+	return e.generateSubkey(config, creationTime, keyLifetimeSecs, packet.KeyFlagSign)
+}
 
-	subPrivRaw, err := newSigner(config)
-	if err != nil {
+// AddExternalSigningSubkey adds signer, a crypto.Signer whose private key
+// may be held in an HSM or a KMS, as a signing subkey to the Entity. The
+// public key of signer must be an *rsa.PublicKey, an *ecdsa.PublicKey or an
+// ed25519.PublicKey. The subkey is cross-signed by signer, and bound with
+// the primary private key, which must be available and decrypted.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AddExternalSigningSubkey(signer crypto.Signer, config *packet.Config) error {
+	if err := checkPrimaryPrivateKey(e); err != nil {
 		return err
 	}
-	sub := packet.NewSignerPrivateKey(creationTime, subPrivRaw)
-	sub.IsSubkey = true
-	if config != nil && config.V5Keys {
-		sub.UpgradeToV5()
-	}
-
-	subkey := Subkey{
-		PublicKey:  &sub.PublicKey,
-		PrivateKey: sub,
+	creationTime := config.Now()
+	sub, err := packet.NewExternalSignerPrivateKey(creationTime, signer)
+	if err != nil {
+		return err
 	}
-	subkey.Sig = createSignaturePacket(e.PrimaryKey, packet.SigTypeSubkeyBinding, config)
-	subkey.Sig.CreationTime = creationTime
-	subkey.Sig.KeyLifetimeSecs = &keyLifetimeSecs
-	subkey.Sig.FlagsValid = true
-	subkey.Sig.FlagSign = true
-	subkey.Sig.EmbeddedSignature = createSignaturePacket(subkey.PublicKey, packet.SigTypePrimaryKeyBinding, config)
-	subkey.Sig.EmbeddedSignature.CreationTime = creationTime
+	return e.bindSubkey(sub, config, creationTime, addedSubkeyLifetime(config), packet.KeyFlagSign)
+}
 
-	err = subkey.Sig.EmbeddedSignature.CrossSignKey(subkey.PublicKey, e.PrimaryKey, subkey.PrivateKey, config)
-	if err != nil {
+// ImportEncryptionSubkey adds priv, an existing encryption key, as an
+// encryption subkey to the Entity. priv must be an *rsa.PrivateKey, an
+// *elgamal.PrivateKey or an *ecdh.PrivateKey, which includes X25519 keys.
+// The subkey keeps the given creation time, from which its lifetime is
+// counted, and is bound with the primary private key, which must be
+// available and decrypted.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) ImportEncryptionSubkey(priv interface{}, creationTime time.Time, config *packet.Config) error {
+	if err := checkPrimaryPrivateKey(e); err != nil {
 		return err
 	}
+	switch priv.(type) {
+	case *rsa.PrivateKey, *elgamal.PrivateKey, *ecdh.PrivateKey:
+	default:
+		return errors.InvalidArgumentError("unsupported encryption key type")
+	}
+	sub := packet.NewDecrypterPrivateKey(creationTime, priv)
+	return e.bindSubkey(sub, config, config.Now(), addedSubkeyLifetime(config), packet.KeyFlagEncryptCommunications|packet.KeyFlagEncryptStorage)
+}
 
-	err = subkey.Sig.SignKey(subkey.PublicKey, e.PrivateKey, config)
-	if err != nil {
+// ImportSigningSubkey adds priv, an existing signing key, as a signing
+// subkey to the Entity. priv must be an *rsa.PrivateKey, an ECDSA key from
+// crypto/ecdsa or this module, an ed25519.PrivateKey or an
+// *eddsa.PrivateKey; any other crypto.Signer is used as with
+// AddExternalSigningSubkey. The subkey keeps the given creation time, from
+// which its lifetime is counted. It is cross-signed by priv, and bound with
+// the primary private key, which must be available and decrypted.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) ImportSigningSubkey(priv interface{}, creationTime time.Time, config *packet.Config) error {
+	if err := checkPrimaryPrivateKey(e); err != nil {
 		return err
 	}
+	var sub *packet.PrivateKey
+	switch key := priv.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, *eddsa.PrivateKey:
+		sub = packet.NewSignerPrivateKey(creationTime, key)
+	case *goecdsa.PrivateKey:
+		curveInfo := ecc.FindByCurve(ecc.NewGenericCurve(key.Curve))
+		if curveInfo == nil {
+			return errors.UnsupportedError("unknown elliptic curve of signing key")
+		}
+		curve, ok := curveInfo.Curve.(ecc.ECDSACurve)
+		if !ok {
+			return errors.UnsupportedError("elliptic curve of signing key cannot sign")
+		}
+		ecdsaPriv := ecdsa.NewPrivateKey(*ecdsa.NewPublicKey(curve))
+		ecdsaPriv.X, ecdsaPriv.Y, ecdsaPriv.D = key.X, key.Y, key.D
+		sub = packet.NewECDSAPrivateKey(creationTime, ecdsaPriv)
+	case ed25519.PrivateKey:
+		eddsaPriv := eddsa.NewPrivateKey(*eddsa.NewPublicKey(ecc.NewEd25519()))
+		eddsaPriv.X = append([]byte(nil), key.Public().(ed25519.PublicKey)...)
+		eddsaPriv.D = append([]byte(nil), key.Seed()...)
+		sub = packet.NewEdDSAPrivateKey(creationTime, eddsaPriv)
+	case crypto.Signer:
+		var err error
+		if sub, err = packet.NewExternalSignerPrivateKey(creationTime, key); err != nil {
+			return err
+		}
+	default:
+		return errors.InvalidArgumentError("unsupported signing key type")
+	}
+	return e.bindSubkey(sub, config, config.Now(), addedSubkeyLifetime(config), packet.KeyFlagSign)
+}
 
-	e.Subkeys = append(e.Subkeys, subkey)
-	return nil
+// AddAuthenticationSubkey adds an authentication keypair as a subkey to the
+// Entity. Its binding signature only carries the authentication flag, as
+// expected by gpg-agent to use it as an SSH key. It uses the signing
+// algorithm of config, and is not cross-signed.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AddAuthenticationSubkey(config *packet.Config) error {
+	return e.AddSubkey(config, packet.KeyFlagAuthenticate)
 }
 
 // AddEncryptionSubkey adds an encryption keypair as a subkey to the Entity.
 // If config is nil, sensible defaults will be used.
 func (e *Entity) AddEncryptionSubkey(config *packet.Config) error {
 	creationTime := config.Now()
-	keyLifetimeSecs := config.KeyLifetime()
+	keyLifetimeSecs := addedSubkeyLifetime(config)
 	return e.addEncryptionSubkey(config, creationTime, keyLifetimeSecs)
 }
 
 func (e *Entity) addEncryptionSubkey(config *packet.Config, creationTime time.Time, keyLifetimeSecs uint32) error {
-	subPrivRaw, err := newDecrypter(config)
+	return e.generateSubkey(config, creationTime, keyLifetimeSecs, packet.KeyFlagEncryptCommunications|packet.KeyFlagEncryptStorage)
+}
+
+// AddDerivedEncryptionSubkey adds to the Entity an X25519 (ECDH over
+// Curve25519) encryption subkey derived from its Ed25519 primary key, for
+// ecosystems that deliberately derive a whole identity from a single seed.
+// The secret scalar of the subkey is the secret scalar of the primary key,
+// and its public point is the image of the primary public key under the
+// birational map from the Edwards to the Montgomery form of the curve.
+//
+// Deriving the subkey this way reuses the same secret for signatures and
+// key agreement. Although no practical attack is known on this combination,
+// the two keys are not independent: compromising either of them
+// compromises both, and the subkey cannot be rotated without the primary
+// key. Generate independent subkeys with AddEncryptionSubkey unless this
+// trade-off is intended. config.AllowDerivedEncryptionKeys must be set, and
+// the private primary key must be decrypted.
+func (e *Entity) AddDerivedEncryptionSubkey(config *packet.Config) error {
+	if !config.DerivedEncryptionKeysAllowed() {
+		return errors.InvalidArgumentError("deriving encryption keys is not allowed by the config")
+	}
+	if err := checkPrimaryPrivateKey(e); err != nil {
+		return err
+	}
+	primary, ok := e.PrivateKey.PrivateKey.(*eddsa.PrivateKey)
+	if !ok || primary.GetCurve().GetCurveName() != "ed25519" {
+		return errors.InvalidArgumentError("encryption keys can only be derived from Ed25519 keys")
+	}
+
+	// The Ed25519 secret scalar is the first half of the SHA-512 hash of the
+	// seed. The X25519 key generation reads it as the little-endian scalar,
+	// and clamps it identically.
+	h := sha512.Sum512(primary.D)
+	kdf := ecdh.KDF{
+		Hash:   algorithm.SHA512,
+		Cipher: algorithm.AES256,
+	}
+	subPrivRaw, err := ecdh.GenerateKey(bytes.NewReader(h[:32]), ecc.NewCurve25519(), kdf)
 	if err != nil {
 		return err
 	}
+
+	creationTime := config.Now()
 	sub := packet.NewDecrypterPrivateKey(creationTime, subPrivRaw)
+	return e.bindSubkey(sub, config, creationTime, addedSubkeyLifetime(config), packet.KeyFlagEncryptCommunications|packet.KeyFlagEncryptStorage)
+}
+
+// addedSubkeyLifetime returns the lifetime of the subkeys added to an
+// existing key.
+func addedSubkeyLifetime(config *packet.Config) uint32 {
+	if lifetime := config.SubkeyLifetime(); lifetime != 0 {
+		return lifetime
+	}
+	return config.KeyLifetime()
+}
+
+// generateSubkey generates a subkey with the given combination of
+// packet.KeyFlag* values and binds it to the Entity. Subkeys that can sign
+// or authenticate are generated with newSigner, encryption-only subkeys with
+// newDecrypter. Signing subkeys are cross-signed.
+func (e *Entity) generateSubkey(config *packet.Config, creationTime time.Time, keyLifetimeSecs uint32, flags int) error {
+	const signFlags = packet.KeyFlagCertify | packet.KeyFlagSign | packet.KeyFlagAuthenticate
+	const encryptFlags = packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage
+	if flags&(signFlags|encryptFlags) == 0 {
+		return errors.InvalidArgumentError("no usage flags given for subkey")
+	}
+
+	var sub *packet.PrivateKey
+	if flags&signFlags != 0 {
+		subPrivRaw, err := newSigner(config)
+		if err != nil {
+			return err
+		}
+		sub = packet.NewSignerPrivateKey(creationTime, subPrivRaw)
+		if flags&encryptFlags != 0 && !sub.PubKeyAlgo.CanEncrypt() {
+			return errors.InvalidArgumentError("subkey algorithm cannot be used for encryption")
+		}
+	} else {
+		subPrivRaw, err := newDecrypter(config)
+		if err != nil {
+			return err
+		}
+		sub = packet.NewDecrypterPrivateKey(creationTime, subPrivRaw)
+	}
+	return e.bindSubkey(sub, config, creationTime, keyLifetimeSecs, flags)
+}
+
+// bindSubkey makes sub a subkey of the Entity with the given combination of
+// packet.KeyFlag* values. Signing subkeys are cross-signed.
+func (e *Entity) bindSubkey(sub *packet.PrivateKey, config *packet.Config, creationTime time.Time, keyLifetimeSecs uint32, flags int) error {
 	sub.IsSubkey = true
 	if config != nil && config.V5Keys {
 		sub.UpgradeToV5()
@@ -215,10 +447,22 @@ func (e *Entity) addEncryptionSubkey(config *packet.Config, creationTime time.Ti
 	subkey.Sig.CreationTime = creationTime
 	subkey.Sig.KeyLifetimeSecs = &keyLifetimeSecs
 	subkey.Sig.FlagsValid = true
-	subkey.Sig.FlagEncryptStorage = true
-	subkey.Sig.FlagEncryptCommunications = true
+	subkey.Sig.FlagCertify = flags&packet.KeyFlagCertify != 0
+	subkey.Sig.FlagSign = flags&packet.KeyFlagSign != 0
+	subkey.Sig.FlagEncryptCommunications = flags&packet.KeyFlagEncryptCommunications != 0
+	subkey.Sig.FlagEncryptStorage = flags&packet.KeyFlagEncryptStorage != 0
+	subkey.Sig.FlagAuthenticate = flags&packet.KeyFlagAuthenticate != 0
+
+	if subkey.Sig.FlagSign {
+		subkey.Sig.EmbeddedSignature = createSignaturePacket(subkey.PublicKey, packet.SigTypePrimaryKeyBinding, config)
+		subkey.Sig.EmbeddedSignature.CreationTime = creationTime
+		err := subkey.Sig.EmbeddedSignature.CrossSignKey(subkey.PublicKey, e.PrimaryKey, subkey.PrivateKey, config)
+		if err != nil {
+			return err
+		}
+	}
 
-	err = subkey.Sig.SignKey(subkey.PublicKey, e.PrivateKey, config)
+	err := subkey.Sig.SignKey(subkey.PublicKey, e.PrivateKey, config)
 	if err != nil {
 		return err
 	}
@@ -229,6 +473,9 @@ func (e *Entity) addEncryptionSubkey(config *packet.Config, creationTime time.Ti
 
 // Generates a signing key
 func newSigner(config *packet.Config) (signer interface{}, err error) {
+	if err := packet.CheckKeyAlgorithm(keyVersion(config), config.PublicKeyAlgorithm(), config.CurveName()); err != nil {
+		return nil, err
+	}
 	switch config.PublicKeyAlgorithm() {
 	case packet.PubKeyAlgoRSA:
 		bits := config.RSAModulusBits()
@@ -270,6 +517,13 @@ func newSigner(config *packet.Config) (signer interface{}, err error) {
 
 // Generates an encryption/decryption key
 func newDecrypter(config *packet.Config) (decrypter interface{}, err error) {
+	algo := config.PublicKeyAlgorithm()
+	if algo == packet.PubKeyAlgoEdDSA || algo == packet.PubKeyAlgoECDSA {
+		algo = packet.PubKeyAlgoECDH
+	}
+	if err := packet.CheckKeyAlgorithm(keyVersion(config), algo, config.CurveName()); err != nil {
+		return nil, err
+	}
 	switch config.PublicKeyAlgorithm() {
 	case packet.PubKeyAlgoRSA:
 		bits := config.RSAModulusBits()
@@ -299,6 +553,14 @@ func newDecrypter(config *packet.Config) (decrypter interface{}, err error) {
 	}
 }
 
+// keyVersion returns the version of the keys generated with config.
+func keyVersion(config *packet.Config) int {
+	if config != nil && config.V5Keys {
+		return 5
+	}
+	return 4
+}
+
 var bigOne = big.NewInt(1)
 
 // generateRSAKeyWithPrimes generates a multi-prime RSA keypair of the
@@ -0,0 +1,353 @@
+package openpgp
+
+import (
+	"crypto"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// An EntityOption configures the Entity generated by NewEntityWithOptions.
+type EntityOption func(*entityOptions)
+
+type entityUserId struct {
+	name, comment, email string
+}
+
+type keyAlgorithm struct {
+	algorithm packet.PublicKeyAlgorithm
+	curve     packet.Curve
+	rsaBits   int
+}
+
+type subkeyOptions struct {
+	keyAlgorithm
+	flags    int
+	lifetime time.Duration
+}
+
+// A KeySpec describes a key of an Entity generated by NewEntityWithOptions,
+// see WithPrimaryKeySpec and WithSubkeySpec.
+type KeySpec struct {
+	// Algorithm is the public key algorithm of the key, and Curve its curve
+	// for elliptic curve algorithms.
+	Algorithm packet.PublicKeyAlgorithm
+	Curve     packet.Curve
+	// RSABits is the size of RSA keys. If zero, the RSABits of the config
+	// is used.
+	RSABits int
+	// Flags is the combination of packet.KeyFlag* values of a subkey. It is
+	// ignored for the primary key, which can always certify and sign.
+	Flags int
+	// Lifetime is the lifetime of the key. If zero, the primary key has the
+	// KeyLifetimeSecs of the config, and a subkey has the SubkeyLifetimeSecs
+	// of the config, or does not expire before the primary key if it is not
+	// set. NewEntityWithOptions fails if it is negative or longer than
+	// 2^32-1 seconds, about 136 years.
+	Lifetime time.Duration
+}
+
+type entityOptions struct {
+	userIds       []entityUserId
+	withoutUserId bool
+	directKeySig  bool
+	primary       *keyAlgorithm
+	primarySigner crypto.Signer
+	subkeys       []subkeyOptions
+	keyLifetime   *time.Duration
+	notations     []*packet.Notation
+	policyURI     string
+	signOnly      bool
+}
+
+// WithUserId adds an identity composed of the given full name, comment and
+// email, any of which may be empty but must not contain any of "()<>\x00".
+// It may be given several times; the first identity is marked as primary.
+func WithUserId(name, comment, email string) EntityOption {
+	return func(o *entityOptions) {
+		o.userIds = append(o.userIds, entityUserId{name, comment, email})
+	}
+}
+
+// WithoutUserID generates an entity without any identity. The properties of
+// the primary key (key flags, preferences and expiration) are then carried by
+// a direct-key self-signature, stored in Entity.SelfSignature.
+func WithoutUserID() EntityOption {
+	return func(o *entityOptions) {
+		o.withoutUserId = true
+	}
+}
+
+// WithDirectKeySignature stores the properties of the primary key (key
+// flags, preferences, features and expiration) in a direct-key self-signature,
+// stored in Entity.SelfSignature, as RFC 9580 does for version 6 keys. The
+// self-signatures of the identities then only carry their key flags and
+// expiration, and the preferences are looked up on the direct-key
+// self-signature, see Entity.Preferences.
+func WithDirectKeySignature() EntityOption {
+	return func(o *entityOptions) {
+		o.directKeySig = true
+	}
+}
+
+// WithPrimaryAlgorithm selects the public key algorithm, and the curve for
+// elliptic curve algorithms, of the primary key, overriding the Algorithm and
+// Curve of the config. The algorithm must be able to sign.
+func WithPrimaryAlgorithm(algorithm packet.PublicKeyAlgorithm, curve packet.Curve) EntityOption {
+	return func(o *entityOptions) {
+		o.primary = &keyAlgorithm{algorithm, curve, 0}
+	}
+}
+
+// WithPrimarySigner uses signer as the primary key instead of generating
+// one, for primary keys held in an HSM or a KMS. The public key of signer
+// must be an *rsa.PublicKey, an *ecdsa.PublicKey or an ed25519.PublicKey;
+// the self-signatures of the entity are made by signer, see
+// packet.NewExternalSignerPrivateKey. The private key of the resulting
+// entity cannot be serialized. Subkeys are still generated locally.
+func WithPrimarySigner(signer crypto.Signer) EntityOption {
+	return func(o *entityOptions) {
+		o.primarySigner = signer
+	}
+}
+
+// WithPrimaryKeySpec selects the algorithm, the size for RSA keys and the
+// lifetime of the primary key, overriding the config. The algorithm must be
+// able to sign.
+func WithPrimaryKeySpec(spec KeySpec) EntityOption {
+	return func(o *entityOptions) {
+		o.primary = &keyAlgorithm{spec.Algorithm, spec.Curve, spec.RSABits}
+		if spec.Lifetime != 0 {
+			lifetime := spec.Lifetime
+			o.keyLifetime = &lifetime
+		}
+	}
+}
+
+// WithSubkey adds a subkey of the given algorithm and curve, with the given
+// combination of packet.KeyFlag* values. Signing subkeys are cross-signed.
+// It may be given several times. If no subkey is requested, a single
+// encryption subkey of the primary key's algorithm family is generated, as
+// in NewEntity.
+func WithSubkey(algorithm packet.PublicKeyAlgorithm, curve packet.Curve, flags int) EntityOption {
+	return func(o *entityOptions) {
+		o.subkeys = append(o.subkeys, subkeyOptions{keyAlgorithm{algorithm, curve, 0}, flags, 0})
+	}
+}
+
+// WithSubkeySpec adds a subkey described by spec, with its own algorithm,
+// size for RSA keys, usages and lifetime. Signing subkeys are cross-signed.
+// It may be given several times, along with WithSubkey.
+func WithSubkeySpec(spec KeySpec) EntityOption {
+	return func(o *entityOptions) {
+		o.subkeys = append(o.subkeys, subkeyOptions{
+			keyAlgorithm: keyAlgorithm{spec.Algorithm, spec.Curve, spec.RSABits},
+			flags:        spec.Flags,
+			lifetime:     spec.Lifetime,
+		})
+	}
+}
+
+// WithoutEncryptionSubkey generates an entity that cannot receive encrypted
+// messages: the default encryption subkey is not generated, and requesting a
+// subkey that can encrypt is an error.
+func WithoutEncryptionSubkey() EntityOption {
+	return func(o *entityOptions) {
+		o.signOnly = true
+	}
+}
+
+// WithExpiry sets the lifetime of the primary key, overriding the
+// KeyLifetimeSecs of the config. A zero lifetime means the key never expires.
+func WithExpiry(lifetime time.Duration) EntityOption {
+	return func(o *entityOptions) {
+		o.keyLifetime = &lifetime
+	}
+}
+
+// WithNotations adds the given notations to all the self-signatures created
+// with the entity, in addition to the SignatureNotations of the config.
+func WithNotations(notations ...*packet.Notation) EntityOption {
+	return func(o *entityOptions) {
+		o.notations = append(o.notations, notations...)
+	}
+}
+
+// WithPolicyURI sets the URI of the policy under which the self-signatures
+// created with the entity are issued, overriding the SignaturePolicyURI of
+// the config.
+func WithPolicyURI(uri string) EntityOption {
+	return func(o *entityOptions) {
+		o.policyURI = uri
+	}
+}
+
+// NewEntityWithOptions returns an Entity generated according to the given
+// options. Unlike NewEntity, it can create entities without identities or
+// with several identities, and subkeys with their own algorithms and usages,
+// in a single operation. At least one identity must be given with WithUserId,
+// unless WithoutUserID is used.
+// If config is nil, sensible defaults will be used.
+func NewEntityWithOptions(config *packet.Config, options ...EntityOption) (*Entity, error) {
+	o := new(entityOptions)
+	for _, option := range options {
+		option(o)
+	}
+	if o.withoutUserId && len(o.userIds) > 0 {
+		return nil, errors.InvalidArgumentError("user IDs given for an entity without user IDs")
+	}
+	if !o.withoutUserId && len(o.userIds) == 0 {
+		return nil, errors.InvalidArgumentError("no user ID given")
+	}
+	if o.signOnly {
+		for _, sub := range o.subkeys {
+			if sub.flags&(packet.KeyFlagEncryptCommunications|packet.KeyFlagEncryptStorage) != 0 {
+				return nil, errors.InvalidArgumentError("encryption subkey requested for a sign-only entity")
+			}
+		}
+	}
+
+	creationTime := config.Now()
+	var err error
+	keyLifetimeSecs := config.KeyLifetime()
+	if o.keyLifetime != nil {
+		if keyLifetimeSecs, err = lifetimeToSecs(*o.keyLifetime); err != nil {
+			return nil, err
+		}
+	}
+	subkeyLifetimeSecs := make([]uint32, len(o.subkeys))
+	for i, sub := range o.subkeys {
+		if subkeyLifetimeSecs[i], err = lifetimeToSecs(sub.lifetime); err != nil {
+			return nil, err
+		}
+	}
+
+	primaryConfig := o.keyConfig(config, o.primary)
+	var primary *packet.PrivateKey
+	if o.primarySigner != nil {
+		if o.primary != nil {
+			return nil, errors.InvalidArgumentError("primary key algorithm given for an external primary key")
+		}
+		primary, err = packet.NewExternalSignerPrivateKey(creationTime, o.primarySigner)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		primaryPrivRaw, err := newSigner(primaryConfig)
+		syncRSAPrimes(config, primaryConfig)
+		if err != nil {
+			return nil, err
+		}
+		primary = packet.NewSignerPrivateKey(creationTime, primaryPrivRaw)
+	}
+	if config != nil && config.V5Keys {
+		primary.UpgradeToV5()
+	}
+
+	e := &Entity{
+		PrimaryKey: &primary.PublicKey,
+		PrivateKey: primary,
+		Identities: make(map[string]*Identity),
+		Subkeys:    []Subkey{},
+	}
+
+	if o.withoutUserId || o.directKeySig {
+		if err = e.addDirectKeySelfSignature(primaryConfig, creationTime, keyLifetimeSecs); err != nil {
+			return nil, err
+		}
+	}
+	// Entities with a direct-key self-signature advertise their preferences
+	// there only, as version 6 keys do (RFC 9580, section 5.2.3.10).
+	for _, uid := range o.userIds {
+		if err = e.addUserId(uid.name, uid.comment, uid.email, primaryConfig, creationTime, keyLifetimeSecs, !o.directKeySig); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(o.subkeys) == 0 && !o.signOnly {
+		// NOTE: No key expiry here unless SubkeyLifetimeSecs is set, as in
+		// NewEntity.
+		subConfig := o.keyConfig(config, o.primary)
+		err = e.addEncryptionSubkey(subConfig, creationTime, config.SubkeyLifetime())
+		syncRSAPrimes(config, subConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for i, sub := range o.subkeys {
+		subConfig := o.keyConfig(config, &sub.keyAlgorithm)
+		lifetimeSecs := subkeyLifetimeSecs[i]
+		if lifetimeSecs == 0 {
+			lifetimeSecs = config.SubkeyLifetime()
+		}
+		err = e.generateSubkey(subConfig, creationTime, lifetimeSecs, sub.flags)
+		syncRSAPrimes(config, subConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// addDirectKeySelfSignature creates the direct-key self-signature carrying
+// the properties of the primary key.
+func (e *Entity) addDirectKeySelfSignature(config *packet.Config, creationTime time.Time, keyLifetimeSecs uint32) error {
+	selfSignature := createSignaturePacket(e.PrimaryKey, packet.SigTypeDirectSignature, config)
+	selfSignature.CreationTime = creationTime
+	selfSignature.KeyLifetimeSecs = &keyLifetimeSecs
+	selfSignature.FlagsValid = true
+	selfSignature.FlagSign = true
+	selfSignature.FlagCertify = true
+	if err := setSelfSignaturePreferences(selfSignature, e.PrimaryKey, config); err != nil {
+		return err
+	}
+	if err := selfSignature.SignDirectKeySignature(e.PrimaryKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+	e.SelfSignature = selfSignature
+	e.Signatures = append(e.Signatures, selfSignature)
+	return nil
+}
+
+// keyConfig returns the config used to generate and bind a key of the given
+// algorithm, or of the algorithm of config if k is nil. It is a copy of config
+// if k, any notation or a policy URI is given, and config itself otherwise.
+func (o *entityOptions) keyConfig(config *packet.Config, k *keyAlgorithm) *packet.Config {
+	if k == nil && len(o.notations) == 0 && o.policyURI == "" {
+		return config
+	}
+	c := copyConfig(config)
+	if k != nil {
+		c.Algorithm = k.algorithm
+		c.Curve = k.curve
+		if k.rsaBits != 0 {
+			c.RSABits = k.rsaBits
+		}
+	}
+	if len(o.notations) > 0 {
+		c.SignatureNotations = append(append([]*packet.Notation(nil), config.Notations()...), o.notations...)
+	}
+	if o.policyURI != "" {
+		c.SignaturePolicyURI = o.policyURI
+	}
+	return c
+}
+
+// syncRSAPrimes propagates the prepopulated RSA primes consumed through
+// keyConfig, a copy of config, back to config.
+func syncRSAPrimes(config, keyConfig *packet.Config) {
+	if config != nil && config != keyConfig {
+		config.RSAPrimes = keyConfig.RSAPrimes
+	}
+}
+
+// copyConfig returns a shallow copy of config, which may be nil.
+func copyConfig(config *packet.Config) *packet.Config {
+	if config == nil {
+		return new(packet.Config)
+	}
+	c := *config
+	return &c
+}
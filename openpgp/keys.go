@@ -5,11 +5,11 @@
 package openpgp
 
 import (
+	"bytes"
 	goerrors "errors"
 	"io"
 	"time"
 
-	"github.com/ProtonMail/go-crypto/openpgp/armor"
 	"github.com/ProtonMail/go-crypto/openpgp/errors"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
 )
@@ -21,14 +21,22 @@ var PublicKeyType = "PGP PUBLIC KEY BLOCK"
 var PrivateKeyType = "PGP PRIVATE KEY BLOCK"
 
 // An Entity represents the components of an OpenPGP key: a primary public key
-// (which must be a signing key), one or more identities claimed by that key,
+// (which must be a signing key), zero or more identities claimed by that key,
 // and zero or more subkeys, which may be encryption keys.
 type Entity struct {
-	PrimaryKey  *packet.PublicKey
-	PrivateKey  *packet.PrivateKey
-	Identities  map[string]*Identity // indexed by Identity.Name
-	Revocations []*packet.Signature
-	Subkeys     []Subkey
+	PrimaryKey    *packet.PublicKey
+	PrivateKey    *packet.PrivateKey
+	Identities    map[string]*Identity // indexed by Identity.Name
+	Revocations   []*packet.Signature
+	SelfSignature *packet.Signature   // direct-key self-signature, carrying the primary key properties of entities without identities
+	Signatures    []*packet.Signature // all (potentially unverified) direct-key signatures
+	Subkeys       []Subkey
+	// UserAttributes holds the user attributes, such as photo IDs, that
+	// carry a valid self-signature.
+	UserAttributes []*UserAttribute
+	// UnknownPackets holds the packets of unknown types that follow the
+	// primary key, if the entity was read with Config.PreserveUnknownPackets.
+	UnknownPackets []*packet.OpaquePacket
 }
 
 // An Identity represents an identity claimed by an Entity and zero or more
@@ -39,6 +47,9 @@ type Identity struct {
 	SelfSignature *packet.Signature
 	Revocations   []*packet.Signature
 	Signatures    []*packet.Signature // all (potentially unverified) self-signatures, revocations, and third-party signatures
+	// UnknownPackets holds the packets of unknown types that follow the
+	// user ID, if the entity was read with Config.PreserveUnknownPackets.
+	UnknownPackets []*packet.OpaquePacket
 }
 
 // A Subkey is an additional public key in an Entity. Subkeys can be used for
@@ -48,6 +59,9 @@ type Subkey struct {
 	PrivateKey  *packet.PrivateKey
 	Sig         *packet.Signature
 	Revocations []*packet.Signature
+	// UnknownPackets holds the packets of unknown types that follow the
+	// subkey, if the entity was read with Config.PreserveUnknownPackets.
+	UnknownPackets []*packet.OpaquePacket
 }
 
 // A Key identifies a specific public key in an Entity. This is either the
@@ -86,6 +100,18 @@ func (e *Entity) PrimaryIdentity() *Identity {
 	return primaryIdentity
 }
 
+// primarySelfSignature returns the self-signature that carries the
+// properties of the primary key, and the identity it belongs to. This is the
+// self-signature of the primary identity or, for entities without
+// identities, the direct-key self-signature, in which case the returned
+// identity is nil.
+func (e *Entity) primarySelfSignature() (*packet.Signature, *Identity) {
+	if i := e.PrimaryIdentity(); i != nil {
+		return i.SelfSignature, i
+	}
+	return e.SelfSignature, nil
+}
+
 func shouldPreferIdentity(existingId, potentialNewId *Identity) bool {
 	if existingId == nil {
 		return true
@@ -120,12 +146,12 @@ func shouldPreferIdentity(existingId, potentialNewId *Identity) bool {
 // given Entity.
 func (e *Entity) EncryptionKey(now time.Time) (Key, bool) {
 	// Fail to find any encryption key if the...
-	i := e.PrimaryIdentity()
-	if e.PrimaryKey.KeyExpired(i.SelfSignature, now) || // primary key has expired
-		i.SelfSignature == nil || // user ID has no self-signature
-		i.SelfSignature.SigExpired(now) || // user ID self-signature has expired
+	selfSig, i := e.primarySelfSignature()
+	if selfSig == nil || // user ID or primary key has no self-signature
+		e.PrimaryKey.KeyExpired(selfSig, now) || // primary key has expired
+		selfSig.SigExpired(now) || // self-signature has expired
 		e.Revoked(now) || // primary key has been revoked
-		i.Revoked(now) { // user ID has been revoked
+		(i != nil && i.Revoked(now)) { // user ID has been revoked
 		return Key{}, false
 	}
 
@@ -152,24 +178,35 @@ func (e *Entity) EncryptionKey(now time.Time) (Key, bool) {
 
 	// If we don't have any subkeys for encryption and the primary key
 	// is marked as OK to encrypt with, then we can use it.
-	if i.SelfSignature.FlagsValid && i.SelfSignature.FlagEncryptCommunications &&
+	if selfSig.FlagsValid && selfSig.FlagEncryptCommunications &&
 		e.PrimaryKey.PubKeyAlgo.CanEncrypt() {
-		return Key{e, e.PrimaryKey, e.PrivateKey, i.SelfSignature, e.Revocations}, true
+		return Key{e, e.PrimaryKey, e.PrivateKey, selfSig, e.Revocations}, true
 	}
 
 	return Key{}, false
 }
 
 // CertificationKey return the best candidate Key for certifying a key with this
-// Entity.
+// Entity. As certifications must be made by primary keys, this is the primary
+// key, if it can certify.
 func (e *Entity) CertificationKey(now time.Time) (Key, bool) {
 	return e.CertificationKeyById(now, 0)
 }
 
 // CertificationKeyById return the Key for key certification with this
-// Entity and keyID.
+// Entity and keyID. As certifications must be made by primary keys, this is
+// the primary key, if it can certify and has the given keyID.
 func (e *Entity) CertificationKeyById(now time.Time, id uint64) (Key, bool) {
-	return e.signingKeyByIdUsage(now, id, packet.KeyFlagCertify)
+	return e.certificationKeyById(now, id, nil)
+}
+
+// certificationKeyById returns the Key for key certification with this
+// Entity and keyID, which is a subkey only if config allows it.
+func (e *Entity) certificationKeyById(now time.Time, id uint64, config *packet.Config) (Key, bool) {
+	if config.SubkeyCertificationsAllowed() {
+		return e.signingKeyByIdUsage(now, id, packet.KeyFlagCertify)
+	}
+	return e.primarySigningKeyByIdUsage(now, id, packet.KeyFlagCertify)
 }
 
 // SigningKey return the best candidate Key for signing a message with this
@@ -184,14 +221,39 @@ func (e *Entity) SigningKeyById(now time.Time, id uint64) (Key, bool) {
 	return e.signingKeyByIdUsage(now, id, packet.KeyFlagSign)
 }
 
+// AuthenticationKey returns the best candidate Key for authenticating with
+// this Entity, for instance over SSH: the newest valid key with the
+// authentication flag, preferably a subkey.
+func (e *Entity) AuthenticationKey(now time.Time) (Key, bool) {
+	return e.signingKeyByIdUsage(now, 0, packet.KeyFlagAuthenticate)
+}
+
+// CanSign returns whether e can sign messages at the given time: it must have
+// a valid signing key whose private key is available, that is neither a
+// dummy key nor encrypted.
+func (e *Entity) CanSign(now time.Time) bool {
+	key, ok := e.SigningKey(now)
+	return ok && key.PrivateKey != nil && !key.PrivateKey.Dummy() && !key.PrivateKey.Encrypted
+}
+
 func (e *Entity) signingKeyByIdUsage(now time.Time, id uint64, flags int) (Key, bool) {
+	return e.keyByIdUsage(now, id, flags, true)
+}
+
+// primarySigningKeyByIdUsage is like signingKeyByIdUsage, but never returns a
+// subkey.
+func (e *Entity) primarySigningKeyByIdUsage(now time.Time, id uint64, flags int) (Key, bool) {
+	return e.keyByIdUsage(now, id, flags, false)
+}
+
+func (e *Entity) keyByIdUsage(now time.Time, id uint64, flags int, allowSubkeys bool) (Key, bool) {
 	// Fail to find any signing key if the...
-	i := e.PrimaryIdentity()
-	if e.PrimaryKey.KeyExpired(i.SelfSignature, now) || // primary key has expired
-		i.SelfSignature == nil || // user ID has no self-signature
-		i.SelfSignature.SigExpired(now) || // user ID self-signature has expired
+	selfSig, i := e.primarySelfSignature()
+	if selfSig == nil || // user ID or primary key has no self-signature
+		e.PrimaryKey.KeyExpired(selfSig, now) || // primary key has expired
+		selfSig.SigExpired(now) || // self-signature has expired
 		e.Revoked(now) || // primary key has been revoked
-		i.Revoked(now) { // user ID has been revoked
+		(i != nil && i.Revoked(now)) { // user ID has been revoked
 		return Key{}, false
 	}
 
@@ -199,9 +261,11 @@ func (e *Entity) signingKeyByIdUsage(now time.Time, id uint64, flags int) (Key,
 	candidateSubkey := -1
 	var maxTime time.Time
 	for idx, subkey := range e.Subkeys {
-		if subkey.Sig.FlagsValid &&
+		if allowSubkeys &&
+			subkey.Sig.FlagsValid &&
 			(flags&packet.KeyFlagCertify == 0 || subkey.Sig.FlagCertify) &&
 			(flags&packet.KeyFlagSign == 0 || subkey.Sig.FlagSign) &&
+			(flags&packet.KeyFlagAuthenticate == 0 || subkey.Sig.FlagAuthenticate) &&
 			subkey.PublicKey.PubKeyAlgo.CanSign() &&
 			!subkey.PublicKey.KeyExpired(subkey.Sig, now) &&
 			!subkey.Sig.SigExpired(now) &&
@@ -220,12 +284,13 @@ func (e *Entity) signingKeyByIdUsage(now time.Time, id uint64, flags int) (Key,
 
 	// If we don't have any subkeys for signing and the primary key
 	// is marked as OK to sign with, then we can use it.
-	if i.SelfSignature.FlagsValid &&
-		(flags&packet.KeyFlagCertify == 0 || i.SelfSignature.FlagCertify) &&
-		(flags&packet.KeyFlagSign == 0 || i.SelfSignature.FlagSign) &&
+	if selfSig.FlagsValid &&
+		(flags&packet.KeyFlagCertify == 0 || selfSig.FlagCertify) &&
+		(flags&packet.KeyFlagSign == 0 || selfSig.FlagSign) &&
+		(flags&packet.KeyFlagAuthenticate == 0 || selfSig.FlagAuthenticate) &&
 		e.PrimaryKey.PubKeyAlgo.CanSign() &&
 		(id == 0 || e.PrimaryKey.KeyId == id) {
-		return Key{e, e.PrimaryKey, e.PrivateKey, i.SelfSignature, e.Revocations}, true
+		return Key{e, e.PrimaryKey, e.PrivateKey, selfSig, e.Revocations}, true
 	}
 
 	// No keys with a valid Signing Flag or no keys matched the id passed in
@@ -290,6 +355,41 @@ func (e *Entity) DecryptPrivateKeys(passphrase []byte) error {
 	return packet.DecryptPrivateKeys(keysToDecrypt, passphrase)
 }
 
+// ChangePassphrase decrypts the private primary key and subkeys of the
+// entity with oldPassphrase, and encrypts them with newPassphrase, using the
+// S2K function and cipher of config. Keys that are not encrypted are
+// encrypted as well. Public keys and dummy keys are ignored. If an error is
+// returned, the keys are left unchanged.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) ChangePassphrase(oldPassphrase, newPassphrase []byte, config *packet.Config) error {
+	var keys []*packet.PrivateKey
+	if e.PrivateKey != nil && !e.PrivateKey.Dummy() {
+		keys = append(keys, e.PrivateKey)
+	}
+	for _, sub := range e.Subkeys {
+		if sub.PrivateKey != nil && !sub.PrivateKey.Dummy() {
+			keys = append(keys, sub.PrivateKey)
+		}
+	}
+
+	// The keys are re-encrypted as copies, which replace them on success.
+	copies := make([]*packet.PrivateKey, len(keys))
+	for i, key := range keys {
+		c := *key
+		copies[i] = &c
+	}
+	if err := packet.DecryptPrivateKeys(copies, oldPassphrase); err != nil {
+		return err
+	}
+	if err := packet.EncryptPrivateKeys(copies, newPassphrase, config); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		*key = *copies[i]
+	}
+	return nil
+}
+
 // Revoked returns whether the identity has been revoked by a self-signature.
 // Note that third-party revocation signatures are not supported.
 func (i *Identity) Revoked(now time.Time) bool {
@@ -318,8 +418,7 @@ type EntityList []*Entity
 func (el EntityList) KeysById(id uint64) (keys []Key) {
 	for _, e := range el {
 		if e.PrimaryKey.KeyId == id {
-			ident := e.PrimaryIdentity()
-			selfSig := ident.SelfSignature
+			selfSig, _ := e.primarySelfSignature()
 			keys = append(keys, Key{e, e.PrimaryKey, e.PrivateKey, selfSig, e.Revocations})
 		}
 
@@ -377,26 +476,33 @@ func (el EntityList) DecryptionKeys() (keys []Key) {
 	return
 }
 
-// ReadArmoredKeyRing reads one or more public/private keys from an armor keyring file.
+// ReadArmoredKeyRing reads one or more public/private keys from an armor
+// keyring file, which may contain several concatenated armored blocks, see
+// ReadArmoredKeyRingBlocks. An error is only returned if no key could be
+// read, in which case it is the error of the first block.
 func ReadArmoredKeyRing(r io.Reader) (EntityList, error) {
-	block, err := armor.Decode(r)
-	if err == io.EOF {
-		return nil, errors.InvalidArgumentError("no armored data found")
-	}
+	el, blockErrors, err := ReadArmoredKeyRingBlocks(r)
 	if err != nil {
 		return nil, err
 	}
-	if block.Type != PublicKeyType && block.Type != PrivateKeyType {
-		return nil, errors.InvalidArgumentError("expected public or private key block, got: " + block.Type)
+	if len(el) == 0 && len(blockErrors) > 0 {
+		return nil, blockErrors[0].Err
 	}
-
-	return ReadKeyRing(block.Body)
+	return el, nil
 }
 
 // ReadKeyRing reads one or more public/private keys. Unsupported keys are
 // ignored as long as at least a single valid key is found.
 func ReadKeyRing(r io.Reader) (el EntityList, err error) {
-	packets := packet.NewReader(r)
+	return ReadKeyRingWithConfig(r, nil)
+}
+
+// ReadKeyRingWithConfig reads one or more public/private keys, like
+// ReadKeyRing, from a packet reader created with the given config. This allows
+// for instance preserving the packets of unknown types, see
+// packet.Config.PreserveUnknownPackets.
+func ReadKeyRingWithConfig(r io.Reader, config *packet.Config) (el EntityList, err error) {
+	packets := packet.NewReaderWithConfig(r, config)
 	var lastUnsupportedError error
 
 	for {
@@ -493,13 +599,15 @@ EachPacket:
 			if err := addUserID(e, packets, pkt); err != nil {
 				return nil, err
 			}
+		case *packet.UserAttribute:
+			if err := addUserAttribute(e, packets, pkt); err != nil {
+				return nil, err
+			}
 		case *packet.Signature:
 			if pkt.SigType == packet.SigTypeKeyRevocation {
 				revocations = append(revocations, pkt)
 			} else if pkt.SigType == packet.SigTypeDirectSignature {
-				// TODO: RFC4880 5.2.1 permits signatures
-				// directly on keys (eg. to bind additional
-				// revocation keys).
+				addDirectKeySignature(e, pkt)
 			}
 			// Else, ignoring the signature as it does not follow anything
 			// we would know to attach it to.
@@ -521,13 +629,15 @@ EachPacket:
 			if err != nil {
 				return nil, err
 			}
+		case *packet.OpaquePacket:
+			e.UnknownPackets = append(e.UnknownPackets, pkt)
 		default:
 			// we ignore unknown packets
 		}
 	}
 
-	if len(e.Identities) == 0 {
-		return nil, errors.StructuralError("entity without any identities")
+	if len(e.Identities) == 0 && e.SelfSignature == nil {
+		return nil, errors.StructuralError("entity without any identities or direct-key self-signature")
 	}
 
 	for _, revocation := range revocations {
@@ -543,6 +653,22 @@ EachPacket:
 	return e, nil
 }
 
+// addDirectKeySignature adds a direct-key signature to e. The latest valid
+// self-signature becomes the SelfSignature of e. Invalid self-signatures are
+// dropped rather than rejected, so that keys carrying direct-key signatures
+// that cannot be verified may still be read.
+func addDirectKeySignature(e *Entity, sig *packet.Signature) {
+	if sig.CheckKeyIdOrFingerprint(e.PrimaryKey) {
+		if err := e.PrimaryKey.VerifyDirectKeySignature(sig); err != nil {
+			return
+		}
+		if e.SelfSignature == nil || sig.CreationTime.After(e.SelfSignature.CreationTime) {
+			e.SelfSignature = sig
+		}
+	}
+	e.Signatures = append(e.Signatures, sig)
+}
+
 func addUserID(e *Entity, packets *packet.Reader, pkt *packet.UserId) error {
 	// Make a new Identity object, that we might wind up throwing away.
 	// We'll only add it if we get a valid self-signature over this
@@ -559,6 +685,11 @@ func addUserID(e *Entity, packets *packet.Reader, pkt *packet.UserId) error {
 			return err
 		}
 
+		if op, ok := p.(*packet.OpaquePacket); ok {
+			identity.UnknownPackets = append(identity.UnknownPackets, op)
+			continue
+		}
+
 		sig, ok := p.(*packet.Signature)
 		if !ok {
 			packets.Unread(p)
@@ -605,6 +736,11 @@ func addSubkey(e *Entity, packets *packet.Reader, pub *packet.PublicKey, priv *p
 			return errors.StructuralError("subkey signature invalid: " + err.Error())
 		}
 
+		if op, ok := p.(*packet.OpaquePacket); ok {
+			subKey.UnknownPackets = append(subKey.UnknownPackets, op)
+			continue
+		}
+
 		sig, ok := p.(*packet.Signature)
 		if !ok {
 			packets.Unread(p)
@@ -672,6 +808,21 @@ func (e *Entity) serializePrivate(w io.Writer, config *packet.Config, reSign boo
 			return err
 		}
 	}
+	if reSign && e.SelfSignature != nil {
+		err = e.SelfSignature.SignDirectKeySignature(e.PrimaryKey, e.PrivateKey, config)
+		if err != nil {
+			return
+		}
+	}
+	for _, sig := range e.Signatures {
+		err = sig.Serialize(w)
+		if err != nil {
+			return err
+		}
+	}
+	if err = serializeUnknownPackets(w, e.UnknownPackets); err != nil {
+		return err
+	}
 	for _, ident := range e.Identities {
 		err = ident.UserId.Serialize(w)
 		if err != nil {
@@ -692,6 +843,12 @@ func (e *Entity) serializePrivate(w io.Writer, config *packet.Config, reSign boo
 				return err
 			}
 		}
+		if err = serializeUnknownPackets(w, ident.UnknownPackets); err != nil {
+			return err
+		}
+	}
+	if err = e.serializeUserAttributes(w, config, reSign); err != nil {
+		return err
 	}
 	for _, subkey := range e.Subkeys {
 		err = subkey.PrivateKey.Serialize(w)
@@ -721,6 +878,9 @@ func (e *Entity) serializePrivate(w io.Writer, config *packet.Config, reSign boo
 		if err != nil {
 			return
 		}
+		if err = serializeUnknownPackets(w, subkey.UnknownPackets); err != nil {
+			return
+		}
 	}
 	return nil
 }
@@ -738,6 +898,15 @@ func (e *Entity) Serialize(w io.Writer) error {
 			return err
 		}
 	}
+	for _, sig := range e.Signatures {
+		err = sig.Serialize(w)
+		if err != nil {
+			return err
+		}
+	}
+	if err = serializeUnknownPackets(w, e.UnknownPackets); err != nil {
+		return err
+	}
 	for _, ident := range e.Identities {
 		err = ident.UserId.Serialize(w)
 		if err != nil {
@@ -749,6 +918,12 @@ func (e *Entity) Serialize(w io.Writer) error {
 				return err
 			}
 		}
+		if err = serializeUnknownPackets(w, ident.UnknownPackets); err != nil {
+			return err
+		}
+	}
+	if err = e.serializeUserAttributes(w, nil, false); err != nil {
+		return err
 	}
 	for _, subkey := range e.Subkeys {
 		err = subkey.PublicKey.Serialize(w)
@@ -765,6 +940,19 @@ func (e *Entity) Serialize(w io.Writer) error {
 		if err != nil {
 			return err
 		}
+		if err = serializeUnknownPackets(w, subkey.UnknownPackets); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// serializeUnknownPackets writes the preserved packets of unknown types to w.
+func serializeUnknownPackets(w io.Writer, packets []*packet.OpaquePacket) error {
+	for _, op := range packets {
+		if err := op.Serialize(w); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -775,41 +963,97 @@ func (e *Entity) Serialize(w io.Writer) error {
 // necessary.
 // If config is nil, sensible defaults will be used.
 func (e *Entity) SignIdentity(identity string, signer *Entity, config *packet.Config) error {
-	certificationKey, ok := signer.CertificationKey(config.Now())
+	_, err := signer.CertifyIdentity(e, identity, packet.SigTypeGenericCert, config)
+	return err
+}
+
+// CertifyIdentity makes a certification of type certType, from e, attesting
+// that identity is associated with target, and attaches it to the identity
+// of target. certType is one of packet.SigTypeGenericCert,
+// packet.SigTypePersonaCert, packet.SigTypeCasualCert and
+// packet.SigTypePositiveCert, which state how carefully the identity was
+// checked. The provided identity must already be an element of
+// target.Identities and the private key of e must have been decrypted if
+// necessary. Certifications can be checked with VerifyCertification.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) CertifyIdentity(target *Entity, identity string, certType packet.SignatureType, config *packet.Config) (*packet.Signature, error) {
+	return e.certifyIdentity(target, identity, certType, nil, config)
+}
+
+// certifyIdentity implements CertifyIdentity. If setup is not nil, it is
+// called to set the subpackets of the certification before it is signed.
+func (e *Entity) certifyIdentity(target *Entity, identity string, certType packet.SignatureType, setup func(*packet.Signature), config *packet.Config) (*packet.Signature, error) {
+	switch certType {
+	case packet.SigTypeGenericCert, packet.SigTypePersonaCert, packet.SigTypeCasualCert, packet.SigTypePositiveCert:
+	default:
+		return nil, errors.InvalidArgumentError("signature type is not a certification")
+	}
+
+	certificationKey, err := e.signingCertificationKey(config)
+	if err != nil {
+		return nil, err
+	}
+	return e.certifyIdentityWithKey(certificationKey, target, identity, certType, setup, config)
+}
+
+// signingCertificationKey returns the certification key of e, which must have
+// a decrypted private key.
+func (e *Entity) signingCertificationKey(config *packet.Config) (Key, error) {
+	certificationKey, ok := e.certificationKeyById(config.Now(), 0, config)
 	if !ok {
-		return errors.InvalidArgumentError("no valid certification key found")
+		return Key{}, errors.InvalidArgumentError("no valid certification key found")
 	}
 
+	if certificationKey.PrivateKey == nil {
+		return Key{}, errors.InvalidArgumentError("signing Entity doesn't have a private key")
+	}
+	if certificationKey.PrivateKey.Dummy() {
+		return Key{}, errors.ErrDummyPrivateKey("dummy certification key cannot sign")
+	}
 	if certificationKey.PrivateKey.Encrypted {
-		return errors.InvalidArgumentError("signing Entity's private key must be decrypted")
+		return Key{}, errors.InvalidArgumentError("signing Entity's private key must be decrypted")
 	}
+	return certificationKey, nil
+}
 
-	ident, ok := e.Identities[identity]
+// certifyIdentityWithKey implements certifyIdentity with the certification
+// key of e, as returned by signingCertificationKey.
+func (e *Entity) certifyIdentityWithKey(certificationKey Key, target *Entity, identity string, certType packet.SignatureType, setup func(*packet.Signature), config *packet.Config) (*packet.Signature, error) {
+	if target == nil {
+		return nil, errors.InvalidArgumentError("no target Entity")
+	}
+	ident, ok := target.Identities[identity]
 	if !ok {
-		return errors.InvalidArgumentError("given identity string not found in Entity")
+		return nil, errors.InvalidArgumentError("given identity string not found in Entity")
 	}
 
-	sig := createSignaturePacket(certificationKey.PublicKey, packet.SigTypeGenericCert, config)
+	sig := createSignaturePacket(certificationKey.PublicKey, certType, config)
 
 	signingUserID := config.SigningUserId()
 	if signingUserID != "" {
-		if _, ok := signer.Identities[signingUserID]; !ok {
-			return errors.InvalidArgumentError("signer identity string not found in signer Entity")
+		if _, ok := e.Identities[signingUserID]; !ok {
+			return nil, errors.InvalidArgumentError("signer identity string not found in signer Entity")
 		}
 		sig.SignerUserId = &signingUserID
 	}
+	if setup != nil {
+		setup(sig)
+	}
 
-	if err := sig.SignUserId(identity, e.PrimaryKey, certificationKey.PrivateKey, config); err != nil {
-		return err
+	if err := sig.SignUserId(identity, target.PrimaryKey, certificationKey.PrivateKey, config); err != nil {
+		return nil, err
 	}
 	ident.Signatures = append(ident.Signatures, sig)
-	return nil
+	return sig, nil
 }
 
 // RevokeKey generates a key revocation signature (packet.SigTypeKeyRevocation) with the
 // specified reason code and text (RFC4880 section-5.2.3.23).
 // If config is nil, sensible defaults will be used.
 func (e *Entity) RevokeKey(reason packet.ReasonForRevocation, reasonText string, config *packet.Config) error {
+	if err := checkPrimaryPrivateKey(e); err != nil {
+		return err
+	}
 	revSig := createSignaturePacket(e.PrimaryKey, packet.SigTypeKeyRevocation, config)
 	revSig.RevocationReason = &reason
 	revSig.RevocationReasonText = reasonText
@@ -828,6 +1072,9 @@ func (e *Entity) RevokeSubkey(sk *Subkey, reason packet.ReasonForRevocation, rea
 	if err := e.PrimaryKey.VerifyKeySignature(sk.PublicKey, sk.Sig); err != nil {
 		return errors.InvalidArgumentError("given subkey is not associated with this key")
 	}
+	if err := checkPrimaryPrivateKey(e); err != nil {
+		return err
+	}
 
 	revSig := createSignaturePacket(e.PrimaryKey, packet.SigTypeSubkeyRevocation, config)
 	revSig.RevocationReason = &reason
@@ -840,3 +1087,54 @@ func (e *Entity) RevokeSubkey(sk *Subkey, reason packet.ReasonForRevocation, rea
 	sk.Revocations = append(sk.Revocations, revSig)
 	return nil
 }
+
+// RemoveIdentity removes the identity with the given name, and all its
+// signatures, from e. The last identity of e can only be removed if e has a
+// direct-key self-signature, which then carries the properties of the
+// primary key.
+func (e *Entity) RemoveIdentity(name string) error {
+	if _, ok := e.Identities[name]; !ok {
+		return errors.InvalidArgumentError("identity not found: " + name)
+	}
+	if len(e.Identities) == 1 && e.SelfSignature == nil {
+		return errors.InvalidArgumentError("cannot remove the last identity of a key without a direct-key self-signature")
+	}
+	delete(e.Identities, name)
+	return nil
+}
+
+// RemoveSubkey removes the subkey with the given fingerprint, with its
+// binding signature and revocations, from e. If e is left without a valid
+// encryption key, a packet.WarningNoEncryptionKey warning is reported to
+// config.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) RemoveSubkey(fingerprint []byte, config *packet.Config) error {
+	for i, subkey := range e.Subkeys {
+		if !bytes.Equal(subkey.PublicKey.Fingerprint, fingerprint) {
+			continue
+		}
+		now := config.Now()
+		_, couldEncrypt := e.EncryptionKey(now)
+		e.Subkeys = append(e.Subkeys[:i], e.Subkeys[i+1:]...)
+		if _, canEncrypt := e.EncryptionKey(now); couldEncrypt && !canEncrypt {
+			config.Warn(packet.Warning{Kind: packet.WarningNoEncryptionKey, KeyId: subkey.PublicKey.KeyId})
+		}
+		return nil
+	}
+	return errors.InvalidArgumentError("subkey not found")
+}
+
+// checkPrimaryPrivateKey checks that the private primary key of e is
+// available to make signatures.
+func checkPrimaryPrivateKey(e *Entity) error {
+	if e.PrivateKey == nil {
+		return errors.InvalidArgumentError("private key is required to sign")
+	}
+	if e.PrivateKey.Dummy() {
+		return errors.ErrDummyPrivateKey("dummy private key cannot sign")
+	}
+	if e.PrivateKey.Encrypted {
+		return errors.InvalidArgumentError("private key must be decrypted to sign")
+	}
+	return nil
+}
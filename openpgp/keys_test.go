@@ -4,9 +4,14 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/dsa"
+	goecdsa "crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/big"
 	"strconv"
 	"strings"
@@ -20,6 +25,7 @@ import (
 	"github.com/ProtonMail/go-crypto/openpgp/elgamal"
 	"github.com/ProtonMail/go-crypto/openpgp/errors"
 	"github.com/ProtonMail/go-crypto/openpgp/internal/algorithm"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/ecc"
 	"github.com/ProtonMail/go-crypto/openpgp/packet"
 	"github.com/ProtonMail/go-crypto/openpgp/s2k"
 )
@@ -487,6 +493,45 @@ func TestDummyPrivateKey(t *testing.T) {
 	}
 }
 
+func TestDummyPrivateKeySigning(t *testing.T) {
+	keys, err := ReadArmoredKeyRing(bytes.NewBufferString(onlySubkeyNoPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entity := keys[0]
+	now := time.Now()
+	if !entity.CanSign(now) {
+		t.Error("expected the entity to sign with its subkey")
+	}
+
+	target, err := NewEntity("Golang Gopher", "Test", "no-reply@golang.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const id = "Golang Gopher (Test) <no-reply@golang.com>"
+	if _, ok := target.SignIdentity(id, entity, nil).(errors.ErrDummyPrivateKey); !ok {
+		t.Error("SignIdentity: expected an ErrDummyPrivateKey")
+	}
+	if _, ok := entity.RevokeKey(packet.NoReason, "", nil).(errors.ErrDummyPrivateKey); !ok {
+		t.Error("RevokeKey: expected an ErrDummyPrivateKey")
+	}
+
+	// Without its subkey, the entity can only sign with its dummy primary key.
+	entity.Subkeys = nil
+	if entity.CanSign(now) {
+		t.Error("expected the entity not to sign with a dummy key")
+	}
+	if _, ok := DetachSign(ioutil.Discard, entity, strings.NewReader("message"), nil).(errors.ErrDummyPrivateKey); !ok {
+		t.Error("DetachSign: expected an ErrDummyPrivateKey")
+	}
+	if _, err = Sign(ioutil.Discard, entity, nil, nil); err == nil {
+		t.Fatal("Sign: expected an error")
+	}
+	if _, ok := err.(errors.ErrDummyPrivateKey); !ok {
+		t.Errorf("Sign: expected an ErrDummyPrivateKey, got %v", err)
+	}
+}
+
 // TestExternallyRevokableKey attempts to load and parse a key with a third party revocation permission.
 func TestExternallyRevocableKey(t *testing.T) {
 	kring, err := ReadKeyRing(readerFromHex(subkeyUsageHex))
@@ -845,6 +890,58 @@ func TestNewEntityNilConfigPreferredHash(t *testing.T) {
 	}
 }
 
+func TestNewEntityEd448(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, Curve: packet.Curve448}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entity.PrimaryKey.PubKeyAlgo != packet.PubKeyAlgoEdDSA || entity.PrimaryKey.Curve() != packet.Curve448 {
+		t.Error("expected an Ed448 primary key")
+	}
+	if sub := entity.Subkeys[0].PublicKey; sub.PubKeyAlgo != packet.PubKeyAlgoECDH || sub.Curve() != packet.Curve448 {
+		t.Error("expected an X448 encryption subkey")
+	}
+	selfSig := entity.PrimaryIdentity().SelfSignature
+	if selfSig.Hash != crypto.SHA512 || entity.Subkeys[0].Sig.Hash != crypto.SHA512 {
+		t.Error("expected SHA-512 self-signatures")
+	}
+	want := []uint8{hashToHashId(crypto.SHA512)}
+	if !bytes.Equal(selfSig.PreferredHash, want) {
+		t.Errorf("got preferred hashes %v, want %v", selfSig.PreferredHash, want)
+	}
+
+	serialized := bytes.NewBuffer(nil)
+	if err = entity.SerializePrivate(serialized, nil); err != nil {
+		t.Fatal(err)
+	}
+	if entity, err = ReadEntity(packet.NewReader(serialized)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	w, err := Sign(buf, entity, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("message")); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ReadMessage(buf, EntityList{entity}, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatal(err)
+	}
+	if md.SignatureError != nil || md.Signature.Hash != crypto.SHA512 {
+		t.Errorf("unexpected signature: %v", md.SignatureError)
+	}
+}
+
 func TestNewEntityCorrectName(t *testing.T) {
 	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", nil)
 	if err != nil {
@@ -863,6 +960,43 @@ func TestNewEntityCorrectName(t *testing.T) {
 	}
 }
 
+func TestNewEntityUserIdValidation(t *testing.T) {
+	if _, err := NewEntity("Gopher, Golang (Go)", "", "no-reply@golang.com", nil); err == nil {
+		t.Fatal("expected an error with the default user id validation")
+	}
+	config := &packet.Config{UserIdValidation: packet.UserIdValidationLenient}
+	entity, err := NewEntity("Gopher, Golang (Go)", "", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `"Gopher, Golang (Go)" <no-reply@golang.com>`
+	if _, ok := entity.Identities[want]; !ok {
+		t.Fatalf("identity %q not found", want)
+	}
+	if err = entity.AddUserId("a<b", "Johnny (J)", "x@y.z", config); err != nil {
+		t.Fatal(err)
+	}
+
+	// The names and comments are unquoted and unescaped when read back.
+	var buf bytes.Buffer
+	if err = entity.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEntity(packet.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id, ident := range entity.Identities {
+		readIdent, ok := read.Identities[id]
+		if !ok {
+			t.Fatalf("identity %q not read back", id)
+		}
+		if *readIdent.UserId != *ident.UserId {
+			t.Errorf("read back %#v, want %#v", readIdent.UserId, ident.UserId)
+		}
+	}
+}
+
 func TestNewEntityWithDefaultCipher(t *testing.T) {
 	for _, cipher := range ciphers {
 		c := &packet.Config{
@@ -1124,6 +1258,80 @@ func TestAddSubkey(t *testing.T) {
 	}
 }
 
+func TestAddSubkeyWithFlags(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = entity.AddSubkey(config, packet.KeyFlagAuthenticate); err != nil {
+		t.Fatal(err)
+	}
+	auth := entity.Subkeys[len(entity.Subkeys)-1]
+	if !auth.Sig.FlagAuthenticate || auth.Sig.FlagSign || auth.Sig.FlagEncryptCommunications || auth.Sig.FlagEncryptStorage {
+		t.Error("expected an authentication-only subkey")
+	}
+	if auth.Sig.EmbeddedSignature != nil {
+		t.Error("authentication-only subkey should not be cross-signed")
+	}
+	if err = entity.PrimaryKey.VerifyKeySignature(auth.PublicKey, auth.Sig); err != nil {
+		t.Errorf("invalid subkey signature: %v", err)
+	}
+
+	if err = entity.AddSubkey(config, packet.KeyFlagSign|packet.KeyFlagAuthenticate); err != nil {
+		t.Fatal(err)
+	}
+	if sub := entity.Subkeys[len(entity.Subkeys)-1]; !sub.Sig.FlagSign || !sub.Sig.FlagAuthenticate || sub.Sig.EmbeddedSignature == nil {
+		t.Error("expected a cross-signed signing and authentication subkey")
+	}
+
+	if err = entity.AddSubkey(config, 0); err == nil {
+		t.Error("expected an error for a subkey without flags")
+	}
+	if err = entity.AddSubkey(config, packet.KeyFlagSign|packet.KeyFlagEncryptStorage); err == nil {
+		t.Error("expected an error for an EdDSA encryption subkey")
+	}
+}
+
+func TestAddAuthenticationSubkey(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entity.AuthenticationKey(time.Now()); ok {
+		t.Error("expected no authentication key before adding one")
+	}
+	if err = entity.AddAuthenticationSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+
+	serializedEntity := bytes.NewBuffer(nil)
+	if err = entity.SerializePrivate(serializedEntity, nil); err != nil {
+		t.Fatal(err)
+	}
+	entity, err = ReadEntity(packet.NewReader(serializedEntity))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, ok := entity.AuthenticationKey(time.Now())
+	if !ok {
+		t.Fatal("no authentication key found")
+	}
+	if !key.PublicKey.IsSubkey || key.PublicKey.PubKeyAlgo != packet.PubKeyAlgoEdDSA {
+		t.Error("expected an EdDSA authentication subkey")
+	}
+	if !key.SelfSignature.FlagsValid || !key.SelfSignature.FlagAuthenticate || key.SelfSignature.FlagSign ||
+		key.SelfSignature.FlagEncryptCommunications || key.SelfSignature.FlagEncryptStorage {
+		t.Error("expected the binding signature to only carry the authentication flag")
+	}
+	if signingKey, _ := entity.SigningKey(time.Now()); signingKey.PublicKey == key.PublicKey {
+		t.Error("authentication subkey used as a signing key")
+	}
+}
+
 func TestAddSubkeySerialized(t *testing.T) {
 	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", nil)
 	if err != nil {
@@ -1808,3 +2016,1181 @@ mQ00BF00000BCAD0000000000000000000000000000000000000000000000000
 000000000000000000000000000000000000ABE000G0Dn000000000000000000iQ00BB0BAgAGBCG00000`
 	ReadArmoredKeyRing(strings.NewReader(data))
 }
+
+func TestNewEntityWithOptions(t *testing.T) {
+	notation := &packet.Notation{
+		Name:            "test@example.com",
+		Value:           []byte("value"),
+		IsHumanReadable: true,
+	}
+	entity, err := NewEntityWithOptions(
+		nil,
+		WithUserId("Golang Gopher", "Test Key", "no-reply@golang.com"),
+		WithUserId("Golang Gopher", "", "gopher@golang.com"),
+		WithPrimaryAlgorithm(packet.PubKeyAlgoEdDSA, packet.Curve25519),
+		WithSubkey(packet.PubKeyAlgoECDH, packet.Curve25519, packet.KeyFlagEncryptCommunications|packet.KeyFlagEncryptStorage),
+		WithSubkey(packet.PubKeyAlgoECDSA, packet.CurveNistP256, packet.KeyFlagSign),
+		WithSubkey(packet.PubKeyAlgoEdDSA, packet.Curve25519, packet.KeyFlagAuthenticate),
+		WithExpiry(24*time.Hour),
+		WithNotations(notation),
+		WithPolicyURI("https://example.com/policy"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entity.Identities) != 2 {
+		t.Fatalf("expected 2 identities, got %d", len(entity.Identities))
+	}
+	if entity.PrimaryKey.PubKeyAlgo != packet.PubKeyAlgoEdDSA {
+		t.Errorf("unexpected primary key algorithm: %v", entity.PrimaryKey.PubKeyAlgo)
+	}
+	for _, ident := range entity.Identities {
+		if ident.SelfSignature.KeyLifetimeSecs == nil || *ident.SelfSignature.KeyLifetimeSecs != 24*60*60 {
+			t.Errorf("unexpected key lifetime for %s", ident.Name)
+		}
+		if len(ident.SelfSignature.Notations) != 1 || ident.SelfSignature.Notations[0].Name != notation.Name {
+			t.Errorf("missing notation for %s", ident.Name)
+		}
+		if ident.SelfSignature.PolicyURI != "https://example.com/policy" {
+			t.Errorf("missing policy URI for %s", ident.Name)
+		}
+	}
+
+	if len(entity.Subkeys) != 3 {
+		t.Fatalf("expected 3 subkeys, got %d", len(entity.Subkeys))
+	}
+	encSubkey, signSubkey, authSubkey := entity.Subkeys[0], entity.Subkeys[1], entity.Subkeys[2]
+	if encSubkey.PublicKey.PubKeyAlgo != packet.PubKeyAlgoECDH || !encSubkey.Sig.FlagEncryptCommunications || encSubkey.Sig.FlagSign {
+		t.Error("unexpected encryption subkey")
+	}
+	if signSubkey.PublicKey.PubKeyAlgo != packet.PubKeyAlgoECDSA || !signSubkey.Sig.FlagSign || signSubkey.Sig.EmbeddedSignature == nil {
+		t.Error("unexpected signing subkey")
+	}
+	if authSubkey.PublicKey.PubKeyAlgo != packet.PubKeyAlgoEdDSA || !authSubkey.Sig.FlagAuthenticate || authSubkey.Sig.FlagSign {
+		t.Error("unexpected authentication subkey")
+	}
+
+	if key, ok := entity.EncryptionKey(time.Now()); !ok || key.PublicKey.KeyId != encSubkey.PublicKey.KeyId {
+		t.Error("expected the encryption subkey to be used for encryption")
+	}
+	if key, ok := entity.SigningKey(time.Now()); !ok || key.PublicKey.KeyId != signSubkey.PublicKey.KeyId {
+		t.Error("expected the signing subkey to be used for signing")
+	}
+
+	serializedEntity := bytes.NewBuffer(nil)
+	if err := entity.SerializePrivate(serializedEntity, nil); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEntity(packet.NewReader(serializedEntity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Identities) != 2 || len(read.Subkeys) != 3 {
+		t.Errorf("unexpected entity after serialization: %d identities, %d subkeys", len(read.Identities), len(read.Subkeys))
+	}
+	if sig := read.PrimaryIdentity().SelfSignature; sig.PolicyURI != "https://example.com/policy" || len(sig.Notations) != 1 {
+		t.Error("expected the notation and policy URI to be serialized")
+	}
+}
+
+func TestNewEntityWithOptionsWithoutUserID(t *testing.T) {
+	entity, err := NewEntityWithOptions(
+		nil,
+		WithoutUserID(),
+		WithPrimaryAlgorithm(packet.PubKeyAlgoEdDSA, packet.Curve25519),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entity.Identities) != 0 {
+		t.Fatalf("expected no identity, got %d", len(entity.Identities))
+	}
+	if entity.SelfSignature == nil || entity.SelfSignature.SigType != packet.SigTypeDirectSignature {
+		t.Fatal("expected a direct-key self-signature")
+	}
+	if err := entity.PrimaryKey.VerifyDirectKeySignature(entity.SelfSignature); err != nil {
+		t.Fatalf("invalid direct-key self-signature: %s", err)
+	}
+
+	if _, ok := entity.EncryptionKey(time.Now()); !ok {
+		t.Error("expected an encryption key")
+	}
+	if key, ok := entity.SigningKey(time.Now()); !ok || key.PublicKey != entity.PrimaryKey {
+		t.Error("expected the primary key to be used for signing")
+	}
+
+	serializedEntity := bytes.NewBuffer(nil)
+	if err := entity.Serialize(serializedEntity); err != nil {
+		t.Fatal(err)
+	}
+	packets := packet.NewReader(serializedEntity)
+	var sawSignature bool
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sig, ok := p.(*packet.Signature); ok && sig.SigType == packet.SigTypeDirectSignature {
+			sawSignature = true
+		}
+	}
+	if !sawSignature {
+		t.Error("direct-key self-signature not serialized")
+	}
+}
+
+func TestNewEntityWithOptionsErrors(t *testing.T) {
+	if _, err := NewEntityWithOptions(nil); err == nil {
+		t.Error("expected an error without user ID")
+	}
+	if _, err := NewEntityWithOptions(nil, WithoutUserID(), WithUserId("Golang Gopher", "", "")); err == nil {
+		t.Error("expected an error with conflicting user ID options")
+	}
+	if _, err := NewEntityWithOptions(nil, WithUserId("Golang Gopher", "", ""), WithSubkey(packet.PubKeyAlgoEdDSA, packet.Curve25519, 0)); err == nil {
+		t.Error("expected an error for a subkey without flags")
+	}
+	if _, err := NewEntityWithOptions(nil, WithUserId("Golang Gopher", "", ""), WithSubkey(packet.PubKeyAlgoEdDSA, packet.Curve25519, packet.KeyFlagSign|packet.KeyFlagEncryptStorage)); err == nil {
+		t.Error("expected an error for a signing and encryption subkey of a signing-only algorithm")
+	}
+	tooLong := 200 * 365 * 24 * time.Hour
+	if _, err := NewEntityWithOptions(nil, WithUserId("Golang Gopher", "", ""), WithPrimaryKeySpec(KeySpec{Algorithm: packet.PubKeyAlgoEdDSA, Lifetime: tooLong})); err == nil {
+		t.Error("expected an error for a primary key lifetime out of range")
+	}
+	if _, err := NewEntityWithOptions(nil, WithUserId("Golang Gopher", "", ""), WithSubkeySpec(KeySpec{Algorithm: packet.PubKeyAlgoEdDSA, Flags: packet.KeyFlagSign, Lifetime: tooLong})); err == nil {
+		t.Error("expected an error for a subkey lifetime out of range")
+	}
+	if _, err := NewEntityWithOptions(nil, WithUserId("Golang Gopher", "", ""), WithExpiry(-time.Hour)); err == nil {
+		t.Error("expected an error for a negative lifetime")
+	}
+}
+
+func TestReadEntityWithoutUserID(t *testing.T) {
+	entity, err := NewEntityWithOptions(
+		nil,
+		WithoutUserID(),
+		WithPrimaryAlgorithm(packet.PubKeyAlgoEdDSA, packet.Curve25519),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serializedEntity := bytes.NewBuffer(nil)
+	if err := entity.SerializePrivate(serializedEntity, nil); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEntity(packet.NewReader(serializedEntity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Identities) != 0 || read.SelfSignature == nil || len(read.Signatures) != 1 {
+		t.Fatal("direct-key self-signature not read")
+	}
+
+	buf := new(bytes.Buffer)
+	w, err := Encrypt(buf, []*Entity{read}, read, nil /* no hints */, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const message = "testing"
+	if _, err = w.Write([]byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ReadMessage(buf, EntityList{read}, nil /* no prompt */, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != message {
+		t.Errorf("got: %s, want: %s", string(plaintext), message)
+	}
+	if md.SignatureError != nil || md.Signature == nil {
+		t.Errorf("invalid signature: %v", md.SignatureError)
+	}
+
+	entity.SelfSignature = nil
+	entity.Signatures = nil
+	serializedEntity.Reset()
+	if err := entity.Serialize(serializedEntity); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadEntity(packet.NewReader(serializedEntity)); err == nil {
+		t.Error("expected an error for an entity without identities or direct-key self-signature")
+	}
+}
+
+func TestNewEntityInvalidConfiguration(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoECDSA, Curve: packet.Curve25519}
+	_, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if _, ok := err.(errors.InvalidConfigurationError); !ok {
+		t.Errorf("expected InvalidConfigurationError, got: %v", err)
+	}
+}
+
+func TestReadEntityPreserveUnknownPackets(t *testing.T) {
+	entity, err := NewEntity("Golang Gopher", "Test", "no-reply@golang.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown := func(contents string) []*packet.OpaquePacket {
+		return []*packet.OpaquePacket{{Tag: 60, Contents: []byte(contents)}}
+	}
+	entity.UnknownPackets = unknown("primary key")
+	entity.Identities["Golang Gopher (Test) <no-reply@golang.com>"].UnknownPackets = unknown("user ID")
+	entity.Subkeys[0].UnknownPackets = unknown("subkey")
+
+	serialized := new(bytes.Buffer)
+	if err = entity.Serialize(serialized); err != nil {
+		t.Fatal(err)
+	}
+
+	el, err := ReadKeyRing(bytes.NewReader(serialized.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(el) != 1 || el[0].UnknownPackets != nil || len(el[0].Subkeys) != 1 || el[0].Subkeys[0].UnknownPackets != nil {
+		t.Fatal("unknown packets not skipped by default")
+	}
+
+	el, err = ReadKeyRingWithConfig(bytes.NewReader(serialized.Bytes()), &packet.Config{PreserveUnknownPackets: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(el) != 1 {
+		t.Fatalf("got %d entities, want 1", len(el))
+	}
+	reserialized := new(bytes.Buffer)
+	if err = el[0].Serialize(reserialized); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reserialized.Bytes(), serialized.Bytes()) {
+		t.Error("entity with unknown packets not re-serialized byte-for-byte")
+	}
+}
+
+func TestAddDerivedEncryptionSubkey(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := NewEntity("Golang Gopher", "Test", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := entity.AddDerivedEncryptionSubkey(config).(errors.InvalidArgumentError); !ok {
+		t.Fatal("derived a subkey without the config allowing it")
+	}
+	config.AllowDerivedEncryptionKeys = true
+	if err = entity.AddDerivedEncryptionSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+	subkey := entity.Subkeys[len(entity.Subkeys)-1]
+	if err = entity.PrimaryKey.VerifyKeySignature(subkey.PublicKey, subkey.Sig); err != nil {
+		t.Fatal(err)
+	}
+	if !subkey.Sig.FlagEncryptCommunications || !subkey.Sig.FlagEncryptStorage || subkey.Sig.FlagSign {
+		t.Error("wrong flags on the derived subkey")
+	}
+
+	// The public point is the image of the Ed25519 public key y under the
+	// birational map u = (1 + y) / (1 - y) mod 2^255 - 19.
+	edPoint := entity.PrimaryKey.PublicKey.(*eddsa.PublicKey).X
+	le := make([]byte, len(edPoint))
+	for i := range edPoint {
+		le[len(le)-1-i] = edPoint[i]
+	}
+	le[0] &= 0x7f
+	p := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	y := new(big.Int).SetBytes(le)
+	u := new(big.Int).Add(big.NewInt(1), y)
+	u.Mul(u, new(big.Int).ModInverse(new(big.Int).Sub(big.NewInt(1), y), p))
+	u.Mod(u, p)
+	montPoint := subkey.PublicKey.PublicKey.(*ecdh.PublicKey).Point
+	got := make([]byte, len(montPoint))
+	for i := range montPoint {
+		got[len(got)-1-i] = montPoint[i]
+	}
+	if new(big.Int).SetBytes(got).Cmp(u) != 0 {
+		t.Error("derived public point is not the image of the Ed25519 public key")
+	}
+
+	// The derivation is deterministic.
+	if err = entity.AddDerivedEncryptionSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(entity.Subkeys[len(entity.Subkeys)-1].PublicKey.PublicKey.(*ecdh.PublicKey).Point, montPoint) {
+		t.Error("derivation is not deterministic")
+	}
+
+	rsaEntity, err := NewEntity("Golang Gopher", "Test", "no-reply@golang.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rsaEntity.AddDerivedEncryptionSubkey(config).(errors.InvalidArgumentError); !ok {
+		t.Error("derived a subkey from an RSA key")
+	}
+}
+
+func TestNewEntityWithKeySpecs(t *testing.T) {
+	entity, err := NewEntityWithOptions(
+		nil,
+		WithUserId("Golang Gopher", "Test Key", "no-reply@golang.com"),
+		WithPrimaryKeySpec(KeySpec{Algorithm: packet.PubKeyAlgoEdDSA, Curve: packet.Curve25519, Lifetime: 48 * time.Hour}),
+		WithSubkeySpec(KeySpec{
+			Algorithm: packet.PubKeyAlgoECDH,
+			Curve:     packet.Curve25519,
+			Flags:     packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage,
+			Lifetime:  24 * time.Hour,
+		}),
+		WithSubkeySpec(KeySpec{
+			Algorithm: packet.PubKeyAlgoRSA,
+			RSABits:   1024,
+			Flags:     packet.KeyFlagSign,
+			Lifetime:  12 * time.Hour,
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entity.PrimaryKey.PubKeyAlgo != packet.PubKeyAlgoEdDSA {
+		t.Errorf("unexpected primary key algorithm: %v", entity.PrimaryKey.PubKeyAlgo)
+	}
+	if lifetime := entity.PrimaryIdentity().SelfSignature.KeyLifetimeSecs; lifetime == nil || *lifetime != 48*60*60 {
+		t.Error("unexpected primary key lifetime")
+	}
+	if len(entity.Subkeys) != 2 {
+		t.Fatalf("expected 2 subkeys, got %d", len(entity.Subkeys))
+	}
+	encSubkey, signSubkey := entity.Subkeys[0], entity.Subkeys[1]
+	if encSubkey.PublicKey.PubKeyAlgo != packet.PubKeyAlgoECDH || *encSubkey.Sig.KeyLifetimeSecs != 24*60*60 {
+		t.Error("unexpected encryption subkey")
+	}
+	if bits, _ := signSubkey.PublicKey.BitLength(); signSubkey.PublicKey.PubKeyAlgo != packet.PubKeyAlgoRSA || bits != 1024 ||
+		!signSubkey.Sig.FlagSign || *signSubkey.Sig.KeyLifetimeSecs != 12*60*60 {
+		t.Error("unexpected signing subkey")
+	}
+
+	later := time.Now().Add(18 * time.Hour)
+	if key, ok := entity.EncryptionKey(later); !ok || key.PublicKey != encSubkey.PublicKey {
+		t.Error("expected the encryption subkey to be valid after 18 hours")
+	}
+	if key, ok := entity.SigningKey(later); ok && key.PublicKey == signSubkey.PublicKey {
+		t.Error("expected the signing subkey to be expired after 18 hours")
+	}
+}
+
+func TestNewSigningEntity(t *testing.T) {
+	entity, err := NewSigningEntity("Golang Gopher", "Release Key", "no-reply@golang.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entity.Subkeys) != 0 {
+		t.Errorf("expected no subkey, got %d", len(entity.Subkeys))
+	}
+	if _, ok := entity.EncryptionKey(time.Now()); ok {
+		t.Error("sign-only entity has an encryption key")
+	}
+	if _, ok := entity.SigningKey(time.Now()); !ok {
+		t.Error("sign-only entity has no signing key")
+	}
+	if _, err := Encrypt(ioutil.Discard, []*Entity{entity}, nil, nil, nil); err == nil {
+		t.Error("encryption to a sign-only entity succeeded")
+	}
+
+	entity, err = NewEntityWithOptions(
+		&packet.Config{Algorithm: packet.PubKeyAlgoEdDSA},
+		WithUserId("Golang Gopher", "", "no-reply@golang.com"),
+		WithoutEncryptionSubkey(),
+		WithSubkey(packet.PubKeyAlgoEdDSA, packet.Curve25519, packet.KeyFlagSign),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entity.Subkeys) != 1 || !entity.Subkeys[0].Sig.FlagSign {
+		t.Error("expected a single signing subkey")
+	}
+
+	_, err = NewEntityWithOptions(
+		nil,
+		WithUserId("Golang Gopher", "", "no-reply@golang.com"),
+		WithoutEncryptionSubkey(),
+		WithSubkey(packet.PubKeyAlgoECDH, packet.Curve25519, packet.KeyFlagEncryptStorage),
+	)
+	if _, ok := err.(errors.InvalidArgumentError); !ok {
+		t.Errorf("expected an InvalidArgumentError for an encryption subkey, got %v", err)
+	}
+}
+
+func TestUpdateExpiry(t *testing.T) {
+	notation := &packet.Notation{Name: "key@golang.com", Value: []byte("original"), IsHumanReadable: true}
+	config := &packet.Config{
+		Algorithm:          packet.PubKeyAlgoEdDSA,
+		KeyLifetimeSecs:    3600,
+		SignatureNotations: []*packet.Notation{notation},
+		SignaturePolicyURI: "https://golang.com/original-policy",
+	}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.AddSubkey(config, packet.KeyFlagSign); err != nil {
+		t.Fatal(err)
+	}
+	signer := &entity.Subkeys[len(entity.Subkeys)-1]
+	oldEmbedded := signer.Sig.EmbeddedSignature
+
+	later := time.Now().Add(time.Hour)
+	updateConfig := &packet.Config{
+		Time:               func() time.Time { return later },
+		SignatureNotations: []*packet.Notation{{Name: "update@golang.com", Value: []byte("update")}},
+		SignaturePolicyURI: "https://golang.com/update-policy",
+	}
+	lifetime := 30 * 24 * time.Hour
+	if err = entity.UpdateExpiry(lifetime, updateConfig); err != nil {
+		t.Fatal(err)
+	}
+	for i := range entity.Subkeys {
+		if err = entity.UpdateSubkeyExpiry(&entity.Subkeys[i], lifetime, updateConfig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if signer.Sig.EmbeddedSignature == nil || signer.Sig.EmbeddedSignature == oldEmbedded {
+		t.Error("expected a new cross-signature for the signing subkey")
+	}
+
+	other, err := NewEntity("Golang Gopher", "Other Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.UpdateSubkeyExpiry(&other.Subkeys[0], lifetime, updateConfig); err == nil {
+		t.Error("expected an error for a subkey of another entity")
+	}
+
+	serializedEntity := bytes.NewBuffer(nil)
+	if err = entity.SerializePrivate(serializedEntity, nil); err != nil {
+		t.Fatal(err)
+	}
+	entity, err = ReadEntity(packet.NewReader(serializedEntity))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selfSig := entity.PrimaryIdentity().SelfSignature
+	if selfSig.KeyLifetimeSecs == nil || *selfSig.KeyLifetimeSecs != uint32(lifetime/time.Second) {
+		t.Errorf("unexpected primary key lifetime: %v", selfSig.KeyLifetimeSecs)
+	}
+	if !selfSig.FlagCertify || !selfSig.FlagSign || len(selfSig.PreferredSymmetric) == 0 {
+		t.Error("expected the self-signature properties to be preserved")
+	}
+	for _, sk := range entity.Subkeys {
+		if sk.Sig.KeyLifetimeSecs == nil || *sk.Sig.KeyLifetimeSecs != uint32(lifetime/time.Second) {
+			t.Errorf("unexpected subkey lifetime: %v", sk.Sig.KeyLifetimeSecs)
+		}
+	}
+	for _, sig := range []*packet.Signature{selfSig, entity.Subkeys[0].Sig, entity.Subkeys[1].Sig} {
+		if len(sig.Notations) != 1 || sig.Notations[0].Name != notation.Name || string(sig.Notations[0].Value) != "original" {
+			t.Errorf("expected the original notations to be preserved, got %+v", sig.Notations)
+		}
+		if sig.PolicyURI != config.SignaturePolicyURI {
+			t.Errorf("expected the original policy URI to be preserved, got %q", sig.PolicyURI)
+		}
+	}
+
+	// The key would have expired with its original lifetime.
+	past := time.Now().Add(2 * time.Hour)
+	if _, ok := entity.SigningKey(past); !ok {
+		t.Error("expected a valid signing key after the original expiration")
+	}
+	if _, ok := entity.EncryptionKey(past); !ok {
+		t.Error("expected a valid encryption key after the original expiration")
+	}
+}
+
+func TestSubkeyLifetime(t *testing.T) {
+	const day = 24 * 60 * 60
+	config := &packet.Config{
+		Algorithm:          packet.PubKeyAlgoEdDSA,
+		KeyLifetimeSecs:    30 * day,
+		SubkeyLifetimeSecs: 10 * day,
+	}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := entity.PrimaryKey.CreationTime
+
+	primary, ok := entity.SigningKey(created)
+	if !ok {
+		t.Fatal("no signing key")
+	}
+	if expiry, ok := primary.ExpirationTime(); !ok || !expiry.Equal(created.Add(30*day*time.Second)) {
+		t.Errorf("unexpected primary key expiration time %v", expiry)
+	}
+	encryption, ok := entity.EncryptionKey(created)
+	if !ok {
+		t.Fatal("no encryption key")
+	}
+	if expiry, ok := encryption.ExpirationTime(); !ok || !expiry.Equal(created.Add(10*day*time.Second)) {
+		t.Errorf("unexpected subkey expiration time %v", expiry)
+	}
+	if _, ok = entity.EncryptionKey(created.Add(20 * day * time.Second)); ok {
+		t.Error("expected the encryption subkey to be expired")
+	}
+
+	// Subkeys never outlive their primary key.
+	config.SubkeyLifetimeSecs = 60 * day
+	if err = entity.AddSigningSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+	sub := entity.Subkeys[len(entity.Subkeys)-1]
+	if *sub.Sig.KeyLifetimeSecs != 60*day {
+		t.Errorf("unexpected subkey lifetime %d", *sub.Sig.KeyLifetimeSecs)
+	}
+	key := Key{entity, sub.PublicKey, sub.PrivateKey, sub.Sig, sub.Revocations}
+	if expiry, ok := key.ExpirationTime(); !ok || !expiry.Equal(created.Add(30*day*time.Second)) {
+		t.Errorf("unexpected subkey expiration time %v", expiry)
+	}
+
+	// Without SubkeyLifetimeSecs, the subkeys of new keys only expire with
+	// their primary key.
+	config.SubkeyLifetimeSecs = 0
+	entity, err = NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lifetime := entity.Subkeys[0].Sig.KeyLifetimeSecs; lifetime != nil && *lifetime != 0 {
+		t.Errorf("unexpected subkey lifetime %d", *lifetime)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.AddSigningSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.AddAuthenticationSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+	oldEnc, oldSign, auth := entity.Subkeys[0].PublicKey.KeyId, entity.Subkeys[1].PublicKey.KeyId, entity.Subkeys[2].PublicKey.KeyId
+
+	summary, err := entity.Rotate(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Added) != 2 || len(entity.Subkeys) != 5 {
+		t.Fatalf("expected 2 new subkeys, got %v", summary.Added)
+	}
+	if len(summary.Revoked) != 2 || summary.Revoked[0] != oldEnc || summary.Revoked[1] != oldSign {
+		t.Errorf("unexpected revoked subkeys: %v", summary.Revoked)
+	}
+
+	serializedEntity := bytes.NewBuffer(nil)
+	if err = entity.SerializePrivate(serializedEntity, nil); err != nil {
+		t.Fatal(err)
+	}
+	entity, err = ReadEntity(packet.NewReader(serializedEntity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for _, subkey := range entity.Subkeys {
+		revoked := subkey.Revoked(now)
+		if want := subkey.PublicKey.KeyId == oldEnc || subkey.PublicKey.KeyId == oldSign; revoked != want {
+			t.Errorf("subkey %X: got revoked %v, want %v", subkey.PublicKey.KeyId, revoked, want)
+		}
+		if revoked && *subkey.Revocations[0].RevocationReason != packet.KeySuperseded {
+			t.Error("expected the superseded reason")
+		}
+	}
+	if key, ok := entity.SigningKey(now); !ok || key.PublicKey.KeyId != summary.Added[0] {
+		t.Error("expected the new signing subkey to be used for signing")
+	}
+	if key, ok := entity.EncryptionKey(now); !ok || key.PublicKey.KeyId != summary.Added[1] {
+		t.Error("expected the new encryption subkey to be used for encryption")
+	}
+	if key, ok := entity.AuthenticationKey(now); !ok || key.PublicKey.KeyId != auth {
+		t.Error("expected the authentication subkey to be kept")
+	}
+
+	signOnly, err := NewSigningEntity("Golang Gopher", "Signing Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary, err = signOnly.Rotate(config); err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Added) != 1 || len(summary.Revoked) != 0 {
+		t.Errorf("unexpected rotation of a sign-only entity: %+v", summary)
+	}
+	if _, ok := signOnly.EncryptionKey(now); ok {
+		t.Error("expected no encryption subkey for a sign-only entity")
+	}
+}
+
+func TestOfflinePrimary(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.AddSigningSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+
+	online, err := entity.WithOfflinePrimary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entity.PrivateKey.Dummy() {
+		t.Fatal("the original entity should keep its primary key")
+	}
+	const name = "Golang Gopher (Test Key) <no-reply@golang.com>"
+	numSignatures := len(entity.Signatures)
+	online.Identities[name].SelfSignature = nil
+	delete(online.Identities, name)
+	lifetime := uint32(1)
+	online.Subkeys[0].Sig.KeyLifetimeSecs = &lifetime
+	online.Signatures = append(online.Signatures, &packet.Signature{})
+	if entity.Identities[name] == nil || entity.Identities[name].SelfSignature == nil ||
+		entity.Subkeys[0].Sig.KeyLifetimeSecs == &lifetime || len(entity.Signatures) != numSignatures {
+		t.Fatal("modifying the copy should not modify the original entity")
+	}
+	online, err = entity.WithOfflinePrimary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized := bytes.NewBuffer(nil)
+	if err = online.SerializePrivateWithoutSigning(serialized, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(serialized.Bytes(), []byte("GNU\x01")) {
+		t.Error("expected a GNU dummy S2K in the serialized entity")
+	}
+	online, err = ReadEntity(packet.NewReader(serialized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !online.PrivateKey.Dummy() {
+		t.Fatal("expected a dummy primary key")
+	}
+	if err = online.AddUserId("Golang Gopher", "", "gopher@golang.com", config); err == nil {
+		t.Error("expected an error when certifying without the primary key")
+	}
+
+	// The online subkeys can still sign and decrypt.
+	signed := bytes.NewBuffer(nil)
+	if err = DetachSign(signed, online, bytes.NewBufferString("message"), config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = CheckDetachedSignature(EntityList{entity}, bytes.NewBufferString("message"), signed, nil); err != nil {
+		t.Errorf("invalid signature of the online subkey: %v", err)
+	}
+	encrypted := bytes.NewBuffer(nil)
+	w, err := Encrypt(encrypted, []*Entity{entity}, nil, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("message")); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadMessage(encrypted, EntityList{online}, nil, config); err != nil {
+		t.Errorf("cannot decrypt with the online subkeys: %v", err)
+	}
+
+	if err = online.CombineOfflinePrimary(online); err == nil {
+		t.Error("expected an error when combining with a dummy primary key")
+	}
+	if err = online.CombineOfflinePrimary(entity); err != nil {
+		t.Fatal(err)
+	}
+	if online.PrivateKey.Dummy() {
+		t.Fatal("expected the primary key to be restored")
+	}
+	if err = online.AddUserId("Golang Gopher", "", "gopher@golang.com", config); err != nil {
+		t.Errorf("cannot certify with the restored primary key: %v", err)
+	}
+}
+
+func TestSigningProfile(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.AddUserId("Golang Gopher", "", "gopher@golang.com", config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = entity.SigningProfile(0, config); err == nil {
+		t.Error("expected an error for an entity without signing subkey")
+	}
+	if err = entity.AddSigningSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+	signingSubkey := entity.Subkeys[len(entity.Subkeys)-1]
+
+	profile, err := entity.SigningProfile(0, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized := bytes.NewBuffer(nil)
+	if err = profile.SerializePrivateWithoutSigning(serialized, nil); err != nil {
+		t.Fatal(err)
+	}
+	profile, err = ReadEntity(packet.NewReader(serialized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !profile.PrivateKey.Dummy() {
+		t.Error("expected a dummy primary key")
+	}
+	if len(profile.Identities) != 1 || len(profile.Subkeys) != 1 {
+		t.Fatalf("got %d identities and %d subkeys, want 1 and 1", len(profile.Identities), len(profile.Subkeys))
+	}
+	if profile.Subkeys[0].PublicKey.KeyId != signingSubkey.PublicKey.KeyId || profile.Subkeys[0].PrivateKey == nil {
+		t.Error("expected the private signing subkey")
+	}
+
+	signed := bytes.NewBuffer(nil)
+	if err = DetachSign(signed, profile, bytes.NewBufferString("message"), config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = CheckDetachedSignature(EntityList{entity}, bytes.NewBufferString("message"), signed, nil); err != nil {
+		t.Errorf("invalid signature of the signing profile: %v", err)
+	}
+
+	if _, err = entity.SigningProfile(entity.Subkeys[0].PublicKey.KeyId, config); err == nil {
+		t.Error("expected an error for an encryption subkey")
+	}
+}
+
+func TestChangePassphrase(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.AddSigningSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+	oldPassphrase, newPassphrase := []byte("old"), []byte("new")
+	if err = entity.EncryptPrivateKeys(oldPassphrase, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	argon2Config := &packet.Config{
+		DefaultCipher: packet.CipherAES256,
+		S2KConfig:     &s2k.Config{S2KMode: s2k.Argon2S2K},
+	}
+	if err = entity.ChangePassphrase(newPassphrase, newPassphrase, argon2Config); err == nil {
+		t.Fatal("expected an error with the wrong passphrase")
+	}
+	if err = entity.DecryptPrivateKeys(oldPassphrase); err != nil {
+		t.Fatalf("keys changed by a failed passphrase change: %v", err)
+	}
+	if err = entity.EncryptPrivateKeys(oldPassphrase, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = entity.ChangePassphrase(oldPassphrase, newPassphrase, argon2Config); err != nil {
+		t.Fatal(err)
+	}
+	keys := []*packet.PrivateKey{entity.PrivateKey}
+	for _, subkey := range entity.Subkeys {
+		keys = append(keys, subkey.PrivateKey)
+	}
+	for _, key := range keys {
+		if !key.Encrypted {
+			t.Fatal("expected encrypted private keys")
+		}
+		serialized := bytes.NewBuffer(nil)
+		if err = key.Serialize(serialized); err != nil {
+			t.Fatal(err)
+		}
+		// S2K usage, AES-256 and Argon2 S2K.
+		if !bytes.Contains(serialized.Bytes(), []byte{254, uint8(packet.CipherAES256), uint8(s2k.Argon2S2K)}) {
+			t.Error("expected the key to be encrypted with Argon2 and AES-256")
+		}
+	}
+	if err = entity.DecryptPrivateKeys(oldPassphrase); err == nil {
+		t.Error("expected the old passphrase to be rejected")
+	}
+	if err = entity.DecryptPrivateKeys(newPassphrase); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// externalSigner hides the type of a private key, as an HSM-backed
+// crypto.Signer would.
+type externalSigner struct {
+	crypto.Signer
+}
+
+func TestExternalSigner(t *testing.T) {
+	ecdsaKey, err := goecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entity, err := NewEntityWithOptions(nil,
+		WithUserId("Golang Gopher", "", "no-reply@golang.com"),
+		WithPrimarySigner(externalSigner{ecdsaKey}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entity.PrimaryKey.PubKeyAlgo != packet.PubKeyAlgoECDSA {
+		t.Fatalf("unexpected primary key algorithm %d", entity.PrimaryKey.PubKeyAlgo)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.AddExternalSigningSubkey(externalSigner{edKey}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The self-signatures and the cross-signature made by the external
+	// signers are valid.
+	var buf bytes.Buffer
+	if err = entity.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEntity(packet.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Subkeys) != 2 || read.Subkeys[1].PublicKey.PubKeyAlgo != packet.PubKeyAlgoEdDSA {
+		t.Fatal("external signing subkey not found")
+	}
+
+	var sig bytes.Buffer
+	message := []byte("hello world")
+	if err = DetachSign(&sig, entity, bytes.NewReader(message), nil); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := CheckDetachedSignature(EntityList{read}, bytes.NewReader(message), &sig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer != read {
+		t.Error("unexpected signer")
+	}
+
+	if err = entity.SerializePrivate(&buf, nil); err == nil {
+		t.Error("expected an error serializing an external private key")
+	}
+}
+
+func TestImportSubkeys(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := NewEntity("Golang Gopher", "", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creationTime := time.Unix(1600000000, 0)
+	kdf := ecdh.KDF{Hash: algorithm.SHA256, Cipher: algorithm.AES128}
+	x25519Key, err := ecdh.GenerateKey(rand.Reader, ecc.NewCurve25519(), kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.ImportEncryptionSubkey(x25519Key, creationTime, config); err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.ImportSigningSubkey(edKey, creationTime, config); err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.ImportEncryptionSubkey(edKey, creationTime, config); err == nil {
+		t.Error("expected an error importing a signing key as an encryption subkey")
+	}
+
+	var buf bytes.Buffer
+	if err = entity.SerializePrivate(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEntity(packet.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Subkeys) != 3 {
+		t.Fatalf("got %d subkeys, want 3", len(read.Subkeys))
+	}
+	encryptionSubkey, signingSubkey := read.Subkeys[1], read.Subkeys[2]
+	if !encryptionSubkey.PublicKey.CreationTime.Equal(creationTime) ||
+		!signingSubkey.PublicKey.CreationTime.Equal(creationTime) {
+		t.Error("imported subkeys do not keep their creation time")
+	}
+	if encryptionSubkey.PublicKey.PubKeyAlgo != packet.PubKeyAlgoECDH ||
+		signingSubkey.PublicKey.PubKeyAlgo != packet.PubKeyAlgoEdDSA {
+		t.Fatal("unexpected algorithms of imported subkeys")
+	}
+
+	// Encrypt to the imported encryption subkey only.
+	recipient := &Entity{
+		PrimaryKey: read.PrimaryKey,
+		Identities: read.Identities,
+		Subkeys:    []Subkey{encryptionSubkey},
+	}
+	var ciphertext bytes.Buffer
+	w, err := Encrypt(&ciphertext, []*Entity{recipient}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte("hello world")
+	if _, err = w.Write(message); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	md, err := ReadMessage(&ciphertext, EntityList{read}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(plaintext, message) {
+		t.Error("unexpected plaintext")
+	}
+
+	signer := &Entity{
+		PrimaryKey: read.PrimaryKey,
+		PrivateKey: read.PrivateKey,
+		Identities: read.Identities,
+		Subkeys:    []Subkey{signingSubkey},
+	}
+	var sig bytes.Buffer
+	if err = DetachSign(&sig, signer, bytes.NewReader(message), nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = CheckDetachedSignature(EntityList{read}, bytes.NewReader(message), bytes.NewReader(sig.Bytes()), nil); err != nil {
+		t.Fatal(err)
+	}
+	issuer, err := packet.Read(&sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *issuer.(*packet.Signature).IssuerKeyId != signingSubkey.PublicKey.KeyId {
+		t.Error("signature not made by the imported signing subkey")
+	}
+}
+
+func TestEntityClone(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := NewEntity("Golang Gopher", "", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.AddSigningSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+
+	clone := entity.Clone()
+	var want, got bytes.Buffer
+	if err = entity.SerializePrivateWithoutSigning(&want, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = clone.SerializePrivateWithoutSigning(&got, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Fatal("clone does not serialize like the original")
+	}
+
+	// Self-signatures are still shared within the clone.
+	ident := clone.Identities["Golang Gopher <no-reply@golang.com>"]
+	if ident.SelfSignature != ident.Signatures[0] {
+		t.Error("self-signature of the clone is not in its signatures")
+	}
+	if clone.PrimaryKey != &clone.PrivateKey.PublicKey {
+		t.Error("primary public key of the clone is not embedded in its private key")
+	}
+
+	// Modifying the clone leaves the original untouched.
+	*ident.SelfSignature.KeyLifetimeSecs = 3600
+	ident.SelfSignature.PreferredHash[0] = 0
+	clone.PrivateKey.PrivateKey.(*eddsa.PrivateKey).D[0] ^= 0xff
+	clone.Subkeys[1].PrivateKey = nil
+	if err = clone.AddEncryptionSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+
+	var after bytes.Buffer
+	if err = entity.SerializePrivateWithoutSigning(&after, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(after.Bytes(), want.Bytes()) {
+		t.Error("original modified through its clone")
+	}
+	if len(entity.Subkeys) != 2 {
+		t.Errorf("original has %d subkeys, want 2", len(entity.Subkeys))
+	}
+}
+
+func TestRemoveIdentityAndSubkey(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := NewEntity("Golang Gopher", "", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.AddUserId("Gopher", "", "gopher@golang.com", config); err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.AddSigningSubkey(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = entity.RemoveIdentity("Unknown"); err == nil {
+		t.Error("expected an error removing an unknown identity")
+	}
+	if err = entity.RemoveIdentity("Golang Gopher <no-reply@golang.com>"); err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.RemoveIdentity("Gopher <gopher@golang.com>"); err == nil {
+		t.Error("expected an error removing the last identity")
+	}
+
+	var warnings packet.WarningCollector
+	config.Warnings = &warnings
+	if err = entity.RemoveSubkey([]byte{1, 2, 3}, config); err == nil {
+		t.Error("expected an error removing an unknown subkey")
+	}
+	signingSubkey := entity.Subkeys[1].PublicKey
+	if err = entity.RemoveSubkey(signingSubkey.Fingerprint, config); err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings.Warnings()) != 0 {
+		t.Errorf("unexpected warnings: %v", warnings.Warnings())
+	}
+	encryptionSubkey := entity.Subkeys[0].PublicKey
+	if err = entity.RemoveSubkey(encryptionSubkey.Fingerprint, config); err != nil {
+		t.Fatal(err)
+	}
+	if w := warnings.Warnings(); len(w) != 1 || w[0].Kind != packet.WarningNoEncryptionKey || w[0].KeyId != encryptionSubkey.KeyId {
+		t.Errorf("unexpected warnings: %v", w)
+	}
+
+	var buf bytes.Buffer
+	if err = entity.SerializePrivate(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEntity(packet.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Identities) != 1 || len(read.Subkeys) != 0 {
+		t.Errorf("got %d identities and %d subkeys, want 1 and 0", len(read.Identities), len(read.Subkeys))
+	}
+	if _, ok := read.Identities["Gopher <gopher@golang.com>"]; !ok {
+		t.Error("remaining identity not found")
+	}
+}
+
+func TestEntityBuilder(t *testing.T) {
+	entity, err := NewEntityBuilder().
+		Version(5).
+		Primary(KeySpec{Algorithm: packet.PubKeyAlgoEdDSA}).
+		UserID("Golang Gopher", "", "no-reply@golang.com").
+		UserID("Gopher", "", "gopher@golang.com").
+		AddSubkey(KeySpec{Algorithm: packet.PubKeyAlgoECDH, Flags: packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage}).
+		AddSubkey(KeySpec{Algorithm: packet.PubKeyAlgoEdDSA, Flags: packet.KeyFlagSign, Lifetime: time.Hour}).
+		Expiry(24 * time.Hour).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entity.PrimaryKey.Version != 5 || entity.PrimaryKey.PubKeyAlgo != packet.PubKeyAlgoEdDSA {
+		t.Errorf("unexpected primary key: version %d, algorithm %d", entity.PrimaryKey.Version, entity.PrimaryKey.PubKeyAlgo)
+	}
+	if len(entity.Identities) != 2 || len(entity.Subkeys) != 2 {
+		t.Fatalf("got %d identities and %d subkeys, want 2 and 2", len(entity.Identities), len(entity.Subkeys))
+	}
+	for _, subkey := range entity.Subkeys {
+		if subkey.PublicKey.Version != 5 {
+			t.Errorf("subkey has version %d, want 5", subkey.PublicKey.Version)
+		}
+	}
+	if lifetime := *entity.Subkeys[1].Sig.KeyLifetimeSecs; lifetime != 3600 {
+		t.Errorf("signing subkey lifetime is %d, want 3600", lifetime)
+	}
+	if lifetime := *entity.PrimaryIdentity().SelfSignature.KeyLifetimeSecs; lifetime != 24*3600 {
+		t.Errorf("primary key lifetime is %d, want %d", lifetime, 24*3600)
+	}
+
+	for _, builder := range []*EntityBuilder{
+		NewEntityBuilder().UserID("Gopher", "", "").Version(6),
+		NewEntityBuilder().UserID("Gopher", "", "").AddSubkey(KeySpec{Algorithm: packet.PubKeyAlgoEdDSA}),
+		NewEntityBuilder(),
+	} {
+		if _, err := builder.Build(); err == nil {
+			t.Error("expected an error building an invalid entity")
+		}
+	}
+}
+
+func TestGenerateEntities(t *testing.T) {
+	var progress []int
+	results, err := GenerateEntities(5, &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}, &BatchOptions{
+		Workers: 2,
+		EntityOptions: func(i int) []EntityOption {
+			return []EntityOption{WithUserId("Gopher "+strconv.Itoa(i), "", "")}
+		},
+		Progress: func(result BatchResult) {
+			progress = append(progress, result.Index)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 5 || len(progress) != 5 {
+		t.Fatalf("got %d results and %d progress reports, want 5", len(results), len(progress))
+	}
+	for i, result := range results {
+		if result.Index != i || result.Entity == nil {
+			t.Fatalf("unexpected result %d: %+v", i, result)
+		}
+		if _, ok := result.Entity.Identities["Gopher "+strconv.Itoa(i)]; !ok {
+			t.Errorf("entity %d lacks its identity", i)
+		}
+	}
+
+	primes, err := GenerateRSAPrimes(4, 1024, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoRSA, RSABits: 1024, RSAPrimes: primes}
+	results, err = GenerateEntities(1, config, nil, WithUserId("Gopher", "", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.RSAPrimes) != 0 {
+		t.Errorf("%d prepopulated primes left, want 0", len(config.RSAPrimes))
+	}
+	priv := results[0].Entity.PrivateKey.PrivateKey.(*rsa.PrivateKey)
+	if priv.Primes[0].Cmp(primes[0]) != 0 || priv.Primes[1].Cmp(primes[1]) != 0 {
+		t.Error("primary key does not use the prepopulated primes")
+	}
+
+	if _, err := GenerateEntities(2, nil, nil); err == nil {
+		t.Error("expected an error generating entities without user ID")
+	}
+}
@@ -0,0 +1,129 @@
+package openpgp
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SerializeHKPIndex writes the machine readable index of the entities in el
+// to w, as returned by HKP keyservers for "op=index&options=mr" requests. See
+// https://datatracker.ietf.org/doc/html/draft-shaw-openpgp-hkp-00#section-5.2.
+// The revoked and expired flags are evaluated at the given time.
+func (el EntityList) SerializeHKPIndex(w io.Writer, now time.Time) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("info:1:" + strconv.Itoa(len(el)) + "\n")
+	for _, e := range el {
+		writeHKPIndexEntity(bw, e, now)
+	}
+	return bw.Flush()
+}
+
+func writeHKPIndexEntity(w *bufio.Writer, e *Entity, now time.Time) {
+	pk := e.PrimaryKey
+	var keyLength, expiration, flags string
+	if bitLength, err := pk.BitLength(); err == nil {
+		keyLength = strconv.Itoa(int(bitLength))
+	}
+	if e.Revoked(now) {
+		flags += "r"
+	}
+	if sig, _ := e.primarySelfSignature(); sig != nil {
+		if sig.KeyLifetimeSecs != nil && *sig.KeyLifetimeSecs != 0 {
+			expiration = hkpTimestamp(pk.CreationTime.Add(time.Duration(*sig.KeyLifetimeSecs) * time.Second))
+		}
+		if pk.KeyExpired(sig, now) {
+			flags += "e"
+		}
+	}
+	w.WriteString("pub:" + strings.ToUpper(hex.EncodeToString(pk.Fingerprint)) +
+		":" + strconv.Itoa(int(pk.PubKeyAlgo)) + ":" + keyLength +
+		":" + hkpTimestamp(pk.CreationTime) + ":" + expiration + ":" + flags + "\n")
+
+	names := make([]string, 0, len(e.Identities))
+	for name := range e.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ident := e.Identities[name]
+		var creation, expiration, flags string
+		if ident.Revoked(now) {
+			flags += "r"
+		}
+		if sig := ident.SelfSignature; sig != nil {
+			creation = hkpTimestamp(sig.CreationTime)
+			if sig.SigLifetimeSecs != nil && *sig.SigLifetimeSecs != 0 {
+				expiration = hkpTimestamp(sig.CreationTime.Add(time.Duration(*sig.SigLifetimeSecs) * time.Second))
+			}
+			if sig.SigExpired(now) {
+				flags += "e"
+			}
+		}
+		w.WriteString("uid:" + hkpEscape(name) + ":" + creation + ":" + expiration + ":" + flags + "\n")
+	}
+}
+
+func hkpTimestamp(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+// hkpEscape percent-encodes the colons, percent signs and all the octets
+// outside of printable ASCII in s.
+func hkpEscape(s string) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c >= 0x7f || c == ':' || c == '%' {
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&0x0f])
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// SerializeSKSDump writes the public part of the entities in el as SKS
+// keyserver dump files: binary transferable public keys concatenated one after
+// the other, with at most keysPerFile keys per file. create is called to open
+// each file in turn, with indices starting at zero, for instance to create
+// "sks-dump-0000.pgp", "sks-dump-0001.pgp" and so on; the returned file is
+// closed once it is full. If keysPerFile is zero or negative, all the entities
+// are written to a single file. Dump files can be read back with ReadKeyRing.
+func (el EntityList) SerializeSKSDump(create func(index int) (io.WriteCloser, error), keysPerFile int) error {
+	if keysPerFile <= 0 {
+		keysPerFile = len(el)
+	}
+	for index, start := 0, 0; start < len(el); index, start = index+1, start+keysPerFile {
+		end := start + keysPerFile
+		if end > len(el) {
+			end = len(el)
+		}
+		f, err := create(index)
+		if err != nil {
+			return err
+		}
+		bw := bufio.NewWriter(f)
+		for _, e := range el[start:end] {
+			if err = e.Serialize(bw); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		if err = bw.Flush(); err != nil {
+			f.Close()
+			return err
+		}
+		if err = f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package openpgp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestSerializeHKPIndex(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, KeyLifetimeSecs: 3600}
+	entity, err := NewEntity("Golang Gopher", "test: 100%", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := entity.PrimaryKey
+	creation := strconv.FormatInt(pk.CreationTime.Unix(), 10)
+	expiration := strconv.FormatInt(pk.CreationTime.Unix()+3600, 10)
+	bitLength, err := pk.BitLength()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = (EntityList{entity}).SerializeHKPIndex(&buf, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	want := "info:1:1\n" +
+		"pub:" + strings.ToUpper(hex.EncodeToString(pk.Fingerprint)) + ":22:" + strconv.Itoa(int(bitLength)) + ":" + creation + ":" + expiration + ":\n" +
+		"uid:Golang Gopher (test%3A 100%25) <no-reply@golang.com>:" + creation + "::\n"
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err = (EntityList{entity}).SerializeHKPIndex(&buf, pk.CreationTime.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), ":"+expiration+":e\n") {
+		t.Errorf("expected the key to be flagged as expired, got:\n%s", buf.String())
+	}
+}
+
+type sksDumpFile struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (f *sksDumpFile) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestSerializeSKSDump(t *testing.T) {
+	var el EntityList
+	for i := 0; i < 5; i++ {
+		entity, err := NewEntity("Golang Gopher", strconv.Itoa(i), "no-reply@golang.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+		if err != nil {
+			t.Fatal(err)
+		}
+		el = append(el, entity)
+	}
+
+	var files []*sksDumpFile
+	create := func(index int) (io.WriteCloser, error) {
+		if index != len(files) {
+			t.Fatalf("unexpected file index %d", index)
+		}
+		f := new(sksDumpFile)
+		files = append(files, f)
+		return f, nil
+	}
+	if err := el.SerializeSKSDump(create, 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("got %d files, want 3", len(files))
+	}
+
+	var read EntityList
+	for i, f := range files {
+		if !f.closed {
+			t.Errorf("file %d was not closed", i)
+		}
+		keys, err := ReadKeyRing(&f.Buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		read = append(read, keys...)
+	}
+	if len(read) != len(el) {
+		t.Fatalf("got %d entities, want %d", len(read), len(el))
+	}
+	for i := range el {
+		if !bytes.Equal(read[i].PrimaryKey.Fingerprint, el[i].PrimaryKey.Fingerprint) {
+			t.Errorf("entity %d: fingerprint mismatch", i)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package openpgp
+
+import (
+	"crypto"
+	"strconv"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/algorithm"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// NegotiatedProperty is a property of an encrypted message whose algorithm
+// is negotiated with the recipients.
+type NegotiatedProperty uint8
+
+const (
+	// NegotiatedCipher is the symmetric cipher of SEIPDv1 messages.
+	NegotiatedCipher NegotiatedProperty = iota
+	// NegotiatedAEAD is the use of SEIPDv2 packets.
+	NegotiatedAEAD
+	// NegotiatedCipherSuite is the cipher and AEAD mode of SEIPDv2 messages.
+	NegotiatedCipherSuite
+	// NegotiatedHash is the hash function of the signature of signed
+	// messages.
+	NegotiatedHash
+	// NegotiatedCompression is the compression algorithm.
+	NegotiatedCompression
+)
+
+func (p NegotiatedProperty) String() string {
+	switch p {
+	case NegotiatedCipher:
+		return "cipher"
+	case NegotiatedAEAD:
+		return "AEAD"
+	case NegotiatedCipherSuite:
+		return "cipher suite"
+	case NegotiatedHash:
+		return "hash"
+	case NegotiatedCompression:
+		return "compression"
+	}
+	return "property #" + strconv.Itoa(int(p))
+}
+
+// An AlgorithmDowngrade reports that a recipient does not support the
+// algorithm configured for a property of the message, which caused another
+// algorithm to be used.
+type AlgorithmDowngrade struct {
+	Recipient *Entity
+	Property  NegotiatedProperty
+}
+
+// An AlgorithmNegotiation holds the algorithms used to encrypt a message to a
+// set of recipients, as computed by NegotiateAlgorithms.
+type AlgorithmNegotiation struct {
+	// Cipher is the cipher of the session key.
+	Cipher packet.CipherFunction
+	// AEAD is true if the message is encrypted with a SEIPDv2 packet, using
+	// CipherSuite.
+	AEAD        bool
+	CipherSuite packet.CipherSuite
+	// Hash is the hash function of the signature, if the message is signed.
+	// It is zero if no candidate hash function is available.
+	Hash crypto.Hash
+	// Compression is the compression algorithm of the message.
+	Compression packet.CompressionAlgo
+	// Downgrades lists, in the order of the recipients, the recipients that
+	// prevented the use of the configured algorithms.
+	Downgrades []AlgorithmDowngrade
+
+	candidateHashes []uint8
+}
+
+// NegotiateAlgorithms computes the algorithms used by Encrypt to encrypt a
+// message to the given recipients. For each property, the candidate
+// algorithms are the ones in the preferences of every recipient, and the
+// configured algorithm is used if it is a candidate; otherwise the candidate
+// preferred by this package is. SEIPDv2 is used if config enables AEAD and
+// every recipient supports it, unless config forces the encryption version.
+// If the recipients have no common algorithm, the ones every implementation
+// must support are used: AES-128, AES-128 with OCB, SHA-256 and no
+// compression. Recipients that do not support a configured algorithm are
+// reported in the Downgrades of the result.
+// If config is nil, sensible defaults will be used.
+func NegotiateAlgorithms(to []*Entity, config *packet.Config) (*AlgorithmNegotiation, error) {
+	// These are the possible ciphers that we'll use for the message.
+	candidateCiphers := []uint8{
+		uint8(packet.CipherAES256),
+		uint8(packet.CipherAES128),
+	}
+
+	// These are the possible hash functions that we'll use for the signature.
+	candidateHashes := []uint8{
+		hashToHashId(crypto.SHA256),
+		hashToHashId(crypto.SHA384),
+		hashToHashId(crypto.SHA512),
+		hashToHashId(crypto.SHA3_256),
+		hashToHashId(crypto.SHA3_512),
+	}
+
+	// Prefer GCM if everyone supports it
+	candidateCipherSuites := [][2]uint8{
+		{uint8(packet.CipherAES256), uint8(packet.AEADModeGCM)},
+		{uint8(packet.CipherAES256), uint8(packet.AEADModeEAX)},
+		{uint8(packet.CipherAES256), uint8(packet.AEADModeOCB)},
+		{uint8(packet.CipherAES128), uint8(packet.AEADModeGCM)},
+		{uint8(packet.CipherAES128), uint8(packet.AEADModeEAX)},
+		{uint8(packet.CipherAES128), uint8(packet.AEADModeOCB)},
+	}
+
+	candidateCompression := []uint8{
+		uint8(packet.CompressionNone),
+		uint8(packet.CompressionZIP),
+		uint8(packet.CompressionZLIB),
+	}
+
+	configuredCipher := config.Cipher()
+	configuredMode := config.AEAD().Mode()
+	configuredSuite := [2]uint8{uint8(configuredCipher), uint8(configuredMode)}
+	configuredHash := config.Hash()
+	configuredHashId, _ := algorithm.HashToHashId(configuredHash)
+	configuredCompression := config.Compression()
+
+	// Whether configured algorithms are supported by this package at all,
+	// as recipients are only blamed for the ones that are.
+	cipherSupported := containsPreference(candidateCiphers, uint8(configuredCipher))
+	suiteSupported := containsCipherSuite(candidateCipherSuites, configuredSuite)
+	hashSupported := configuredHash.Available() && containsPreference(candidateHashes, configuredHashId)
+	compressionSupported := configuredCompression != packet.CompressionNone &&
+		containsPreference(candidateCompression, uint8(configuredCompression))
+
+	// AEAD is used only if config enables it and every key supports it
+	n := &AlgorithmNegotiation{AEAD: config.AEAD() != nil}
+	var downgrades []AlgorithmDowngrade
+	blame := func(e *Entity, p NegotiatedProperty) {
+		downgrades = append(downgrades, AlgorithmDowngrade{Recipient: e, Property: p})
+	}
+
+	for _, e := range to {
+		if _, ok := e.EncryptionKey(config.Now()); !ok {
+			return nil, errors.InvalidArgumentError("cannot encrypt a message to key id " + strconv.FormatUint(e.PrimaryKey.KeyId, 16) + " because it has no valid encryption keys")
+		}
+
+		prefs := e.Preferences(config.Now())
+		if !prefs.SEIPDv2 {
+			if n.AEAD {
+				blame(e, NegotiatedAEAD)
+			}
+			n.AEAD = false
+		}
+		if cipherSupported && !containsPreference(prefs.Ciphers, uint8(configuredCipher)) {
+			blame(e, NegotiatedCipher)
+		}
+		if suiteSupported && !containsCipherSuite(prefs.CipherSuites, configuredSuite) {
+			blame(e, NegotiatedCipherSuite)
+		}
+		if hashSupported && !containsPreference(prefs.Hashes, configuredHashId) {
+			blame(e, NegotiatedHash)
+		}
+		if compressionSupported && !containsPreference(prefs.Compression, uint8(configuredCompression)) {
+			blame(e, NegotiatedCompression)
+		}
+
+		candidateCiphers = intersectPreferences(candidateCiphers, prefs.Ciphers)
+		candidateHashes = intersectPreferences(candidateHashes, prefs.Hashes)
+		candidateCipherSuites = intersectCipherSuites(candidateCipherSuites, prefs.CipherSuites)
+		candidateCompression = intersectPreferences(candidateCompression, prefs.Compression)
+	}
+
+	switch config.ForcedEncryptionVersion() {
+	case packet.ForceSEIPDv1:
+		n.AEAD = false
+	case packet.ForceSEIPDv2:
+		n.AEAD = true
+	}
+
+	// In the event that the intersection of supported algorithms is empty we use the ones
+	// labelled as MUST that every implementation supports.
+	if len(candidateCiphers) == 0 {
+		// https://www.ietf.org/archive/id/draft-ietf-openpgp-crypto-refresh-07.html#section-9.3
+		candidateCiphers = []uint8{uint8(packet.CipherAES128)}
+	}
+	if len(candidateHashes) == 0 {
+		// https://www.ietf.org/archive/id/draft-ietf-openpgp-crypto-refresh-07.html#hash-algos
+		candidateHashes = []uint8{hashToHashId(crypto.SHA256)}
+	}
+	if len(candidateCipherSuites) == 0 {
+		// https://www.ietf.org/archive/id/draft-ietf-openpgp-crypto-refresh-07.html#section-9.6
+		candidateCipherSuites = [][2]uint8{{uint8(packet.CipherAES128), uint8(packet.AEADModeOCB)}}
+	}
+
+	n.Cipher = packet.CipherFunction(candidateCiphers[0])
+	n.CipherSuite = packet.CipherSuite{
+		Cipher: packet.CipherFunction(candidateCipherSuites[0][0]),
+		Mode:   packet.AEADMode(candidateCipherSuites[0][1]),
+	}
+
+	// If the cipher specified by config is a candidate, we'll use that.
+	if containsPreference(candidateCiphers, uint8(configuredCipher)) {
+		n.Cipher = configuredCipher
+	}
+
+	// If the AEAD mode specified by config is supported by every recipient,
+	// we'll use it, preferably with the configured cipher.
+	for _, c := range candidateCipherSuites {
+		if packet.AEADMode(c[1]) != configuredMode {
+			continue
+		}
+		if n.CipherSuite.Mode != configuredMode || packet.CipherFunction(c[0]) == configuredCipher {
+			n.CipherSuite = packet.CipherSuite{
+				Cipher: packet.CipherFunction(c[0]),
+				Mode:   configuredMode,
+			}
+		}
+	}
+	if n.AEAD {
+		// The session key must match the cipher of the AEAD cipher suite.
+		n.Cipher = n.CipherSuite.Cipher
+	}
+
+	for _, hashId := range candidateHashes {
+		if h, ok := algorithm.HashIdToHash(hashId); ok && h.Available() {
+			n.Hash = h
+			break
+		}
+	}
+	// If the hash specified by config is a candidate, we'll use that.
+	if hashSupported && containsPreference(candidateHashes, configuredHashId) {
+		n.Hash = configuredHash
+	}
+	n.candidateHashes = candidateHashes
+
+	// If the compression specified by config is a candidate, we'll use that,
+	// and no compression otherwise.
+	n.Compression = packet.CompressionNone
+	if containsPreference(candidateCompression, uint8(configuredCompression)) {
+		n.Compression = configuredCompression
+	}
+
+	// Only report the properties whose configured algorithm is not used.
+	for _, d := range downgrades {
+		var downgraded bool
+		switch d.Property {
+		case NegotiatedAEAD:
+			downgraded = !n.AEAD && config.ForcedEncryptionVersion() == packet.NegotiateEncryptionVersion
+		case NegotiatedCipher:
+			downgraded = !n.AEAD && n.Cipher != configuredCipher
+		case NegotiatedCipherSuite:
+			downgraded = n.AEAD && (n.CipherSuite.Cipher != configuredCipher || n.CipherSuite.Mode != configuredMode)
+		case NegotiatedHash:
+			downgraded = n.Hash != configuredHash
+		case NegotiatedCompression:
+			downgraded = n.Compression != configuredCompression
+		}
+		if downgraded {
+			n.Downgrades = append(n.Downgrades, d)
+		}
+	}
+	return n, nil
+}
+
+func containsPreference(prefs []uint8, v uint8) bool {
+	for _, p := range prefs {
+		if p == v {
+			return true
+		}
+	}
+	return false
+}
+
+func containsCipherSuite(suites [][2]uint8, suite [2]uint8) bool {
+	for _, s := range suites {
+		if s == suite {
+			return true
+		}
+	}
+	return false
+}
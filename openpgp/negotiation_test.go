@@ -0,0 +1,71 @@
+package openpgp
+
+import (
+	"crypto"
+	"reflect"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestNegotiateAlgorithms(t *testing.T) {
+	config := &packet.Config{
+		Algorithm:              packet.PubKeyAlgoEdDSA,
+		DefaultCipher:          packet.CipherAES256,
+		DefaultHash:            crypto.SHA512,
+		DefaultCompressionAlgo: packet.CompressionZLIB,
+		AEADConfig:             &packet.AEADConfig{DefaultMode: packet.AEADModeGCM},
+	}
+	modern, err := NewEntity("Golang Gopher", "Modern", "modern@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := NewEntity("Golang Gopher", "Legacy", "legacy@golang.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := NegotiateAlgorithms([]*Entity{modern}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &AlgorithmNegotiation{
+		Cipher:      packet.CipherAES256,
+		AEAD:        true,
+		CipherSuite: packet.CipherSuite{Cipher: packet.CipherAES256, Mode: packet.AEADModeGCM},
+		Hash:        crypto.SHA512,
+		Compression: packet.CompressionZLIB,
+	}
+	n.candidateHashes = nil
+	if !reflect.DeepEqual(n, want) {
+		t.Errorf("got %+v, want %+v", n, want)
+	}
+
+	n, err = NegotiateAlgorithms([]*Entity{modern, legacy}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.AEAD || n.Cipher != packet.CipherAES128 || n.Hash != crypto.SHA256 || n.Compression != packet.CompressionNone {
+		t.Errorf("unexpected negotiation with the legacy recipient: %+v", n)
+	}
+	wantDowngrades := []AlgorithmDowngrade{
+		{legacy, NegotiatedAEAD},
+		{legacy, NegotiatedCipher},
+		{legacy, NegotiatedHash},
+		{legacy, NegotiatedCompression},
+	}
+	if !reflect.DeepEqual(n.Downgrades, wantDowngrades) {
+		t.Errorf("got downgrades %v, want %v", n.Downgrades, wantDowngrades)
+	}
+
+	// Without preferences in common, the mandatory algorithms are used.
+	sig, _ := legacy.primarySelfSignature()
+	sig.PreferredSymmetric = []uint8{uint8(packet.CipherCAST5)}
+	n, err = NegotiateAlgorithms([]*Entity{modern, legacy}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Cipher != packet.CipherAES128 || len(n.Downgrades) != 0 {
+		t.Errorf("unexpected negotiation without common cipher: %+v", n)
+	}
+}
@@ -0,0 +1,98 @@
+package openpgp
+
+import (
+	"bytes"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// WithOfflinePrimary returns a copy of e in which the secret primary key is
+// replaced by a GNU dummy stub, while the secret subkeys are kept. Serialized
+// with SerializePrivateWithoutSigning, it can be used for day-to-day signing
+// and decryption while the primary key is kept offline, as GnuPG does with
+// "gpg --export-secret-subkeys". e itself is not modified.
+func (e *Entity) WithOfflinePrimary() (*Entity, error) {
+	if e.PrivateKey == nil {
+		return nil, errors.InvalidArgumentError("private key is missing")
+	}
+	for _, subkey := range e.Subkeys {
+		if subkey.PrivateKey == nil {
+			return nil, errors.InvalidArgumentError("private subkey is missing")
+		}
+	}
+	online := e.Clone()
+	online.PrivateKey = packet.NewGnuDummyPrivateKey(*online.PrimaryKey)
+	online.PrimaryKey = &online.PrivateKey.PublicKey
+	return online, nil
+}
+
+// CombineOfflinePrimary restores the secret primary key of e, whose primary
+// key is a GNU dummy stub, from offline, a copy of the same key that holds
+// it. The identities, subkeys and signatures of offline that e does not have
+// are added to e as well.
+func (e *Entity) CombineOfflinePrimary(offline *Entity) error {
+	if !bytes.Equal(e.PrimaryKey.Fingerprint, offline.PrimaryKey.Fingerprint) {
+		return errors.InvalidArgumentError("offline primary key does not match the entity")
+	}
+	if offline.PrivateKey == nil || offline.PrivateKey.Dummy() {
+		return errors.InvalidArgumentError("offline entity does not hold the secret primary key")
+	}
+	e.PrivateKey = offline.PrivateKey
+	e.merge(offline)
+	return nil
+}
+
+// SigningProfile returns a minimal copy of e for machines that only need to
+// sign, such as CI runners: the secret primary key is replaced by a GNU
+// dummy stub, and the copy only holds the primary identity with its
+// self-signature, the direct-key self-signature if any, the key revocations,
+// and the signing subkey with the given key ID, or the signing subkey that
+// SigningKey selects at the time of config if id is 0. Encryption subkeys,
+// other identities, user attributes and third-party signatures are left
+// out. Serialize the copy with SerializePrivateWithoutSigning. e itself is
+// not modified.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) SigningProfile(id uint64, config *packet.Config) (*Entity, error) {
+	if e.PrivateKey == nil {
+		return nil, errors.InvalidArgumentError("private key is missing")
+	}
+	key, ok := e.SigningKeyById(config.Now(), id)
+	if !ok || key.PublicKey == e.PrimaryKey {
+		return nil, errors.InvalidArgumentError("no valid signing subkey found")
+	}
+	if key.PrivateKey == nil || key.PrivateKey.Dummy() {
+		return nil, errors.InvalidArgumentError("private signing subkey is missing")
+	}
+
+	profile := &Entity{
+		PrimaryKey:    e.PrimaryKey,
+		PrivateKey:    packet.NewGnuDummyPrivateKey(*e.PrimaryKey),
+		Identities:    make(map[string]*Identity),
+		Revocations:   e.Revocations,
+		SelfSignature: e.SelfSignature,
+	}
+	if e.SelfSignature != nil {
+		profile.Signatures = []*packet.Signature{e.SelfSignature}
+	}
+	if ident := e.PrimaryIdentity(); ident != nil && ident.SelfSignature != nil {
+		profile.Identities[ident.Name] = &Identity{
+			Name:          ident.Name,
+			UserId:        ident.UserId,
+			SelfSignature: ident.SelfSignature,
+			Signatures:    []*packet.Signature{ident.SelfSignature},
+		}
+	}
+	for _, subkey := range e.Subkeys {
+		if subkey.PublicKey == key.PublicKey {
+			profile.Subkeys = []Subkey{{
+				PublicKey:   subkey.PublicKey,
+				PrivateKey:  subkey.PrivateKey,
+				Sig:         subkey.Sig,
+				Revocations: subkey.Revocations,
+			}}
+			break
+		}
+	}
+	return profile, nil
+}
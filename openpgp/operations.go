@@ -0,0 +1,239 @@
+package openpgp
+
+import (
+	"context"
+	"crypto"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// The functions of this file take their parameters as option structs and a
+// context, and return result types, so that they can grow new options and
+// results without breaking their callers. The positional functions, such as
+// Encrypt and ReadMessage, are kept as shims over them, without a context,
+// and behave as before. They are added to this module rather than to a new
+// major version, and no interfaces are defined over them: callers that need
+// to substitute them can declare their own.
+//
+// The context is checked before the operation starts, each time data is
+// read or written, and when a passphrase is requested, so that long
+// streaming operations can be cancelled. It does not interrupt a single
+// cryptographic operation, such as the decryption of a session key.
+
+// EncryptOptions configures EncryptMessage.
+type EncryptOptions struct {
+	// Recipients are the entities the message is encrypted to.
+	Recipients []*Entity
+	// Passphrases, if any, can also decrypt the message.
+	Passphrases [][]byte
+	// Signer, if not nil, signs the message. Its signing key must be
+	// decrypted.
+	Signer *Entity
+	// TextSignature, if set, signs the message in text mode, over its
+	// canonicalized line endings.
+	TextSignature bool
+	// Hints holds metadata about the contents, also encrypted.
+	Hints *FileHints
+	// KeyWriter, if not nil, receives the encrypted session keys, while the
+	// encrypted data is written to the ciphertext writer, as by
+	// EncryptSplit.
+	KeyWriter io.Writer
+	// Config, if not nil, configures the algorithms of the message.
+	Config *packet.Config
+}
+
+// An EncryptResult describes a message written by EncryptMessage.
+type EncryptResult struct {
+	// Negotiation holds the algorithms negotiated with the recipients.
+	Negotiation *AlgorithmNegotiation
+	// RecipientKeys are the keys the session key is encrypted to, one for
+	// each recipient.
+	RecipientKeys []Key
+	// SigningKey is the key that signs the message, or nil if it is not
+	// signed.
+	SigningKey *Key
+}
+
+// A MessageWriter is the writer of the plaintext of a message, which must be
+// closed once the plaintext has been written.
+type MessageWriter struct {
+	ctx context.Context
+	w   io.WriteCloser
+	// Result describes the message being written.
+	Result *EncryptResult
+}
+
+// Write writes plaintext to the message, unless the context of the writer
+// is done.
+func (mw *MessageWriter) Write(p []byte) (int, error) {
+	if err := mw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return mw.w.Write(p)
+}
+
+// Close finishes the message, unless the context of the writer is done.
+func (mw *MessageWriter) Close() error {
+	if err := mw.ctx.Err(); err != nil {
+		return err
+	}
+	return mw.w.Close()
+}
+
+// EncryptMessage encrypts a message to the recipients and passphrases of
+// opts and, optionally, signs it, as by EncryptWithPassphrases. The
+// ciphertext is written to ciphertext.
+func EncryptMessage(ctx context.Context, ciphertext io.Writer, opts EncryptOptions) (*MessageWriter, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sigType := packet.SigTypeBinary
+	if opts.TextSignature {
+		sigType = packet.SigTypeText
+	}
+	keyWriter := opts.KeyWriter
+	if keyWriter == nil {
+		keyWriter = ciphertext
+	}
+	w, result, err := encrypt(keyWriter, ciphertext, opts.Recipients, opts.Passphrases, opts.Signer, opts.Hints, sigType, opts.Config)
+	if err != nil {
+		return nil, err
+	}
+	return &MessageWriter{ctx: ctx, w: w, Result: result}, nil
+}
+
+// DecryptOptions configures DecryptMessage.
+type DecryptOptions struct {
+	// KeyRing holds the, possibly encrypted, private keys that decrypt the
+	// message, and the public keys that verify its signature.
+	KeyRing KeyRing
+	// Prompt, if not nil, is called to decrypt private keys or to obtain a
+	// passphrase, see PromptFunction.
+	Prompt PromptFunction
+	// Config, if not nil, configures how the message is read.
+	Config *packet.Config
+}
+
+// DecryptMessage reads a message that may be encrypted and signed, as by
+// ReadMessage. The UnverifiedBody of the returned MessageDetails fails with
+// the error of ctx once it is done.
+func DecryptMessage(ctx context.Context, message io.Reader, opts DecryptOptions) (*MessageDetails, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	prompt := opts.Prompt
+	if prompt != nil {
+		prompt = func(keys []Key, symmetric bool) ([]byte, error) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return opts.Prompt(keys, symmetric)
+		}
+	}
+	md, err := readMessage(withContext(ctx, message), opts.KeyRing, prompt, opts.Config)
+	if err != nil {
+		return nil, err
+	}
+	md.UnverifiedBody = withContext(ctx, md.UnverifiedBody)
+	return md, nil
+}
+
+// SignOptions configures SignDetached.
+type SignOptions struct {
+	// Signer signs the message. Its signing key must be decrypted.
+	Signer *Entity
+	// Text, if set, signs the message in text mode, over its canonicalized
+	// line endings.
+	Text bool
+	// Armor, if set, writes an armored signature.
+	Armor bool
+	// Config, if not nil, configures the signature.
+	Config *packet.Config
+}
+
+// SignDetached writes a detached signature of message to w, as by
+// DetachSign, and returns it.
+func SignDetached(ctx context.Context, w io.Writer, message io.Reader, opts SignOptions) (*packet.Signature, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts.Signer == nil {
+		return nil, errors.InvalidArgumentError("no signer provided")
+	}
+	sigType := packet.SigTypeBinary
+	if opts.Text {
+		sigType = packet.SigTypeText
+	}
+	message = withContext(ctx, message)
+	if opts.Armor {
+		return armoredDetachSign(w, opts.Signer, message, sigType, opts.Config)
+	}
+	return detachSign(w, opts.Signer, message, sigType, opts.Config)
+}
+
+// VerifyOptions configures VerifyDetached.
+type VerifyOptions struct {
+	// KeyRing holds the public keys that may have made the signature.
+	KeyRing KeyRing
+	// ExpectedHashes, if not empty, are the hash functions the signature
+	// may use.
+	ExpectedHashes []crypto.Hash
+	// Armor, if set, reads an armored signature.
+	Armor bool
+	// Config, if not nil, configures how the signature is read and checked.
+	Config *packet.Config
+}
+
+// A VerifyResult describes a verified detached signature.
+type VerifyResult struct {
+	// Signature is the signature packet.
+	Signature *packet.Signature
+	// Signer is the entity that made the signature.
+	Signer *Entity
+}
+
+// VerifyDetached checks a detached signature of signed, as by
+// VerifyDetachedSignatureAndHash. The result is returned along with
+// verification errors that concern a known signer, such as
+// errors.ErrSignatureExpired, and is nil otherwise.
+func VerifyDetached(ctx context.Context, signed, signature io.Reader, opts VerifyOptions) (*VerifyResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if opts.Armor {
+		body, err := readArmored(signature, SignatureType)
+		if err != nil {
+			return nil, err
+		}
+		signature = body
+	}
+	sig, signer, err := verifyDetachedSignature(opts.KeyRing, withContext(ctx, signed), signature, opts.ExpectedHashes, opts.Config)
+	if sig == nil || signer == nil {
+		return nil, err
+	}
+	return &VerifyResult{Signature: sig, Signer: signer}, err
+}
+
+// withContext returns a reader of r that fails with the error of ctx once it
+// is done. r is returned as is if ctx can never be done.
+func withContext(ctx context.Context, r io.Reader) io.Reader {
+	if ctx.Done() == nil {
+		return r
+	}
+	return contextReader{ctx, r}
+}
+
+// contextReader fails with the error of its context once it is done.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(p)
+}
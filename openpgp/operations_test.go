@@ -0,0 +1,125 @@
+package openpgp
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestEncryptDecryptMessage(t *testing.T) {
+	entity, err := NewEntity("Golang Gopher", "", "no-reply@golang.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	keys, data := new(bytes.Buffer), new(bytes.Buffer)
+	w, err := EncryptMessage(ctx, data, EncryptOptions{
+		Recipients:  []*Entity{entity},
+		Passphrases: [][]byte{[]byte("password")},
+		Signer:      entity,
+		KeyWriter:   keys,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Result.RecipientKeys) != 1 || w.Result.RecipientKeys[0].PublicKey != entity.Subkeys[0].PublicKey {
+		t.Error("unexpected recipient keys")
+	}
+	if w.Result.SigningKey == nil || w.Result.SigningKey.PublicKey != entity.PrimaryKey {
+		t.Error("unexpected signing key")
+	}
+	const message = "hello world"
+	if _, err := w.Write([]byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := append(keys.Bytes(), data.Bytes()...)
+
+	// The result describes the packets actually written.
+	packets := packet.NewReader(bytes.NewReader(ciphertext))
+	for {
+		p, err := packets.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ek, ok := p.(*packet.EncryptedKey); ok && ek.KeyId != w.Result.RecipientKeys[0].PublicKey.KeyId {
+			t.Errorf("session key encrypted to %x, want %x", ek.KeyId, w.Result.RecipientKeys[0].PublicKey.KeyId)
+		}
+		if se, ok := p.(*packet.SymmetricallyEncrypted); ok {
+			if (se.Version == 2) != w.Result.Negotiation.AEAD {
+				t.Errorf("got v%d encrypted data, negotiated AEAD: %v", se.Version, w.Result.Negotiation.AEAD)
+			}
+			break
+		}
+	}
+
+	md, err := DecryptMessage(ctx, bytes.NewReader(ciphertext), DecryptOptions{KeyRing: EntityList{entity}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != message || md.SignatureError != nil {
+		t.Errorf("got %q, signature error %v", contents, md.SignatureError)
+	}
+
+	// The passphrase decrypts the message as well.
+	md, err = DecryptMessage(ctx, bytes.NewReader(ciphertext), DecryptOptions{
+		Prompt: func(keys []Key, symmetric bool) ([]byte, error) {
+			return []byte("password"), nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents, err = ioutil.ReadAll(md.UnverifiedBody); err != nil || string(contents) != message {
+		t.Errorf("got %q, %v", contents, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	md, err = DecryptMessage(cancelled, bytes.NewReader(ciphertext), DecryptOptions{KeyRing: EntityList{entity}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := ioutil.ReadAll(md.UnverifiedBody); err != context.Canceled {
+		t.Errorf("got error %v reading with a cancelled context, want %v", err, context.Canceled)
+	}
+	if _, err := EncryptMessage(cancelled, data, EncryptOptions{Recipients: []*Entity{entity}}); err != context.Canceled {
+		t.Errorf("got error %v encrypting with a cancelled context, want %v", err, context.Canceled)
+	}
+}
+
+func TestSignVerifyDetached(t *testing.T) {
+	entity, err := NewEntity("Golang Gopher", "", "no-reply@golang.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	message := []byte("hello world\n")
+	for _, armor := range []bool{false, true} {
+		sigBuf := new(bytes.Buffer)
+		sig, err := SignDetached(ctx, sigBuf, bytes.NewReader(message), SignOptions{Signer: entity, Text: true, Armor: armor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := VerifyDetached(ctx, bytes.NewReader(message), sigBuf, VerifyOptions{KeyRing: EntityList{entity}, Armor: armor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Signer != entity || result.Signature.CreationTime.Unix() != sig.CreationTime.Unix() {
+			t.Error("unexpected verification result")
+		}
+	}
+
+	if _, err := SignDetached(ctx, new(bytes.Buffer), bytes.NewReader(message), SignOptions{}); err == nil {
+		t.Error("expected an error signing without signer")
+	}
+}
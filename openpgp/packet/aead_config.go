@@ -2,7 +2,41 @@
 
 package packet
 
-import "math/bits"
+import (
+	"math/bits"
+	"strconv"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+)
+
+const (
+	// MinAEADChunkSize is the smallest chunk size that can be used in an
+	// AEAD encrypted packet (chunk size octet 0).
+	MinAEADChunkSize = 1 << 6
+	// MaxAEADChunkSize is the largest chunk size that can be used in a v2
+	// Symmetrically Encrypted Integrity Protected Data packet (chunk size
+	// octet 16, i.e. 4 MiB).
+	MaxAEADChunkSize = 1 << 22
+
+	maxAEADChunkSizeByte = 16
+
+	// defaultAEADChunkSize is the chunk size used when neither the chunk
+	// size nor the size of the payload is known.
+	defaultAEADChunkSize = 1 << 18
+)
+
+// aeadChunkSizeTiers lists, by increasing payload size, the chunk sizes
+// selected by ChunkSizeFor. Small payloads are split into small chunks, which
+// are authenticated and released early on decryption; large payloads use
+// large chunks, which reduce the per-chunk overhead.
+var aeadChunkSizeTiers = []struct {
+	maxPayloadSize uint64
+	chunkSize      uint64
+}{
+	{1 << 20, 1 << 14},
+	{1 << 26, defaultAEADChunkSize},
+	{^uint64(0), MaxAEADChunkSize},
+}
 
 // CipherSuite contains a combination of Cipher and Mode
 type CipherSuite struct {
@@ -15,9 +49,17 @@ type CipherSuite struct {
 // AEADConfig collects a number of AEAD parameters along with sensible defaults.
 // A nil AEADConfig is valid and results in all default values.
 type AEADConfig struct {
-	// The AEAD mode of operation.
+	// The AEAD mode of operation: AEADModeOCB (the default), AEADModeEAX
+	// or AEADModeGCM. When encrypting to public keys, it is used if all the
+	// recipients support it; otherwise the first mode they all support is.
 	DefaultMode AEADMode
-	// Amount of octets in each chunk of data
+	// Amount of octets in each chunk of data. It must be between
+	// MinAEADChunkSize and MaxAEADChunkSize, and is rounded down to a
+	// power of two. Larger chunks reduce the per-chunk overhead when
+	// encrypting large amounts of data, at the cost of buffering more
+	// unauthenticated plaintext on decryption. If zero, it is selected
+	// according to the size of the payload if it is known, see ChunkSizeFor,
+	// and 256 KiB is used otherwise.
 	ChunkSize uint64
 }
 
@@ -49,13 +91,45 @@ func (conf *AEADConfig) ChunkSizeByte() byte {
 	switch {
 	case exponent < 6:
 		exponent = 6
-	case exponent > 16:
-		exponent = 16
+	case exponent > maxAEADChunkSizeByte+6:
+		exponent = maxAEADChunkSizeByte + 6
 	}
 
 	return byte(exponent - 6)
 }
 
+// ChunkSizeFor returns the chunk size used to encrypt a payload of the given
+// size in octets, or of unknown size if payloadSize is zero. The configured
+// ChunkSize, rounded down to a power of two, takes precedence; otherwise,
+// 16 KiB is used up to 1 MiB, 256 KiB up to 64 MiB and 4 MiB beyond.
+func (conf *AEADConfig) ChunkSizeFor(payloadSize uint64) uint64 {
+	if conf != nil && conf.ChunkSize != 0 {
+		return uint64(1) << (conf.ChunkSizeByte() + 6)
+	}
+	if payloadSize == 0 {
+		return defaultAEADChunkSize
+	}
+	for _, tier := range aeadChunkSizeTiers {
+		if payloadSize <= tier.maxPayloadSize {
+			return tier.chunkSize
+		}
+	}
+	return MaxAEADChunkSize
+}
+
+// CheckChunkSize returns an error if the configured chunk size is outside of
+// the range allowed for v2 Symmetrically Encrypted Integrity Protected Data
+// packets.
+func (conf *AEADConfig) CheckChunkSize() error {
+	if conf == nil || conf.ChunkSize == 0 {
+		return nil
+	}
+	if conf.ChunkSize < MinAEADChunkSize || conf.ChunkSize > MaxAEADChunkSize {
+		return errors.InvalidArgumentError("aead chunk size out of range: " + strconv.FormatUint(conf.ChunkSize, 10))
+	}
+	return nil
+}
+
 // decodeAEADChunkSize returns the effective chunk size. In 32-bit systems, the
 // maximum returned value is 1 << 30.
 func decodeAEADChunkSize(c byte) int {
@@ -88,6 +88,15 @@ func (ar *aeadDecrypter) Read(dst []byte) (n int, err error) {
 	if errRead != nil && errRead != io.EOF {
 		return 0, errRead
 	}
+	if errRead == io.EOF && len(cipherChunk) == 0 && ar.bytesProcessed > 0 {
+		// The previous chunk ended exactly at the final authentication tag,
+		// which is all that is left in peekedBytes.
+		if errChunk := ar.validateFinalTag(ar.peekedBytes); errChunk != nil {
+			return 0, errChunk
+		}
+		ar.eof = true
+		return 0, io.EOF
+	}
 	decrypted, errChunk := ar.openChunk(cipherChunk)
 	if errChunk != nil {
 		return 0, errChunk
@@ -4,6 +4,7 @@ package packet
 
 import (
 	"io"
+	"strconv"
 
 	"github.com/ProtonMail/go-crypto/openpgp/errors"
 	"github.com/ProtonMail/go-crypto/openpgp/internal/algorithm"
@@ -22,6 +23,12 @@ type AEADEncrypted struct {
 // Only currently defined version
 const aeadEncryptedVersion = 1
 
+// maxLegacyAEADChunkSizeByte is the largest chunk size octet permitted in
+// AEAD Encrypted Data packets, for chunks of 2^62 bytes. Implementations of
+// the draft only produce much smaller chunks, which are decrypted within the
+// memory limits of the running system.
+const maxLegacyAEADChunkSizeByte = 56
+
 func (ae *AEADEncrypted) parse(buf io.Reader) error {
 	headerData := make([]byte, 4)
 	if n, err := io.ReadFull(buf, headerData); n < 4 {
@@ -45,7 +52,10 @@ func (ae *AEADEncrypted) parse(buf io.Reader) error {
 	ae.initialNonce = initialNonce
 	c := headerData[1]
 	if _, ok := algorithm.CipherById[c]; !ok {
-		return errors.UnsupportedError("unknown cipher: " + string(c))
+		return errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(c)))
+	}
+	if headerData[3] > maxLegacyAEADChunkSizeByte {
+		return errors.UnsupportedError("invalid aead chunk size byte: " + strconv.Itoa(int(headerData[3])))
 	}
 	ae.cipher = CipherFunction(c)
 	ae.mode = mode
@@ -54,8 +64,12 @@ func (ae *AEADEncrypted) parse(buf io.Reader) error {
 }
 
 // Decrypt returns a io.ReadCloser from which decrypted bytes can be read, or
-// an error.
+// an error. The cipher is the one given in the packet, so ciph is ignored,
+// and ErrKeyIncorrect is returned if the key does not have its key size.
 func (ae *AEADEncrypted) Decrypt(ciph CipherFunction, key []byte) (io.ReadCloser, error) {
+	if len(key) != ae.cipher.KeySize() {
+		return nil, errors.ErrKeyIncorrect
+	}
 	return ae.decrypt(key)
 }
 
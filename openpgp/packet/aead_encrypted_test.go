@@ -7,6 +7,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"io"
+	"io/ioutil"
 	mathrand "math/rand"
 	"testing"
 
@@ -26,7 +27,7 @@ func TestAeadRFCParse(t *testing.T) {
 		packetBytes, _ := hex.DecodeString(sample.full)
 		packetReader := bytes.NewBuffer(packetBytes)
 		packet := new(AEADEncrypted)
-		ptype, _, contentsReader, err := readHeader(packetReader)
+		ptype, _, contentsReader, err := readHeader(packetReader, nil)
 		if ptype != packetTypeAEADEncrypted || err != nil {
 			t.Error("Error reading packet header")
 		}
@@ -71,7 +72,7 @@ func TestAeadEmptyStream(t *testing.T) {
 
 	// Decrypt correct stream
 	packet := new(AEADEncrypted)
-	ptype, _, contentsReader, err := readHeader(raw)
+	ptype, _, contentsReader, err := readHeader(raw, nil)
 	if ptype != packetTypeAEADEncrypted || err != nil {
 		t.Error("Error reading packet header")
 	}
@@ -88,7 +89,7 @@ func TestAeadEmptyStream(t *testing.T) {
 
 	// Decrypt corrupt stream
 	packet = new(AEADEncrypted)
-	ptype, _, contentsReader, err = readHeader(corrupt)
+	ptype, _, contentsReader, err = readHeader(corrupt, nil)
 	if ptype != packetTypeAEADEncrypted || err != nil {
 		t.Error("Error reading packet header")
 	}
@@ -117,7 +118,7 @@ func TestAeadNilConfigStream(t *testing.T) {
 
 	packet := new(AEADEncrypted)
 
-	ptype, _, contentsReader, err := readHeader(raw)
+	ptype, _, contentsReader, err := readHeader(raw, nil)
 	if ptype != packetTypeAEADEncrypted || err != nil {
 		t.Error("Error reading packet header")
 	}
@@ -151,7 +152,7 @@ func TestAeadStreamRandomizeSlow(t *testing.T) {
 	// Packet is ready in 'raw'
 
 	packet := new(AEADEncrypted)
-	ptype, _, contentsReader, err := readHeader(raw)
+	ptype, _, contentsReader, err := readHeader(raw, nil)
 	if ptype != packetTypeAEADEncrypted || err != nil {
 		t.Error("Error reading packet header")
 	}
@@ -196,7 +197,7 @@ func TestAeadCorruptStreamRandomizeSlow(t *testing.T) {
 		raw.Bytes()[index] = 255 - raw.Bytes()[index]
 	}
 	packet := new(AEADEncrypted)
-	ptype, _, contentsReader, err := readHeader(raw)
+	ptype, _, contentsReader, err := readHeader(raw, nil)
 	if ptype != packetTypeAEADEncrypted || err != nil {
 		t.Error("Error reading packet header")
 	}
@@ -239,7 +240,7 @@ func TestAeadTruncatedStreamRandomizeSlow(t *testing.T) {
 	truncated := bytes.NewBuffer(truncatedRaw)
 
 	packet := new(AEADEncrypted)
-	ptype, _, truncatedContentsReader, err := readHeader(truncated)
+	ptype, _, truncatedContentsReader, err := readHeader(truncated, nil)
 	if ptype != packetTypeAEADEncrypted || err != nil {
 		t.Error("Error reading packet header")
 	}
@@ -284,7 +285,7 @@ func TestAeadUnclosedStreamRandomizeSlow(t *testing.T) {
 	// Don't call Close
 
 	packet := new(AEADEncrypted)
-	_, _, contentsReader, err := readHeader(rawCipher)
+	_, _, contentsReader, err := readHeader(rawCipher, nil)
 	if err != nil {
 		return
 	}
@@ -444,3 +445,55 @@ func SerializeAEADEncrypted(w io.Writer, key []byte, config *Config) (io.WriteCl
 		writer: writer,
 	}, nil
 }
+
+func TestAeadLegacyHeaderAndKeyChecks(t *testing.T) {
+	key := randomKey(16)
+	config := &Config{DefaultCipher: CipherAES128, AEADConfig: &AEADConfig{DefaultMode: AEADModeOCB}}
+	raw, _, err := randomStream(key, 100, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypted := raw.Bytes()
+
+	p, err := Read(bytes.NewReader(encrypted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.(*AEADEncrypted).Decrypt(CipherAES256, randomKey(32)); err != errors.ErrKeyIncorrect {
+		t.Errorf("expected ErrKeyIncorrect for a key of the wrong size, got %v", err)
+	}
+
+	// The chunk size octet follows the packet header, version, cipher and mode.
+	ptype, _, contents, err := readHeader(bytes.NewReader(encrypted), nil)
+	if err != nil || ptype != packetTypeAEADEncrypted {
+		t.Fatal("error reading packet header")
+	}
+	body, err := ioutil.ReadAll(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body[3] = maxLegacyAEADChunkSizeByte + 1
+	if err := new(AEADEncrypted).parse(bytes.NewReader(body)); err == nil {
+		t.Error("expected an error for an invalid chunk size octet")
+	}
+}
+
+func TestAEADChunkSizeFor(t *testing.T) {
+	tests := []struct {
+		config      *AEADConfig
+		payloadSize uint64
+		want        uint64
+	}{
+		{nil, 0, 1 << 18},
+		{nil, 100, 1 << 14},
+		{nil, 1 << 20, 1 << 14},
+		{nil, 1<<20 + 1, 1 << 18},
+		{&AEADConfig{}, 1 << 30, MaxAEADChunkSize},
+		{&AEADConfig{ChunkSize: 3000}, 1 << 30, 2048},
+	}
+	for i, test := range tests {
+		if got := test.config.ChunkSizeFor(test.payloadSize); got != test.want {
+			t.Errorf("#%d: got chunk size %d, want %d", i, got, test.want)
+		}
+	}
+}
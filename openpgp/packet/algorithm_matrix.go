@@ -0,0 +1,115 @@
+package packet
+
+import (
+	"crypto"
+	"strconv"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/ecc"
+)
+
+var (
+	ecdhCurves  = []Curve{Curve25519, Curve448, CurveNistP256, CurveNistP384, CurveNistP521, CurveSecP256k1, CurveBrainpoolP256, CurveBrainpoolP384, CurveBrainpoolP512}
+	ecdsaCurves = []Curve{CurveNistP256, CurveNistP384, CurveNistP521, CurveSecP256k1, CurveBrainpoolP256, CurveBrainpoolP384, CurveBrainpoolP512}
+	eddsaCurves = []Curve{Curve25519, Curve448}
+)
+
+// keyAlgorithmMatrix lists, for each supported key version, the public key
+// algorithms that keys of that version may use and, for elliptic curve
+// algorithms, the curves they may use. It is consulted when generating and
+// parsing keys. v6 keys, and the restrictions RFC 9580 puts on them, are not
+// implemented.
+var keyAlgorithmMatrix = map[int]map[PublicKeyAlgorithm][]Curve{
+	4: {
+		PubKeyAlgoRSA:            nil,
+		PubKeyAlgoRSAEncryptOnly: nil,
+		PubKeyAlgoRSASignOnly:    nil,
+		PubKeyAlgoElGamal:        nil,
+		PubKeyAlgoDSA:            nil,
+		PubKeyAlgoECDH:           ecdhCurves,
+		PubKeyAlgoECDSA:          ecdsaCurves,
+		PubKeyAlgoEdDSA:          eddsaCurves,
+	},
+	5: {
+		PubKeyAlgoRSA:            nil,
+		PubKeyAlgoRSAEncryptOnly: nil,
+		PubKeyAlgoRSASignOnly:    nil,
+		PubKeyAlgoElGamal:        nil,
+		PubKeyAlgoDSA:            nil,
+		PubKeyAlgoECDH:           ecdhCurves,
+		PubKeyAlgoECDSA:          ecdsaCurves,
+		PubKeyAlgoEdDSA:          eddsaCurves,
+	},
+}
+
+// CheckKeyAlgorithm returns an InvalidConfigurationError if keys of the
+// given version cannot use the given public key algorithm or, for elliptic
+// curve algorithms, the given curve. The curve is ignored for other
+// algorithms.
+func CheckKeyAlgorithm(version int, algorithm PublicKeyAlgorithm, curve Curve) error {
+	algorithms, ok := keyAlgorithmMatrix[version]
+	if !ok {
+		return errors.InvalidConfigurationError("unsupported key version " + strconv.Itoa(version))
+	}
+	if _, ok := algorithms[algorithm]; !ok {
+		return errors.InvalidConfigurationError("public key algorithm " + strconv.Itoa(int(algorithm)) + " cannot be used with v" + strconv.Itoa(version) + " keys")
+	}
+	if !keyAlgorithmPermitted(version, algorithm, curve) {
+		return errors.InvalidConfigurationError("curve " + string(curve) + " cannot be used with public key algorithm " + strconv.Itoa(int(algorithm)) + " in v" + strconv.Itoa(version) + " keys")
+	}
+	return nil
+}
+
+func keyAlgorithmPermitted(version int, algorithm PublicKeyAlgorithm, curve Curve) bool {
+	curves, ok := keyAlgorithmMatrix[version][algorithm]
+	if !ok {
+		return false
+	}
+	if curves == nil {
+		return true
+	}
+	for _, c := range curves {
+		if c == curve {
+			return true
+		}
+	}
+	return false
+}
+
+// signatureHashMatrix lists the default hash function of the signatures made
+// with the public key algorithms and curves whose security level requires a
+// hash function stronger than SHA-256.
+var signatureHashMatrix = map[PublicKeyAlgorithm]map[Curve]crypto.Hash{
+	PubKeyAlgoEdDSA: {
+		Curve448: crypto.SHA512,
+	},
+	PubKeyAlgoECDSA: {
+		CurveNistP384:      crypto.SHA384,
+		CurveBrainpoolP384: crypto.SHA384,
+		CurveNistP521:      crypto.SHA512,
+		CurveBrainpoolP512: crypto.SHA512,
+	},
+}
+
+// DefaultSignatureHash returns the default hash function of the signatures
+// made with pk, which matches the security level of the key: SHA-512 for
+// Ed448, NIST P-521 and Brainpool P-512 keys, SHA-384 for NIST P-384 and
+// Brainpool P-384 keys, and SHA-256 for other keys.
+func (pk *PublicKey) DefaultSignatureHash() crypto.Hash {
+	if h, ok := signatureHashMatrix[pk.PubKeyAlgo][pk.Curve()]; ok {
+		return h
+	}
+	return crypto.SHA256
+}
+
+// Curve returns the curve of an elliptic curve public key, or the empty
+// Curve for other keys.
+func (pk *PublicKey) Curve() Curve {
+	if pk.oid == nil {
+		return ""
+	}
+	if curveInfo := ecc.FindByOid(pk.oid); curveInfo != nil {
+		return Curve(curveInfo.GenName)
+	}
+	return ""
+}
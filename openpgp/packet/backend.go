@@ -0,0 +1,63 @@
+package packet
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"hash"
+	"strconv"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/algorithm"
+)
+
+// The backend functions replace, process-wide, the implementations of the
+// block ciphers and hash functions used by this module, e.g. with
+// implementations backed by cgo libraries or kernel crypto for higher
+// throughput. They are safe for concurrent use, and take effect for the
+// ciphers and hashes instantiated afterwards. Backends are typically set in
+// an init function, in files guarded by build tags, after checking at run
+// time that the alternative implementation is available.
+
+// SetCipherBackend makes this module use newCipher to instantiate the block
+// cipher c, for encrypted messages and private keys. If newCipher returns an
+// error, such as for a key size it does not support, the Go implementation
+// is used instead. A nil newCipher restores the Go implementation.
+// newCipher is checked before it is registered: it must accept keys of the
+// size of c, have its block size and pass a known-answer test against the
+// Go implementation.
+func SetCipherBackend(c CipherFunction, newCipher func(key []byte) (cipher.Block, error)) error {
+	if !c.IsSupported() {
+		return errors.UnsupportedError("cipher function " + strconv.Itoa(int(c)))
+	}
+	if newCipher != nil {
+		if err := algorithm.CheckCipherBackend(algorithm.CipherFunction(c), newCipher); err != nil {
+			return errors.InvalidArgumentError("backend of cipher function " + strconv.Itoa(int(c)) + ": " + err.Error())
+		}
+	}
+	algorithm.SetCipherBackend(algorithm.CipherFunction(c), newCipher)
+	return nil
+}
+
+// SetHashBackend makes this module use newHash to instantiate the hash
+// function h, for signatures, modification detection codes and S2K
+// functions; key fingerprints are still computed by the crypto package. h
+// must be linked into the binary, as its availability is checked with
+// h.Available. A nil newHash restores the implementation registered with the
+// crypto package. newHash is checked before it is registered: its hashes
+// must have the size and block size of h and pass a known-answer test
+// against the implementation registered with the crypto package.
+func SetHashBackend(h crypto.Hash, newHash func() hash.Hash) error {
+	if _, ok := algorithm.HashToHashIdWithSha1(h); !ok {
+		return errors.UnsupportedError("hash function " + strconv.Itoa(int(h)))
+	}
+	if newHash != nil {
+		if !h.Available() {
+			return errors.UnsupportedError("hash function " + strconv.Itoa(int(h)) + " is not linked into the binary")
+		}
+		if err := algorithm.CheckHashBackend(h, newHash); err != nil {
+			return errors.InvalidArgumentError("backend of hash function " + strconv.Itoa(int(h)) + ": " + err.Error())
+		}
+	}
+	algorithm.SetHashBackend(h, newHash)
+	return nil
+}
@@ -0,0 +1,122 @@
+package packet
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"hash"
+	"io/ioutil"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBackends(t *testing.T) {
+	var ciphers, hashes int32
+	if err := SetCipherBackend(CipherAES128, func(key []byte) (cipher.Block, error) {
+		atomic.AddInt32(&ciphers, 1)
+		return aes.NewCipher(key)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetHashBackend(crypto.SHA1, func() hash.Hash {
+		atomic.AddInt32(&hashes, 1)
+		return sha1.New()
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		SetCipherBackend(CipherAES128, nil)
+		SetHashBackend(crypto.SHA1, nil)
+	}()
+	// The backends are called once when they are checked.
+	if ciphers != 1 || hashes != 1 {
+		t.Errorf("backends checked %d and %d times, want 1 and 1", ciphers, hashes)
+	}
+	atomic.StoreInt32(&ciphers, 0)
+	atomic.StoreInt32(&hashes, 0)
+
+	buf := new(bytes.Buffer)
+	key := make([]byte, CipherAES128.KeySize())
+	w, err := SerializeSymmetricallyEncrypted(buf, CipherAES128, false, CipherSuite{}, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := []byte("hello world\n")
+	if _, err := w.Write(contents); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := p.(*SymmetricallyEncrypted).Decrypt(CipherAES128, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decrypted, contents) {
+		t.Errorf("got %q, want %q", decrypted, contents)
+	}
+	if ciphers != 2 || hashes != 2 {
+		t.Errorf("backends used %d and %d times, want 2 and 2", ciphers, hashes)
+	}
+
+	if err := SetCipherBackend(CipherFunction(1), nil); err == nil {
+		t.Error("expected an error setting the backend of an unknown cipher")
+	}
+	if err := SetHashBackend(crypto.MD5, nil); err == nil {
+		t.Error("expected an error setting the backend of an unsupported hash")
+	}
+}
+
+// reversedBlock swaps encryption and decryption of a block cipher.
+type reversedBlock struct {
+	cipher.Block
+}
+
+func (b reversedBlock) Encrypt(dst, src []byte) { b.Block.Decrypt(dst, src) }
+func (b reversedBlock) Decrypt(dst, src []byte) { b.Block.Encrypt(dst, src) }
+
+func TestInvalidBackends(t *testing.T) {
+	badCiphers := []func(key []byte) (cipher.Block, error){
+		// Wrong block size
+		func(key []byte) (cipher.Block, error) { return des.NewCipher(key[:8]) },
+		// Wrong output
+		func(key []byte) (cipher.Block, error) {
+			block, err := aes.NewCipher(key)
+			return reversedBlock{block}, err
+		},
+		// Unsupported key size
+		func(key []byte) (cipher.Block, error) { return nil, aes.KeySizeError(len(key)) },
+	}
+	for i, newCipher := range badCiphers {
+		if err := SetCipherBackend(CipherAES128, newCipher); err == nil {
+			SetCipherBackend(CipherAES128, nil)
+			t.Errorf("#%d: expected an error setting an invalid cipher backend", i)
+		}
+	}
+
+	badHashes := []func() hash.Hash{
+		// Wrong size
+		sha256.New224,
+		// Wrong output
+		func() hash.Hash { return hmac.New(sha256.New, []byte("key")) },
+	}
+	for i, newHash := range badHashes {
+		if err := SetHashBackend(crypto.SHA256, newHash); err == nil {
+			SetHashBackend(crypto.SHA256, nil)
+			t.Errorf("#%d: expected an error setting an invalid hash backend", i)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package packet
+
+import (
+	"crypto/dsa"
+	"crypto/rsa"
+	"math/big"
+
+	"github.com/ProtonMail/go-crypto/openpgp/ecdh"
+	"github.com/ProtonMail/go-crypto/openpgp/ecdsa"
+	"github.com/ProtonMail/go-crypto/openpgp/eddsa"
+	"github.com/ProtonMail/go-crypto/openpgp/elgamal"
+)
+
+// The Clone methods return deep copies of packets, which can be modified
+// without affecting the original. Encoded fields, such as MPIs and OIDs, are
+// never modified in place and are shared between the copies.
+
+// Clone returns a deep copy of pk.
+func (pk *PublicKey) Clone() *PublicKey {
+	c := *pk
+	c.Fingerprint = cloneBytes(pk.Fingerprint)
+	c.PublicKey = clonePublicKeyMaterial(pk.PublicKey)
+	return &c
+}
+
+// Clone returns a deep copy of pk, including its secret key material.
+// Private keys held elsewhere, such as crypto.Signer implementations, are
+// shared between the copies.
+func (pk *PrivateKey) Clone() *PrivateKey {
+	c := *pk
+	c.PublicKey = *pk.PublicKey.Clone()
+	c.encryptedData = cloneBytes(pk.encryptedData)
+	c.iv = cloneBytes(pk.iv)
+	if pk.s2kParams != nil {
+		params := *pk.s2kParams
+		c.s2kParams = &params
+	}
+	c.PrivateKey = clonePrivateKeyMaterial(pk.PrivateKey)
+	return &c
+}
+
+// Clone returns a deep copy of uat.
+func (uat *UserAttribute) Clone() *UserAttribute {
+	c := &UserAttribute{Contents: make([]*OpaqueSubpacket, len(uat.Contents))}
+	for i, sp := range uat.Contents {
+		c.Contents[i] = &OpaqueSubpacket{
+			SubType:       sp.SubType,
+			EncodedLength: cloneBytes(sp.EncodedLength),
+			Contents:      cloneBytes(sp.Contents),
+		}
+	}
+	return c
+}
+
+// Clone returns a deep copy of op.
+func (op *OpaquePacket) Clone() *OpaquePacket {
+	c := *op
+	c.Contents = cloneBytes(op.Contents)
+	return &c
+}
+
+// Clone returns a deep copy of sig, including its embedded signature.
+func (sig *Signature) Clone() *Signature {
+	c := *sig
+	c.HashSuffix = cloneBytes(sig.HashSuffix)
+	if sig.Metadata != nil {
+		metadata := *sig.Metadata
+		c.Metadata = &metadata
+	}
+	c.rawSubpackets = cloneSubpackets(sig.rawSubpackets)
+	c.outSubpackets = cloneSubpackets(sig.outSubpackets)
+	c.unknownSubpackets = append([]signatureSubpacketType(nil), sig.unknownSubpackets...)
+	c.unknownCriticalSubpackets = append([]signatureSubpacketType(nil), sig.unknownCriticalSubpackets...)
+	if sig.SigLifetimeSecs != nil {
+		v := *sig.SigLifetimeSecs
+		c.SigLifetimeSecs = &v
+	}
+	if sig.KeyLifetimeSecs != nil {
+		v := *sig.KeyLifetimeSecs
+		c.KeyLifetimeSecs = &v
+	}
+	c.PreferredSymmetric = cloneBytes(sig.PreferredSymmetric)
+	c.PreferredHash = cloneBytes(sig.PreferredHash)
+	c.PreferredCompression = cloneBytes(sig.PreferredCompression)
+	if sig.PreferredCipherSuites != nil {
+		c.PreferredCipherSuites = append([][2]uint8{}, sig.PreferredCipherSuites...)
+	}
+	if sig.IssuerKeyId != nil {
+		v := *sig.IssuerKeyId
+		c.IssuerKeyId = &v
+	}
+	c.IssuerFingerprint = cloneBytes(sig.IssuerFingerprint)
+	if sig.SignerUserId != nil {
+		v := *sig.SignerUserId
+		c.SignerUserId = &v
+	}
+	if sig.IsPrimaryId != nil {
+		v := *sig.IsPrimaryId
+		c.IsPrimaryId = &v
+	}
+	if sig.Notations != nil {
+		c.Notations = make([]*Notation, len(sig.Notations))
+		for i, notation := range sig.Notations {
+			n := *notation
+			n.Value = cloneBytes(notation.Value)
+			c.Notations[i] = &n
+		}
+	}
+	if sig.TrustRegularExpression != nil {
+		v := *sig.TrustRegularExpression
+		c.TrustRegularExpression = &v
+	}
+	if sig.RevocationReason != nil {
+		v := *sig.RevocationReason
+		c.RevocationReason = &v
+	}
+	if sig.EmbeddedSignature != nil {
+		c.EmbeddedSignature = sig.EmbeddedSignature.Clone()
+	}
+	return &c
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+func cloneInt(n *big.Int) *big.Int {
+	if n == nil {
+		return nil
+	}
+	return new(big.Int).Set(n)
+}
+
+func cloneSubpackets(subpackets []outputSubpacket) []outputSubpacket {
+	if subpackets == nil {
+		return nil
+	}
+	c := make([]outputSubpacket, len(subpackets))
+	for i, subpacket := range subpackets {
+		c[i] = subpacket
+		c[i].contents = cloneBytes(subpacket.contents)
+	}
+	return c
+}
+
+// clonePublicKeyMaterial returns a deep copy of the public key material of
+// a PublicKey. Unknown types are shared.
+func clonePublicKeyMaterial(key interface{}) interface{} {
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		return &rsa.PublicKey{N: cloneInt(pub.N), E: pub.E}
+	case *dsa.PublicKey:
+		return &dsa.PublicKey{
+			Parameters: dsa.Parameters{P: cloneInt(pub.P), Q: cloneInt(pub.Q), G: cloneInt(pub.G)},
+			Y:          cloneInt(pub.Y),
+		}
+	case *elgamal.PublicKey:
+		return &elgamal.PublicKey{G: cloneInt(pub.G), P: cloneInt(pub.P), Y: cloneInt(pub.Y)}
+	case *ecdsa.PublicKey:
+		c := *pub
+		c.X, c.Y = cloneInt(pub.X), cloneInt(pub.Y)
+		return &c
+	case *eddsa.PublicKey:
+		c := *pub
+		c.X = cloneBytes(pub.X)
+		return &c
+	case *ecdh.PublicKey:
+		c := *pub
+		c.Point = cloneBytes(pub.Point)
+		return &c
+	}
+	return key
+}
+
+// clonePrivateKeyMaterial returns a deep copy of the secret key material of
+// a PrivateKey. Unknown types, such as crypto.Signer implementations, are
+// shared.
+func clonePrivateKeyMaterial(key interface{}) interface{} {
+	switch priv := key.(type) {
+	case *rsa.PrivateKey:
+		c := &rsa.PrivateKey{
+			PublicKey: *clonePublicKeyMaterial(&priv.PublicKey).(*rsa.PublicKey),
+			D:         cloneInt(priv.D),
+			Primes:    make([]*big.Int, len(priv.Primes)),
+		}
+		for i, prime := range priv.Primes {
+			c.Primes[i] = cloneInt(prime)
+		}
+		if priv.Precomputed.Dp != nil {
+			c.Precompute()
+		}
+		return c
+	case *dsa.PrivateKey:
+		return &dsa.PrivateKey{
+			PublicKey: *clonePublicKeyMaterial(&priv.PublicKey).(*dsa.PublicKey),
+			X:         cloneInt(priv.X),
+		}
+	case *elgamal.PrivateKey:
+		return &elgamal.PrivateKey{
+			PublicKey: *clonePublicKeyMaterial(&priv.PublicKey).(*elgamal.PublicKey),
+			X:         cloneInt(priv.X),
+		}
+	case *ecdsa.PrivateKey:
+		c := *priv
+		c.PublicKey = *clonePublicKeyMaterial(&priv.PublicKey).(*ecdsa.PublicKey)
+		c.D = cloneInt(priv.D)
+		return &c
+	case *eddsa.PrivateKey:
+		c := *priv
+		c.PublicKey = *clonePublicKeyMaterial(&priv.PublicKey).(*eddsa.PublicKey)
+		c.D = cloneBytes(priv.D)
+		return &c
+	case *ecdh.PrivateKey:
+		c := *priv
+		c.PublicKey = *clonePublicKeyMaterial(&priv.PublicKey).(*ecdh.PublicKey)
+		c.D = cloneBytes(priv.D)
+		return &c
+	}
+	return key
+}
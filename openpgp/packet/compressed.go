@@ -16,6 +16,8 @@ import (
 // Compressed represents a compressed OpenPGP packet. The decompressed contents
 // will contain more OpenPGP packets. See RFC 4880, section 5.6.
 type Compressed struct {
+	// Algo is the compression algorithm of the packet.
+	Algo CompressionAlgo
 	Body io.Reader
 }
 
@@ -35,8 +37,17 @@ type CompressionConfig struct {
 	// slower) compression levels. If Level is less than -1 or
 	// more then 9, a non-nil error will be returned during
 	// encryption. See the constants above for convenient common
-	// settings for Level.
+	// settings for Level. Payloads that are already compressed gain
+	// little from recompression, and can be written faster with
+	// BestSpeed or NoCompression.
 	Level int
+	// Adaptive, if set, skips the compression of messages whose contents
+	// are already compressed, such as JPEG images or ZIP archives, which
+	// saves CPU time and avoids leaking information about the plaintext
+	// through the size of the compressed message. Such contents are
+	// detected by the content type hinted at by the caller, if any, and
+	// otherwise by sampling the start of the plaintext.
+	Adaptive bool
 }
 
 func (c *Compressed) parse(r io.Reader) error {
@@ -46,6 +57,7 @@ func (c *Compressed) parse(r io.Reader) error {
 		return err
 	}
 
+	c.Algo = CompressionAlgo(buf[0])
 	switch buf[0] {
 	case 0:
 		c.Body = r
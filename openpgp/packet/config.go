@@ -9,8 +9,11 @@ import (
 	"crypto/rand"
 	"io"
 	"math/big"
+	"strconv"
 	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/algorithm"
 	"github.com/ProtonMail/go-crypto/openpgp/s2k"
 )
 
@@ -21,7 +24,12 @@ type Config struct {
 	// If nil, the crypto/rand Reader is used.
 	Rand io.Reader
 	// DefaultHash is the default hash function to be used.
-	// If zero, SHA-256 is used.
+	// If zero, SHA-256 is used. Signatures made with keys that require a
+	// stronger hash function use the default hash function of their key
+	// instead, see PublicKey.DefaultSignatureHash. As no key requires less
+	// than SHA-256, hash functions weaker than SHA-256, such as SHA-224 or
+	// SHA-1, are never used for signatures unless SignatureHash selects
+	// them.
 	DefaultHash crypto.Hash
 	// DefaultCipher is the cipher to be used.
 	// If zero, AES-128 is used.
@@ -73,15 +81,35 @@ type Config struct {
 	// **Note: using this option may break compatibility with other OpenPGP
 	// implementations, as well as future versions of this library.**
 	AEADConfig *AEADConfig
+	// V6SKESK, if AEADConfig is also set, makes passphrase-encrypted
+	// messages use v6 Symmetric-Key Encrypted Session Key packets, as defined
+	// in RFC 9580, instead of the v5 packets of earlier drafts. Combine it
+	// with an s2k.Argon2S2K S2KConfig, whose Argon2Config sets the Argon2
+	// parameters, for RFC 9580 passphrase-based encryption.
+	V6SKESK bool
 	// V5Keys configures version 5 key generation. If false, this package still
 	// supports version 5 keys, but produces version 4 keys.
 	V5Keys bool
+	// LibrePGPCompatibility, if true, reads version 5 keys and signatures as
+	// encoded by LibrePGP implementations such as GnuPG 2.4 and later, which
+	// differ from the draft encoding this package writes. Currently, it
+	// accepts the Issuer Key ID subpacket in version 5 signatures, which
+	// GnuPG emits along with the Issuer Fingerprint subpacket. It only
+	// affects parsing, so that such keys and signatures can be verified.
+	LibrePGPCompatibility bool
 	// "The validity period of the key.  This is the number of seconds after
 	// the key creation time that the key expires.  If this is not present
 	// or has a value of zero, the key never expires.  This is found only on
 	// a self-signature.""
 	// https://tools.ietf.org/html/rfc4880#section-5.2.3.6
 	KeyLifetimeSecs uint32
+	// SubkeyLifetimeSecs is the validity period of the subkeys of new keys,
+	// measured from their creation time, independently of the lifetime of
+	// the primary key. If zero, the subkeys generated with a new key do not
+	// expire before the primary key, and the subkeys added to an existing
+	// key have a lifetime of KeyLifetimeSecs. Subkeys never outlive their
+	// primary key.
+	SubkeyLifetimeSecs uint32
 	// "The validity period of the signature.  This is the number of seconds
 	// after the signature creation time that the signature expires.  If
 	// this is not present or has a value of zero, it never expires."
@@ -104,14 +132,165 @@ type Config struct {
 	// might be no other way than to tolerate the missing MDC. Setting this flag, allows this
 	// mode of operation. It should be considered a measure of last resort.
 	InsecureAllowUnauthenticatedMessages bool
+	// NormalizeLineEndings, if set, makes ReadMessage convert the CRLF line
+	// endings of text literal data, in the LiteralFormatText,
+	// LiteralFormatUTF8 or LiteralFormatMIME formats, to LF. Signatures are
+	// still verified over the data as stored in the message.
+	NormalizeLineEndings bool
+	// LiteralDataHook, if not nil, is called by ReadMessage with the literal
+	// data packet of a message as soon as its header is parsed, before the
+	// message is authenticated and its signature verified: the file name,
+	// date and format it carries are not yet trustworthy. It lets callers
+	// display the metadata of large messages while they are streamed. The
+	// hook must not read the Body of the packet.
+	LiteralDataHook func(literalData *LiteralData)
+	// SessionKeyHook, if not nil, is called by ReadMessage with the
+	// public-key and symmetric-key encrypted session key packets of an
+	// encrypted message, before any private key or passphrase is tried. It
+	// lets callers supply a session key obtained out of band, e.g. unwrapped
+	// by a hardware token or cached from a previous parse, so that messages
+	// can be decrypted without private keys in the process. The cipher is
+	// ignored for SEIPDv2 messages, which specify it. If the hook returns a
+	// nil key, ReadMessage falls back to the key ring and prompt. A non-nil
+	// key is final: as a wrong key is usually only detected while the
+	// encrypted data is read, which cannot be read again, decryption then
+	// fails instead of trying the key ring.
+	SessionKeyHook func(encryptedKeys []*EncryptedKey, symmetricKeys []*SymmetricKeyEncrypted) (cipher CipherFunction, key []byte, err error)
+	// UserIdValidation selects the conventions that the user IDs of
+	// generated keys must follow. By default, names, comments and emails
+	// cannot contain '(', ')', '<', '>' or '\x00'.
+	UserIdValidation UserIdValidation
 	// KnownNotations is a map of Notation Data names to bools, which controls
 	// the notation names that are allowed to be present in critical Notation Data
 	// signature subpackets.
 	KnownNotations map[string]bool
 	// SignatureNotations is a list of Notations to be added to any signatures.
 	SignatureNotations []*Notation
+	// SignaturePolicyURI, if not empty, is the URI of the policy under which
+	// signatures are issued, added to any signatures as a Policy URI.
+	SignaturePolicyURI string
+	// Warnings, if not nil, receives the non-fatal anomalies encountered
+	// while parsing, verifying or decrypting, such as skipped packets or
+	// ignored subpackets. See WarningCollector for a simple implementation.
+	Warnings WarningSink
+	// MinPaddingLength and MaxPaddingLength, if MaxPaddingLength is not
+	// zero, cause a Padding packet to be appended inside encrypted messages,
+	// to hide the length of the plaintext. Its length is chosen uniformly at
+	// random between MinPaddingLength and MaxPaddingLength, inclusive.
+	// See RFC 9580, section 5.14.
+	MinPaddingLength int
+	MaxPaddingLength int
+	// DecryptionWorkers, if greater than one, is the number of goroutines
+	// that decrypt the encrypted session keys of a message concurrently,
+	// with the unlocked private keys available for them. Decryption then
+	// proceeds with the first session key that works. Rand, if set, must
+	// then be safe for concurrent use.
+	DecryptionWorkers int
+	// PreserveUnknownPackets, if true, makes the packet readers created
+	// with this config return packets of unknown types as OpaquePacket
+	// values, instead of skipping them. Keys read with such a reader keep
+	// these packets in their UnknownPackets fields, and write them back when
+	// serialized, for forward compatibility with future packet types.
+	PreserveUnknownPackets bool
+	// CriticalSubpackets is the policy applied to signatures that contain
+	// unknown critical subpackets, when read with this config. By default,
+	// such signatures are rejected, as mandated by RFC 4880.
+	CriticalSubpackets CriticalSubpacketPolicy
+	// AcceptCriticalSubpacket, if not nil, is called with the type of each
+	// unknown critical subpacket found in a signature. If it returns true,
+	// the subpacket is ignored and the signature accepted, whatever the
+	// CriticalSubpackets policy.
+	AcceptCriticalSubpacket func(subpacketType uint8) bool
+	// AllowSubkeyCertifications, if true, allows certifications to be made
+	// and verified with subkeys that have the certification flag. By
+	// default, only primary keys are used for certifications, as mandated by
+	// RFC 4880, section 5.2.3.21, as some implementations reject
+	// certifications made by subkeys.
+	AllowSubkeyCertifications bool
+	// EncryptionVersion forces the version of the packets of encrypted
+	// messages, instead of deriving it from AEADConfig and the features of
+	// the recipient keys, for instance when encrypting to recipients whose
+	// advertised features are known to be wrong. By default, the version is
+	// negotiated.
+	EncryptionVersion EncryptionVersion
+	// LenientEdDSAEncoding, if true, accepts EdDSA keys and signatures read
+	// with this config whose values are padded with leading zero bytes, as
+	// produced by some older implementations. Such signature values are
+	// normalized, so that they are re-serialized canonically, while public
+	// keys are kept as read, as their encoding is covered by the
+	// fingerprint.
+	LenientEdDSAEncoding bool
+	// AllowDerivedEncryptionKeys, if true, allows encryption subkeys to be
+	// derived from Ed25519 primary keys with AddDerivedEncryptionSubkey.
+	// See its documentation for the security implications.
+	AllowDerivedEncryptionKeys bool
+	// SignatureHash, if not nil, is called with the public key making a
+	// signature and returns the hash function of the signature, overriding
+	// DefaultHash and the default hash function of the key. If it returns
+	// zero, the hash function is chosen as if SignatureHash was nil.
+	SignatureHash func(signer *PublicKey) crypto.Hash
+	// PreferredHashes, PreferredSymmetric, PreferredAEADCiphersuites and
+	// PreferredCompression, if not empty, are the algorithm preferences
+	// written verbatim, most preferred first, into the self-signatures of
+	// new keys and identities. Otherwise, the preferences are derived from
+	// DefaultHash, DefaultCipher, AEADConfig and DefaultCompressionAlgo,
+	// followed by the algorithms that every implementation must support.
+	// See ValidatePreferences.
+	PreferredHashes           []crypto.Hash
+	PreferredSymmetric        []CipherFunction
+	PreferredAEADCiphersuites []CipherSuite
+	PreferredCompression      []CompressionAlgo
+	// MaxSignatureSubpacketAreaLength, if positive, is the maximum length in
+	// bytes of each of the hashed and unhashed subpacket areas of the
+	// signatures made with this config. It cannot raise the limit of 65535
+	// bytes imposed by the encoding of the areas. MaxSignatureSubpackets, if
+	// positive, is the maximum number of subpackets of these signatures.
+	// Signing fails with an InvalidArgumentError if a signature, e.g. one
+	// carrying large notations, exceeds these limits.
+	MaxSignatureSubpacketAreaLength int
+	MaxSignatureSubpackets          int
+	// MaxPartialBodyChunks, if positive, is the maximum number of partial
+	// body lengths of a packet read with this config, which bounds the work
+	// done on streams split into many chunks. A first partial body length
+	// shorter than 512 bytes is always rejected.
+	MaxPartialBodyChunks int
 }
 
+// maxSubpacketAreaLength is the largest length of a signature subpacket
+// area that can be encoded. See RFC 4880, section 5.2.3.
+const maxSubpacketAreaLength = 0xffff
+
+// EncryptionVersion selects the packets used for encrypted messages.
+type EncryptionVersion uint8
+
+const (
+	// NegotiateEncryptionVersion uses SEIPDv2 packets if AEADConfig is set
+	// and every recipient supports them, and SEIPDv1 packets otherwise.
+	NegotiateEncryptionVersion EncryptionVersion = iota
+	// ForceSEIPDv1 always uses v3 Public-Key Encrypted Session Key packets
+	// and SEIPDv1 packets, even if AEADConfig is set and every recipient
+	// supports SEIPDv2.
+	ForceSEIPDv1
+	// ForceSEIPDv2 always uses SEIPDv2 packets, with the default AEADConfig
+	// if it is not set, even if some recipients do not advertise support for
+	// them.
+	ForceSEIPDv2
+)
+
+// CriticalSubpacketPolicy defines how signatures with unknown critical
+// subpackets are handled.
+type CriticalSubpacketPolicy uint8
+
+const (
+	// RejectUnknownCriticalSubpackets makes signatures with unknown critical
+	// subpackets fail to parse, with an UnsupportedError.
+	RejectUnknownCriticalSubpackets CriticalSubpacketPolicy = iota
+	// ReportUnknownCriticalSubpackets accepts signatures with unknown
+	// critical subpackets, ignoring these subpackets, and reports each of them
+	// as a WarningUnknownCriticalSubpacket.
+	ReportUnknownCriticalSubpackets
+)
+
 func (c *Config) Random() io.Reader {
 	if c == nil || c.Rand == nil {
 		return rand.Reader
@@ -126,6 +305,27 @@ func (c *Config) Hash() crypto.Hash {
 	return c.DefaultHash
 }
 
+// HashForSigner returns the hash function of the signatures made with the
+// given key: the one returned by SignatureHash, if any, and otherwise the
+// configured hash function, unless the default hash function of the key is
+// stronger.
+func (c *Config) HashForSigner(signer *PublicKey) crypto.Hash {
+	if c != nil && c.SignatureHash != nil {
+		if h := c.SignatureHash(signer); h != 0 {
+			return h
+		}
+	}
+	return strongerHash(c.Hash(), signer.DefaultSignatureHash())
+}
+
+// strongerHash returns h, unless it is available and shorter than d.
+func strongerHash(h, d crypto.Hash) crypto.Hash {
+	if h.Available() && h.Size() < d.Size() {
+		return d
+	}
+	return h
+}
+
 func (c *Config) Cipher() CipherFunction {
 	if c == nil || uint8(c.DefaultCipher) == 0 {
 		return CipherAES128
@@ -148,6 +348,15 @@ func (c *Config) KeyLifetime() uint32 {
 	return c.KeyLifetimeSecs
 }
 
+// SubkeyLifetime returns the validity period of new subkeys, or zero if it
+// is not set.
+func (c *Config) SubkeyLifetime() uint32 {
+	if c == nil {
+		return 0
+	}
+	return c.SubkeyLifetimeSecs
+}
+
 // SigLifetime returns the validity period of the signature.
 func (c *Config) SigLifetime() uint32 {
 	if c == nil {
@@ -246,3 +455,297 @@ func (c *Config) Notations() []*Notation {
 	}
 	return c.SignatureNotations
 }
+
+// PolicyURI returns the URI of the policy under which signatures are issued,
+// or the empty string if signatures carry no Policy URI subpacket.
+func (c *Config) PolicyURI() string {
+	if c == nil {
+		return ""
+	}
+	return c.SignaturePolicyURI
+}
+
+// Warn reports w to the configured WarningSink, if any.
+func (c *Config) Warn(w Warning) {
+	if c == nil || c.Warnings == nil {
+		return
+	}
+	c.Warnings.Warn(w)
+}
+
+// PaddingLength returns a random length for the Padding packet appended to
+// encrypted messages, or zero if padding is disabled.
+func (c *Config) PaddingLength() (int, error) {
+	if c == nil || c.MaxPaddingLength == 0 {
+		return 0, nil
+	}
+	if c.MinPaddingLength < 0 || c.MaxPaddingLength < c.MinPaddingLength {
+		return 0, errors.InvalidArgumentError("invalid padding length range")
+	}
+	extra, err := rand.Int(c.Random(), big.NewInt(int64(c.MaxPaddingLength-c.MinPaddingLength)+1))
+	if err != nil {
+		return 0, err
+	}
+	return c.MinPaddingLength + int(extra.Int64()), nil
+}
+
+// DecryptionConcurrency returns the number of goroutines used to decrypt the
+// encrypted session keys of a message.
+func (c *Config) DecryptionConcurrency() int {
+	if c == nil || c.DecryptionWorkers < 1 {
+		return 1
+	}
+	return c.DecryptionWorkers
+}
+
+// PreserveUnknown returns whether packets of unknown types are preserved as
+// OpaquePacket values rather than skipped.
+func (c *Config) PreserveUnknown() bool {
+	if c == nil {
+		return false
+	}
+	return c.PreserveUnknownPackets
+}
+
+// SubkeyCertificationsAllowed returns whether certifications can be made and
+// verified with subkeys.
+func (c *Config) SubkeyCertificationsAllowed() bool {
+	if c == nil {
+		return false
+	}
+	return c.AllowSubkeyCertifications
+}
+
+// DerivedEncryptionKeysAllowed returns whether encryption subkeys may be
+// derived from signing primary keys.
+func (c *Config) DerivedEncryptionKeysAllowed() bool {
+	if c == nil {
+		return false
+	}
+	return c.AllowDerivedEncryptionKeys
+}
+
+// LibrePGPCompatible returns whether version 5 keys and signatures are read
+// as encoded by LibrePGP implementations.
+func (c *Config) LibrePGPCompatible() bool {
+	if c == nil {
+		return false
+	}
+	return c.LibrePGPCompatibility
+}
+
+// LenientEdDSA returns whether EdDSA values padded with leading zero bytes
+// are accepted.
+func (c *Config) LenientEdDSA() bool {
+	if c == nil {
+		return false
+	}
+	return c.LenientEdDSAEncoding
+}
+
+// SignatureSubpacketAreaLimit returns the maximum length in bytes of each of
+// the subpacket areas of new signatures.
+func (c *Config) SignatureSubpacketAreaLimit() int {
+	if c == nil || c.MaxSignatureSubpacketAreaLength <= 0 || c.MaxSignatureSubpacketAreaLength > maxSubpacketAreaLength {
+		return maxSubpacketAreaLength
+	}
+	return c.MaxSignatureSubpacketAreaLength
+}
+
+// SignatureSubpacketsLimit returns the maximum number of subpackets of new
+// signatures, or zero if it is not limited.
+func (c *Config) SignatureSubpacketsLimit() int {
+	if c == nil || c.MaxSignatureSubpackets < 0 {
+		return 0
+	}
+	return c.MaxSignatureSubpackets
+}
+
+// PartialBodyChunksLimit returns the maximum number of partial body lengths
+// of a packet, or zero if it is not limited.
+func (c *Config) PartialBodyChunksLimit() int {
+	if c == nil || c.MaxPartialBodyChunks < 0 {
+		return 0
+	}
+	return c.MaxPartialBodyChunks
+}
+
+// ForcedEncryptionVersion returns the version of the packets of encrypted
+// messages forced by the config, or NegotiateEncryptionVersion.
+func (c *Config) ForcedEncryptionVersion() EncryptionVersion {
+	if c == nil {
+		return NegotiateEncryptionVersion
+	}
+	return c.EncryptionVersion
+}
+
+// HashPreferences returns the configured hash preferences, or nil.
+func (c *Config) HashPreferences() []crypto.Hash {
+	if c == nil {
+		return nil
+	}
+	return c.PreferredHashes
+}
+
+// SymmetricPreferences returns the configured cipher preferences, or nil.
+func (c *Config) SymmetricPreferences() []CipherFunction {
+	if c == nil {
+		return nil
+	}
+	return c.PreferredSymmetric
+}
+
+// AEADCiphersuitePreferences returns the configured AEAD cipher suite
+// preferences, or nil.
+func (c *Config) AEADCiphersuitePreferences() []CipherSuite {
+	if c == nil {
+		return nil
+	}
+	return c.PreferredAEADCiphersuites
+}
+
+// CompressionPreferences returns the configured compression preferences, or
+// nil.
+func (c *Config) CompressionPreferences() []CompressionAlgo {
+	if c == nil {
+		return nil
+	}
+	return c.PreferredCompression
+}
+
+// ValidatePreferences returns an InvalidConfigurationError if the configured
+// algorithm preferences list an algorithm that this package does not
+// support, or list an algorithm twice. A nil Config is valid.
+func (c *Config) ValidatePreferences() error {
+	if c == nil {
+		return nil
+	}
+	seen := make(map[interface{}]bool)
+	duplicate := func(v interface{}) bool {
+		if seen[v] {
+			return true
+		}
+		seen[v] = true
+		return false
+	}
+	for _, h := range c.PreferredHashes {
+		if _, ok := algorithm.HashToHashId(h); !ok {
+			return errors.InvalidConfigurationError("unsupported preferred hash function " + strconv.Itoa(int(h)))
+		}
+		if duplicate(h) {
+			return errors.InvalidConfigurationError("duplicate preferred hash function " + strconv.Itoa(int(h)))
+		}
+	}
+	for _, cipher := range c.PreferredSymmetric {
+		if _, ok := algorithm.CipherById[uint8(cipher)]; !ok {
+			return errors.InvalidConfigurationError("unknown preferred cipher " + strconv.Itoa(int(cipher)))
+		}
+		if duplicate(cipher) {
+			return errors.InvalidConfigurationError("duplicate preferred cipher " + strconv.Itoa(int(cipher)))
+		}
+	}
+	for _, suite := range c.PreferredAEADCiphersuites {
+		if _, ok := algorithm.CipherById[uint8(suite.Cipher)]; !ok {
+			return errors.InvalidConfigurationError("unknown cipher in preferred AEAD cipher suite " + strconv.Itoa(int(suite.Cipher)))
+		}
+		switch suite.Mode {
+		case AEADModeEAX, AEADModeOCB, AEADModeGCM:
+		default:
+			return errors.InvalidConfigurationError("unsupported AEAD mode in preferred cipher suite " + strconv.Itoa(int(suite.Mode)))
+		}
+		if duplicate(suite) {
+			return errors.InvalidConfigurationError("duplicate preferred AEAD cipher suite")
+		}
+	}
+	for _, algo := range c.PreferredCompression {
+		switch algo {
+		case CompressionNone, CompressionZIP, CompressionZLIB:
+		default:
+			return errors.InvalidConfigurationError("unsupported preferred compression algorithm " + strconv.Itoa(int(algo)))
+		}
+		if duplicate(algo) {
+			return errors.InvalidConfigurationError("duplicate preferred compression algorithm " + strconv.Itoa(int(algo)))
+		}
+	}
+	return nil
+}
+
+// unknownCriticalSubpacket returns whether a signature containing an unknown
+// critical subpacket of the given type is accepted, and whether the subpacket
+// must then be reported as a warning.
+func (c *Config) unknownCriticalSubpacket(subpacketType uint8) (accept, report bool) {
+	if c == nil {
+		return false, false
+	}
+	if c.AcceptCriticalSubpacket != nil && c.AcceptCriticalSubpacket(subpacketType) {
+		return true, false
+	}
+	if c.CriticalSubpackets == ReportUnknownCriticalSubpackets {
+		return true, true
+	}
+	return false, false
+}
+
+// Validate returns an InvalidConfigurationError describing the first option
+// of c that is invalid, or that cannot be used together with other options,
+// such as a public key algorithm and curve that keys of the configured
+// version cannot use. A nil Config is valid.
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+	version := 4
+	if c.V5Keys {
+		version = 5
+	}
+	if err := CheckKeyAlgorithm(version, c.PublicKeyAlgorithm(), c.CurveName()); err != nil {
+		return err
+	}
+	if c.PublicKeyAlgorithm() == PubKeyAlgoRSA && c.RSAModulusBits() < 1024 {
+		return errors.InvalidConfigurationError("RSA modulus must be at least 1024 bits")
+	}
+	if c.DefaultCipher != 0 {
+		if _, ok := algorithm.CipherById[uint8(c.DefaultCipher)]; !ok {
+			return errors.InvalidConfigurationError("unknown cipher " + strconv.Itoa(int(c.DefaultCipher)))
+		}
+	}
+	if c.DefaultHash != 0 {
+		if _, ok := algorithm.HashToHashId(c.DefaultHash); !ok {
+			return errors.InvalidConfigurationError("unsupported hash function " + strconv.Itoa(int(c.DefaultHash)))
+		}
+	}
+	switch c.DefaultCompressionAlgo {
+	case CompressionNone, CompressionZIP, CompressionZLIB:
+	default:
+		return errors.InvalidConfigurationError("unsupported compression algorithm " + strconv.Itoa(int(c.DefaultCompressionAlgo)))
+	}
+	if c.CompressionConfig != nil && (c.CompressionConfig.Level < DefaultCompression || c.CompressionConfig.Level > BestCompression) {
+		return errors.InvalidConfigurationError("compression level out of range: " + strconv.Itoa(c.CompressionConfig.Level))
+	}
+	if c.AEADConfig != nil {
+		switch c.AEADConfig.DefaultMode {
+		case 0, AEADModeEAX, AEADModeOCB, AEADModeGCM:
+		default:
+			return errors.InvalidConfigurationError("unsupported AEAD mode " + strconv.Itoa(int(c.AEADConfig.DefaultMode)))
+		}
+		if c.AEADConfig.CheckChunkSize() != nil {
+			return errors.InvalidConfigurationError("aead chunk size out of range: " + strconv.FormatUint(c.AEADConfig.ChunkSize, 10))
+		}
+	}
+	if c.MaxPaddingLength != 0 && (c.MinPaddingLength < 0 || c.MaxPaddingLength < c.MinPaddingLength) {
+		return errors.InvalidConfigurationError("invalid padding length range")
+	}
+	if c.CriticalSubpackets > ReportUnknownCriticalSubpackets {
+		return errors.InvalidConfigurationError("unknown critical subpacket policy " + strconv.Itoa(int(c.CriticalSubpackets)))
+	}
+	if c.MaxSignatureSubpacketAreaLength < 0 || c.MaxSignatureSubpackets < 0 {
+		return errors.InvalidConfigurationError("negative signature subpacket limit")
+	}
+	if c.MaxPartialBodyChunks < 0 {
+		return errors.InvalidConfigurationError("negative partial body chunk limit")
+	}
+	if c.EncryptionVersion > ForceSEIPDv2 {
+		return errors.InvalidConfigurationError("unknown encryption version " + strconv.Itoa(int(c.EncryptionVersion)))
+	}
+	return c.ValidatePreferences()
+}
@@ -0,0 +1,116 @@
+package packet
+
+import (
+	"bytes"
+	"crypto"
+
+	"github.com/ProtonMail/go-crypto/openpgp/s2k"
+)
+
+// EffectiveDefaults lists the algorithms and parameters that operations
+// use with a given Config, once the defaults of unset options are applied.
+// See Config.EffectiveDefaults.
+type EffectiveDefaults struct {
+	// Cipher is the cipher of encrypted messages and private keys.
+	Cipher CipherFunction
+	// Hash is the hash function of signatures: the configured one, raised
+	// to SHA-256 if it is weaker, unless a signing key requires a stronger
+	// one or Config.SignatureHash selects another one.
+	Hash crypto.Hash
+	// Compression is the compression algorithm of messages.
+	Compression CompressionAlgo
+
+	// KeyVersion is the version of new keys.
+	KeyVersion int
+	// PublicKeyAlgorithm is the algorithm of new keys. RSABits is the size
+	// of new RSA keys, and Curve is the curve of new elliptic curve keys;
+	// each is only set if it applies to PublicKeyAlgorithm.
+	PublicKeyAlgorithm PublicKeyAlgorithm
+	RSABits            int
+	Curve              Curve
+	// KeyLifetimeSecs, SubkeyLifetimeSecs and SigLifetimeSecs are the
+	// validity periods of new keys, subkeys and signatures, or zero if they
+	// do not expire. See Config.SubkeyLifetimeSecs for subkeys.
+	KeyLifetimeSecs    uint32
+	SubkeyLifetimeSecs uint32
+	SigLifetimeSecs    uint32
+
+	// AEAD is true if messages are encrypted with AEAD, as SEIPDv2 packets,
+	// when all recipients support it. AEADMode is the AEAD mode of such
+	// messages, and AEADChunkSize their chunk size, or zero if it is chosen
+	// by the size of each message.
+	AEAD          bool
+	AEADMode      AEADMode
+	AEADChunkSize uint64
+	// EncryptionVersion is the forced version of encrypted messages, if any.
+	EncryptionVersion EncryptionVersion
+
+	// S2KMode is the S2K function that derives keys from passphrases, for
+	// private keys and passphrase-encrypted messages. S2KHash and S2KCount
+	// are the hash function and the number of bytes hashed by the Salted
+	// and Iterated and Salted functions, while Argon2Passes,
+	// Argon2Parallelism and Argon2Memory, in KiB, are the parameters of
+	// Argon2. Fields that do not apply to S2KMode are zero.
+	S2KMode           s2k.Mode
+	S2KHash           crypto.Hash
+	S2KCount          int
+	Argon2Passes      uint8
+	Argon2Parallelism uint8
+	Argon2Memory      uint32
+}
+
+// EffectiveDefaults returns the algorithms and parameters that operations
+// use with c, which may be nil or partially set. It lets callers, such as
+// security reviews and tests, check what a given version of this package
+// does without reading its source. It returns an error if c cannot derive
+// keys from passphrases.
+func (c *Config) EffectiveDefaults() (*EffectiveDefaults, error) {
+	d := &EffectiveDefaults{
+		Cipher:             c.Cipher(),
+		Hash:               strongerHash(c.Hash(), crypto.SHA256),
+		Compression:        c.Compression(),
+		KeyVersion:         4,
+		PublicKeyAlgorithm: c.PublicKeyAlgorithm(),
+		KeyLifetimeSecs:    c.KeyLifetime(),
+		SubkeyLifetimeSecs: c.SubkeyLifetime(),
+		SigLifetimeSecs:    c.SigLifetime(),
+		EncryptionVersion:  c.ForcedEncryptionVersion(),
+	}
+	if c != nil && c.V5Keys {
+		d.KeyVersion = 5
+	}
+	switch d.PublicKeyAlgorithm {
+	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly, PubKeyAlgoRSAEncryptOnly:
+		d.RSABits = c.RSAModulusBits()
+	case PubKeyAlgoECDSA, PubKeyAlgoEdDSA, PubKeyAlgoECDH:
+		d.Curve = c.CurveName()
+	}
+
+	aead := c.AEAD()
+	if (aead != nil && d.EncryptionVersion != ForceSEIPDv1) || d.EncryptionVersion == ForceSEIPDv2 {
+		d.AEAD = true
+		d.AEADMode = aead.Mode()
+		if aead != nil && aead.ChunkSize != 0 {
+			d.AEADChunkSize = aead.ChunkSizeFor(0)
+		}
+	}
+
+	// The S2K parameters are those that s2k.Generate produces. It is passed
+	// a copy of the S2K config, which it may modify, and a zero salt.
+	var s2kConfig *s2k.Config
+	if conf := c.S2K(); conf != nil {
+		copied := *conf
+		s2kConfig = &copied
+	}
+	params, err := s2k.Generate(bytes.NewReader(make([]byte, s2k.Argon2SaltSize)), s2kConfig)
+	if err != nil {
+		return nil, err
+	}
+	d.S2KMode = params.Mode()
+	d.S2KHash, _ = params.Hash()
+	d.S2KCount = params.Count()
+	d.Argon2Passes = params.Passes()
+	d.Argon2Parallelism = params.Parallelism()
+	d.Argon2Memory = params.Memory()
+	return d, nil
+}
@@ -0,0 +1,185 @@
+package packet
+
+import (
+	"crypto"
+	"crypto/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/eddsa"
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/ecc"
+	"github.com/ProtonMail/go-crypto/openpgp/s2k"
+)
+
+func TestCheckKeyAlgorithm(t *testing.T) {
+	tests := []struct {
+		version   int
+		algorithm PublicKeyAlgorithm
+		curve     Curve
+		ok        bool
+	}{
+		{4, PubKeyAlgoRSA, "", true},
+		{4, PubKeyAlgoEdDSA, Curve25519, true},
+		{5, PubKeyAlgoECDSA, CurveBrainpoolP384, true},
+		{5, PubKeyAlgoECDH, Curve448, true},
+		{4, PubKeyAlgoECDSA, Curve25519, false},
+		{4, PubKeyAlgoEdDSA, CurveNistP256, false},
+		{4, PublicKeyAlgorithm(100), "", false},
+		{6, PubKeyAlgoEdDSA, Curve25519, false},
+	}
+	for _, test := range tests {
+		err := CheckKeyAlgorithm(test.version, test.algorithm, test.curve)
+		if test.ok && err != nil {
+			t.Errorf("v%d, algorithm %d, curve %q: unexpected error: %s", test.version, test.algorithm, test.curve, err)
+		}
+		if !test.ok {
+			if _, ok := err.(errors.InvalidConfigurationError); !ok {
+				t.Errorf("v%d, algorithm %d, curve %q: expected InvalidConfigurationError, got: %v", test.version, test.algorithm, test.curve, err)
+			}
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := []*Config{
+		nil,
+		{},
+		{Algorithm: PubKeyAlgoECDSA, Curve: CurveNistP384, V5Keys: true},
+		{AEADConfig: &AEADConfig{DefaultMode: AEADModeGCM, ChunkSize: 1 << 20}},
+		{MinPaddingLength: 16, MaxPaddingLength: 32},
+		{MaxSignatureSubpacketAreaLength: 1024, MaxSignatureSubpackets: 16},
+		{CompressionConfig: &CompressionConfig{Level: BestSpeed}},
+		{
+			PreferredHashes:           []crypto.Hash{crypto.SHA512, crypto.SHA256},
+			PreferredSymmetric:        []CipherFunction{CipherAES256, CipherAES128},
+			PreferredAEADCiphersuites: []CipherSuite{{CipherAES256, AEADModeOCB}, {CipherAES256, AEADModeGCM}},
+			PreferredCompression:      []CompressionAlgo{CompressionNone},
+		},
+	}
+	for i, config := range valid {
+		if err := config.Validate(); err != nil {
+			t.Errorf("#%d: unexpected error: %s", i, err)
+		}
+	}
+
+	invalid := []*Config{
+		{Algorithm: PubKeyAlgoECDSA, Curve: Curve25519},
+		{RSABits: 512},
+		{DefaultCipher: CipherFunction(42)},
+		{DefaultCompressionAlgo: CompressionAlgo(3)},
+		{AEADConfig: &AEADConfig{DefaultMode: AEADMode(4)}},
+		{AEADConfig: &AEADConfig{ChunkSize: 1}},
+		{MinPaddingLength: 32, MaxPaddingLength: 16},
+		{MaxSignatureSubpackets: -1},
+		{CompressionConfig: &CompressionConfig{Level: 10}},
+		{PreferredHashes: []crypto.Hash{crypto.MD4}},
+		{PreferredHashes: []crypto.Hash{crypto.SHA256, crypto.SHA256}},
+		{PreferredSymmetric: []CipherFunction{CipherFunction(42)}},
+		{PreferredAEADCiphersuites: []CipherSuite{{CipherAES128, AEADMode(4)}}},
+		{PreferredAEADCiphersuites: []CipherSuite{{CipherAES128, AEADModeOCB}, {CipherAES128, AEADModeOCB}}},
+		{PreferredCompression: []CompressionAlgo{CompressionAlgo(3)}},
+	}
+	for i, config := range invalid {
+		if _, ok := config.Validate().(errors.InvalidConfigurationError); !ok {
+			t.Errorf("#%d: expected InvalidConfigurationError", i)
+		}
+	}
+}
+
+func TestHashForSigner(t *testing.T) {
+	ed25519Priv, err := eddsa.GenerateKey(rand.Reader, ecc.NewEd25519())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed448Priv, err := eddsa.GenerateKey(rand.Reader, ecc.NewEd448())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ed25519Key := &NewEdDSAPrivateKey(time.Now(), ed25519Priv).PublicKey
+	ed448Key := &NewEdDSAPrivateKey(time.Now(), ed448Priv).PublicKey
+
+	tests := []struct {
+		config *Config
+		signer *PublicKey
+		want   crypto.Hash
+	}{
+		{nil, ed25519Key, crypto.SHA256},
+		{nil, ed448Key, crypto.SHA512},
+		{&Config{DefaultHash: crypto.SHA384}, ed25519Key, crypto.SHA384},
+		{&Config{DefaultHash: crypto.SHA384}, ed448Key, crypto.SHA512},
+		{&Config{DefaultHash: crypto.SHA3_512}, ed448Key, crypto.SHA3_512},
+		{&Config{SignatureHash: func(*PublicKey) crypto.Hash { return crypto.SHA3_512 }}, ed25519Key, crypto.SHA3_512},
+		{&Config{SignatureHash: func(*PublicKey) crypto.Hash { return 0 }}, ed448Key, crypto.SHA512},
+	}
+	for i, test := range tests {
+		if got := test.config.HashForSigner(test.signer); got != test.want {
+			t.Errorf("#%d: got hash %v, want %v", i, got, test.want)
+		}
+	}
+}
+
+func TestConfigEffectiveDefaults(t *testing.T) {
+	d, err := (*Config)(nil).EffectiveDefaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &EffectiveDefaults{
+		Cipher:             CipherAES128,
+		Hash:               crypto.SHA256,
+		Compression:        CompressionNone,
+		KeyVersion:         4,
+		PublicKeyAlgorithm: PubKeyAlgoRSA,
+		RSABits:            2048,
+		S2KMode:            s2k.IteratedSaltedS2K,
+		S2KHash:            crypto.SHA256,
+		S2KCount:           16777216,
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("unexpected defaults of a nil config: %+v", d)
+	}
+
+	s2kConfig := &s2k.Config{S2KMode: s2k.Argon2S2K}
+	config := &Config{
+		Algorithm:  PubKeyAlgoEdDSA,
+		V5Keys:     true,
+		AEADConfig: &AEADConfig{},
+		S2KConfig:  s2kConfig,
+	}
+	d, err = config.EffectiveDefaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.KeyVersion != 5 || d.Curve != Curve25519 || d.RSABits != 0 {
+		t.Errorf("unexpected key defaults: %+v", d)
+	}
+	if !d.AEAD || d.AEADMode != AEADModeOCB || d.AEADChunkSize != 0 {
+		t.Errorf("unexpected AEAD defaults: %+v", d)
+	}
+	if d.S2KMode != s2k.Argon2S2K || d.S2KHash != 0 || d.Argon2Passes != 3 ||
+		d.Argon2Parallelism != 4 || d.Argon2Memory != 64*1024 {
+		t.Errorf("unexpected S2K defaults: %+v", d)
+	}
+	if *s2kConfig != (s2k.Config{S2KMode: s2k.Argon2S2K}) {
+		t.Error("S2K config modified")
+	}
+
+	// Hash functions weaker than SHA-256 are not used for signatures.
+	for _, h := range []crypto.Hash{crypto.SHA1, crypto.SHA224} {
+		d, err = (&Config{DefaultHash: h}).EffectiveDefaults()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Hash != crypto.SHA256 {
+			t.Errorf("got hash %v for default hash %v, want SHA-256", d.Hash, h)
+		}
+	}
+	d, err = (&Config{DefaultHash: crypto.SHA512}).EffectiveDefaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Hash != crypto.SHA512 {
+		t.Errorf("got hash %v, want SHA-512", d.Hash)
+	}
+}
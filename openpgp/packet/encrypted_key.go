@@ -7,6 +7,7 @@ package packet
 import (
 	"crypto"
 	"crypto/rsa"
+	"crypto/subtle"
 	"encoding/binary"
 	"io"
 	"math/big"
@@ -15,6 +16,7 @@ import (
 	"github.com/ProtonMail/go-crypto/openpgp/ecdh"
 	"github.com/ProtonMail/go-crypto/openpgp/elgamal"
 	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/algorithm"
 	"github.com/ProtonMail/go-crypto/openpgp/internal/encoding"
 )
 
@@ -98,11 +100,14 @@ func (e *EncryptedKey) Decrypt(priv *PrivateKey, config *Config) error {
 	var err error
 	var b []byte
 
-	// TODO(agl): use session key decryption routines here to avoid
-	// padding oracle attacks.
 	switch priv.PubKeyAlgo {
 	case PubKeyAlgoRSA, PubKeyAlgoRSAEncryptOnly:
-		// Supports both *rsa.PrivateKey and crypto.Decrypter
+		if k, ok := priv.PrivateKey.(*rsa.PrivateKey); ok {
+			b, err = decryptRSASessionKey(config.Random(), k, padToKeySize(&k.PublicKey, e.encryptedMPI1.Bytes()))
+			break
+		}
+		// Other crypto.Decrypter implementations (e.g. hardware tokens)
+		// do not expose the session key decryption routines.
 		k := priv.PrivateKey.(crypto.Decrypter)
 		b, err = k.Decrypt(config.Random(), padToKeySize(k.Public().(*rsa.PublicKey), e.encryptedMPI1.Bytes()), nil)
 	case PubKeyAlgoElGamal:
@@ -115,28 +120,75 @@ func (e *EncryptedKey) Decrypt(priv *PrivateKey, config *Config) error {
 		oid := priv.PublicKey.oid.EncodedBytes()
 		b, err = ecdh.Decrypt(priv.PrivateKey.(*ecdh.PrivateKey), vsG, m, oid, priv.PublicKey.Fingerprint[:])
 	default:
-		err = errors.InvalidArgumentError("cannot decrypt encrypted session key with private key of type " + strconv.Itoa(int(priv.PubKeyAlgo)))
+		return errors.InvalidArgumentError("cannot decrypt encrypted session key with private key of type " + strconv.Itoa(int(priv.PubKeyAlgo)))
 	}
 
-	if err != nil {
-		return err
+	// Decryption failures, malformed session key blocks and bad checksums
+	// are reported with the same error, and the cipher octet and the
+	// checksum are checked together and in constant time, so that a
+	// malformed session key cannot be told apart from a bad checksum.
+	if err != nil || sessionKeyBlockValid(b) != 1 {
+		return errors.ErrSessionKeyDecryption
 	}
-
 	e.CipherFunc = CipherFunction(b[0])
-	if !e.CipherFunc.IsSupported() {
-		return errors.UnsupportedError("unsupported encryption function")
-	}
-
 	e.Key = b[1 : len(b)-2]
-	expectedChecksum := uint16(b[len(b)-2])<<8 | uint16(b[len(b)-1])
-	checksum := checksumKeyMaterial(e.Key)
-	if checksum != expectedChecksum {
-		return errors.StructuralError("EncryptedKey checksum incorrect")
-	}
 
 	return nil
 }
 
+// sessionKeyBlockLengths lists the possible lengths of a decrypted v3 session
+// key block (cipher octet, session key and two-octet checksum) for the key
+// sizes of the supported ciphers.
+var sessionKeyBlockLengths = []int{1 + 16 + 2, 1 + 24 + 2, 1 + 32 + 2}
+
+// decryptRSASessionKey decrypts an RSA encrypted session key block without
+// revealing, through errors or timing, whether the PKCS #1 v1.5 padding was
+// valid. The plaintext is decrypted for every possible session key block
+// length with rsa.DecryptPKCS1v15SessionKey, which falls back to a random key
+// on failure; the block that is well-formed is then selected in constant
+// time. If no block is well-formed, a random invalid block is returned and
+// rejected by the caller in the same way as a bad checksum.
+func decryptRSASessionKey(rand io.Reader, priv *rsa.PrivateKey, ciphertext []byte) ([]byte, error) {
+	maxLen := sessionKeyBlockLengths[len(sessionKeyBlockLengths)-1]
+	selected := make([]byte, maxLen)
+	selectedLen := maxLen
+	block := make([]byte, maxLen)
+	for _, l := range sessionKeyBlockLengths {
+		if _, err := io.ReadFull(rand, block[:l]); err != nil {
+			return nil, err
+		}
+		// Make sure the random fallback can never be a valid block.
+		block[0] = 0
+		if err := rsa.DecryptPKCS1v15SessionKey(rand, priv, ciphertext, block[:l]); err != nil {
+			return nil, err
+		}
+		valid := sessionKeyBlockValid(block[:l])
+		subtle.ConstantTimeCopy(valid, selected[:l], block[:l])
+		selectedLen = subtle.ConstantTimeSelect(valid, l, selectedLen)
+	}
+	return selected[:selectedLen], nil
+}
+
+// sessionKeyBlockValid returns 1 if b is a well-formed session key block, that
+// is, a supported cipher octet whose key size matches the length of the key,
+// followed by the key and its checksum, and 0 otherwise. It runs in time
+// independent of the contents of b.
+func sessionKeyBlockValid(b []byte) int {
+	if len(b) < 3 {
+		return 0
+	}
+	keyLen := len(b) - 3
+	cipherOk := 0
+	for id := range algorithm.CipherById {
+		sameCipher := subtle.ConstantTimeByteEq(b[0], id)
+		sameSize := subtle.ConstantTimeEq(int32(CipherFunction(id).KeySize()), int32(keyLen))
+		cipherOk |= sameCipher & sameSize
+	}
+	expectedChecksum := uint16(b[len(b)-2])<<8 | uint16(b[len(b)-1])
+	checksum := checksumKeyMaterial(b[1 : len(b)-2])
+	return cipherOk & subtle.ConstantTimeEq(int32(checksum), int32(expectedChecksum))
+}
+
 // Serialize writes the encrypted key packet, e, to w.
 func (e *EncryptedKey) Serialize(w io.Writer) error {
 	var mpiLen int
@@ -211,6 +263,46 @@ func SerializeEncryptedKey(w io.Writer, pub *PublicKey, cipherFunc CipherFunctio
 	return errors.UnsupportedError("encrypting a key to public key of type " + strconv.Itoa(int(pub.PubKeyAlgo)))
 }
 
+// SerializeEncryptedKeys generates a random session key for the cipher of
+// config and serializes an encrypted key packet to w for each of the given
+// public keys, containing the session key encrypted to that key. Keys with the
+// same fingerprint are only written once. The session key and its cipher are
+// returned and must be passed to SerializeSymmetricallyEncrypted.
+// If config is nil, sensible defaults will be used.
+func SerializeEncryptedKeys(w io.Writer, pubs []*PublicKey, config *Config) (sessionKey []byte, cipherFunc CipherFunction, err error) {
+	cipherFunc = config.Cipher()
+	sessionKey = make([]byte, cipherFunc.KeySize())
+	if _, err = io.ReadFull(config.Random(), sessionKey); err != nil {
+		return nil, 0, err
+	}
+	if err = SerializeEncryptedKeysReuseKey(w, pubs, cipherFunc, sessionKey, config); err != nil {
+		return nil, 0, err
+	}
+	return sessionKey, cipherFunc, nil
+}
+
+// SerializeEncryptedKeysReuseKey serializes an encrypted key packet to w for
+// each of the given public keys, containing the given session key encrypted
+// to that key. Keys with the same fingerprint are only written once.
+// If config is nil, sensible defaults will be used.
+func SerializeEncryptedKeysReuseKey(w io.Writer, pubs []*PublicKey, cipherFunc CipherFunction, sessionKey []byte, config *Config) error {
+	if len(pubs) == 0 {
+		return errors.InvalidArgumentError("no encryption recipient provided")
+	}
+	written := make(map[string]bool, len(pubs))
+	for _, pub := range pubs {
+		fingerprint := string(pub.Fingerprint)
+		if written[fingerprint] {
+			continue
+		}
+		if err := SerializeEncryptedKey(w, pub, cipherFunc, sessionKey, config); err != nil {
+			return err
+		}
+		written[fingerprint] = true
+	}
+	return nil
+}
+
 func serializeEncryptedKeyRSA(w io.Writer, rand io.Reader, header [10]byte, pub *rsa.PublicKey, keyBlock []byte) error {
 	cipherText, err := rsa.EncryptPKCS1v15(rand, pub, keyBlock)
 	if err != nil {
@@ -6,6 +6,8 @@ package packet
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -14,6 +16,9 @@ import (
 
 	"crypto"
 	"crypto/rsa"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/encoding"
 )
 
 func bigFromBase10(s string) *big.Int {
@@ -84,6 +89,53 @@ func TestDecryptingEncryptedKey(t *testing.T) {
 	}
 }
 
+func TestDecryptingEncryptedKeyMalformed(t *testing.T) {
+	const encryptedKeyHex = "c18c032a67d68660df41c70104005789d0de26b6a50c985a02a13131ca829c413a35d0e6fa8d6842599252162808ac7439c72151c8c6183e76923fe3299301414d0c25a2f06a2257db3839e7df0ec964773f6e4c4ac7ff3b48c444237166dd46ba8ff443a5410dc670cb486672fdbe7c9dfafb75b4fea83af3a204fe2a7dfa86bd20122b4f3d2646cbeecb8f7be8"
+
+	// Corrupt the ciphertext and encrypt session key blocks that are
+	// correctly padded but carry an unknown cipher, a key of the wrong
+	// size for its cipher or a bad checksum. All of them must fail with
+	// ErrSessionKeyDecryption.
+	corrupted, _ := hex.DecodeString(encryptedKeyHex)
+	corrupted[len(corrupted)-1] ^= 0x01
+	malformed := [][]byte{corrupted}
+
+	key := make([]byte, 16)
+	for _, block := range [][]byte{
+		append(append([]byte{0x42}, key...), 0, 0),
+		append(append([]byte{byte(CipherAES256)}, key...), 0, 0),
+		append(append([]byte{byte(CipherAES128)}, key...), 0, 1),
+	} {
+		cipherText, err := rsa.EncryptPKCS1v15(rand.Reader, &encryptedKeyPub, block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var header [10]byte
+		header[0] = encryptedKeyVersion
+		binary.BigEndian.PutUint64(header[1:9], encryptedKeyPriv.KeyId)
+		header[9] = byte(PubKeyAlgoRSA)
+		cipherMPI := encoding.NewMPI(cipherText)
+		buf := new(bytes.Buffer)
+		if err = serializeHeader(buf, packetTypeEncryptedKey, len(header)+int(cipherMPI.EncodedLength())); err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(header[:])
+		buf.Write(cipherMPI.EncodedBytes())
+		malformed = append(malformed, buf.Bytes())
+	}
+
+	for i, packet := range malformed {
+		p, err := Read(bytes.NewReader(packet))
+		if err != nil {
+			t.Fatalf("#%d: error from Read: %s", i, err)
+		}
+		err = p.(*EncryptedKey).Decrypt(encryptedKeyPriv, nil)
+		if err != errors.ErrSessionKeyDecryption {
+			t.Errorf("#%d: got error %v, expected %q", i, err, errors.ErrSessionKeyDecryption)
+		}
+	}
+}
+
 type rsaDecrypter struct {
 	rsaPrivateKey *rsa.PrivateKey
 	decryptCount  int
@@ -153,8 +205,8 @@ func TestRSADecrypter(t *testing.T) {
 }
 
 func TestEncryptingEncryptedKey(t *testing.T) {
-	key := []byte{1, 2, 3, 4}
-	const expectedKeyHex = "01020304"
+	key := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	const expectedKeyHex = "0102030405060708090a0b0c0d0e0f10"
 	const keyId = 0x2a67d68660df41c7
 
 	pub := &PublicKey{
@@ -224,3 +276,54 @@ func TestSerializingEncryptedKey(t *testing.T) {
 		t.Fatalf("serialization of encrypted key differed from original. Original was %s, but reserialized as %s", encryptedKeyHex, bufHex)
 	}
 }
+
+func TestSerializeEncryptedKeys(t *testing.T) {
+	newPub := func(fingerprint byte) *PublicKey {
+		return &PublicKey{
+			PublicKey:   &encryptedKeyPub,
+			KeyId:       0x2a67d68660df41c7,
+			PubKeyAlgo:  PubKeyAlgoRSA,
+			Fingerprint: bytes.Repeat([]byte{fingerprint}, 20),
+		}
+	}
+	pubs := []*PublicKey{newPub(1), newPub(2), newPub(1)}
+
+	buf := new(bytes.Buffer)
+	config := &Config{DefaultCipher: CipherAES256}
+	sessionKey, cipherFunc, err := SerializeEncryptedKeys(buf, pubs, config)
+	if err != nil {
+		t.Fatalf("error writing encrypted key packets: %s", err)
+	}
+	if cipherFunc != CipherAES256 || len(sessionKey) != CipherAES256.KeySize() {
+		t.Fatalf("unexpected session key: cipher %d, %d bytes", cipherFunc, len(sessionKey))
+	}
+
+	count := 0
+	for {
+		p, err := Read(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error from Read: %s", err)
+		}
+		ek, ok := p.(*EncryptedKey)
+		if !ok {
+			t.Fatalf("didn't parse an EncryptedKey, got %#v", p)
+		}
+		if err = ek.Decrypt(encryptedKeyPriv, nil); err != nil {
+			t.Fatalf("error from Decrypt: %s", err)
+		}
+		if ek.CipherFunc != cipherFunc || !bytes.Equal(ek.Key, sessionKey) {
+			t.Errorf("unexpected EncryptedKey contents: %#v", ek)
+		}
+		count++
+	}
+	if count != 2 {
+		t.Errorf("got %d encrypted key packets, want 2", count)
+	}
+
+	if _, _, err = SerializeEncryptedKeys(new(bytes.Buffer), nil, nil); err == nil {
+		t.Error("expected an error without recipients")
+	}
+}
@@ -0,0 +1,155 @@
+package packet
+
+import (
+	"crypto/elliptic"
+	"crypto/sha1"
+	"encoding/hex"
+	"math/big"
+	"strconv"
+	"sync"
+
+	"github.com/ProtonMail/go-crypto/brainpool"
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/ecc"
+)
+
+// keygripCurve holds the domain parameters of an elliptic curve, as hashed
+// by libgcrypt when computing keygrips.
+type keygripCurve struct {
+	p, a, b, g, n []byte
+}
+
+// newWeierstrassKeygripCurve returns the domain parameters of the short
+// Weierstrass curve c, with coefficients a and b.
+func newWeierstrassKeygripCurve(c elliptic.Curve, a, b []byte) *keygripCurve {
+	params := c.Params()
+	size := (params.BitSize + 7) / 8
+	g := make([]byte, 1+2*size)
+	g[0] = 4
+	gx, gy := params.Gx.Bytes(), params.Gy.Bytes()
+	copy(g[1+size-len(gx):], gx)
+	copy(g[1+2*size-len(gy):], gy)
+	return &keygripCurve{
+		p: params.P.Bytes(),
+		a: a,
+		b: b,
+		g: g,
+		n: params.N.Bytes(),
+	}
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+var (
+	keygripCurvesOnce sync.Once
+	keygripCurves     map[string]*keygripCurve
+)
+
+// initKeygripCurves sets keygripCurves to the domain parameters of the
+// curves for which keygrips are supported, indexed by ecc.CurveInfo.GenName.
+func initKeygripCurves() {
+	nistCurve := func(c elliptic.Curve) *keygripCurve {
+		// a = -3 mod p
+		a := new(big.Int).Sub(c.Params().P, big.NewInt(3))
+		return newWeierstrassKeygripCurve(c, a.Bytes(), c.Params().B.Bytes())
+	}
+	brainpoolCurve := func(c elliptic.Curve, a, b string) *keygripCurve {
+		// The brainpool package does not expose the coefficients of the
+		// random curves.
+		return newWeierstrassKeygripCurve(c, mustDecodeHex(a), mustDecodeHex(b))
+	}
+	curve25519P := "7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffed"
+	curve25519N := "1000000000000000000000000000000014def9dea2f79cd65812631a5cf5d3ed"
+	keygripCurves = map[string]*keygripCurve{
+		"P256": nistCurve(elliptic.P256()),
+		"P384": nistCurve(elliptic.P384()),
+		"P521": nistCurve(elliptic.P521()),
+		"BrainpoolP256": brainpoolCurve(brainpool.P256r1(),
+			"7d5a0975fc2c3057eef67530417affe7fb8055c126dc5c6ce94a4b44f330b5d9",
+			"26dc5c6ce94a4b44f330b5d9bbd77cbf958416295cf7e1ce6bccdc18ff8c07b6"),
+		"BrainpoolP384": brainpoolCurve(brainpool.P384r1(),
+			"7bc382c63d8c150c3c72080ace05afa0c2bea28e4fb22787139165efba91f90f8aa5814a503ad4eb04a8c7dd22ce2826",
+			"04a8c7dd22ce28268b39b55416f0447c2fb77de107dcd2a62e880ea53eeb62d57cb4390295dbc9943ab78696fa504c11"),
+		"BrainpoolP512": brainpoolCurve(brainpool.P512r1(),
+			"7830a3318b603b89e2327145ac234cc594cbdd8d3df91610a83441caea9863bc2ded5d5aa8253aa10a2ef1c98b9ac8b57f1117a72bf2c7b9e7c1ac4d77fc94ca",
+			"3df91610a83441caea9863bc2ded5d5aa8253aa10a2ef1c98b9ac8b57f1117a72bf2c7b9e7c1ac4d77fc94cadc083e67984050b75ebae5dd2809bd638016f723"),
+		// libgcrypt stores the negative coefficients of Ed25519 by their
+		// absolute value.
+		"Ed25519": {
+			p: mustDecodeHex(curve25519P),
+			a: []byte{0x01},
+			b: mustDecodeHex("2dfc9311d490018c7338bf8688861767ff8ff5b2bebe27548a14b235eca6874a"),
+			g: mustDecodeHex("04" +
+				"216936d3cd6e53fec0a4e231fdd6dc5c692cc7609525a7b2c9562d608f25d51a" +
+				"6666666666666666666666666666666666666666666666666666666666666658"),
+			n: mustDecodeHex(curve25519N),
+		},
+		"Curve25519": {
+			p: mustDecodeHex(curve25519P),
+			a: mustDecodeHex("01db41"),
+			b: []byte{0x01},
+			g: mustDecodeHex("04" +
+				"0000000000000000000000000000000000000000000000000000000000000009" +
+				"20ae19a1b8a086b4e01edd2c7748d14c923d4d7e6d7c61b229e9c5a27eced3d9"),
+			n: mustDecodeHex(curve25519N),
+		},
+	}
+}
+
+// Keygrip returns the keygrip of the key, as computed by libgcrypt. GnuPG
+// uses keygrips to identify keys in gpg-agent and on smartcards. Keygrips
+// are supported for RSA keys, and for ECDSA, EdDSA and ECDH keys on the NIST,
+// Brainpool and 25519 curves.
+func (pk *PublicKey) Keygrip() ([]byte, error) {
+	h := sha1.New()
+	switch pk.PubKeyAlgo {
+	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly, PubKeyAlgoRSAEncryptOnly:
+		// The modulus is hashed as a signed big-endian integer.
+		n := pk.n.Bytes()
+		if len(n) > 0 && n[0]&0x80 != 0 {
+			h.Write([]byte{0})
+		}
+		h.Write(n)
+	case PubKeyAlgoECDSA, PubKeyAlgoEdDSA, PubKeyAlgoECDH:
+		curveInfo := ecc.FindByOid(pk.oid)
+		if curveInfo == nil {
+			return nil, errors.UnsupportedError("unknown curve for keygrip")
+		}
+		name := curveInfo.GenName
+		q := pk.p.Bytes()
+		if pk.PubKeyAlgo == PubKeyAlgoEdDSA && name == "Curve25519" {
+			// EdDSA points are hashed in their compact form, without the
+			// 0x40 prefix.
+			name = "Ed25519"
+			if len(q) == 33 && q[0] == 0x40 {
+				q = q[1:]
+			}
+		}
+		keygripCurvesOnce.Do(initKeygripCurves)
+		curve, ok := keygripCurves[name]
+		if !ok {
+			return nil, errors.UnsupportedError("keygrip for curve " + curveInfo.GenName)
+		}
+		for _, param := range []struct {
+			name  byte
+			value []byte
+		}{
+			{'p', curve.p}, {'a', curve.a}, {'b', curve.b}, {'g', curve.g}, {'n', curve.n}, {'q', q},
+		} {
+			h.Write([]byte("(1:"))
+			h.Write([]byte{param.name})
+			h.Write([]byte(strconv.Itoa(len(param.value)) + ":"))
+			h.Write(param.value)
+			h.Write([]byte(")"))
+		}
+	default:
+		return nil, errors.UnsupportedError("keygrip for public key algorithm " + strconv.Itoa(int(pk.PubKeyAlgo)))
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,79 @@
+package packet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/internal/ecc"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/encoding"
+)
+
+// Test vectors from libgcrypt's tests/t-keygrip.c.
+var keygripTests = []struct {
+	algo    PublicKeyAlgorithm
+	curve   string
+	q       string
+	keygrip string
+}{
+	{
+		PubKeyAlgoECDSA, "P256",
+		"04c8a4cec2e9a9bc8e173531a67b0840df345c32e261add780e6d83d56efadfd5de872f8b854819b59543ce0b7f822330464fbc4e6324daddcd9d059554f63b344",
+		"e6df942dbd8c7705a3dd416efc0401db310e99b6",
+	},
+	{
+		PubKeyAlgoEdDSA, "Curve25519",
+		"40773e72848c1fd5f9652b29e2e7af79571a04990e96f2016bf4e0ec1890c2b7db",
+		"9db6c64a38830f4960701789475520be8c821f47",
+	},
+}
+
+func TestKeygrip(t *testing.T) {
+	for i, test := range keygripTests {
+		var oid *encoding.OID
+		for _, curveInfo := range ecc.Curves {
+			if curveInfo.GenName != test.curve {
+				continue
+			}
+			_, isEdDSA := curveInfo.Curve.(ecc.EdDSACurve)
+			if isEdDSA == (test.algo == PubKeyAlgoEdDSA) {
+				oid = curveInfo.Oid
+				break
+			}
+		}
+		q, _ := hex.DecodeString(test.q)
+		pk := &PublicKey{PubKeyAlgo: test.algo, oid: oid, p: encoding.NewMPI(q)}
+
+		keygrip, err := pk.Keygrip()
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if want, _ := hex.DecodeString(test.keygrip); !bytes.Equal(keygrip, want) {
+			t.Errorf("#%d: wrong keygrip: got %x, want %s", i, keygrip, test.keygrip)
+		}
+	}
+}
+
+func TestKeygripWeierstrassCurves(t *testing.T) {
+	keygripCurvesOnce.Do(initKeygripCurves)
+	for _, name := range []string{"P256", "P384", "P521", "BrainpoolP256", "BrainpoolP384", "BrainpoolP512"} {
+		curve := keygripCurves[name]
+		p := new(big.Int).SetBytes(curve.p)
+		a := new(big.Int).SetBytes(curve.a)
+		b := new(big.Int).SetBytes(curve.b)
+		size := (len(curve.g) - 1) / 2
+		x := new(big.Int).SetBytes(curve.g[1 : 1+size])
+		y := new(big.Int).SetBytes(curve.g[1+size:])
+
+		// The generator must be on the curve y^2 = x^3 + ax + b.
+		lhs := new(big.Int).Exp(y, big.NewInt(2), p)
+		rhs := new(big.Int).Exp(x, big.NewInt(3), p)
+		rhs.Add(rhs, new(big.Int).Mul(a, x))
+		rhs.Add(rhs, b)
+		rhs.Mod(rhs, p)
+		if lhs.Cmp(rhs) != 0 {
+			t.Errorf("%s: generator is not on the curve", name)
+		}
+	}
+}
@@ -7,10 +7,28 @@ package packet
 import (
 	"encoding/binary"
 	"io"
+	"strconv"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+)
+
+// The formats of literal data. See RFC 9580, section 5.9.
+const (
+	// LiteralFormatBinary is the format of binary data.
+	LiteralFormatBinary uint8 = 'b'
+	// LiteralFormatText is the format of text data, in an unspecified
+	// encoding.
+	LiteralFormatText uint8 = 't'
+	// LiteralFormatUTF8 is the format of UTF-8 encoded text data.
+	LiteralFormatUTF8 uint8 = 'u'
+	// LiteralFormatMIME is the format of MIME messages, as used by mail
+	// software.
+	LiteralFormatMIME uint8 = 'm'
 )
 
 // LiteralData represents an encrypted file. See RFC 4880, section 5.9.
 type LiteralData struct {
+	// Format is the format of the data, such as LiteralFormatBinary.
 	Format   uint8
 	IsBinary bool
 	FileName string
@@ -18,6 +36,17 @@ type LiteralData struct {
 	Body     io.Reader
 }
 
+// IsText reports whether the data is text, in the LiteralFormatText,
+// LiteralFormatUTF8 or LiteralFormatMIME formats, whose line endings are
+// stored as CRLF.
+func (l *LiteralData) IsText() bool {
+	return isTextLiteralFormat(l.Format)
+}
+
+func isTextLiteralFormat(format uint8) bool {
+	return format == LiteralFormatText || format == LiteralFormatUTF8 || format == LiteralFormatMIME
+}
+
 // ForEyesOnly returns whether the contents of the LiteralData have been marked
 // as especially sensitive.
 func (l *LiteralData) ForEyesOnly() bool {
@@ -33,7 +62,7 @@ func (l *LiteralData) parse(r io.Reader) (err error) {
 	}
 
 	l.Format = buf[0]
-	l.IsBinary = l.Format == 'b'
+	l.IsBinary = l.Format == LiteralFormatBinary
 	fileNameLen := int(buf[1])
 
 	_, err = readFull(r, buf[:fileNameLen])
@@ -57,11 +86,23 @@ func (l *LiteralData) parse(r io.Reader) (err error) {
 // WriteCloser to which the data itself can be written and which MUST be closed
 // on completion. The fileName is truncated to 255 bytes.
 func SerializeLiteral(w io.WriteCloser, isBinary bool, fileName string, time uint32) (plaintext io.WriteCloser, err error) {
-	var buf [4]byte
-	buf[0] = 't'
+	format := LiteralFormatText
 	if isBinary {
-		buf[0] = 'b'
+		format = LiteralFormatBinary
+	}
+	return SerializeLiteralFormat(w, format, fileName, time)
+}
+
+// SerializeLiteralFormat is like SerializeLiteral, but writes data of the
+// given format, one of the LiteralFormat* constants. The data of text formats
+// should have CRLF line endings, and that of LiteralFormatUTF8 must be valid
+// UTF-8; neither is checked.
+func SerializeLiteralFormat(w io.WriteCloser, format uint8, fileName string, time uint32) (plaintext io.WriteCloser, err error) {
+	if format != LiteralFormatBinary && !isTextLiteralFormat(format) {
+		return nil, errors.InvalidArgumentError("unsupported literal data format " + strconv.Itoa(int(format)))
 	}
+	var buf [4]byte
+	buf[0] = format
 	if len(fileName) > 255 {
 		fileName = fileName[:255]
 	}
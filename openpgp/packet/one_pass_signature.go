@@ -14,26 +14,39 @@ import (
 )
 
 // OnePassSignature represents a one-pass signature packet. See RFC 4880,
-// section 5.4.
+// section 5.4, and RFC 9580, section 5.4, for version 6 packets.
 type OnePassSignature struct {
+	// Version is 3, or 6 for the packets of signatures made by version 6
+	// keys. Zero is serialized as 3.
+	Version    int
 	SigType    SignatureType
 	Hash       crypto.Hash
 	PubKeyAlgo PublicKeyAlgorithm
-	KeyId      uint64
-	IsLast     bool
+	// KeyId is the key ID of the signing key. In version 6 packets, it is
+	// derived from KeyFingerprint.
+	KeyId  uint64
+	IsLast bool
+	// Salt is the salt of the signature, hashed before the signed data,
+	// and KeyFingerprint the fingerprint of the signing key. They are only
+	// used in version 6 packets.
+	Salt           []byte
+	KeyFingerprint []byte
 }
 
-const onePassSignatureVersion = 3
+const (
+	onePassSignatureVersion   = 3
+	onePassSignatureVersionV6 = 6
+)
 
 func (ops *OnePassSignature) parse(r io.Reader) (err error) {
-	var buf [13]byte
-
-	_, err = readFull(r, buf[:])
+	var buf [8]byte
+	_, err = readFull(r, buf[:4])
 	if err != nil {
 		return
 	}
-	if buf[0] != onePassSignatureVersion {
-		err = errors.UnsupportedError("one-pass-signature packet version " + strconv.Itoa(int(buf[0])))
+	ops.Version = int(buf[0])
+	if ops.Version != onePassSignatureVersion && ops.Version != onePassSignatureVersionV6 {
+		return errors.UnsupportedError("one-pass-signature packet version " + strconv.Itoa(int(buf[0])))
 	}
 
 	var ok bool
@@ -44,15 +57,61 @@ func (ops *OnePassSignature) parse(r io.Reader) (err error) {
 
 	ops.SigType = SignatureType(buf[1])
 	ops.PubKeyAlgo = PublicKeyAlgorithm(buf[3])
-	ops.KeyId = binary.BigEndian.Uint64(buf[4:12])
-	ops.IsLast = buf[12] != 0
+
+	if ops.Version == onePassSignatureVersionV6 {
+		if _, err = readFull(r, buf[:1]); err != nil {
+			return
+		}
+		ops.Salt = make([]byte, buf[0])
+		if _, err = readFull(r, ops.Salt); err != nil {
+			return
+		}
+		ops.KeyFingerprint = make([]byte, 32)
+		if _, err = readFull(r, ops.KeyFingerprint); err != nil {
+			return
+		}
+		ops.KeyId = binary.BigEndian.Uint64(ops.KeyFingerprint[:8])
+	} else {
+		if _, err = readFull(r, buf[:8]); err != nil {
+			return
+		}
+		ops.KeyId = binary.BigEndian.Uint64(buf[:8])
+	}
+
+	if _, err = readFull(r, buf[:1]); err != nil {
+		return
+	}
+	ops.IsLast = buf[0] != 0
 	return
 }
 
 // Serialize marshals the given OnePassSignature to w.
 func (ops *OnePassSignature) Serialize(w io.Writer) error {
-	var buf [13]byte
-	buf[0] = onePassSignatureVersion
+	version := ops.Version
+	if version == 0 {
+		version = onePassSignatureVersion
+	}
+	var buf []byte
+	switch version {
+	case onePassSignatureVersion:
+		buf = make([]byte, 13)
+		binary.BigEndian.PutUint64(buf[4:12], ops.KeyId)
+	case onePassSignatureVersionV6:
+		if len(ops.Salt) > 255 {
+			return errors.InvalidArgumentError("one-pass-signature salt too long")
+		}
+		if len(ops.KeyFingerprint) != 32 {
+			return errors.InvalidArgumentError("one-pass-signature v6 requires a v6 key fingerprint")
+		}
+		buf = make([]byte, 4, 4+1+len(ops.Salt)+32+1)
+		buf = append(buf, uint8(len(ops.Salt)))
+		buf = append(buf, ops.Salt...)
+		buf = append(buf, ops.KeyFingerprint...)
+		buf = append(buf, 0)
+	default:
+		return errors.InvalidArgumentError("unknown one-pass-signature version " + strconv.Itoa(version))
+	}
+	buf[0] = uint8(version)
 	buf[1] = uint8(ops.SigType)
 	var ok bool
 	buf[2], ok = algorithm.HashToHashIdWithSha1(ops.Hash)
@@ -60,14 +119,13 @@ func (ops *OnePassSignature) Serialize(w io.Writer) error {
 		return errors.UnsupportedError("hash type: " + strconv.Itoa(int(ops.Hash)))
 	}
 	buf[3] = uint8(ops.PubKeyAlgo)
-	binary.BigEndian.PutUint64(buf[4:12], ops.KeyId)
 	if ops.IsLast {
-		buf[12] = 1
+		buf[len(buf)-1] = 1
 	}
 
 	if err := serializeHeader(w, packetTypeOnePassSignature, len(buf)); err != nil {
 		return err
 	}
-	_, err := w.Write(buf[:])
+	_, err := w.Write(buf)
 	return err
 }
@@ -31,7 +31,10 @@ func (op *OpaquePacket) parse(r io.Reader) (err error) {
 }
 
 // Serialize marshals the packet to a writer in its original form, including
-// the packet header.
+// the packet header. The header is always written in the OpenPGP format with
+// a definite length, so packets of types above 15, which cannot use the legacy
+// format, are written byte-for-byte as long as their length was encoded in
+// the shortest form.
 func (op *OpaquePacket) Serialize(w io.Writer) (err error) {
 	err = serializeHeader(w, packetType(op.Tag), len(op.Contents))
 	if err == nil {
@@ -69,7 +72,7 @@ func NewOpaqueReader(r io.Reader) *OpaqueReader {
 
 // Read the next OpaquePacket.
 func (or *OpaqueReader) Next() (op *OpaquePacket, err error) {
-	tag, _, contents, err := readHeader(or.r)
+	tag, _, contents, err := readHeader(or.r, nil)
 	if err != nil {
 		return
 	}
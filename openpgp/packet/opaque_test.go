@@ -6,9 +6,12 @@ package packet
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/hex"
 	"io"
 	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
 )
 
 // Test packet.Read error handling in OpaquePacket.Parse,
@@ -60,6 +63,53 @@ func TestOpaqueParseReason(t *testing.T) {
 	}
 }
 
+func TestReaderPreserveUnknownPackets(t *testing.T) {
+	unknown := &OpaquePacket{Tag: 60, Contents: []byte("experimental packet")}
+	var buf bytes.Buffer
+	if err := unknown.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := SerializePadding(&buf, 16, rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if err := unknown.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	input := buf.Bytes()
+
+	if _, err := NewReader(bytes.NewReader(input)).Next(); err != io.EOF {
+		t.Errorf("unknown packets not skipped by default: %v", err)
+	}
+
+	packets := NewReaderWithConfig(bytes.NewReader(input), &Config{PreserveUnknownPackets: true})
+	var out bytes.Buffer
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		op, ok := p.(*OpaquePacket)
+		if !ok {
+			t.Fatalf("got %T, want *OpaquePacket", p)
+		}
+		if _, ok := op.Reason.(errors.UnknownPacketTypeError); !ok {
+			t.Errorf("unexpected reason: %v", op.Reason)
+		}
+		if err = op.Serialize(&out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var want bytes.Buffer
+	unknown.Serialize(&want)
+	unknown.Serialize(&want)
+	if !bytes.Equal(out.Bytes(), want.Bytes()) {
+		t.Errorf("re-serialized packets differ: got %x, want %x", out.Bytes(), want.Bytes())
+	}
+}
+
 // This key material has public key and signature packet versions modified to
 // an unsupported value (1), so that trying to parse the OpaquePacket to
 // a typed packet will get an error. It also contains a GnuPG trust packet.
@@ -11,6 +11,7 @@ import (
 	"crypto/cipher"
 	"crypto/rsa"
 	"io"
+	"strconv"
 
 	"github.com/ProtonMail/go-crypto/openpgp/errors"
 	"github.com/ProtonMail/go-crypto/openpgp/internal/algorithm"
@@ -59,6 +60,11 @@ func readLength(r io.Reader) (length int64, isPartial bool, err error) {
 	return
 }
 
+// minPartialBodyLength is the smallest first partial body length accepted
+// when reading. See RFC 4880, section 4.2.2.4. The later partial lengths may
+// be shorter, and are only bounded in number by Config.MaxPartialBodyChunks.
+const minPartialBodyLength = 512
+
 // partialLengthReader wraps an io.Reader and handles OpenPGP partial lengths.
 // The continuation lengths are parsed and removed from the stream and EOF is
 // returned at the end of the packet. See RFC 4880, section 4.2.2.4.
@@ -66,6 +72,34 @@ type partialLengthReader struct {
 	r         io.Reader
 	remaining int64
 	isPartial bool
+	// chunks is the number of partial lengths read so far, and maxChunks
+	// its limit, if positive.
+	chunks    int
+	maxChunks int
+}
+
+// newPartialLengthReader returns a partialLengthReader for the packet
+// contents following a first partial length of the given value.
+func newPartialLengthReader(r io.Reader, length int64, config *Config) (*partialLengthReader, error) {
+	if length < minPartialBodyLength {
+		return nil, errors.StructuralError("first partial body length too short: " + strconv.FormatInt(length, 10))
+	}
+	pr := &partialLengthReader{r: r, isPartial: true, maxChunks: config.PartialBodyChunksLimit()}
+	if err := pr.setPartialLength(length); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+// setPartialLength starts a new chunk of the given partial length, and
+// checks the number of chunks against the reading limit.
+func (r *partialLengthReader) setPartialLength(length int64) error {
+	r.chunks++
+	if r.maxChunks > 0 && r.chunks > r.maxChunks {
+		return errors.StructuralError("too many partial body lengths")
+	}
+	r.remaining = length
+	return nil
 }
 
 func (r *partialLengthReader) Read(p []byte) (n int, err error) {
@@ -73,7 +107,16 @@ func (r *partialLengthReader) Read(p []byte) (n int, err error) {
 		if !r.isPartial {
 			return 0, io.EOF
 		}
-		r.remaining, r.isPartial, err = readLength(r.r)
+		var length int64
+		length, r.isPartial, err = readLength(r.r)
+		if err != nil {
+			return 0, err
+		}
+		if r.isPartial {
+			err = r.setPartialLength(length)
+		} else {
+			r.remaining = length
+		}
 		if err != nil {
 			return 0, err
 		}
@@ -163,7 +206,8 @@ func (l *spanReader) Read(p []byte) (n int, err error) {
 
 // readHeader parses a packet header and returns an io.Reader which will return
 // the contents of the packet. See RFC 4880, section 4.2.
-func readHeader(r io.Reader) (tag packetType, length int64, contents io.Reader, err error) {
+// If config is not nil, it sets the limits of partial lengths.
+func readHeader(r io.Reader, config *Config) (tag packetType, length int64, contents io.Reader, err error) {
 	var buf [4]byte
 	_, err = io.ReadFull(r, buf[:1])
 	if err != nil {
@@ -202,10 +246,9 @@ func readHeader(r io.Reader) (tag packetType, length int64, contents io.Reader,
 		return
 	}
 	if isPartial {
-		contents = &partialLengthReader{
-			remaining: length,
-			isPartial: true,
-			r:         r,
+		contents, err = newPartialLengthReader(r, length, config)
+		if err != nil {
+			return
 		}
 		length = -1
 	} else {
@@ -317,6 +360,7 @@ const (
 	packetTypeUserAttribute                            packetType = 17
 	packetTypeSymmetricallyEncryptedIntegrityProtected packetType = 18
 	packetTypeAEADEncrypted                            packetType = 20
+	packetTypePadding                                  packetType = 21
 )
 
 // EncryptedDataPacket holds encrypted data. It is currently implemented by
@@ -328,7 +372,14 @@ type EncryptedDataPacket interface {
 // Read reads a single OpenPGP packet from the given io.Reader. If there is an
 // error parsing a packet, the whole packet is consumed from the input.
 func Read(r io.Reader) (p Packet, err error) {
-	tag, _, contents, err := readHeader(r)
+	return read(r, nil)
+}
+
+// read reads a single OpenPGP packet from r, like Read, according to config.
+// If config preserves unknown packets, packets of unknown types are returned
+// as an OpaquePacket, along with an UnknownPacketTypeError.
+func read(r io.Reader, config *Config) (p Packet, err error) {
+	tag, _, contents, err := readHeader(r, config)
 	if err != nil {
 		return
 	}
@@ -337,7 +388,7 @@ func Read(r io.Reader) (p Packet, err error) {
 	case packetTypeEncryptedKey:
 		p = new(EncryptedKey)
 	case packetTypeSignature:
-		p = new(Signature)
+		p = &Signature{parseConfig: config}
 	case packetTypeSymmetricKeyEncrypted:
 		p = new(SymmetricKeyEncrypted)
 	case packetTypeOnePassSignature:
@@ -347,10 +398,11 @@ func Read(r io.Reader) (p Packet, err error) {
 		if tag == packetTypePrivateSubkey {
 			pk.IsSubkey = true
 		}
+		pk.lenientEdDSA = config.LenientEdDSA()
 		p = pk
 	case packetTypePublicKey, packetTypePublicSubkey:
 		isSubkey := tag == packetTypePublicSubkey
-		p = &PublicKey{IsSubkey: isSubkey}
+		p = &PublicKey{IsSubkey: isSubkey, lenientEdDSA: config.LenientEdDSA()}
 	case packetTypeCompressed:
 		p = new(Compressed)
 	case packetTypeSymmetricallyEncrypted:
@@ -367,8 +419,17 @@ func Read(r io.Reader) (p Packet, err error) {
 		p = se
 	case packetTypeAEADEncrypted:
 		p = new(AEADEncrypted)
+	case packetTypePadding:
+		p = new(Padding)
 	default:
 		err = errors.UnknownPacketTypeError(tag)
+		if config.PreserveUnknown() {
+			op := &OpaquePacket{Tag: uint8(tag), Reason: err}
+			if parseErr := op.parse(contents); parseErr != nil {
+				return nil, parseErr
+			}
+			return op, err
+		}
 	}
 	if p != nil {
 		err = p.parse(contents)
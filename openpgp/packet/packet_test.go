@@ -100,7 +100,7 @@ var partialLengthReaderTests = []struct {
 
 func TestPartialLengthReader(t *testing.T) {
 	for i, test := range partialLengthReaderTests {
-		r := &partialLengthReader{readerFromHex(test.hexInput), 0, true}
+		r := &partialLengthReader{r: readerFromHex(test.hexInput), isPartial: true}
 		out, err := ioutil.ReadAll(r)
 		if test.err != nil {
 			if err != test.err {
@@ -120,6 +120,55 @@ func TestPartialLengthReader(t *testing.T) {
 	}
 }
 
+func TestPartialLengthReaderLimits(t *testing.T) {
+	// A user ID packet split into three chunks of 512 bytes, followed by a
+	// final chunk of one byte.
+	var packet bytes.Buffer
+	packet.WriteByte(0xc0 | byte(packetTypeUserId))
+	for i := 0; i < 3; i++ {
+		packet.WriteByte(0xe9)
+		packet.Write(make([]byte, 512))
+	}
+	packet.Write([]byte{1, 0})
+
+	for _, test := range []struct {
+		maxChunks int
+		ok        bool
+	}{
+		{0, true},
+		{3, true},
+		{2, false},
+	} {
+		config := &Config{MaxPartialBodyChunks: test.maxChunks}
+		_, _, contents, err := readHeader(bytes.NewReader(packet.Bytes()), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := io.Copy(ioutil.Discard, contents)
+		if test.ok && (err != nil || n != 3*512+1) {
+			t.Errorf("limit %d: read %d bytes, err: %v", test.maxChunks, n, err)
+		}
+		if _, ok := err.(errors.StructuralError); !test.ok && !ok {
+			t.Errorf("limit %d: expected StructuralError, got %v", test.maxChunks, err)
+		}
+	}
+
+	// The first partial length is checked when the header is read.
+	if _, _, _, err := readHeader(readerFromHex("cde801"), nil); err == nil {
+		t.Error("expected an error for a short first partial length")
+	}
+	// Later partial lengths may be shorter.
+	short := append([]byte{0xc0 | byte(packetTypeUserId), 0xe9}, make([]byte, 512)...)
+	short = append(short, 0xe0, 0, 1, 0)
+	_, _, contents, err := readHeader(bytes.NewReader(short), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := io.Copy(ioutil.Discard, contents); err != nil || n != 514 {
+		t.Errorf("short later partial length: read %d bytes, err: %v", n, err)
+	}
+}
+
 var readHeaderTests = []struct {
 	hexInput        string
 	structuralError bool
@@ -151,7 +200,7 @@ var readHeaderTests = []struct {
 
 func TestReadHeader(t *testing.T) {
 	for i, test := range readHeaderTests {
-		tag, length, contents, err := readHeader(readerFromHex(test.hexInput))
+		tag, length, contents, err := readHeader(readerFromHex(test.hexInput), nil)
 		if test.structuralError {
 			if _, ok := err.(errors.StructuralError); ok {
 				continue
@@ -198,7 +247,7 @@ func TestSerializeHeader(t *testing.T) {
 	for _, length := range lengths {
 		buf := bytes.NewBuffer(nil)
 		serializeHeader(buf, tag, length)
-		tag2, length2, _, err := readHeader(buf)
+		tag2, length2, _, err := readHeader(buf, nil)
 		if err != nil {
 			t.Errorf("length %d, err: %s", length, err)
 		}
@@ -251,7 +300,7 @@ func TestPartialLengths(t *testing.T) {
 
 	want := (maxChunkSize * (maxChunkSize + 1)) / 2
 	copyBuf := bytes.NewBuffer(nil)
-	r := &partialLengthReader{buf, 0, true}
+	r := &partialLengthReader{r: buf, isPartial: true}
 	m, err := io.Copy(copyBuf, r)
 	if m != int64(want) {
 		t.Errorf("short copy got: %d want: %d", m, want)
@@ -282,7 +331,7 @@ func TestPartialLengthsShortWrite(t *testing.T) {
 		t.Fatal(err)
 	}
 	copyBuf := bytes.NewBuffer(nil)
-	r := &partialLengthReader{buf, 0, true}
+	r := &partialLengthReader{r: buf, isPartial: true}
 	if _, err := io.Copy(copyBuf, r); err != nil {
 		t.Fatal(err)
 	}
@@ -290,3 +339,120 @@ func TestPartialLengthsShortWrite(t *testing.T) {
 		t.Errorf("got %q want %q", buf.Bytes(), data)
 	}
 }
+
+func TestReaderWarnings(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	// An unknown packet (tag 60), followed by a User ID packet.
+	if err := serializeHeader(buf, packetType(60), 3); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write([]byte{1, 2, 3})
+	if err := NewUserId("Test", "", "test@example.com").Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := new(WarningCollector)
+	packets := NewReaderWithConfig(buf, &Config{Warnings: collector})
+	p, err := packets.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(*UserId); !ok {
+		t.Fatalf("expected a *UserId, got %#v", p)
+	}
+
+	warnings := collector.Warnings()
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %d", len(warnings))
+	}
+	if warnings[0].Kind != WarningUnknownPacket || warnings[0].PacketType != 60 {
+		t.Errorf("unexpected warning: %s", warnings[0])
+	}
+	collector.Reset()
+	if len(collector.Warnings()) != 0 {
+		t.Error("expected no warnings after Reset")
+	}
+}
+
+func TestPadding(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	if err := SerializePadding(buf, 32, bytes.NewReader(make([]byte, 32))); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewUserId("Test", "", "test@example.com").Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	serialized := buf.Bytes()
+
+	p, err := Read(bytes.NewReader(serialized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pad, ok := p.(*Padding); !ok || *pad != 32 {
+		t.Fatalf("expected a 32 byte *Padding, got %#v", p)
+	}
+
+	p, err = NewReader(bytes.NewReader(serialized)).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := p.(*UserId); !ok {
+		t.Fatalf("expected the Padding packet to be skipped, got %#v", p)
+	}
+}
+
+func TestSerializePacket(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	uid := NewUserId("Test", "", "test@example.com")
+	if err := SerializePacket(buf, uint8(packetTypeUserId), []byte(uid.Id)); err != nil {
+		t.Fatal(err)
+	}
+
+	literal, err := SerializePacketStream(noOpCloser{buf}, uint8(packetTypeLiteralData))
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := bytes.Repeat([]byte("contents"), 1000)
+	literal.Write([]byte{'b', 0, 0, 0, 0, 0})
+	literal.Write(contents)
+	if err := literal.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	packets := NewReader(buf)
+	p, err := packets.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readUid, ok := p.(*UserId); !ok || readUid.Id != uid.Id {
+		t.Fatalf("unexpected packet: %#v", p)
+	}
+	p, err = packets.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ld, ok := p.(*LiteralData)
+	if !ok {
+		t.Fatalf("unexpected packet: %#v", p)
+	}
+	body, err := ioutil.ReadAll(ld.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, contents) {
+		t.Error("unexpected literal data contents")
+	}
+
+	if err := SerializePacketHeader(ioutil.Discard, 0, 1); err == nil {
+		t.Error("expected an error for a reserved packet type")
+	}
+	if err := SerializePacketHeader(ioutil.Discard, 64, 1); err == nil {
+		t.Error("expected an error for a packet type that cannot be encoded")
+	}
+	if err := SerializePacketHeader(ioutil.Discard, uint8(packetTypeUserId), -1); err == nil {
+		t.Error("expected an error for a negative length")
+	}
+	if _, err := SerializePacketStream(noOpCloser{ioutil.Discard}, uint8(packetTypeUserId)); err == nil {
+		t.Error("expected an error for a partial length user ID packet")
+	}
+}
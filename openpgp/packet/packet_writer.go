@@ -0,0 +1,74 @@
+package packet
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+)
+
+// This file exposes the framing of OpenPGP packets, for callers that need
+// to lay out packet sequences that the openpgp package does not produce,
+// such as messages whose encrypted session keys are stored separately from
+// the encrypted data. The body of most packets can be produced with the
+// constructors of this package: SerializeEncryptedKey,
+// SerializeSymmetricKeyEncrypted, SerializeSymmetricallyEncrypted,
+// SerializeCompressed, SerializeLiteral, SerializePadding and the Serialize
+// methods of the packet types.
+
+// maxPacketLength is the largest body length that a packet header can
+// express. See RFC 4880, section 4.2.2.
+const maxPacketLength = 1<<32 - 1
+
+// SerializePacketHeader writes the header of a packet with the given tag and
+// body length to w, in the new packet format. See RFC 4880, section 4.2. The
+// tag must be between 1 and 63, and the length must fit in 32 bits. The
+// caller must then write exactly length bytes of body.
+func SerializePacketHeader(w io.Writer, tag uint8, length int) error {
+	if err := checkPacketTag(tag); err != nil {
+		return err
+	}
+	if length < 0 || int64(length) > maxPacketLength {
+		return errors.InvalidArgumentError("invalid packet length")
+	}
+	return serializeHeader(w, packetType(tag), length)
+}
+
+// SerializePacket writes a packet with the given tag and body to w. The tag
+// must be between 1 and 63.
+func SerializePacket(w io.Writer, tag uint8, body []byte) error {
+	if err := SerializePacketHeader(w, tag, len(body)); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// SerializePacketStream writes the header of a packet with the given tag, of
+// unknown length, to w, and returns a WriteCloser to which the body of the
+// packet must be written. The body is written using partial body lengths,
+// which RFC 4880, section 4.2.2.4, only permits for data packets: Literal
+// Data, Compressed Data, Symmetrically Encrypted Data, Symmetrically
+// Encrypted Integrity Protected Data and AEAD Encrypted Data packets.
+// Closing the returned WriteCloser terminates the packet and closes w.
+func SerializePacketStream(w io.WriteCloser, tag uint8) (io.WriteCloser, error) {
+	if err := checkPacketTag(tag); err != nil {
+		return nil, err
+	}
+	switch packetType(tag) {
+	case packetTypeLiteralData, packetTypeCompressed, packetTypeSymmetricallyEncrypted,
+		packetTypeSymmetricallyEncryptedIntegrityProtected, packetTypeAEADEncrypted:
+	default:
+		return nil, errors.InvalidArgumentError("partial body lengths are not permitted for packet type " + strconv.Itoa(int(tag)))
+	}
+	return serializeStreamHeader(w, packetType(tag))
+}
+
+// checkPacketTag returns an error if tag cannot be encoded in a packet
+// header, or is reserved.
+func checkPacketTag(tag uint8) error {
+	if tag == 0 || tag > 63 {
+		return errors.InvalidArgumentError("invalid packet type " + strconv.Itoa(int(tag)))
+	}
+	return nil
+}
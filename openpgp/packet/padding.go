@@ -0,0 +1,27 @@
+package packet
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// Padding represents a Padding packet, see RFC 9580, section 5.14. Its
+// contents are random and carry no meaning; it only serves to obscure the
+// length of the rest of the message. The value is the length of the padding.
+type Padding int
+
+func (pad *Padding) parse(r io.Reader) error {
+	n, err := io.Copy(ioutil.Discard, r)
+	*pad = Padding(n)
+	return err
+}
+
+// SerializePadding writes a Padding packet holding length random bytes, read
+// from rand, to w.
+func SerializePadding(w io.Writer, length int, rand io.Reader) error {
+	if err := serializeHeader(w, packetTypePadding, length); err != nil {
+		return err
+	}
+	_, err := io.CopyN(w, rand, int64(length))
+	return err
+}
@@ -9,9 +9,11 @@ import (
 	"crypto"
 	"crypto/cipher"
 	"crypto/dsa"
-	"crypto/rand"
+	goecdsa "crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
 	"io"
 	"io/ioutil"
 	"math/big"
@@ -23,8 +25,10 @@ import (
 	"github.com/ProtonMail/go-crypto/openpgp/eddsa"
 	"github.com/ProtonMail/go-crypto/openpgp/elgamal"
 	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/ecc"
 	"github.com/ProtonMail/go-crypto/openpgp/internal/encoding"
 	"github.com/ProtonMail/go-crypto/openpgp/s2k"
+	"golang.org/x/crypto/hkdf"
 )
 
 // PrivateKey represents a possibly encrypted private key. See RFC 4880,
@@ -40,9 +44,12 @@ type PrivateKey struct {
 	PrivateKey   interface{}
 	sha1Checksum bool
 	iv           []byte
+	// aead is the AEAD mode protecting the secret key material, if s2kType
+	// is S2KAEAD.
+	aead AEADMode
 
 	// Type of encryption of the S2K packet
-	// Allowed values are 0 (Not encrypted), 254 (SHA1), or
+	// Allowed values are 0 (Not encrypted), 253 (AEAD), 254 (SHA1), or
 	// 255 (2-byte checksum)
 	s2kType S2KType
 	// Full parameters of the S2K packet
@@ -55,6 +62,8 @@ type S2KType uint8
 const (
 	// S2KNON unencrypt
 	S2KNON S2KType = 0
+	// S2KAEAD AEAD protection, see RFC 9580, section 5.5.3
+	S2KAEAD S2KType = 253
 	// S2KSHA1 sha1 sum check
 	S2KSHA1 S2KType = 254
 	// S2KCHECKSUM sum check
@@ -123,12 +132,51 @@ func NewSignerPrivateKey(creationTime time.Time, signer interface{}) *PrivateKey
 	case eddsa.PrivateKey:
 		pk.PublicKey = *NewEdDSAPublicKey(creationTime, &pubkey.PublicKey)
 	default:
+		if s, ok := signer.(crypto.Signer); ok {
+			if external, err := NewExternalSignerPrivateKey(creationTime, s); err == nil {
+				return external
+			}
+		}
 		panic("openpgp: unknown signer type in NewSignerPrivateKey")
 	}
 	pk.PrivateKey = signer
 	return pk
 }
 
+// NewExternalSignerPrivateKey creates a PrivateKey whose signatures are made
+// by signer, a crypto.Signer whose private key may be held elsewhere, e.g. in
+// an HSM or a KMS. The public key of signer must be an *rsa.PublicKey, an
+// *ecdsa.PublicKey on a curve supported by OpenPGP, or an ed25519.PublicKey.
+// Such private keys can sign, but their secret material cannot be
+// serialized, encrypted or decrypted.
+func NewExternalSignerPrivateKey(creationTime time.Time, signer crypto.Signer) (*PrivateKey, error) {
+	pk := new(PrivateKey)
+	switch pub := signer.Public().(type) {
+	case *rsa.PublicKey:
+		pk.PublicKey = *NewRSAPublicKey(creationTime, pub)
+	case *goecdsa.PublicKey:
+		curveInfo := ecc.FindByCurve(ecc.NewGenericCurve(pub.Curve))
+		if curveInfo == nil {
+			return nil, errors.UnsupportedError("unknown elliptic curve of external signer")
+		}
+		curve, ok := curveInfo.Curve.(ecc.ECDSACurve)
+		if !ok {
+			return nil, errors.UnsupportedError("elliptic curve of external signer cannot sign")
+		}
+		ecdsaPub := ecdsa.NewPublicKey(curve)
+		ecdsaPub.X, ecdsaPub.Y = pub.X, pub.Y
+		pk.PublicKey = *NewECDSAPublicKey(creationTime, ecdsaPub)
+	case ed25519.PublicKey:
+		eddsaPub := eddsa.NewPublicKey(ecc.NewEd25519())
+		eddsaPub.X = append([]byte(nil), pub...)
+		pk.PublicKey = *NewEdDSAPublicKey(creationTime, eddsaPub)
+	default:
+		return nil, errors.UnsupportedError("public key type of external signer")
+	}
+	pk.PrivateKey = signer
+	return pk, nil
+}
+
 // NewDecrypterPrivateKey creates a PrivateKey from a *{rsa|elgamal|ecdh}.PrivateKey.
 func NewDecrypterPrivateKey(creationTime time.Time, decrypter interface{}) *PrivateKey {
 	pk := new(PrivateKey)
@@ -170,7 +218,7 @@ func (pk *PrivateKey) parse(r io.Reader) (err error) {
 	case S2KNON:
 		pk.s2k = nil
 		pk.Encrypted = false
-	case S2KSHA1, S2KCHECKSUM:
+	case S2KAEAD, S2KSHA1, S2KCHECKSUM:
 		if v5 && pk.s2kType == S2KCHECKSUM {
 			return errors.StructuralError("wrong s2k identifier for version 5")
 		}
@@ -182,6 +230,15 @@ func (pk *PrivateKey) parse(r io.Reader) (err error) {
 		if pk.cipher != 0 && !pk.cipher.IsSupported() {
 			return errors.UnsupportedError("unsupported cipher function in private key")
 		}
+		if pk.s2kType == S2KAEAD {
+			if _, err = readFull(r, buf[:]); err != nil {
+				return
+			}
+			pk.aead = AEADMode(buf[0])
+			if pk.aead.IvLength() == 0 {
+				return errors.UnsupportedError("unsupported AEAD mode in private key: " + strconv.Itoa(int(pk.aead)))
+			}
+		}
 		pk.s2kParams, err = s2k.ParseIntoParams(r)
 		if err != nil {
 			return
@@ -206,7 +263,11 @@ func (pk *PrivateKey) parse(r io.Reader) (err error) {
 		if blockSize == 0 {
 			return errors.UnsupportedError("unsupported cipher in private key: " + strconv.Itoa(int(pk.cipher)))
 		}
-		pk.iv = make([]byte, blockSize)
+		if pk.s2kType == S2KAEAD {
+			pk.iv = make([]byte, pk.aead.IvLength())
+		} else {
+			pk.iv = make([]byte, blockSize)
+		}
 		_, err = readFull(r, pk.iv)
 		if err != nil {
 			return
@@ -255,6 +316,45 @@ func (pk *PrivateKey) parse(r io.Reader) (err error) {
 	return
 }
 
+// NewGnuDummyPrivateKey returns a private key packet for pub without secret
+// key material, using the GNU dummy S2K extension. This is how GnuPG exports
+// keys whose secret part is kept offline.
+func NewGnuDummyPrivateKey(pub PublicKey) *PrivateKey {
+	return &PrivateKey{
+		PublicKey: pub,
+		s2kType:   S2KSHA1,
+		s2kParams: s2k.NewGnuDummyParams(),
+	}
+}
+
+// NewGnuDivertToCardPrivateKey returns a private key packet for pub whose
+// secret key material is stored on the smart card with the given serial
+// number, using the GNU divert-to-card S2K extension. This is how GnuPG
+// references card-resident keys.
+func NewGnuDivertToCardPrivateKey(pub PublicKey, serial []byte) (*PrivateKey, error) {
+	params, err := s2k.NewGnuDivertToCardParams(serial)
+	if err != nil {
+		return nil, err
+	}
+	return &PrivateKey{
+		PublicKey: pub,
+		s2kType:   S2KSHA1,
+		s2kParams: params,
+	}, nil
+}
+
+// DivertToCard returns true if the secret key material is stored on a smart
+// card. This is a GNU extension; such keys are also dummy keys.
+func (pk *PrivateKey) DivertToCard() bool {
+	return pk.s2kParams.DivertToCard()
+}
+
+// CardSerial returns the serial number of the smart card holding the secret
+// key material of a divert-to-card key, or nil otherwise.
+func (pk *PrivateKey) CardSerial() []byte {
+	return pk.s2kParams.CardSerial()
+}
+
 // Dummy returns true if the private key is a dummy key. This is a GNU extension.
 func (pk *PrivateKey) Dummy() bool {
 	return pk.s2kParams.Dummy()
@@ -281,6 +381,9 @@ func (pk *PrivateKey) Serialize(w io.Writer) (err error) {
 	optional := bytes.NewBuffer(nil)
 	if pk.Encrypted || pk.Dummy() {
 		optional.Write([]byte{uint8(pk.cipher)})
+		if pk.s2kType == S2KAEAD {
+			optional.Write([]byte{uint8(pk.aead)})
+		}
 		if err := pk.s2kParams.Serialize(optional); err != nil {
 			return err
 		}
@@ -379,13 +482,29 @@ func (pk *PrivateKey) decrypt(decryptionKey []byte) error {
 		return nil
 	}
 
-	block := pk.cipher.new(decryptionKey)
-	cfb := cipher.NewCFBDecrypter(block, pk.iv)
+	var data []byte
+	if pk.s2kType == S2KAEAD {
+		key, additionalData, err := pk.aeadKeyAndData(decryptionKey)
+		if err != nil {
+			return err
+		}
+		aead := pk.aead.new(pk.cipher.new(key))
+		data, err = aead.Open(nil, pk.iv, pk.encryptedData, additionalData)
+		if err != nil {
+			return errors.StructuralError("private key decryption failure")
+		}
+	} else {
+		block := pk.cipher.new(decryptionKey)
+		cfb := cipher.NewCFBDecrypter(block, pk.iv)
 
-	data := make([]byte, len(pk.encryptedData))
-	cfb.XORKeyStream(data, pk.encryptedData)
+		data = make([]byte, len(pk.encryptedData))
+		cfb.XORKeyStream(data, pk.encryptedData)
+	}
 
-	if pk.sha1Checksum {
+	switch {
+	case pk.s2kType == S2KAEAD:
+		// The AEAD tag authenticates the key material.
+	case pk.sha1Checksum:
 		if len(data) < sha1.Size {
 			return errors.StructuralError("truncated private key data")
 		}
@@ -396,7 +515,7 @@ func (pk *PrivateKey) decrypt(decryptionKey []byte) error {
 			return errors.StructuralError("private key checksum failure")
 		}
 		data = data[:len(data)-sha1.Size]
-	} else {
+	default:
 		if len(data) < 2 {
 			return errors.StructuralError("truncated private key data")
 		}
@@ -473,8 +592,10 @@ func DecryptPrivateKeys(keys []*PrivateKey, passphrase []byte) error {
 	return nil
 }
 
-// encrypt encrypts an unencrypted private key.
-func (pk *PrivateKey) encrypt(key []byte, params *s2k.Params, cipherFunction CipherFunction) error {
+// encrypt encrypts an unencrypted private key, with an IV read from random.
+// s2kType selects the protection: S2KSHA1 for CFB with a SHA-1 checksum, or
+// S2KAEAD for AEAD with aeadMode.
+func (pk *PrivateKey) encrypt(random io.Reader, key []byte, params *s2k.Params, s2kType S2KType, cipherFunction CipherFunction, aeadMode AEADMode) error {
 	if pk.Dummy() {
 		return errors.ErrDummyPrivateKey("dummy key found")
 	}
@@ -485,7 +606,10 @@ func (pk *PrivateKey) encrypt(key []byte, params *s2k.Params, cipherFunction Cip
 	if len(key) != cipherFunction.KeySize() {
 		return errors.InvalidArgumentError("supplied encryption key has the wrong size")
 	}
-	
+	if s2kType != S2KSHA1 && s2kType != S2KAEAD {
+		return errors.InvalidArgumentError("unsupported private key protection: " + strconv.Itoa(int(s2kType)))
+	}
+
 	priv := bytes.NewBuffer(nil)
 	err := pk.serializePrivateKey(priv)
 	if err != nil {
@@ -497,38 +621,103 @@ func (pk *PrivateKey) encrypt(key []byte, params *s2k.Params, cipherFunction Cip
 	pk.s2k, err = pk.s2kParams.Function()
 	if err != nil {
 		return err
-	} 
+	}
 
 	privateKeyBytes := priv.Bytes()
-	pk.sha1Checksum = true
-	block := pk.cipher.new(key)
-	pk.iv = make([]byte, pk.cipher.blockSize())
-	_, err = rand.Read(pk.iv)
-	if err != nil {
-		return err
-	}
-	cfb := cipher.NewCFBEncrypter(block, pk.iv)
+	pk.s2kType = s2kType
+	if s2kType == S2KAEAD {
+		pk.aead = aeadMode
+		pk.sha1Checksum = false
+		pk.iv = make([]byte, pk.aead.IvLength())
+		if _, err = io.ReadFull(random, pk.iv); err != nil {
+			return err
+		}
+		aeadKey, additionalData, err := pk.aeadKeyAndData(key)
+		if err != nil {
+			return err
+		}
+		aead := pk.aead.new(pk.cipher.new(aeadKey))
+		pk.encryptedData = aead.Seal(nil, pk.iv, privateKeyBytes, additionalData)
+	} else {
+		pk.sha1Checksum = true
+		block := pk.cipher.new(key)
+		pk.iv = make([]byte, pk.cipher.blockSize())
+		if _, err = io.ReadFull(random, pk.iv); err != nil {
+			return err
+		}
+		cfb := cipher.NewCFBEncrypter(block, pk.iv)
 
-	if pk.sha1Checksum {
-		pk.s2kType = S2KSHA1
 		h := sha1.New()
 		h.Write(privateKeyBytes)
-		sum := h.Sum(nil)
-		privateKeyBytes = append(privateKeyBytes, sum...)
-	} else {
-		pk.s2kType = S2KCHECKSUM
-		var sum uint16
-		for _, b := range privateKeyBytes {
-			sum += uint16(b)
-		}
-		priv.Write([]byte{uint8(sum >> 8), uint8(sum)})
-	}
+		privateKeyBytes = append(privateKeyBytes, h.Sum(nil)...)
 
-	pk.encryptedData = make([]byte, len(privateKeyBytes))
-	cfb.XORKeyStream(pk.encryptedData, privateKeyBytes)
+		pk.encryptedData = make([]byte, len(privateKeyBytes))
+		cfb.XORKeyStream(pk.encryptedData, privateKeyBytes)
+	}
 	pk.Encrypted = true
 	pk.PrivateKey = nil
-	return err
+	return nil
+}
+
+// aeadKeyAndData returns the key and the associated data used to protect the
+// secret key material with AEAD, given the key derived by the S2K. See RFC
+// 9580, section 5.5.3.
+func (pk *PrivateKey) aeadKeyAndData(s2kKey []byte) (key, additionalData []byte, err error) {
+	packetTag := byte(0xc0 | packetTypePrivateKey)
+	if pk.IsSubkey {
+		packetTag = byte(0xc0 | packetTypePrivateSubkey)
+	}
+
+	info := []byte{packetTag, byte(pk.Version), byte(pk.cipher), byte(pk.aead)}
+	key = make([]byte, pk.cipher.KeySize())
+	_, _ = readFull(hkdf.New(sha256.New, s2kKey, nil, info), key)
+
+	var buf bytes.Buffer
+	buf.WriteByte(packetTag)
+	if err = pk.PublicKey.serializeWithoutHeaders(&buf); err != nil {
+		return nil, nil, err
+	}
+	return key, buf.Bytes(), nil
+}
+
+// Reprotect changes the protection of the secret key material to mode,
+// without changing the key material itself. mode is S2KNON to store the key
+// in the clear, S2KSHA1 for CFB encryption with a SHA-1 checksum, or S2KAEAD
+// for AEAD encryption. An encrypted key is first decrypted with passphrase,
+// and the same passphrase is used to protect it again, with a fresh S2K and
+// the cipher and AEAD mode given by config. The key is left encrypted unless
+// mode is S2KNON. On error, the key is left unchanged.
+// If config is nil, sensible defaults will be used.
+func (pk *PrivateKey) Reprotect(mode S2KType, passphrase []byte, config *Config) error {
+	if pk.Dummy() {
+		return errors.ErrDummyPrivateKey("dummy key found")
+	}
+	if mode != S2KNON && mode != S2KSHA1 && mode != S2KAEAD {
+		return errors.InvalidArgumentError("unsupported private key protection: " + strconv.Itoa(int(mode)))
+	}
+
+	reprotected := *pk
+	if err := reprotected.Decrypt(passphrase); err != nil {
+		return err
+	}
+	if mode != S2KNON {
+		params, err := s2k.Generate(config.Random(), config.S2K())
+		if err != nil {
+			return err
+		}
+		key := make([]byte, config.Cipher().KeySize())
+		s2k, err := params.Function()
+		if err != nil {
+			return err
+		}
+		s2k(key, passphrase)
+		err = reprotected.encrypt(config.Random(), key, params, mode, config.Cipher(), config.AEAD().Mode())
+		if err != nil {
+			return err
+		}
+	}
+	*pk = reprotected
+	return nil
 }
 
 // EncryptWithConfig encrypts an unencrypted private key using the passphrase and the config.
@@ -545,7 +734,7 @@ func (pk *PrivateKey) EncryptWithConfig(passphrase []byte, config *Config) error
 	}
 	s2k(key, passphrase)
 	// Encrypt the private key with the derived encryption key.
-	return pk.encrypt(key, params, config.Cipher())
+	return pk.encrypt(config.Random(), key, params, S2KSHA1, config.Cipher(), 0)
 }
 
 // EncryptPrivateKeys encrypts all unencrypted keys with the given config and passphrase.
@@ -564,7 +753,7 @@ func EncryptPrivateKeys(keys []*PrivateKey, passphrase []byte, config *Config) e
 	s2k(encryptionKey, passphrase)
 	for _, key := range keys {
 		if key != nil && !key.Dummy() && !key.Encrypted {
-			err = key.encrypt(encryptionKey, params, config.Cipher())
+			err = key.encrypt(config.Random(), encryptionKey, params, S2KSHA1, config.Cipher(), 0)
 			if err != nil {
 				return err
 			}
@@ -754,7 +943,11 @@ func (pk *PrivateKey) parseEdDSAPrivateKey(data []byte) (err error) {
 		return err
 	}
 
-	if err = eddsaPriv.UnmarshalByteSecret(d.Bytes()); err != nil {
+	secret := d.Bytes()
+	if pk.lenientEdDSA {
+		secret = stripLeadingZeros(secret)
+	}
+	if err = eddsaPriv.UnmarshalByteSecret(secret); err != nil {
 		return err
 	}
 
@@ -14,6 +14,7 @@ import (
 	"crypto/x509"
 	"encoding/hex"
 	"hash"
+	"io/ioutil"
 	"math/big"
 	mathrand "math/rand"
 	"testing"
@@ -203,6 +204,69 @@ func TestExternalPrivateKeyEncryptDecryptArgon2(t *testing.T) {
 	}
 }
 
+func TestPrivateKeyReprotect(t *testing.T) {
+	passphrase := []byte("testing")
+	config := &Config{
+		S2KConfig:  &s2k.Config{S2KMode: s2k.Argon2S2K},
+		AEADConfig: &AEADConfig{DefaultMode: AEADModeGCM},
+	}
+	for i, test := range privateKeyTests {
+		p, err := Read(readerFromHex(test.privateKeyHex))
+		if err != nil {
+			t.Fatalf("#%d: failed to parse: %s", i, err)
+		}
+		privKey := p.(*PrivateKey)
+
+		reference := *privKey
+		if err = reference.Decrypt(passphrase); err != nil {
+			t.Fatalf("#%d: failed to decrypt: %s", i, err)
+		}
+		var want bytes.Buffer
+		if err = reference.serializePrivateKey(&want); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = privKey.Reprotect(S2KAEAD, []byte("incorrect"), config); err == nil {
+			t.Errorf("#%d: reprotected with incorrect passphrase", i)
+		}
+		if !privKey.Encrypted || privKey.s2kType != S2KSHA1 {
+			t.Errorf("#%d: failed reprotection modified the key", i)
+		}
+
+		for _, mode := range []S2KType{S2KAEAD, S2KNON, S2KSHA1, S2KAEAD} {
+			if err = privKey.Reprotect(mode, passphrase, config); err != nil {
+				t.Fatalf("#%d: failed to reprotect with mode %d: %s", i, mode, err)
+			}
+			var buf bytes.Buffer
+			if err = privKey.Serialize(&buf); err != nil {
+				t.Fatal(err)
+			}
+			p, err = Read(&buf)
+			if err != nil {
+				t.Fatalf("#%d: failed to parse reprotected key with mode %d: %s", i, mode, err)
+			}
+			privKey = p.(*PrivateKey)
+			if privKey.s2kType != mode || privKey.Encrypted != (mode != S2KNON) {
+				t.Errorf("#%d: wrong protection: got %d, want %d", i, privKey.s2kType, mode)
+			}
+		}
+
+		if err = privKey.Decrypt([]byte("incorrect")); err == nil {
+			t.Errorf("#%d: decrypted with incorrect passphrase", i)
+		}
+		if err = privKey.Decrypt(passphrase); err != nil {
+			t.Fatalf("#%d: failed to decrypt: %s", i, err)
+		}
+		var got bytes.Buffer
+		if err = privKey.serializePrivateKey(&got); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("#%d: key material changed", i)
+		}
+	}
+}
+
 func populateHash(hashFunc crypto.Hash, msg []byte) (hash.Hash, error) {
 	h := hashFunc.New()
 	if _, err := h.Write(msg); err != nil {
@@ -432,6 +496,142 @@ func TestEdDSASignerPrivateKeyRandomizeFast(t *testing.T) {
 	}
 }
 
+func TestGnuDivertToCardPrivateKey(t *testing.T) {
+	eddsaPriv, err := eddsa.GenerateKey(rand.Reader, ecc.NewEd25519())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := NewSignerPrivateKey(time.Now(), eddsaPriv).PublicKey
+	serial := []byte{0xd2, 0x76, 0x00, 0x01, 0x24, 0x01, 0x03, 0x04, 0x00, 0x05, 0x00, 0x00, 0x12, 0x34, 0x00, 0x00}
+
+	priv, err := NewGnuDivertToCardPrivateKey(pub, serial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = priv.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, ok := p.(*PrivateKey)
+	if !ok {
+		t.Fatalf("expected a private key packet, got %T", p)
+	}
+	if !parsed.Dummy() || !parsed.DivertToCard() {
+		t.Error("expected a divert-to-card key")
+	}
+	if !bytes.Equal(parsed.CardSerial(), serial) {
+		t.Errorf("wrong card serial: got %x, want %x", parsed.CardSerial(), serial)
+	}
+	if !bytes.Equal(parsed.Fingerprint, pub.Fingerprint) {
+		t.Error("public key was not preserved")
+	}
+
+	if _, err = NewGnuDivertToCardPrivateKey(pub, make([]byte, 17)); err == nil {
+		t.Error("expected an error for a long card serial")
+	}
+}
+
+func TestLenientEdDSAEncoding(t *testing.T) {
+	eddsaPriv, err := eddsa.GenerateKey(rand.Reader, ecc.NewEd25519())
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := NewSignerPrivateKey(time.Now(), eddsaPriv)
+	lenient := &Config{LenientEdDSAEncoding: true}
+
+	buf := new(bytes.Buffer)
+	if err = priv.PublicKey.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	paddedKey := padMPI(t, buf.Bytes(), int(priv.PublicKey.p.EncodedLength()))
+	if _, err = Read(bytes.NewReader(paddedKey)); err == nil {
+		t.Error("parsed a padded EdDSA public key in strict mode")
+	}
+	p, err := NewReaderWithConfig(bytes.NewReader(paddedKey), lenient).Next()
+	if err != nil {
+		t.Fatalf("failed to parse a padded EdDSA public key in lenient mode: %s", err)
+	}
+	pub := p.(*PublicKey)
+	if !bytes.Equal(pub.PublicKey.(*eddsa.PublicKey).X, eddsaPriv.PublicKey.X) {
+		t.Error("wrong EdDSA public key parsed in lenient mode")
+	}
+	if reserialized := new(bytes.Buffer); pub.Serialize(reserialized) != nil || !bytes.Equal(reserialized.Bytes(), paddedKey) {
+		t.Error("padded EdDSA public key not re-serialized as read")
+	}
+
+	sig := &Signature{
+		Version:    4,
+		SigType:    SigTypeBinary,
+		PubKeyAlgo: PubKeyAlgoEdDSA,
+		Hash:       crypto.SHA256,
+	}
+	msg := []byte("message")
+	h, err := populateHash(sig.Hash, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sig.Sign(h, priv, nil); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err = sig.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	canonical := append([]byte(nil), buf.Bytes()...)
+	paddedSig := padMPI(t, canonical, int(sig.EdDSASigR.EncodedLength()+sig.EdDSASigS.EncodedLength()))
+
+	p, err = Read(bytes.NewReader(paddedSig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ = populateHash(sig.Hash, msg)
+	if err = priv.VerifySignature(h, p.(*Signature)); err == nil {
+		t.Error("verified a padded EdDSA signature in strict mode")
+	}
+	p, err = NewReaderWithConfig(bytes.NewReader(paddedSig), lenient).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, _ = populateHash(sig.Hash, msg)
+	if err = priv.VerifySignature(h, p.(*Signature)); err != nil {
+		t.Errorf("failed to verify a padded EdDSA signature in lenient mode: %s", err)
+	}
+	buf.Reset()
+	if err = p.(*Signature).Serialize(buf); err != nil || !bytes.Equal(buf.Bytes(), canonical) {
+		t.Error("padded EdDSA signature not re-serialized canonically")
+	}
+}
+
+// padMPI returns the packet serialized in b with the MPI starting at the
+// given offset from the end of its body padded with a leading zero byte.
+func padMPI(t *testing.T, b []byte, offsetFromEnd int) []byte {
+	tag, _, contents, err := readHeader(bytes.NewReader(b), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := len(body) - offsetFromEnd
+	bitLength := int(body[offset])<<8 | int(body[offset+1])
+	paddedBitLength := ((bitLength+7)/8 + 1) * 8
+	padded := append([]byte(nil), body[:offset]...)
+	padded = append(padded, byte(paddedBitLength>>8), byte(paddedBitLength), 0)
+	padded = append(padded, body[offset+2:]...)
+
+	buf := new(bytes.Buffer)
+	if err = serializeHeader(buf, tag, len(padded)); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(padded)
+	return buf.Bytes()
+}
+
 // Tests correctness when encrypting an EdDSA private key with a password.
 func TestEncryptDecryptEdDSAPrivateKeyRandomizeFast(t *testing.T) {
 	password := make([]byte, 20)
@@ -545,3 +745,44 @@ func TestElGamalValidation(t *testing.T) {
 	}
 	priv.Y = &y
 }
+
+// externalSigner hides the type of a private key, as an HSM-backed
+// crypto.Signer would.
+type externalSigner struct {
+	crypto.Signer
+}
+
+func TestExternalSignerPrivateKey(t *testing.T) {
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := NewExternalSignerPrivateKey(time.Now(), externalSigner{rsaPriv})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if priv.PubKeyAlgo != PubKeyAlgoRSA {
+		t.Fatalf("unexpected algorithm %d", priv.PubKeyAlgo)
+	}
+
+	sig := &Signature{
+		Version:    4,
+		SigType:    SigTypeBinary,
+		PubKeyAlgo: priv.PubKeyAlgo,
+		Hash:       crypto.SHA256,
+	}
+	h := crypto.SHA256.New()
+	h.Write([]byte("hello"))
+	if err = sig.Sign(h, priv, nil); err != nil {
+		t.Fatal(err)
+	}
+	h = crypto.SHA256.New()
+	h.Write([]byte("hello"))
+	if err = priv.VerifySignature(h, sig); err != nil {
+		t.Error(err)
+	}
+
+	if err = priv.Serialize(ioutil.Discard); err == nil {
+		t.Error("expected an error serializing an external private key")
+	}
+}
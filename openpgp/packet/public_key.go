@@ -52,6 +52,10 @@ type PublicKey struct {
 	// kdf stores key derivation function parameters
 	// used for ECDH encryption. See RFC 6637, Section 9.
 	kdf encoding.Field
+
+	// lenientEdDSA is set if the key is read with a config that accepts
+	// EdDSA values padded with leading zero bytes.
+	lenientEdDSA bool
 }
 
 // UpgradeToV5 updates the version of the key to v5, and updates all necessary
@@ -214,6 +218,9 @@ func (pk *PublicKey) parse(r io.Reader) (err error) {
 	if err != nil {
 		return
 	}
+	if !keyAlgorithmPermitted(pk.Version, pk.PubKeyAlgo, pk.Curve()) {
+		return errors.UnsupportedError("public key algorithm " + strconv.Itoa(int(pk.PubKeyAlgo)) + " with curve " + string(pk.Curve()) + " in v" + strconv.Itoa(pk.Version) + " key")
+	}
 
 	pk.setFingerprintAndKeyId()
 	return
@@ -236,6 +243,56 @@ func (pk *PublicKey) setFingerprintAndKeyId() {
 	}
 }
 
+// FingerprintFromBody computes the fingerprint and key ID of a serialized
+// public key packet body (without packet header), without parsing the key
+// material. The version octet of the body selects the fingerprint scheme:
+// v4 keys use SHA-1, v5 and v6 keys use SHA-256 with their respective
+// prefix octets. This allows keys stored as raw packets to be addressed
+// without constructing a PublicKey.
+func FingerprintFromBody(body []byte) (fingerprint []byte, keyId uint64, err error) {
+	if len(body) == 0 {
+		return nil, 0, errors.StructuralError("empty public key body")
+	}
+	version := int(body[0])
+	var h hash.Hash
+	switch version {
+	case 4:
+		if len(body) > 0xffff {
+			return nil, 0, errors.StructuralError("public key body too long")
+		}
+		h = sha1.New()
+		h.Write([]byte{0x99, byte(len(body) >> 8), byte(len(body))})
+	case 5, 6:
+		prefix := byte(0x9A)
+		if version == 6 {
+			prefix = 0x9B
+		}
+		h = sha256.New()
+		var header [5]byte
+		header[0] = prefix
+		binary.BigEndian.PutUint32(header[1:], uint32(len(body)))
+		h.Write(header[:])
+	default:
+		return nil, 0, errors.UnsupportedError("public key version " + strconv.Itoa(version))
+	}
+	h.Write(body)
+	fingerprint = h.Sum(nil)
+	return fingerprint, KeyIdFromFingerprint(version, fingerprint), nil
+}
+
+// KeyIdFromFingerprint returns the key ID corresponding to the given
+// fingerprint of a key of the given version. v4 key IDs are the low-order 64
+// bits of the fingerprint, v5 and v6 key IDs the high-order 64 bits.
+func KeyIdFromFingerprint(version int, fingerprint []byte) uint64 {
+	if len(fingerprint) < 8 {
+		return 0
+	}
+	if version == 4 {
+		return binary.BigEndian.Uint64(fingerprint[len(fingerprint)-8:])
+	}
+	return binary.BigEndian.Uint64(fingerprint[:8])
+}
+
 // parseRSA parses RSA public key material from the given Reader. See RFC 4880,
 // section 5.5.2.
 func (pk *PublicKey) parseRSA(r io.Reader) (err error) {
@@ -415,18 +472,23 @@ func (pk *PublicKey) parseEdDSA(r io.Reader) (err error) {
 		return
 	}
 
-	if len(pk.p.Bytes()) == 0 {
+	point := pk.p.Bytes()
+	if pk.lenientEdDSA {
+		// pk.p is kept as read, as it is covered by the fingerprint.
+		point = stripLeadingZeros(point)
+	}
+	if len(point) == 0 {
 		return errors.StructuralError("empty EdDSA public key")
 	}
 
 	pub := eddsa.NewPublicKey(c)
 
-	switch flag := pk.p.Bytes()[0]; flag {
+	switch flag := point[0]; flag {
 	case 0x04:
 		// TODO: see _grcy_ecc_eddsa_ensure_compact in grcypt
 		return errors.UnsupportedError("unsupported EdDSA compression: " + strconv.Itoa(int(flag)))
 	case 0x40:
-		err = pub.UnmarshalPoint(pk.p.Bytes())
+		err = pub.UnmarshalPoint(point)
 	default:
 		return errors.UnsupportedError("unsupported EdDSA compression: " + strconv.Itoa(int(flag)))
 	}
@@ -435,6 +497,14 @@ func (pk *PublicKey) parseEdDSA(r io.Reader) (err error) {
 	return
 }
 
+// stripLeadingZeros returns b without its leading zero bytes.
+func stripLeadingZeros(b []byte) []byte {
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
 // SerializeForHash serializes the PublicKey to w with the special packet
 // header format needed for hashing.
 func (pk *PublicKey) SerializeForHash(w io.Writer) error {
@@ -650,7 +720,7 @@ func keySignatureHash(pk, signed signingKey, hashFunc crypto.Hash) (h hash.Hash,
 	if !hashFunc.Available() {
 		return nil, errors.UnsupportedError("hash function")
 	}
-	h = hashFunc.New()
+	h = algorithm.NewHash(hashFunc)
 
 	// RFC 4880, section 5.2.4
 	err = pk.SerializeForHash(h)
@@ -697,7 +767,7 @@ func keyRevocationHash(pk signingKey, hashFunc crypto.Hash) (h hash.Hash, err er
 	if !hashFunc.Available() {
 		return nil, errors.UnsupportedError("hash function")
 	}
-	h = hashFunc.New()
+	h = algorithm.NewHash(hashFunc)
 
 	// RFC 4880, section 5.2.4
 	err = pk.SerializeForHash(h)
@@ -715,6 +785,16 @@ func (pk *PublicKey) VerifyRevocationSignature(sig *Signature) (err error) {
 	return pk.VerifySignature(h, sig)
 }
 
+// VerifyDirectKeySignature returns nil iff sig is a valid direct-key
+// signature, made by this public key, over this public key.
+func (pk *PublicKey) VerifyDirectKeySignature(sig *Signature) (err error) {
+	h, err := keyRevocationHash(pk, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return pk.VerifySignature(h, sig)
+}
+
 // VerifySubkeyRevocationSignature returns nil iff sig is a valid subkey revocation signature,
 // made by this public key, of signed.
 func (pk *PublicKey) VerifySubkeyRevocationSignature(sig *Signature, signed *PublicKey) (err error) {
@@ -731,7 +811,7 @@ func userIdSignatureHash(id string, pk *PublicKey, hashFunc crypto.Hash) (h hash
 	if !hashFunc.Available() {
 		return nil, errors.UnsupportedError("hash function")
 	}
-	h = hashFunc.New()
+	h = algorithm.NewHash(hashFunc)
 
 	// RFC 4880, section 5.2.4
 	pk.SerializeSignaturePrefix(h)
@@ -759,6 +839,44 @@ func (pk *PublicKey) VerifyUserIdSignature(id string, pub *PublicKey, sig *Signa
 	return pk.VerifySignature(h, sig)
 }
 
+// userAttributeSignatureHash returns a Hash of the message that needs to be
+// signed to assert that pk is a valid key for uat.
+func userAttributeSignatureHash(uat *UserAttribute, pk *PublicKey, hashFunc crypto.Hash) (h hash.Hash, err error) {
+	if !hashFunc.Available() {
+		return nil, errors.UnsupportedError("hash function")
+	}
+	body, err := uat.body()
+	if err != nil {
+		return nil, err
+	}
+	h = algorithm.NewHash(hashFunc)
+
+	// RFC 4880, section 5.2.4
+	pk.SerializeSignaturePrefix(h)
+	pk.serializeWithoutHeaders(h)
+
+	var buf [5]byte
+	buf[0] = 0xd1
+	buf[1] = byte(len(body) >> 24)
+	buf[2] = byte(len(body) >> 16)
+	buf[3] = byte(len(body) >> 8)
+	buf[4] = byte(len(body))
+	h.Write(buf[:])
+	h.Write(body)
+
+	return
+}
+
+// VerifyUserAttributeSignature returns nil iff sig is a valid signature, made
+// by this public key, that uat is a user attribute of pub.
+func (pk *PublicKey) VerifyUserAttributeSignature(uat *UserAttribute, pub *PublicKey, sig *Signature) (err error) {
+	h, err := userAttributeSignatureHash(uat, pub, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return pk.VerifySignature(h, sig)
+}
+
 // KeyIdString returns the public key's fingerprint in capital hex
 // (e.g. "6C7EE1B8621CC013").
 func (pk *PublicKey) KeyIdString() string {
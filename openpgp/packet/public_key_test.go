@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"crypto/elliptic"
 	"encoding/hex"
+	"io/ioutil"
 	"math/big"
 	"testing"
 	"time"
@@ -98,6 +99,58 @@ func TestPublicKeySerialize(t *testing.T) {
 	}
 }
 
+func TestFingerprintFromBody(t *testing.T) {
+	for i, test := range pubKeyTests {
+		_, _, contents, err := readHeader(readerFromHex(test.hexData), nil)
+		if err != nil {
+			t.Errorf("#%d: readHeader error: %s", i, err)
+			continue
+		}
+		body, err := ioutil.ReadAll(contents)
+		if err != nil {
+			t.Errorf("#%d: ReadAll error: %s", i, err)
+			continue
+		}
+		fingerprint, keyId, err := FingerprintFromBody(body)
+		if err != nil {
+			t.Errorf("#%d: FingerprintFromBody error: %s", i, err)
+			continue
+		}
+		expectedFingerprint, _ := hex.DecodeString(test.hexFingerprint)
+		if !bytes.Equal(expectedFingerprint, fingerprint) {
+			t.Errorf("#%d: bad fingerprint got:%x want:%x", i, fingerprint, expectedFingerprint)
+		}
+		if keyId != test.keyId {
+			t.Errorf("#%d: bad keyid got:%x want:%x", i, keyId, test.keyId)
+		}
+	}
+
+	ecdsaPub := ecdsa.NewPublicKey(ecc.NewGenericCurve(elliptic.P256()))
+	ecdsaPub.X = fromHex("81fbbc20eea9e8d1c3ceabb0a8185925b113d1ac42cd5c78403bd83da19235c6")
+	ecdsaPub.Y = fromHex("5ed6db13d91db34507d0129bf88981878d29adbf8fcd1720afdb767bb3fcaaff")
+	pub := NewECDSAPublicKey(time.Unix(1297309478, 0), ecdsaPub)
+	pub.UpgradeToV5()
+
+	body := bytes.NewBuffer(nil)
+	if err := pub.serializeWithoutHeaders(body); err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, keyId, err := FingerprintFromBody(body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(fingerprint, pub.Fingerprint) {
+		t.Errorf("bad v5 fingerprint got:%x want:%x", fingerprint, pub.Fingerprint)
+	}
+	if keyId != pub.KeyId {
+		t.Errorf("bad v5 keyid got:%x want:%x", keyId, pub.KeyId)
+	}
+
+	if _, _, err := FingerprintFromBody([]byte{3, 0, 0, 0, 0}); err == nil {
+		t.Error("expected error for unsupported key version")
+	}
+}
+
 func TestEcc384Serialize(t *testing.T) {
 	r := readerFromHex(ecc384PubHex)
 	var w bytes.Buffer
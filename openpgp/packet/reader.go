@@ -15,6 +15,7 @@ import (
 type Reader struct {
 	q       []Packet
 	readers []io.Reader
+	config  *Config
 }
 
 // New io.Readers are pushed when a compressed or encrypted packet is processed
@@ -26,7 +27,9 @@ type Reader struct {
 const maxReaders = 32
 
 // Next returns the most recently unread Packet, or reads another packet from
-// the top-most io.Reader. Unknown packet types are skipped.
+// the top-most io.Reader. Unknown packet types and Padding packets are
+// skipped, unless the Reader was created with a config that preserves unknown
+// packets, in which case they are returned as an OpaquePacket.
 func (r *Reader) Next() (p Packet, err error) {
 	if len(r.q) > 0 {
 		p = r.q[len(r.q)-1]
@@ -35,8 +38,27 @@ func (r *Reader) Next() (p Packet, err error) {
 	}
 
 	for len(r.readers) > 0 {
-		p, err = Read(r.readers[len(r.readers)-1])
+		p, err = read(r.readers[len(r.readers)-1], r.config)
+		if _, ok := p.(*Padding); ok && err == nil {
+			continue
+		}
 		if err == nil {
+			if sig, ok := p.(*Signature); ok {
+				for _, subpacketType := range sig.unknownSubpackets {
+					r.config.Warn(Warning{
+						Kind:          WarningUnknownSubpacket,
+						PacketType:    uint8(packetTypeSignature),
+						SubpacketType: uint8(subpacketType),
+					})
+				}
+				for _, subpacketType := range sig.unknownCriticalSubpackets {
+					r.config.Warn(Warning{
+						Kind:          WarningUnknownCriticalSubpacket,
+						PacketType:    uint8(packetTypeSignature),
+						SubpacketType: uint8(subpacketType),
+					})
+				}
+			}
 			return
 		}
 		if err == io.EOF {
@@ -44,7 +66,11 @@ func (r *Reader) Next() (p Packet, err error) {
 			continue
 		}
 		// TODO: Add strict mode that rejects unknown packets, instead of ignoring them.
-		if _, ok := err.(errors.UnknownPacketTypeError); ok {
+		if tag, ok := err.(errors.UnknownPacketTypeError); ok {
+			if op, ok := p.(*OpaquePacket); ok {
+				return op, nil
+			}
+			r.config.Warn(Warning{Kind: WarningUnknownPacket, Err: err, PacketType: uint8(tag)})
 			continue
 		}
 		if _, ok := err.(errors.UnsupportedError); ok {
@@ -52,6 +78,7 @@ func (r *Reader) Next() (p Packet, err error) {
 			case *SymmetricallyEncrypted, *AEADEncrypted, *Compressed, *LiteralData:
 				return nil, err
 			}
+			r.config.Warn(Warning{Kind: WarningUnsupportedPacket, Err: err})
 			continue
 		}
 		return nil, err
@@ -84,3 +111,11 @@ func NewReader(r io.Reader) *Reader {
 		readers: []io.Reader{r},
 	}
 }
+
+// NewReaderWithConfig returns a Reader that reports the packets and
+// subpackets it skips to the WarningSink of config.
+func NewReaderWithConfig(r io.Reader, config *Config) *Reader {
+	reader := NewReader(r)
+	reader.config = config
+	return reader
+}
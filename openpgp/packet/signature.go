@@ -8,9 +8,11 @@ import (
 	"bytes"
 	"crypto"
 	"crypto/dsa"
+	"encoding/asn1"
 	"encoding/binary"
 	"hash"
 	"io"
+	"math/big"
 	"strconv"
 	"time"
 
@@ -60,6 +62,16 @@ type Signature struct {
 
 	// rawSubpackets contains the unparsed subpackets, in order.
 	rawSubpackets []outputSubpacket
+	// unknownSubpackets contains the types of the unknown, non-critical
+	// subpackets that were ignored while parsing.
+	unknownSubpackets []signatureSubpacketType
+	// unknownCriticalSubpackets contains the types of the unknown, critical
+	// subpackets that were ignored while parsing, as allowed by the
+	// critical subpacket policy of parseConfig.
+	unknownCriticalSubpackets []signatureSubpacketType
+	// parseConfig is the config that signature packets are read with, if
+	// any.
+	parseConfig *Config
 
 	// The following are optional so are nil when not included in the
 	// signature.
@@ -216,6 +228,12 @@ func (sig *Signature) parse(r io.Reader) (err error) {
 		if _, err = sig.EdDSASigS.ReadFrom(r); err != nil {
 			return
 		}
+
+		if sig.parseConfig.LenientEdDSA() {
+			// NewMPI strips the padding of the values, if any.
+			sig.EdDSASigR = encoding.NewMPI(sig.EdDSASigR.Bytes())
+			sig.EdDSASigS = encoding.NewMPI(sig.EdDSASigS.Bytes())
+		}
 	default:
 		panic("unreachable")
 	}
@@ -365,7 +383,7 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 		copy(sig.PreferredSymmetric, subpacket)
 	case issuerSubpacket:
 		// Issuer, section 5.2.3.5
-		if sig.Version > 4 {
+		if sig.Version > 4 && !sig.parseConfig.LibrePGPCompatible() {
 			err = errors.StructuralError("issuer subpacket found in v5 key")
 			return
 		}
@@ -373,6 +391,11 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 			err = errors.StructuralError("issuer subpacket with bad length")
 			return
 		}
+		if sig.Version > 4 && sig.IssuerKeyId != nil {
+			// The key ID derived from the issuer fingerprint takes
+			// precedence.
+			break
+		}
 		sig.IssuerKeyId = new(uint64)
 		*sig.IssuerKeyId = binary.BigEndian.Uint64(subpacket)
 	case notationDataSubpacket:
@@ -476,7 +499,7 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 			err = errors.StructuralError("Cannot have multiple embedded signatures")
 			return
 		}
-		sig.EmbeddedSignature = new(Signature)
+		sig.EmbeddedSignature = &Signature{parseConfig: sig.parseConfig}
 		// Embedded signatures are required to be v4 signatures see
 		// section 12.1. However, we only parse v4 signatures in this
 		// file anyway.
@@ -521,9 +544,17 @@ func parseSignatureSubpacket(sig *Signature, subpacket []byte, isHashed bool) (r
 		}
 	default:
 		if isCritical {
-			err = errors.UnsupportedError("unknown critical signature subpacket type " + strconv.Itoa(int(packetType)))
+			accept, report := sig.parseConfig.unknownCriticalSubpacket(uint8(packetType))
+			if !accept {
+				err = errors.UnsupportedError("unknown critical signature subpacket type " + strconv.Itoa(int(packetType)))
+				return
+			}
+			if report {
+				sig.unknownCriticalSubpackets = append(sig.unknownCriticalSubpackets, packetType)
+			}
 			return
 		}
+		sig.unknownSubpackets = append(sig.unknownSubpackets, packetType)
 	}
 	return
 
@@ -684,15 +715,78 @@ func (sig *Signature) Sign(h hash.Hash, priv *PrivateKey, config *Config) (err e
 	if priv.Dummy() {
 		return errors.ErrDummyPrivateKey("dummy key found")
 	}
-	sig.Version = priv.PublicKey.Version
-	sig.IssuerFingerprint = priv.PublicKey.Fingerprint
-	sig.outSubpackets, err = sig.buildSubpackets(priv.PublicKey)
+	digest, err := sig.prepareSign(h, &priv.PublicKey, config)
 	if err != nil {
-		return err
+		return
 	}
-	digest, err := sig.signPrepareHash(h)
+	return sig.SignDigest(digest, priv, config)
+}
+
+// PrepareSign is the first step of Sign. It fills in the metadata of sig for
+// a signature made by signer, writes the signature trailer to h, which must
+// contain the hash of the signed data, and returns the resulting digest.
+// The digest can be signed by a private key held elsewhere, e.g. by an agent
+// or an HSM, and the result passed to SetSignature; or it can be signed with
+// SignDigest.
+//
+// PrepareSign fails if the subpacket areas of sig do not fit in a signature
+// packet. Sign additionally enforces the limits of its config.
+func (sig *Signature) PrepareSign(h hash.Hash, signer *PublicKey) (digest []byte, err error) {
+	return sig.prepareSign(h, signer, nil)
+}
+
+func (sig *Signature) prepareSign(h hash.Hash, signer *PublicKey, config *Config) (digest []byte, err error) {
+	sig.Version = signer.Version
+	sig.IssuerFingerprint = signer.Fingerprint
+	sig.outSubpackets, err = sig.buildSubpackets(*signer)
 	if err != nil {
-		return
+		return nil, err
+	}
+	if err = checkSubpacketLimits(sig.outSubpackets, config); err != nil {
+		return nil, err
+	}
+	return sig.signPrepareHash(h)
+}
+
+// checkSubpacketLimits returns an InvalidArgumentError if the given
+// subpackets exceed the number of subpackets or the length of the subpacket
+// areas allowed by config. The error names the largest subpacket of an
+// oversized area, which is usually the one added by mistake.
+func checkSubpacketLimits(subpackets []outputSubpacket, config *Config) error {
+	if limit := config.SignatureSubpacketsLimit(); limit > 0 && len(subpackets) > limit {
+		return errors.InvalidArgumentError("signature has " + strconv.Itoa(len(subpackets)) +
+			" subpackets, exceeding the limit of " + strconv.Itoa(limit))
+	}
+	limit := config.SignatureSubpacketAreaLimit()
+	for _, hashed := range []bool{true, false} {
+		length := subpacketsLength(subpackets, hashed)
+		if length <= limit {
+			continue
+		}
+		area := "unhashed"
+		if hashed {
+			area = "hashed"
+		}
+		var largest outputSubpacket
+		for _, subpacket := range subpackets {
+			if subpacket.hashed == hashed && len(subpacket.contents) >= len(largest.contents) {
+				largest = subpacket
+			}
+		}
+		return errors.InvalidArgumentError(area + " signature subpackets are " + strconv.Itoa(length) +
+			" bytes long, exceeding the limit of " + strconv.Itoa(limit) +
+			" bytes; the largest one, of type " + strconv.Itoa(int(largest.subpacketType)) +
+			", is " + strconv.Itoa(len(largest.contents)) + " bytes long")
+	}
+	return nil
+}
+
+// SignDigest is the second step of Sign. It signs digest, as returned by
+// PrepareSign, with priv and stores the result in sig.
+// If config is nil, sensible defaults will be used.
+func (sig *Signature) SignDigest(digest []byte, priv *PrivateKey, config *Config) (err error) {
+	if priv.Dummy() {
+		return errors.ErrDummyPrivateKey("dummy key found")
 	}
 	switch priv.PubKeyAlgo {
 	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly:
@@ -715,7 +809,10 @@ func (sig *Signature) Sign(h hash.Hash, priv *PrivateKey, config *Config) (err e
 			sig.DSASigS = new(encoding.MPI).SetBig(s)
 		}
 	case PubKeyAlgoECDSA:
-		sk := priv.PrivateKey.(*ecdsa.PrivateKey)
+		sk, ok := priv.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return sig.signExternal(digest, priv, sig.Hash, config)
+		}
 		r, s, err := ecdsa.Sign(config.Random(), sk, digest)
 
 		if err == nil {
@@ -723,7 +820,11 @@ func (sig *Signature) Sign(h hash.Hash, priv *PrivateKey, config *Config) (err e
 			sig.ECDSASigS = new(encoding.MPI).SetBig(s)
 		}
 	case PubKeyAlgoEdDSA:
-		sk := priv.PrivateKey.(*eddsa.PrivateKey)
+		sk, ok := priv.PrivateKey.(*eddsa.PrivateKey)
+		if !ok {
+			// EdDSA signs the digest as the message.
+			return sig.signExternal(digest, priv, crypto.Hash(0), config)
+		}
 		r, s, err := eddsa.Sign(sk, digest)
 		if err == nil {
 			sig.EdDSASigR = encoding.NewMPI(r)
@@ -736,6 +837,56 @@ func (sig *Signature) Sign(h hash.Hash, priv *PrivateKey, config *Config) (err e
 	return
 }
 
+// signExternal signs digest with priv, whose private key is a crypto.Signer
+// as created by NewExternalSignerPrivateKey.
+func (sig *Signature) signExternal(digest []byte, priv *PrivateKey, opts crypto.SignerOpts, config *Config) error {
+	signer, ok := priv.PrivateKey.(crypto.Signer)
+	if !ok {
+		return errors.InvalidArgumentError("unknown private key type")
+	}
+	signature, err := signer.Sign(config.Random(), digest, opts)
+	if err != nil {
+		return err
+	}
+	return sig.SetSignature(&priv.PublicKey, signature)
+}
+
+// SetSignature stores in sig a signature made by signer over the digest
+// returned by PrepareSign. The signature must be in the format produced by
+// crypto.Signer implementations: PKCS #1 v1.5 for RSA, ASN.1 DER encoded
+// (r, s) for DSA and ECDSA, and the native signature encoding for EdDSA.
+func (sig *Signature) SetSignature(signer *PublicKey, signature []byte) error {
+	switch signer.PubKeyAlgo {
+	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly:
+		sig.RSASignature = encoding.NewMPI(signature)
+	case PubKeyAlgoDSA, PubKeyAlgoECDSA:
+		var rs struct{ R, S *big.Int }
+		rest, err := asn1.Unmarshal(signature, &rs)
+		if err != nil || len(rest) != 0 || rs.R == nil || rs.S == nil {
+			return errors.InvalidArgumentError("malformed DSA or ECDSA signature")
+		}
+		if signer.PubKeyAlgo == PubKeyAlgoDSA {
+			sig.DSASigR = new(encoding.MPI).SetBig(rs.R)
+			sig.DSASigS = new(encoding.MPI).SetBig(rs.S)
+		} else {
+			sig.ECDSASigR = new(encoding.MPI).SetBig(rs.R)
+			sig.ECDSASigS = new(encoding.MPI).SetBig(rs.S)
+		}
+	case PubKeyAlgoEdDSA:
+		pub := signer.PublicKey.(*eddsa.PublicKey)
+		// EdDSA signatures are twice as long as the public point.
+		if len(signature) != 2*len(pub.X) {
+			return errors.InvalidArgumentError("malformed EdDSA signature")
+		}
+		r, s := pub.GetCurve().MarshalSignature(signature)
+		sig.EdDSASigR = encoding.NewMPI(r)
+		sig.EdDSASigS = encoding.NewMPI(s)
+	default:
+		return errors.UnsupportedError("public key algorithm: " + strconv.Itoa(int(signer.PubKeyAlgo)))
+	}
+	return nil
+}
+
 // SignUserId computes a signature from priv, asserting that pub is a valid
 // key for the identity id.  On success, the signature is stored in sig. Call
 // Serialize to write it out.
@@ -751,6 +902,21 @@ func (sig *Signature) SignUserId(id string, pub *PublicKey, priv *PrivateKey, co
 	return sig.Sign(h, priv, config)
 }
 
+// SignUserAttribute computes a signature from priv, asserting that pub is a
+// valid key for the user attribute uat. On success, the signature is stored in
+// sig. Call Serialize to write it out.
+// If config is nil, sensible defaults will be used.
+func (sig *Signature) SignUserAttribute(uat *UserAttribute, pub *PublicKey, priv *PrivateKey, config *Config) error {
+	if priv.Dummy() {
+		return errors.ErrDummyPrivateKey("dummy key found")
+	}
+	h, err := userAttributeSignatureHash(uat, pub, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return sig.Sign(h, priv, config)
+}
+
 // CrossSignKey computes a signature from signingKey on pub hashed using hashKey. On success,
 // the signature is stored in sig. Call Serialize to write it out.
 // If config is nil, sensible defaults will be used.
@@ -777,6 +943,22 @@ func (sig *Signature) SignKey(pub *PublicKey, priv *PrivateKey, config *Config)
 	return sig.Sign(h, priv, config)
 }
 
+// SignDirectKeySignature computes a direct-key signature of pub using priv.
+// A direct-key self-signature carries the properties of the primary key
+// (key flags, preferences, expiration) for keys without user IDs. On success,
+// the signature is stored in sig. Call Serialize to write it out.
+// If config is nil, sensible defaults will be used.
+func (sig *Signature) SignDirectKeySignature(pub *PublicKey, priv *PrivateKey, config *Config) error {
+	if priv.Dummy() {
+		return errors.ErrDummyPrivateKey("dummy key found")
+	}
+	h, err := keyRevocationHash(pub, sig.Hash)
+	if err != nil {
+		return err
+	}
+	return sig.Sign(h, priv, config)
+}
+
 // RevokeKey computes a revocation signature of pub using priv. On success, the signature is
 // stored in sig. Call Serialize to write it out.
 // If config is nil, sensible defaults will be used.
@@ -823,6 +1005,20 @@ func (sig *Signature) Serialize(w io.Writer) (err error) {
 		panic("impossible")
 	}
 
+	err = serializeHeader(w, packetTypeSignature, sig.bodyLength(sigLength))
+	if err != nil {
+		return
+	}
+	err = sig.serializeBody(w)
+	if err != nil {
+		return err
+	}
+	return
+}
+
+// bodyLength returns the length of the body of the serialized signature
+// packet, given the length of the encoded signature values.
+func (sig *Signature) bodyLength(sigLength int) int {
 	unhashedSubpacketsLen := subpacketsLength(sig.outSubpackets, false)
 	length := len(sig.HashSuffix) - 6 /* trailer not included */ +
 		2 /* length of unhashed subpackets */ + unhashedSubpacketsLen +
@@ -830,15 +1026,46 @@ func (sig *Signature) Serialize(w io.Writer) (err error) {
 	if sig.Version == 5 {
 		length -= 4 // eight-octet instead of four-octet big endian
 	}
-	err = serializeHeader(w, packetTypeSignature, length)
-	if err != nil {
-		return
+	return length
+}
+
+// MaxSerializedLength returns an upper bound of the length of the signature
+// packet, header included, that Serialize would write once sig, prepared
+// with PrepareSign, is signed by signer. It is computed from the algorithm
+// and key size of signer, without signing.
+func (sig *Signature) MaxSerializedLength(signer *PublicKey) (int, error) {
+	if sig.HashSuffix == nil {
+		return 0, errors.InvalidArgumentError("Signature: need to call PrepareSign before MaxSerializedLength")
 	}
-	err = sig.serializeBody(w)
-	if err != nil {
-		return err
+	var sigLength int
+	switch signer.PubKeyAlgo {
+	case PubKeyAlgoRSA, PubKeyAlgoRSASignOnly:
+		// The signature is smaller than the modulus.
+		sigLength = int(signer.n.EncodedLength())
+	case PubKeyAlgoDSA:
+		// r and s are smaller than the subgroup order q.
+		sigLength = 2 * int(signer.q.EncodedLength())
+	case PubKeyAlgoECDSA:
+		// r and s are at most as long as the coordinates of the
+		// uncompressed public point.
+		fieldLength := (len(signer.p.Bytes()) - 1) / 2
+		sigLength = 2 * (2 + fieldLength)
+	case PubKeyAlgoEdDSA:
+		pub, ok := signer.PublicKey.(*eddsa.PublicKey)
+		if !ok {
+			return 0, errors.InvalidArgumentError("unknown EdDSA public key type")
+		}
+		// EdDSA signatures are twice as long as the public point.
+		sigLength = 2 * (2 + len(pub.X))
+	default:
+		return 0, errors.UnsupportedError("public key algorithm: " + strconv.Itoa(int(signer.PubKeyAlgo)))
 	}
-	return
+	length := sig.bodyLength(sigLength)
+	var header bytes.Buffer
+	if err := serializeHeader(&header, packetTypeSignature, length); err != nil {
+		return 0, err
+	}
+	return header.Len() + length, nil
 }
 
 func (sig *Signature) serializeBody(w io.Writer) (err error) {
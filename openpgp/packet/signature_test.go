@@ -7,11 +7,22 @@ package packet
 import (
 	"bytes"
 	"crypto"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
 	"encoding/hex"
+	"io"
+	"math/big"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/ecdsa"
+	"github.com/ProtonMail/go-crypto/openpgp/eddsa"
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/ecc"
 )
 
 func TestSignatureReadAndReserialize(t *testing.T) {
@@ -60,6 +71,43 @@ func TestOnePassSignatureReadAndReserialize(t *testing.T) {
 	}
 }
 
+func TestOnePassSignatureV6(t *testing.T) {
+	ops := &OnePassSignature{
+		Version:        6,
+		SigType:        SigTypeText,
+		Hash:           crypto.SHA512,
+		PubKeyAlgo:     PubKeyAlgoEdDSA,
+		IsLast:         true,
+		Salt:           bytes.Repeat([]byte{0x5a}, 32),
+		KeyFingerprint: bytes.Repeat([]byte{0xcb}, 32),
+	}
+	buf := new(bytes.Buffer)
+	if err := ops.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	packet, err := Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, ok := packet.(*OnePassSignature)
+	if !ok {
+		t.Fatalf("failed to parse, got: %#v", packet)
+	}
+	if parsed.Version != 6 || parsed.SigType != ops.SigType || parsed.Hash != ops.Hash ||
+		parsed.PubKeyAlgo != ops.PubKeyAlgo || !parsed.IsLast ||
+		!bytes.Equal(parsed.Salt, ops.Salt) || !bytes.Equal(parsed.KeyFingerprint, ops.KeyFingerprint) {
+		t.Errorf("got %#v, want %#v", parsed, ops)
+	}
+	if parsed.KeyId != 0xcbcbcbcbcbcbcbcb {
+		t.Errorf("wrong key ID derived from the fingerprint: %x", parsed.KeyId)
+	}
+
+	ops.KeyFingerprint = ops.KeyFingerprint[:20]
+	if err = ops.Serialize(buf); err == nil {
+		t.Error("serialized a v6 one-pass signature with a v4 fingerprint")
+	}
+}
+
 func TestSignatureEmptyFingerprint(t *testing.T) {
 	armoredSig := `-----BEGIN PGP SIGNATURE-----
 
@@ -335,3 +383,233 @@ const signatureWithTrustRegexHex = "c2bd0410010800310502886e09001621040f0bfb42b3
 const signatureWithBadTrustRegexHex = "c2bc0410010800300502886e09001621040f0bfb42b3b08bece556fffcc181c053de849bf20385013c0e862a2e6578616d706c652e636f6d00007e7103fe3fa66963f7a91ceb297286f57bab38446ba591215a9d6589ab6ec0d930438a4d79f80a52440e017dc6dd03f7425ccc1e059edda2b32f4975501eacc5676f216e56c568b75442c3efc750425f0d5276c7611ef838ce3f015f4de0969b4710aac8a76fcf2d48dd0749e937099b55ab77d93132e9777ba3b8cf89f908c2dbfff838"
 
 const positiveCertSignatureDataHex = "c2c0b304130108005d050b0908070206150a09080b020416020301021e010217802418686b70733a2f2f686b70732e706f6f6c2e736b732d6b6579736572766572732e6e65741621045ef9b8a44d89b32f94f3e9333679666422d0f62605025b2cc122021b2f000a09103679666422d0f62668e1080098b71f59ce893769ccb603344290e89df8f12d6ea906cc1c2b166c61a02679070744565f8280712b4e6bdfd482b758ef935655f1674c8f3633ab173d27cbe31e46368a8255134ecc5249ad66324cc4f6a79f160459b326711cfdc35032aac0903657a934f80f79768786ddd6554aa8d385c03adbee17c4e3e2831752d4910077da3b1f5562d267a57540a1c2b0dd2d96ed055c06098599b2390d61cfa37c6d19d9d63749fb3c3cfe0036fd959ba616eb23486216563fed8fdd19f96f5da9943db1698705fb688c1354c379ef01de307c4a0ac016e6385324cb0a7b49cfeee8961a289c8fa4c81d0e24e00969039db223a9835e8b86a8d85df645175f8aa0f8f2"
+
+func TestSignatureUnknownCriticalSubpacketPolicy(t *testing.T) {
+	body := []byte{
+		4, byte(SigTypeBinary), byte(PubKeyAlgoRSA), 8, // version, type, RSA, SHA-256
+		0, 9, // hashed subpackets
+		5, byte(creationTimeSubpacket), 0x60, 0, 0, 0,
+		2, 0x80 | 100, 1, // unknown critical subpacket
+		0, 10, // unhashed subpackets
+		9, byte(issuerSubpacket), 1, 2, 3, 4, 5, 6, 7, 8,
+		0xab, 0xcd, // hash tag
+		0, 8, 0xff, // signature MPI
+	}
+	var buf bytes.Buffer
+	if err := SerializePacket(&buf, uint8(packetTypeSignature), body); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range []struct {
+		config   *Config
+		accepted bool
+		warned   bool
+	}{
+		{nil, false, false},
+		{&Config{}, false, false},
+		{&Config{CriticalSubpackets: ReportUnknownCriticalSubpackets}, true, true},
+		{&Config{AcceptCriticalSubpacket: func(t uint8) bool { return t == 100 }}, true, false},
+		{&Config{AcceptCriticalSubpacket: func(t uint8) bool { return t == 101 }}, false, false},
+	} {
+		warnings := new(WarningCollector)
+		if test.config != nil {
+			test.config.Warnings = warnings
+		}
+		p, err := NewReaderWithConfig(bytes.NewReader(buf.Bytes()), test.config).Next()
+		if test.accepted {
+			if _, ok := p.(*Signature); !ok || err != nil {
+				t.Errorf("#%d: signature not accepted: %v", i, err)
+			}
+		} else if err != io.EOF {
+			t.Errorf("#%d: signature not rejected: %v", i, err)
+		}
+
+		warned := false
+		for _, w := range warnings.Warnings() {
+			if w.Kind == WarningUnknownCriticalSubpacket && w.SubpacketType == 100 {
+				warned = true
+			}
+		}
+		if warned != test.warned {
+			t.Errorf("#%d: got warning %t, want %t", i, warned, test.warned)
+		}
+	}
+}
+
+func TestSignExternalDigest(t *testing.T) {
+	rsaPriv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaPriv, err := ecdsa.GenerateKey(rand.Reader, ecc.NewGenericCurve(elliptic.P256()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	eddsaPriv, err := eddsa.GenerateKey(rand.Reader, ecc.NewEd25519())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each signer mimics an external signer, e.g. an HSM, which only sees
+	// the digest.
+	signers := []struct {
+		pub  *PublicKey
+		sign func(digest []byte) ([]byte, error)
+	}{
+		{NewRSAPublicKey(time.Now(), &rsaPriv.PublicKey), func(digest []byte) ([]byte, error) {
+			return rsa.SignPKCS1v15(rand.Reader, rsaPriv, crypto.SHA256, digest)
+		}},
+		{NewECDSAPublicKey(time.Now(), &ecdsaPriv.PublicKey), func(digest []byte) ([]byte, error) {
+			r, s, err := ecdsa.Sign(rand.Reader, ecdsaPriv, digest)
+			if err != nil {
+				return nil, err
+			}
+			return asn1.Marshal(struct{ R, S *big.Int }{r, s})
+		}},
+		{NewEdDSAPublicKey(time.Now(), &eddsaPriv.PublicKey), func(digest []byte) ([]byte, error) {
+			r, s, err := eddsa.Sign(eddsaPriv, digest)
+			return append(r, s...), err
+		}},
+	}
+
+	message := []byte("signed by an external signer")
+	for i, signer := range signers {
+		sig := &Signature{
+			SigType:      SigTypeBinary,
+			PubKeyAlgo:   signer.pub.PubKeyAlgo,
+			Hash:         crypto.SHA256,
+			CreationTime: time.Now(),
+		}
+		h := sig.Hash.New()
+		h.Write(message)
+		digest, err := sig.PrepareSign(h, signer.pub)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		signature, err := signer.sign(digest)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if signer.pub.PubKeyAlgo != PubKeyAlgoRSA {
+			if err = sig.SetSignature(signer.pub, signature[:len(signature)-1]); err == nil {
+				t.Errorf("#%d: expected an error for a truncated signature", i)
+			}
+		}
+		if err = sig.SetSignature(signer.pub, signature); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+
+		var buf bytes.Buffer
+		if err = sig.Serialize(&buf); err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		p, err := Read(&buf)
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		h = sig.Hash.New()
+		h.Write(message)
+		if err = signer.pub.VerifySignature(h, p.(*Signature)); err != nil {
+			t.Errorf("#%d: signature did not verify: %s", i, err)
+		}
+	}
+}
+
+func TestLibrePGPIssuerSubpacket(t *testing.T) {
+	eddsaPriv, err := eddsa.GenerateKey(rand.Reader, ecc.NewEd25519())
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := NewEdDSAPrivateKey(time.Now(), eddsaPriv)
+	priv.UpgradeToV5()
+
+	sig := &Signature{
+		SigType:    SigTypeBinary,
+		PubKeyAlgo: PubKeyAlgoEdDSA,
+		Hash:       crypto.SHA256,
+	}
+	h := crypto.SHA256.New()
+	h.Write([]byte("message"))
+	if err = sig.Sign(h, priv, nil); err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	if err = sig.serializeBody(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	// Add an Issuer Key ID subpacket to the unhashed area, as GnuPG does.
+	b := body.Bytes()
+	unhashedStart := 6 + (int(b[4])<<8 | int(b[5]))
+	unhashedLen := int(b[unhashedStart])<<8 | int(b[unhashedStart+1])
+	issuer := []byte{9, byte(issuerSubpacket), 0, 0, 0, 0, 0, 0, 0, 0}
+	copy(issuer[2:], priv.Fingerprint[:8])
+	var patched bytes.Buffer
+	patched.Write(b[:unhashedStart])
+	patched.Write([]byte{byte((unhashedLen + len(issuer)) >> 8), byte(unhashedLen + len(issuer))})
+	patched.Write(issuer)
+	patched.Write(b[unhashedStart+2:])
+	var packet bytes.Buffer
+	if err = serializeHeader(&packet, packetTypeSignature, patched.Len()); err != nil {
+		t.Fatal(err)
+	}
+	packet.Write(patched.Bytes())
+
+	if _, err = Read(bytes.NewReader(packet.Bytes())); err == nil {
+		t.Error("expected an error for an issuer subpacket in a v5 signature")
+	}
+	p, err := read(bytes.NewReader(packet.Bytes()), &Config{LibrePGPCompatibility: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := p.(*Signature)
+	if *parsed.IssuerKeyId != priv.KeyId {
+		t.Errorf("unexpected issuer key ID %x", *parsed.IssuerKeyId)
+	}
+	h = crypto.SHA256.New()
+	h.Write([]byte("message"))
+	if err = priv.VerifySignature(h, parsed); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSignatureSubpacketLimits(t *testing.T) {
+	packet, err := Read(readerFromHex(privKeyRSAHex))
+	if err != nil {
+		t.Fatalf("failed to deserialize private key: %v", err)
+	}
+	privKey := packet.(*PrivateKey)
+	if err = privKey.Decrypt([]byte("testing")); err != nil {
+		t.Fatalf("failed to decrypt private key: %v", err)
+	}
+
+	newSig := func(notationLength int) *Signature {
+		return &Signature{
+			SigType:    SigTypeGenericCert,
+			PubKeyAlgo: PubKeyAlgoRSA,
+			Hash:       crypto.SHA256,
+			Notations:  []*Notation{{Name: "test@example.com", Value: make([]byte, notationLength)}},
+		}
+	}
+
+	// The hashed area cannot be encoded, whatever the config.
+	err = newSig(70000).SignUserId("", &privKey.PublicKey, privKey, nil)
+	if _, ok := err.(errors.InvalidArgumentError); !ok {
+		t.Errorf("expected an InvalidArgumentError for an oversized hashed area, got %v", err)
+	}
+
+	config := &Config{MaxSignatureSubpacketAreaLength: 1024}
+	err = newSig(2048).SignUserId("", &privKey.PublicKey, privKey, config)
+	if _, ok := err.(errors.InvalidArgumentError); !ok {
+		t.Errorf("expected an InvalidArgumentError for an area above the limit, got %v", err)
+	}
+	if err = newSig(512).SignUserId("", &privKey.PublicKey, privKey, config); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	config = &Config{MaxSignatureSubpackets: 2}
+	err = newSig(0).SignUserId("", &privKey.PublicKey, privKey, config)
+	if _, ok := err.(errors.InvalidArgumentError); !ok {
+		t.Errorf("expected an InvalidArgumentError for too many subpackets, got %v", err)
+	}
+}
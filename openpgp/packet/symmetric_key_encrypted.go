@@ -7,11 +7,13 @@ package packet
 import (
 	"bytes"
 	"crypto/cipher"
+	"crypto/sha256"
 	"io"
 	"strconv"
 
 	"github.com/ProtonMail/go-crypto/openpgp/errors"
 	"github.com/ProtonMail/go-crypto/openpgp/s2k"
+	"golang.org/x/crypto/hkdf"
 )
 
 // This is the largest session key that we'll support. Since at most 256-bit cipher
@@ -39,10 +41,18 @@ func (ske *SymmetricKeyEncrypted) parse(r io.Reader) error {
 		return err
 	}
 	ske.Version = int(buf[0])
-	if ske.Version != 4 && ske.Version != 5 {
+	if ske.Version != 4 && ske.Version != 5 && ske.Version != 6 {
 		return errors.UnsupportedError("unknown SymmetricKeyEncrypted version")
 	}
 
+	if ske.Version == 6 {
+		// Scalar octet count of the following 5 fields: cipher, AEAD mode,
+		// S2K length, S2K and IV. It is implied by the fields themselves.
+		if _, err := readFull(r, buf[:]); err != nil {
+			return err
+		}
+	}
+
 	// Cipher function
 	if _, err := readFull(r, buf[:]); err != nil {
 		return err
@@ -52,23 +62,39 @@ func (ske *SymmetricKeyEncrypted) parse(r io.Reader) error {
 		return errors.UnsupportedError("unknown cipher: " + strconv.Itoa(int(buf[0])))
 	}
 
-	if ske.Version == 5 {
+	if ske.Version == 5 || ske.Version == 6 {
 		// AEAD mode
 		if _, err := readFull(r, buf[:]); err != nil {
 			return errors.StructuralError("cannot read AEAD octet from packet")
 		}
 		ske.Mode = AEADMode(buf[0])
+		if ske.Mode.TagLength() == 0 {
+			return errors.UnsupportedError("unknown aead mode: " + strconv.Itoa(int(ske.Mode)))
+		}
+	}
+
+	s2kReader := r
+	if ske.Version == 6 {
+		// S2K specifier length
+		if _, err := readFull(r, buf[:]); err != nil {
+			return errors.StructuralError("cannot read S2K length octet from packet")
+		}
+		s2kBytes := make([]byte, buf[0])
+		if _, err := readFull(r, s2kBytes); err != nil {
+			return errors.StructuralError("cannot read S2K specifier from packet")
+		}
+		s2kReader = bytes.NewReader(s2kBytes)
 	}
 
 	var err error
-	if ske.s2k, err = s2k.Parse(r); err != nil {
+	if ske.s2k, err = s2k.Parse(s2kReader); err != nil {
 		if _, ok := err.(errors.ErrDummyPrivateKey); ok {
 			return errors.UnsupportedError("missing key GNU extension in session key")
 		}
 		return err
 	}
 
-	if ske.Version == 5 {
+	if ske.Version == 5 || ske.Version == 6 {
 		// AEAD IV
 		iv := make([]byte, ske.Mode.IvLength())
 		_, err := readFull(r, iv)
@@ -110,7 +136,11 @@ func (ske *SymmetricKeyEncrypted) Decrypt(passphrase []byte) ([]byte, CipherFunc
 		plaintextKey, cipherFunc, err := ske.decryptV4(key)
 		return plaintextKey, cipherFunc, err
 	case 5:
+		// The session key of a v5 packet is used with its own cipher.
 		plaintextKey, err := ske.decryptV5(key)
+		return plaintextKey, ske.CipherFunc, err
+	case 6:
+		plaintextKey, err := ske.decryptV6(key)
 		return plaintextKey, CipherFunction(0), err
 	}
 	err := errors.UnsupportedError("unknown SymmetricKeyEncrypted version")
@@ -147,6 +177,27 @@ func (ske *SymmetricKeyEncrypted) decryptV5(key []byte) ([]byte, error) {
 	return plaintextKey, nil
 }
 
+// decryptV6 decrypts the session key of a v6 packet, wrapped with a key
+// derived from the S2K output with HKDF. See RFC 9580, section 5.3.
+func (ske *SymmetricKeyEncrypted) decryptV6(key []byte) ([]byte, error) {
+	adata := []byte{0xc3, byte(6), byte(ske.CipherFunc), byte(ske.Mode)}
+	aead := getEncryptedKeyAeadInstance(ske.CipherFunc, ske.Mode, deriveKeyEncryptionKeyV6(key, adata), adata)
+
+	plaintextKey, err := aead.Open(nil, ske.iv, ske.encryptedKey, adata)
+	if err != nil {
+		return nil, err
+	}
+	return plaintextKey, nil
+}
+
+// deriveKeyEncryptionKeyV6 derives the key that wraps the session key in a v6
+// packet from the S2K output, using the packet header as HKDF info.
+func deriveKeyEncryptionKeyV6(s2kKey, info []byte) []byte {
+	keyEncryptionKey := make([]byte, len(s2kKey))
+	_, _ = readFull(hkdf.New(sha256.New, s2kKey, nil, info), keyEncryptionKey)
+	return keyEncryptionKey
+}
+
 // SerializeSymmetricKeyEncrypted serializes a symmetric key packet to w.
 // The packet contains a random session key, encrypted by a key derived from
 // the given passphrase. The session key is returned and must be passed to
@@ -177,9 +228,12 @@ func SerializeSymmetricKeyEncrypted(w io.Writer, passphrase []byte, config *Conf
 // If config is nil, sensible defaults will be used.
 func SerializeSymmetricKeyEncryptedReuseKey(w io.Writer, sessionKey []byte, passphrase []byte, config *Config) (err error) {
 	var version int
-	if config.AEAD() != nil {
+	switch {
+	case config.AEAD() != nil && config.V6SKESK:
+		version = 6
+	case config.AEAD() != nil:
 		version = 5
-	} else {
+	default:
 		version = 4
 	}
 	cipherFunc := config.Cipher()
@@ -207,6 +261,10 @@ func SerializeSymmetricKeyEncryptedReuseKey(w io.Writer, sessionKey []byte, pass
 		ivLen := config.AEAD().Mode().IvLength()
 		tagLen := config.AEAD().Mode().TagLength()
 		packetLength = 3 + len(s2kBytes) + ivLen + keySize + tagLen
+	case 6:
+		ivLen := config.AEAD().Mode().IvLength()
+		tagLen := config.AEAD().Mode().TagLength()
+		packetLength = 5 + len(s2kBytes) + ivLen + keySize + tagLen
 	}
 	err = serializeHeader(w, packetTypeSymmetricKeyEncrypted, packetLength)
 	if err != nil {
@@ -216,13 +274,22 @@ func SerializeSymmetricKeyEncryptedReuseKey(w io.Writer, sessionKey []byte, pass
 	// Symmetric Key Encrypted Version
 	buf := []byte{byte(version)}
 
+	if version == 6 {
+		// Octet count of cipher, AEAD mode, S2K length, S2K and IV
+		buf = append(buf, byte(3+len(s2kBytes)+config.AEAD().Mode().IvLength()))
+	}
+
 	// Cipher function
 	buf = append(buf, byte(cipherFunc))
 
-	if version == 5 {
+	if version == 5 || version == 6 {
 		// AEAD mode
 		buf = append(buf, byte(config.AEAD().Mode()))
 	}
+	if version == 6 {
+		// S2K specifier length
+		buf = append(buf, byte(len(s2kBytes)))
+	}
 	_, err = w.Write(buf)
 	if err != nil {
 		return
@@ -237,15 +304,18 @@ func SerializeSymmetricKeyEncryptedReuseKey(w io.Writer, sessionKey []byte, pass
 		iv := make([]byte, cipherFunc.blockSize())
 		c := cipher.NewCFBEncrypter(cipherFunc.new(keyEncryptingKey), iv)
 		encryptedCipherAndKey := make([]byte, keySize+1)
-		c.XORKeyStream(encryptedCipherAndKey, buf[1:])
+		c.XORKeyStream(encryptedCipherAndKey, buf[1:2])
 		c.XORKeyStream(encryptedCipherAndKey[1:], sessionKey)
 		_, err = w.Write(encryptedCipherAndKey)
 		if err != nil {
 			return
 		}
-	case 5:
+	case 5, 6:
 		mode := config.AEAD().Mode()
-		adata := []byte{0xc3, byte(5), byte(cipherFunc), byte(mode)}
+		adata := []byte{0xc3, byte(version), byte(cipherFunc), byte(mode)}
+		if version == 6 {
+			keyEncryptingKey = deriveKeyEncryptionKeyV6(keyEncryptingKey, adata)
+		}
 		aead := getEncryptedKeyAeadInstance(cipherFunc, mode, keyEncryptingKey, adata)
 
 		// Sample iv using random reader
@@ -190,3 +190,54 @@ func TestSerializeSymmetricKeyEncryptedCiphersV4(t *testing.T) {
 		})
 	}
 }
+
+func TestSerializeSymmetricKeyEncryptedV6(t *testing.T) {
+	modes := map[string]AEADMode{
+		"EAX": AEADModeEAX,
+		"OCB": AEADModeOCB,
+		"GCM": AEADModeGCM,
+	}
+	for modeName, mode := range modes {
+		t.Run(modeName, func(t *testing.T) {
+			var buf bytes.Buffer
+			passphrase := []byte("password")
+			config := &Config{
+				DefaultCipher: CipherAES256,
+				AEADConfig:    &AEADConfig{DefaultMode: mode},
+				V6SKESK:       true,
+				S2KConfig: &s2k.Config{
+					S2KMode:      s2k.Argon2S2K,
+					Argon2Config: &s2k.Argon2Config{NumberOfPasses: 1, DegreeOfParallelism: 4, Memory: 2 << 10},
+				},
+			}
+
+			key, err := SerializeSymmetricKeyEncrypted(&buf, passphrase, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			serialized := buf.Bytes()
+			p, err := Read(bytes.NewReader(serialized))
+			if err != nil {
+				t.Fatalf("failed to reparse %s", err)
+			}
+			ske, ok := p.(*SymmetricKeyEncrypted)
+			if !ok {
+				t.Fatalf("parsed a different packet type: %#v", p)
+			}
+			if ske.Version != 6 || ske.Mode != mode || ske.CipherFunc != CipherAES256 {
+				t.Errorf("unexpected packet: version %d, mode %d, cipher %d", ske.Version, ske.Mode, ske.CipherFunc)
+			}
+
+			parsedKey, _, err := ske.Decrypt(passphrase)
+			if err != nil {
+				t.Fatalf("failed to decrypt reparsed SKE: %s", err)
+			}
+			if !bytes.Equal(key, parsedKey) {
+				t.Errorf("keys don't match after Decrypt: %x (original) vs %x (parsed)", key, parsedKey)
+			}
+			if _, _, err := ske.Decrypt([]byte("wrong password")); err == nil {
+				t.Error("decrypted with a wrong passphrase")
+			}
+		})
+	}
+}
@@ -76,6 +76,12 @@ func (se *SymmetricallyEncrypted) Decrypt(c CipherFunction, key []byte) (io.Read
 // written.
 // If config is nil, sensible defaults will be used.
 func SerializeSymmetricallyEncrypted(w io.Writer, c CipherFunction, aeadSupported bool, cipherSuite CipherSuite, key []byte, config *Config) (Contents io.WriteCloser, err error) {
+	if aeadSupported {
+		if err = config.AEAD().CheckChunkSize(); err != nil {
+			return
+		}
+	}
+
 	writeCloser := noOpCloser{w}
 	ciphertext, err := serializeStreamHeader(writeCloser, packetTypeSymmetricallyEncryptedIntegrityProtected)
 	if err != nil {
@@ -83,7 +89,7 @@ func SerializeSymmetricallyEncrypted(w io.Writer, c CipherFunction, aeadSupporte
 	}
 
 	if aeadSupported {
-		return serializeSymmetricallyEncryptedAead(ciphertext, cipherSuite, config.AEADConfig.ChunkSizeByte(), config.Random(), key)
+		return serializeSymmetricallyEncryptedAead(ciphertext, cipherSuite, config.AEAD().ChunkSizeByte(), config.Random(), key)
 	}
 
 	return serializeSymmetricallyEncryptedMdc(ciphertext, c, key, config)
@@ -8,6 +8,7 @@ import (
 	"crypto/cipher"
 	"crypto/sha256"
 	"io"
+	"strconv"
 
 	"github.com/ProtonMail/go-crypto/openpgp/errors"
 	"golang.org/x/crypto/hkdf"
@@ -36,8 +37,8 @@ func (se *SymmetricallyEncrypted) parseAead(r io.Reader) error {
 
 	// Chunk size
 	se.ChunkSizeByte = headerData[2]
-	if se.ChunkSizeByte > 16 {
-		return errors.UnsupportedError("invalid aead chunk size byte: " + string(se.ChunkSizeByte))
+	if se.ChunkSizeByte > maxAEADChunkSizeByte {
+		return errors.UnsupportedError("invalid aead chunk size byte: " + strconv.Itoa(int(se.ChunkSizeByte)))
 	}
 
 	// Salt
@@ -5,6 +5,7 @@
 package packet
 
 import (
+	"crypto"
 	"crypto/cipher"
 	"crypto/sha1"
 	"crypto/subtle"
@@ -13,6 +14,7 @@ import (
 	"strconv"
 
 	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/algorithm"
 )
 
 // seMdcReader wraps an io.Reader with a no-op Close method.
@@ -53,14 +55,18 @@ func (se *SymmetricallyEncrypted) decryptMdc(c CipherFunction, key []byte) (io.R
 		ocfbResync = OCFBNoResync
 	}
 
-	s := NewOCFBDecrypter(c.new(key), se.prefix, ocfbResync)
+	// NewOCFBDecrypter decrypts the prefix in place, so it is given a copy
+	// to keep se.prefix usable with another key.
+	prefix := make([]byte, len(se.prefix))
+	copy(prefix, se.prefix)
+	s := NewOCFBDecrypter(c.new(key), prefix, ocfbResync)
 
 	plaintext := cipher.StreamReader{S: s, R: se.Contents}
 
 	if se.IntegrityProtected {
 		// IntegrityProtected packets have an embedded hash that we need to check.
-		h := sha1.New()
-		h.Write(se.prefix)
+		h := algorithm.NewHash(crypto.SHA1)
+		h.Write(prefix)
 		return &seMDCReader{in: plaintext, h: h}, nil
 	}
 
@@ -248,7 +254,7 @@ func serializeSymmetricallyEncryptedMdc(ciphertext io.WriteCloser, c CipherFunct
 	}
 	plaintext := cipher.StreamWriter{S: s, W: ciphertext}
 
-	h := sha1.New()
+	h := algorithm.NewHash(crypto.SHA1)
 	h.Write(iv)
 	h.Write(iv[blockSize-2:])
 	Contents = &seMDCWriter{w: plaintext, h: h}
@@ -294,3 +294,50 @@ func testSerializeAead(t *testing.T, cipherSuite CipherSuite) {
 		t.Errorf("contents not equal got: %x want: %x", contentsCopy.Bytes(), contents)
 	}
 }
+
+func TestAeadChunkSizes(t *testing.T) {
+	key := make([]byte, CipherAES128.KeySize())
+	_, _ = rand.Read(key)
+	contents := make([]byte, 1000)
+	_, _ = rand.Read(contents)
+	cipherSuite := CipherSuite{Cipher: CipherAES128, Mode: AEADModeOCB}
+
+	for chunkSizeByte := byte(0); chunkSizeByte <= maxAEADChunkSizeByte; chunkSizeByte++ {
+		config := &Config{AEADConfig: &AEADConfig{ChunkSize: 1 << (chunkSizeByte + 6)}}
+		buf := bytes.NewBuffer(nil)
+		w, err := SerializeSymmetricallyEncrypted(buf, CipherFunction(0), true, cipherSuite, key, config)
+		if err != nil {
+			t.Fatalf("chunk size byte %d: error from SerializeSymmetricallyEncrypted: %s", chunkSizeByte, err)
+		}
+		w.Write(contents)
+		w.Close()
+
+		p, err := Read(buf)
+		if err != nil {
+			t.Fatalf("chunk size byte %d: error from Read: %s", chunkSizeByte, err)
+		}
+		se := p.(*SymmetricallyEncrypted)
+		if se.ChunkSizeByte != chunkSizeByte {
+			t.Errorf("found wrong chunk size byte, want: %d, got: %d", chunkSizeByte, se.ChunkSizeByte)
+		}
+		r, err := se.Decrypt(CipherFunction(0), key)
+		if err != nil {
+			t.Fatalf("chunk size byte %d: error from Decrypt: %s", chunkSizeByte, err)
+		}
+		decrypted, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("chunk size byte %d: error reading contents: %s", chunkSizeByte, err)
+		}
+		if !bytes.Equal(decrypted, contents) {
+			t.Errorf("chunk size byte %d: contents not equal", chunkSizeByte)
+		}
+	}
+
+	for _, chunkSize := range []uint64{MinAEADChunkSize - 1, MaxAEADChunkSize + 1} {
+		config := &Config{AEADConfig: &AEADConfig{ChunkSize: chunkSize}}
+		_, err := SerializeSymmetricallyEncrypted(bytes.NewBuffer(nil), CipherFunction(0), true, cipherSuite, key, config)
+		if _, ok := err.(errors.InvalidArgumentError); !ok {
+			t.Errorf("chunk size %d: expected InvalidArgumentError, got: %v", chunkSize, err)
+		}
+	}
+}
@@ -10,6 +10,8 @@ import (
 	"image/jpeg"
 	"io"
 	"io/ioutil"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
 )
 
 const UserAttrImageSubpacket = 1
@@ -56,6 +58,35 @@ func NewUserAttributePhoto(photos ...image.Image) (uat *UserAttribute, err error
 	return
 }
 
+// NewUserAttributeJPEG creates a user attribute packet containing the given
+// JPEG images. Unlike NewUserAttributePhoto, the images are stored as given,
+// without being decoded and re-encoded.
+func NewUserAttributeJPEG(jpegs ...[]byte) (*UserAttribute, error) {
+	uat := new(UserAttribute)
+	for _, data := range jpegs {
+		// A JPEG file starts with the SOI marker.
+		if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+			return nil, errors.InvalidArgumentError("user attribute image is not a JPEG file")
+		}
+		// RFC 4880, Section 5.12.1.
+		contents := make([]byte, 16, 16+len(data))
+		contents[0] = 0x10 // Little-endian image header length (16 bytes)
+		contents[2] = 0x01 // Image header version 1
+		contents[3] = 0x01 // JPEG
+		contents = append(contents, data...)
+
+		lengthBuf := make([]byte, 5)
+		n := serializeSubpacketLength(lengthBuf, len(contents)+1)
+
+		uat.Contents = append(uat.Contents, &OpaqueSubpacket{
+			SubType:       UserAttrImageSubpacket,
+			EncodedLength: lengthBuf[:n],
+			Contents:      contents,
+		})
+	}
+	return uat, nil
+}
+
 // NewUserAttribute creates a new user attribute packet containing the given subpackets.
 func NewUserAttribute(contents ...*OpaqueSubpacket) *UserAttribute {
 	return &UserAttribute{Contents: contents}
@@ -74,20 +105,29 @@ func (uat *UserAttribute) parse(r io.Reader) (err error) {
 // Serialize marshals the user attribute to w in the form of an OpenPGP packet, including
 // header.
 func (uat *UserAttribute) Serialize(w io.Writer) (err error) {
-	var buf bytes.Buffer
-	for _, sp := range uat.Contents {
-		err = sp.Serialize(&buf)
-		if err != nil {
-			return err
-		}
+	body, err := uat.body()
+	if err != nil {
+		return err
 	}
-	if err = serializeHeader(w, packetTypeUserAttribute, buf.Len()); err != nil {
+	if err = serializeHeader(w, packetTypeUserAttribute, len(body)); err != nil {
 		return err
 	}
-	_, err = w.Write(buf.Bytes())
+	_, err = w.Write(body)
 	return
 }
 
+// body returns the serialized subpackets of the user attribute, without the
+// packet header.
+func (uat *UserAttribute) body() ([]byte, error) {
+	var buf bytes.Buffer
+	for _, sp := range uat.Contents {
+		if err := sp.Serialize(&buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
 // ImageData returns zero or more byte slices, each containing
 // JPEG File Interchange Format (JFIF), for each photo in the
 // user attribute packet.
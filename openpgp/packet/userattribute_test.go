@@ -46,6 +46,36 @@ func TestParseUserAttribute(t *testing.T) {
 	}
 }
 
+func TestNewUserAttributeJPEG(t *testing.T) {
+	r := base64.NewDecoder(base64.StdEncoding, bytes.NewBufferString(userAttributePacket))
+	p, err := Read(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := p.(*UserAttribute).ImageData()[0]
+
+	uat, err := NewUserAttributeJPEG(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = uat.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	p, err = Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgs := p.(*UserAttribute).ImageData()
+	if len(imgs) != 1 || !bytes.Equal(imgs[0], img) {
+		t.Error("image data was not preserved")
+	}
+
+	if _, err = NewUserAttributeJPEG([]byte("not a jpeg")); err == nil {
+		t.Error("expected an error for non-JPEG data")
+	}
+}
+
 const userAttributePacket = `
 0cyWzJQBEAABAQAAAAAAAAAAAAAAAP/Y/+AAEEpGSUYAAQIAAAEAAQAA/9sAQwAFAwQEBAMFBAQE
 BQUFBgcMCAcHBwcPCgsJDBEPEhIRDxEQExYcFxMUGhUQERghGBocHR8fHxMXIiQiHiQcHh8e/9sA
@@ -44,23 +44,7 @@ func NewUserId(name, comment, email string) *UserId {
 
 	uid := new(UserId)
 	uid.Name, uid.Comment, uid.Email = name, comment, email
-	uid.Id = name
-	if len(comment) > 0 {
-		if len(uid.Id) > 0 {
-			uid.Id += " "
-		}
-		uid.Id += "("
-		uid.Id += comment
-		uid.Id += ")"
-	}
-	if len(email) > 0 {
-		if len(uid.Id) > 0 {
-			uid.Id += " "
-		}
-		uid.Id += "<"
-		uid.Id += email
-		uid.Id += ">"
-	}
+	uid.Id = formatUserId(name, comment, email)
 	return uid
 }
 
@@ -72,9 +56,29 @@ func (uid *UserId) parse(r io.Reader) (err error) {
 	}
 	uid.Id = string(b)
 	uid.Name, uid.Comment, uid.Email = parseUserId(uid.Id)
+	if strings.ContainsAny(uid.Id, "\"\\") {
+		uid.parseQuoted()
+	}
 	return
 }
 
+// parseQuoted splits uid.Id again if it has a quoted name or an escaped
+// comment, as FormatUserId writes them with UserIdValidationLenient and
+// UserIdValidationStrict. User IDs that FormatUserId would not have written
+// this way keep the fields found by parseUserId.
+func (uid *UserId) parseQuoted() {
+	name, comment, email, err := parseMailbox(uid.Id, false)
+	if err != nil {
+		return
+	}
+	for _, validation := range []UserIdValidation{UserIdValidationLenient, UserIdValidationStrict} {
+		if id, err := FormatUserId(name, comment, email, validation); err == nil && id == uid.Id {
+			uid.Name, uid.Comment, uid.Email = name, comment, email
+			return
+		}
+	}
+}
+
 // Serialize marshals uid to w in the form of an OpenPGP packet, including
 // header.
 func (uid *UserId) Serialize(w io.Writer) error {
@@ -5,6 +5,7 @@
 package packet
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -86,3 +87,108 @@ func TestNewUserIdWithInvalidInput(t *testing.T) {
 		}
 	}
 }
+
+var formatUserIdTests = []struct {
+	name, comment, email string
+	validation           UserIdValidation
+	id                   string
+}{
+	{"John Smith", "", "john@example.com", UserIdValidationDefault, "John Smith <john@example.com>"},
+	{"Smith, John", "", "john@example.com", UserIdValidationLenient, `"Smith, John" <john@example.com>`},
+	{"John (Johnny) Smith", "work", "john@example.com", UserIdValidationLenient, `"John (Johnny) Smith" (work) <john@example.com>`},
+	{`John "J" Smith`, "a (b)", "", UserIdValidationLenient, `"John \"J\" Smith" (a \(b\))`},
+	{"René Descartes", "", "rené@exemple.fr", UserIdValidationStrict, "René Descartes <rené@exemple.fr>"},
+	{"John Q. Public", "", `"john q"@example.com`, UserIdValidationStrict, `"John Q. Public" <"john q"@example.com>`},
+	{"a<b", "", "x@y.z", UserIdValidationLenient, `"a<b" <x@y.z>`},
+	{"Smith, John", "Johnny (J)", "", UserIdValidationLenient, `"Smith, John" (Johnny \(J\))`},
+}
+
+var invalidFormatUserIdTests = []struct {
+	name, comment, email string
+	validation           UserIdValidation
+}{
+	{"Smith, John (", "", "", UserIdValidationDefault},
+	{"John\nSmith", "", "", UserIdValidationLenient},
+	{"John", "", "john <smith>", UserIdValidationLenient},
+	{"John", "", "", UserIdValidationStrict},
+	{"John", "", "john@", UserIdValidationStrict},
+	{"John", "", "john..smith@example.com", UserIdValidationStrict},
+}
+
+func TestFormatUserId(t *testing.T) {
+	for i, test := range formatUserIdTests {
+		uid, err := NewUserIdWithValidation(test.name, test.comment, test.email, test.validation)
+		if err != nil {
+			t.Errorf("#%d: %s", i, err)
+			continue
+		}
+		if uid.Id != test.id {
+			t.Errorf("#%d: got '%s', want '%s'", i, uid.Id, test.id)
+		}
+		name, comment, email, err := ParseUserId(uid.Id, test.validation)
+		if err != nil {
+			t.Errorf("#%d: error parsing '%s': %s", i, uid.Id, err)
+		} else if name != test.name || comment != test.comment || email != test.email {
+			t.Errorf("#%d: parsed '%s' as %q, %q, %q", i, uid.Id, name, comment, email)
+		}
+
+		// The fields are also recovered when reading the packet back.
+		var buf bytes.Buffer
+		if err = uid.Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		p, err := Read(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if read := p.(*UserId); *read != *uid {
+			t.Errorf("#%d: read back %#v, want %#v", i, read, uid)
+		}
+	}
+	for i, test := range invalidFormatUserIdTests {
+		if _, err := FormatUserId(test.name, test.comment, test.email, test.validation); err == nil {
+			t.Errorf("#%d: expected an error", i)
+		}
+	}
+}
+
+var parseUserIdTests = []struct {
+	id                   string
+	validation           UserIdValidation
+	name, comment, email string
+}{
+	{`"Smith, John" <john@example.com>`, UserIdValidationDefault, `"Smith, John"`, "", "john@example.com"},
+	{`"Smith, John" (work (main)) <john@example.com> (ext)`, UserIdValidationStrict, "Smith, John", "work (main) ext", "john@example.com"},
+	{"john@example.com (John)", UserIdValidationStrict, "", "John", "john@example.com"},
+	{`"John <Smith>" <john@example.com>`, UserIdValidationStrict, "John <Smith>", "", "john@example.com"},
+	{"John, Smith <john@example.com> trailing", UserIdValidationLenient, "John, Smith", "", "john@example.com"},
+	{"(unterminated", UserIdValidationLenient, "", "unterminated", ""},
+}
+
+var invalidParseUserIdTests = []string{
+	"John Smith",
+	"John, Smith <john@example.com>",
+	"John <john@example.com> trailing",
+	"John (comment <john@example.com>",
+	"John <john@example.com",
+	"John@Smith <john@example.com>",
+	"John\x00 <john@example.com>",
+}
+
+func TestParseUserIdValidation(t *testing.T) {
+	for i, test := range parseUserIdTests {
+		name, comment, email, err := ParseUserId(test.id, test.validation)
+		if err != nil {
+			t.Errorf("#%d: %s", i, err)
+			continue
+		}
+		if name != test.name || comment != test.comment || email != test.email {
+			t.Errorf("#%d: got %q, %q, %q, want %q, %q, %q", i, name, comment, email, test.name, test.comment, test.email)
+		}
+	}
+	for i, id := range invalidParseUserIdTests {
+		if _, _, _, err := ParseUserId(id, UserIdValidationStrict); err == nil {
+			t.Errorf("#%d: expected an error parsing '%s'", i, id)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package packet
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+)
+
+// UserIdValidation selects the conventions that user IDs must follow when
+// they are formatted or parsed.
+type UserIdValidation uint8
+
+const (
+	// UserIdValidationDefault rejects names, comments and emails containing
+	// '(', ')', '<', '>' or '\x00', like GnuPG, as NewUserId does, and
+	// splits user IDs at parentheses and angle brackets without unquoting
+	// or unescaping anything.
+	UserIdValidationDefault UserIdValidation = iota
+	// UserIdValidationLenient accepts any name and comment without control
+	// characters, quoting the name and escaping the comment as RFC 2822
+	// does if needed. Emails must not contain whitespace, control
+	// characters, '<' or '>'. Malformed user IDs are parsed on a best
+	// effort basis.
+	UserIdValidationLenient
+	// UserIdValidationStrict requires user IDs to be RFC 2822 mailboxes,
+	// with an email address, and UTF-8 allowed in them as RFC 6532 does.
+	UserIdValidationStrict
+)
+
+// NewUserIdWithValidation returns a UserId made of the given name, comment
+// and email, which must follow the conventions selected by validation.
+func NewUserIdWithValidation(name, comment, email string, validation UserIdValidation) (*UserId, error) {
+	id, err := FormatUserId(name, comment, email, validation)
+	if err != nil {
+		return nil, err
+	}
+	return &UserId{Id: id, Name: name, Comment: comment, Email: email}, nil
+}
+
+// FormatUserId returns the user ID made of the given name, comment and
+// email, which must follow the conventions selected by validation, in the
+// form "Full Name (Comment) <email@example.com>". Any of them can be empty,
+// except for the email with UserIdValidationStrict.
+func FormatUserId(name, comment, email string, validation UserIdValidation) (string, error) {
+	switch validation {
+	case UserIdValidationDefault:
+		if hasInvalidCharacters(name) || hasInvalidCharacters(comment) || hasInvalidCharacters(email) {
+			return "", errors.InvalidArgumentError("user id field contained invalid characters")
+		}
+		return formatUserId(name, comment, email), nil
+	case UserIdValidationLenient, UserIdValidationStrict:
+	default:
+		return "", errors.InvalidArgumentError("unknown user id validation")
+	}
+	if hasControlCharacters(name) || hasControlCharacters(comment) || hasControlCharacters(email) {
+		return "", errors.InvalidArgumentError("user id field contained control characters")
+	}
+	if validation == UserIdValidationStrict {
+		if !isAddrSpec(email) {
+			return "", errors.InvalidArgumentError("invalid email address in user id")
+		}
+	} else if strings.ContainsAny(email, " \t<>") {
+		return "", errors.InvalidArgumentError("invalid email address in user id")
+	}
+	if name != "" && !isPhrase(name) {
+		name = quoteString(name)
+	}
+	if comment != "" {
+		comment = escapeComment(comment)
+	}
+	return formatUserId(name, comment, email), nil
+}
+
+// ParseUserId extracts the name, comment and email from a user id string
+// that is formatted as "Full Name (Comment) <email@example.com>", following
+// the conventions selected by validation. With UserIdValidationLenient and
+// UserIdValidationStrict, quoted names are unquoted and escaped comments
+// unescaped; multiple comments are joined by spaces.
+func ParseUserId(id string, validation UserIdValidation) (name, comment, email string, err error) {
+	switch validation {
+	case UserIdValidationDefault:
+		name, comment, email = parseUserId(id)
+		return
+	case UserIdValidationLenient, UserIdValidationStrict:
+		return parseMailbox(id, validation == UserIdValidationStrict)
+	}
+	return "", "", "", errors.InvalidArgumentError("unknown user id validation")
+}
+
+// formatUserId joins the name, comment and email of a user id, which are
+// already quoted and escaped as needed.
+func formatUserId(name, comment, email string) string {
+	id := name
+	if len(comment) > 0 {
+		if len(id) > 0 {
+			id += " "
+		}
+		id += "(" + comment + ")"
+	}
+	if len(email) > 0 {
+		if len(id) > 0 {
+			id += " "
+		}
+		id += "<" + email + ">"
+	}
+	return id
+}
+
+// parseMailbox parses an RFC 2822 mailbox: a name made of words and quoted
+// strings followed by an address in angle brackets, or an address alone,
+// with comments anywhere. If strict is false, syntax errors are tolerated.
+func parseMailbox(id string, strict bool) (name, comment, email string, err error) {
+	if !utf8.ValidString(id) || hasControlCharacters(id) {
+		return "", "", "", errors.StructuralError("user id contains invalid characters")
+	}
+	var words, comments []string
+	var hasAddr, nameHasAt bool
+	for i := 0; i < len(id); {
+		switch c := id[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			text, n, ok := readComment(id[i:])
+			if !ok && strict {
+				return "", "", "", errors.StructuralError("unterminated comment in user id")
+			}
+			if text = strings.TrimSpace(text); text != "" {
+				comments = append(comments, text)
+			}
+			i += n
+		case hasAddr:
+			if strict {
+				return "", "", "", errors.StructuralError("unexpected text after the email address of the user id")
+			}
+			// Text after the address is ignored.
+			i = len(id)
+		case c == '"':
+			text, n, ok := readQuoted(id[i:])
+			if !ok && strict {
+				return "", "", "", errors.StructuralError("unterminated quoted string in user id")
+			}
+			words = append(words, text)
+			i += n
+		case c == '<':
+			j := indexUnquoted(id[i+1:], '>')
+			if j < 0 {
+				if strict {
+					return "", "", "", errors.StructuralError("unterminated email address in user id")
+				}
+				j = len(id) - i - 1
+			}
+			email = strings.TrimSpace(id[i+1 : i+1+j])
+			hasAddr = true
+			i += j + 2
+		default:
+			j := i
+			for j < len(id) && isWordChar(id[j], strict) {
+				j++
+			}
+			if j == i {
+				return "", "", "", errors.StructuralError("unexpected character in user id: " + string(c))
+			}
+			word := id[i:j]
+			if strings.IndexByte(word, '@') >= 0 {
+				nameHasAt = true
+			}
+			words = append(words, word)
+			i = j
+		}
+	}
+	comment = strings.Join(comments, " ")
+	if !hasAddr {
+		// RFC 2822 3.4: alternate simple form of a mailbox
+		if len(words) == 1 && nameHasAt {
+			email = words[0]
+			words = nil
+			nameHasAt = false
+		} else if strict {
+			return "", "", "", errors.StructuralError("user id has no email address")
+		}
+	}
+	if strict && (nameHasAt || !isAddrSpec(email)) {
+		return "", "", "", errors.StructuralError("invalid email address in user id")
+	}
+	name = strings.Join(words, " ")
+	return
+}
+
+// readComment reads a comment, which can be nested, at the start of s. It
+// returns the unescaped text of the comment, the number of bytes read and
+// whether the comment is terminated.
+func readComment(s string) (text string, n int, ok bool) {
+	var b strings.Builder
+	depth := 0
+	for n = 0; n < len(s); n++ {
+		switch c := s[n]; c {
+		case '\\':
+			if n+1 < len(s) {
+				n++
+				b.WriteByte(s[n])
+			}
+		case '(':
+			if depth > 0 {
+				b.WriteByte(c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b.String(), n + 1, true
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), n, false
+}
+
+// readQuoted reads a quoted string at the start of s. It returns the
+// unescaped string, the number of bytes read and whether the string is
+// terminated.
+func readQuoted(s string) (text string, n int, ok bool) {
+	var b strings.Builder
+	for n = 1; n < len(s); n++ {
+		switch c := s[n]; c {
+		case '\\':
+			if n+1 < len(s) {
+				n++
+				b.WriteByte(s[n])
+			}
+		case '"':
+			return b.String(), n + 1, true
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), n, false
+}
+
+// indexUnquoted returns the index of the first c in s outside of quoted
+// strings, or -1.
+func indexUnquoted(s string, c byte) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case c:
+			if !quoted {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// isAtext returns whether c can appear in an RFC 2822 atom. Non-ASCII
+// bytes, from UTF-8 characters, are allowed by RFC 6532.
+func isAtext(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c >= 0x80:
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-/=?^_`{|}~", c) >= 0
+}
+
+// isWordChar returns whether c can appear in an unquoted word of a user id.
+// Strictly, words are atoms, possibly separated by dots as in obsolete
+// phrases, or an address alone.
+func isWordChar(c byte, strict bool) bool {
+	switch c {
+	case ' ', '\t', '(', '"', '<':
+		return false
+	}
+	return !strict || isAtext(c) || c == '.' || c == '@'
+}
+
+// isPhrase returns whether s can be written unquoted as the name of a user
+// id: words of atoms separated by single spaces.
+func isPhrase(s string) bool {
+	for _, word := range strings.Split(s, " ") {
+		if word == "" {
+			return false
+		}
+		for i := 0; i < len(word); i++ {
+			if !isAtext(word[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isDotAtom returns whether s is an RFC 2822 dot-atom.
+func isDotAtom(s string) bool {
+	for _, atom := range strings.Split(s, ".") {
+		if atom == "" {
+			return false
+		}
+		for i := 0; i < len(atom); i++ {
+			if !isAtext(atom[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isAddrSpec returns whether s is an RFC 2822 addr-spec, with a dot-atom or
+// quoted local part and a dot-atom or literal domain.
+func isAddrSpec(s string) bool {
+	at := strings.LastIndexByte(s, '@')
+	if at < 0 {
+		return false
+	}
+	local, domain := s[:at], s[at+1:]
+	if !isDotAtom(local) {
+		if len(local) < 2 || local[0] != '"' {
+			return false
+		}
+		if _, n, ok := readQuoted(local); !ok || n != len(local) {
+			return false
+		}
+	}
+	if strings.HasPrefix(domain, "[") && strings.HasSuffix(domain, "]") {
+		return !strings.ContainsAny(domain[1:len(domain)-1], "[]\\ ")
+	}
+	return isDotAtom(domain)
+}
+
+func quoteString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func escapeComment(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`).Replace(s)
+}
+
+func hasControlCharacters(s string) bool {
+	for _, c := range s {
+		if (c < 0x20 && c != '\t') || c == 0x7f {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package packet
+
+import (
+	"strconv"
+	"sync"
+)
+
+// WarningKind identifies the kind of anomaly reported by a Warning.
+type WarningKind uint8
+
+const (
+	// WarningUnknownPacket is reported when a packet of an unknown type is
+	// skipped.
+	WarningUnknownPacket WarningKind = iota + 1
+	// WarningUnsupportedPacket is reported when a packet that uses an
+	// unsupported feature (version, algorithm, ...) is skipped.
+	WarningUnsupportedPacket
+	// WarningUnknownSubpacket is reported when an unknown, non-critical
+	// signature subpacket is ignored.
+	WarningUnknownSubpacket
+	// WarningSessionKeyDecryption is reported when an encrypted session key
+	// could not be decrypted with an available private key, and another
+	// key or passphrase was tried instead.
+	WarningSessionKeyDecryption
+	// WarningUnknownCriticalSubpacket is reported when an unknown, critical
+	// signature subpacket is ignored, as allowed by the
+	// ReportUnknownCriticalSubpackets policy.
+	WarningUnknownCriticalSubpacket
+	// WarningNoEncryptionKey is reported when a subkey is removed from an
+	// entity that is left without a valid encryption key.
+	WarningNoEncryptionKey
+)
+
+func (kind WarningKind) String() string {
+	switch kind {
+	case WarningUnknownPacket:
+		return "unknown packet"
+	case WarningUnsupportedPacket:
+		return "unsupported packet"
+	case WarningUnknownSubpacket:
+		return "unknown subpacket"
+	case WarningSessionKeyDecryption:
+		return "session key decryption"
+	case WarningUnknownCriticalSubpacket:
+		return "unknown critical subpacket"
+	case WarningNoEncryptionKey:
+		return "no encryption key"
+	}
+	return "warning " + strconv.Itoa(int(kind))
+}
+
+// Warning describes a non-fatal anomaly encountered while parsing, verifying
+// or decrypting OpenPGP data, or while editing keys. Warnings never cause an
+// operation to fail.
+type Warning struct {
+	Kind WarningKind
+	// Err is the error that was ignored, if any.
+	Err error
+	// PacketType is the tag of the packet the warning relates to, if known.
+	PacketType uint8
+	// SubpacketType is the type of the signature subpacket the warning
+	// relates to, for WarningUnknownSubpacket and
+	// WarningUnknownCriticalSubpacket.
+	SubpacketType uint8
+	// KeyId is the ID of the key the warning relates to, if any.
+	KeyId uint64
+}
+
+func (w Warning) String() string {
+	s := "openpgp: warning: " + w.Kind.String()
+	if w.PacketType != 0 {
+		s += " (packet type " + strconv.Itoa(int(w.PacketType)) + ")"
+	}
+	if w.SubpacketType != 0 {
+		s += " (subpacket type " + strconv.Itoa(int(w.SubpacketType)) + ")"
+	}
+	if w.KeyId != 0 {
+		s += " (key " + strconv.FormatUint(w.KeyId, 16) + ")"
+	}
+	if w.Err != nil {
+		s += ": " + w.Err.Error()
+	}
+	return s
+}
+
+// WarningSink receives the warnings reported during an operation. Warn may be
+// called concurrently if the sink is shared between operations.
+type WarningSink interface {
+	Warn(w Warning)
+}
+
+// WarningCollector is a WarningSink that stores all the warnings it receives.
+// The zero value is ready to use.
+type WarningCollector struct {
+	mu       sync.Mutex
+	warnings []Warning
+}
+
+// Warn records w.
+func (c *WarningCollector) Warn(w Warning) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warnings = append(c.warnings, w)
+}
+
+// Warnings returns a copy of the warnings recorded so far.
+func (c *WarningCollector) Warnings() []Warning {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Warning(nil), c.warnings...)
+}
+
+// Reset discards the warnings recorded so far.
+func (c *WarningCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.warnings = nil
+}
@@ -0,0 +1,92 @@
+package openpgp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+)
+
+// A PKARecord is a legacy Public Key Association record, published in a DNS
+// TXT record to associate an email address with the fingerprint of an OpenPGP
+// key and, optionally, the URI the key can be fetched from. Its text form is
+// "v=pka1;fpr=<hex fingerprint>;uri=<URI>".
+type PKARecord struct {
+	Fingerprint []byte
+	URI         string
+}
+
+// PKADomainName returns the DNS name holding the PKA record of the given
+// email address, that is "<local part>._pka.<domain>.".
+func PKADomainName(email string) (string, error) {
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 || at == len(email)-1 {
+		return "", errors.InvalidArgumentError("invalid email address: " + email)
+	}
+	return email[:at] + "._pka." + strings.TrimSuffix(email[at+1:], ".") + ".", nil
+}
+
+// ParsePKARecord parses the text of a PKA DNS TXT record. Unknown fields are
+// ignored.
+func ParsePKARecord(txt string) (*PKARecord, error) {
+	fields := strings.Split(strings.TrimSpace(txt), ";")
+	if fields[0] != "v=pka1" {
+		return nil, errors.StructuralError("PKA record without v=pka1 version")
+	}
+	r := new(PKARecord)
+	for _, field := range fields[1:] {
+		eq := strings.IndexByte(field, '=')
+		if eq < 0 {
+			if field == "" {
+				continue
+			}
+			return nil, errors.StructuralError("malformed PKA record field: " + field)
+		}
+		switch key, value := field[:eq], field[eq+1:]; key {
+		case "fpr":
+			fingerprint, err := hex.DecodeString(value)
+			if err != nil || (len(fingerprint) != 20 && len(fingerprint) != 32) {
+				return nil, errors.StructuralError("invalid PKA record fingerprint: " + value)
+			}
+			r.Fingerprint = fingerprint
+		case "uri":
+			r.URI = value
+		}
+	}
+	if r.Fingerprint == nil {
+		return nil, errors.StructuralError("PKA record without fingerprint")
+	}
+	return r, nil
+}
+
+// NewPKARecord returns the PKA record of the primary key of e, with the given
+// URI, which may be empty.
+func NewPKARecord(e *Entity, uri string) *PKARecord {
+	return &PKARecord{Fingerprint: e.PrimaryKey.Fingerprint, URI: uri}
+}
+
+// String returns the text of the DNS TXT record of r.
+func (r *PKARecord) String() string {
+	txt := "v=pka1;fpr=" + strings.ToUpper(hex.EncodeToString(r.Fingerprint))
+	if r.URI != "" {
+		txt += ";uri=" + r.URI
+	}
+	return txt
+}
+
+// Verify checks that the certificate e, typically fetched from r.URI, is the
+// one r associates with the given email address: the fingerprint of its
+// primary key must match the record, and one of its identities must claim
+// the address.
+func (r *PKARecord) Verify(e *Entity, email string) error {
+	if !bytes.Equal(e.PrimaryKey.Fingerprint, r.Fingerprint) {
+		return errors.InvalidArgumentError("certificate fingerprint does not match PKA record")
+	}
+	for _, ident := range e.Identities {
+		if ident.UserId != nil && strings.EqualFold(ident.UserId.Email, email) {
+			return nil
+		}
+	}
+	return errors.InvalidArgumentError("certificate has no identity for " + email)
+}
@@ -0,0 +1,74 @@
+package openpgp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestPKADomainName(t *testing.T) {
+	name, err := PKADomainName("joe.doe@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "joe.doe._pka.example.org." {
+		t.Errorf("got %s", name)
+	}
+	for _, email := range []string{"example.org", "@example.org", "joe@"} {
+		if _, err := PKADomainName(email); err == nil {
+			t.Errorf("%s: expected an error", email)
+		}
+	}
+}
+
+func TestParsePKARecord(t *testing.T) {
+	r, err := ParsePKARecord("v=pka1;fpr=0B7F08B73A5A4D1C3C8E6E0A7A2B4A91F6C9CE8E;uri=https://example.org/key.asc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Fingerprint) != 20 || r.Fingerprint[0] != 0x0b || r.URI != "https://example.org/key.asc" {
+		t.Errorf("unexpected record: %+v", r)
+	}
+
+	for _, txt := range []string{
+		"",
+		"fpr=0B7F08B73A5A4D1C3C8E6E0A7A2B4A91F6C9CE8E",
+		"v=pka2;fpr=0B7F08B73A5A4D1C3C8E6E0A7A2B4A91F6C9CE8E",
+		"v=pka1;uri=https://example.org/key.asc",
+		"v=pka1;fpr=0B7F08",
+		"v=pka1;fpr=0B7F08B73A5A4D1C3C8E6E0A7A2B4A91F6C9CE8E;uri",
+	} {
+		if _, err := ParsePKARecord(txt); err == nil {
+			t.Errorf("%q: expected an error", txt)
+		}
+	}
+}
+
+func TestPKARecordRoundTrip(t *testing.T) {
+	e, err := NewEntity("Golang Gopher", "", "Gopher@Golang.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewEntity("Golang Gopher", "", "gopher@golang.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := ParsePKARecord(NewPKARecord(e, "https://golang.com/key.asc").String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(r.Fingerprint, e.PrimaryKey.Fingerprint) || r.URI != "https://golang.com/key.asc" {
+		t.Errorf("unexpected record: %+v", r)
+	}
+	if err = r.Verify(e, "gopher@golang.com"); err != nil {
+		t.Error(err)
+	}
+	if err = r.Verify(e, "someone@golang.com"); err == nil {
+		t.Error("expected an error for an unclaimed address")
+	}
+	if err = r.Verify(other, "gopher@golang.com"); err == nil {
+		t.Error("expected an error for a fingerprint mismatch")
+	}
+}
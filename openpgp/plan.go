@@ -0,0 +1,300 @@
+package openpgp
+
+import (
+	"crypto"
+	"io"
+	"io/ioutil"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/algorithm"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Packet tags of the packets of a MessagePlan, see RFC 4880, section 4.3.
+const (
+	TagEncryptedKey                             = 1
+	TagSignature                                = 2
+	TagOnePassSignature                         = 4
+	TagCompressed                               = 8
+	TagLiteralData                              = 11
+	TagSymmetricallyEncryptedIntegrityProtected = 18
+	TagPadding                                  = 21
+)
+
+// A PlannedPacket is a packet of a MessagePlan.
+type PlannedPacket struct {
+	// Tag is the packet tag, one of the Tag* constants.
+	Tag uint8
+	// Version is the version of the packet, or zero for packets without
+	// version.
+	Version int
+	// Depth is the nesting level of the packet: zero for the packets at the
+	// top of the message, one for the packets in the encrypted data, and so
+	// on.
+	Depth int
+	// Key is the recipient key of encrypted session key packets, and the
+	// signing key of signature packets.
+	Key *packet.PublicKey
+}
+
+// A MessagePlan describes the message that Encrypt or Sign would produce,
+// without producing it. See PlanEncrypt and PlanSign.
+type MessagePlan struct {
+	// Packets are the packets of the message, in order.
+	Packets []PlannedPacket
+	// Negotiation holds the algorithms negotiated with the recipients of an
+	// encrypted message. It is nil for signed messages.
+	Negotiation *AlgorithmNegotiation
+	// RecipientKeys are the keys the session key is encrypted to, one for
+	// each recipient.
+	RecipientKeys []Key
+	// SigningKey is the key that signs the message, or nil if it is not
+	// signed, and Hash the hash function of its signature.
+	SigningKey *Key
+	Hash       crypto.Hash
+	// EstimatedSize is an upper bound of the size of the binary message for
+	// a plaintext of the size hinted at by the FileHints, or of an empty
+	// plaintext. Compressed messages are assumed to be incompressible, and
+	// randomized padding to have its maximum length.
+	EstimatedSize int64
+}
+
+// PlanEncrypt returns the plan of the message that Encrypt would produce for
+// the given arguments, without producing ciphertext. The recipient and
+// signing keys are selected, and the algorithms negotiated, as by Encrypt,
+// and the same errors are returned. It consumes randomness from config to
+// compute the exact size of the encrypted session keys, but never uses the
+// signing key: the size of the signature is derived from its algorithm and
+// key size. Like Encrypt, it plans messages without passphrases; the
+// symmetric-key encrypted session key packets that EncryptWithPassphrases
+// adds are left out of the plan and of its EstimatedSize.
+// If config is nil, sensible defaults will be used.
+func PlanEncrypt(to []*Entity, signed *Entity, hints *FileHints, config *packet.Config) (*MessagePlan, error) {
+	if len(to) == 0 {
+		return nil, errors.InvalidArgumentError("no encryption recipient provided")
+	}
+	negotiation, err := NegotiateAlgorithms(to, config)
+	if err != nil {
+		return nil, err
+	}
+	plan := &MessagePlan{Negotiation: negotiation}
+
+	cipher := negotiation.Cipher
+	sessionKey := make([]byte, cipher.KeySize())
+	// Like Encrypt, the session key is encrypted once to each key, even if
+	// several recipients share it.
+	planned := make(map[string]bool, len(to))
+	for _, recipient := range to {
+		key, _ := recipient.EncryptionKey(config.Now())
+		plan.RecipientKeys = append(plan.RecipientKeys, key)
+		fingerprint := string(key.PublicKey.Fingerprint)
+		if planned[fingerprint] {
+			continue
+		}
+		planned[fingerprint] = true
+		size, err := countBytes(func(w io.Writer) error {
+			return packet.SerializeEncryptedKey(w, key.PublicKey, cipher, sessionKey, config)
+		})
+		if err != nil {
+			return nil, err
+		}
+		plan.add(TagEncryptedKey, 3, 0, key.PublicKey, size)
+	}
+
+	version := 1
+	if negotiation.AEAD {
+		version = 2
+	}
+	plan.add(TagSymmetricallyEncryptedIntegrityProtected, version, 0, nil, 0)
+	depth := 1
+	if negotiation.Compression != packet.CompressionNone {
+		plan.add(TagCompressed, 0, depth, nil, 0)
+		depth++
+	}
+	innerSize, err := plan.addSignedLiteral(depth, negotiation.candidateHashes, signed, hints, config)
+	if err != nil {
+		return nil, err
+	}
+	if negotiation.Compression != packet.CompressionNone {
+		innerSize = partialPacketSize(1 + compressedSize(negotiation.Compression, innerSize))
+	}
+	if config != nil && config.MaxPaddingLength != 0 {
+		plan.add(TagPadding, 0, 1, nil, 0)
+		innerSize += packetSize(int64(config.MaxPaddingLength))
+	}
+
+	var encryptedSize int64
+	if negotiation.AEAD {
+		aeadConfig := chunkSizeConfig(config, hints).AEAD()
+		chunkSize := int64(1) << (aeadConfig.ChunkSizeByte() + 6)
+		chunks := (innerSize + chunkSize - 1) / chunkSize
+		tagLength := int64(negotiation.CipherSuite.Mode.TagLength())
+		encryptedSize = 4 + 32 + innerSize + (chunks+1)*tagLength
+	} else {
+		blockSize := int64(algorithm.CipherFunction(cipher).BlockSize())
+		encryptedSize = 1 + blockSize + 2 + innerSize + 22
+	}
+	plan.EstimatedSize += partialPacketSize(encryptedSize)
+	return plan, nil
+}
+
+// EstimateEncryptedSize returns an upper bound of the size of the unsigned
+// binary message produced by Encrypt for a binary plaintext of plaintextLen
+// octets, without file name, encrypted to the given recipients. It accounts
+// for the encrypted session key packets of the recipient keys, the
+// encryption and AEAD chunk overhead, compression, assuming the plaintext is
+// incompressible, and padding, assuming its maximum length. The size of the
+// armored message is armor.EncodedLen of the result.
+// If config is nil, sensible defaults will be used.
+func EstimateEncryptedSize(plaintextLen int64, to []*Entity, config *packet.Config) (int64, error) {
+	if plaintextLen < 0 {
+		return 0, errors.InvalidArgumentError("negative plaintext length")
+	}
+	plan, err := PlanEncrypt(to, nil, &FileHints{IsBinary: true, Size: uint64(plaintextLen)}, config)
+	if err != nil {
+		return 0, err
+	}
+	return plan.EstimatedSize, nil
+}
+
+// PlanSign returns the plan of the message that Sign would produce for the
+// given arguments, without signing the message. The signing key and hash
+// function are selected as by Sign, and the same errors are returned, but
+// the signing key is never used.
+// If config is nil, sensible defaults will be used.
+func PlanSign(signed *Entity, hints *FileHints, config *packet.Config) (*MessagePlan, error) {
+	if signed == nil {
+		return nil, errors.InvalidArgumentError("no signer provided")
+	}
+	candidateHashes, err := signingCandidateHashes(signed, config)
+	if err != nil {
+		return nil, err
+	}
+	plan := new(MessagePlan)
+	size, err := plan.addSignedLiteral(0, candidateHashes, signed, hints, config)
+	if err != nil {
+		return nil, err
+	}
+	plan.EstimatedSize += size
+	return plan, nil
+}
+
+// addSignedLiteral adds to p the packets of the literal data, signed by
+// signed if it is not nil, at the given depth. It returns their size.
+func (p *MessagePlan) addSignedLiteral(depth int, candidateHashes []uint8, signed *Entity, hints *FileHints, config *packet.Config) (int64, error) {
+	var signer *packet.PrivateKey
+	if signed != nil {
+		var err error
+		if signer, err = messageSigner(signed, config); err != nil {
+			return 0, err
+		}
+	}
+	hash, err := selectSignatureHash(candidateHashes, signer, config)
+	if err != nil {
+		return 0, err
+	}
+	if hints == nil {
+		hints = &FileHints{}
+	}
+
+	fileName := hints.FileName
+	if len(fileName) > 255 {
+		fileName = fileName[:255]
+	}
+	literalSize := partialPacketSize(int64(1 + 1 + len(fileName) + 4 + int(hints.Size)))
+	if signer == nil {
+		p.Packets = append(p.Packets, PlannedPacket{Tag: TagLiteralData, Depth: depth})
+		return literalSize, nil
+	}
+
+	signingKey, _ := signed.SigningKeyById(config.Now(), config.SigningKey())
+	p.SigningKey = &signingKey
+	p.Hash = hash
+	ops := &packet.OnePassSignature{
+		SigType:    packet.SigTypeBinary,
+		Hash:       hash,
+		PubKeyAlgo: signer.PubKeyAlgo,
+		KeyId:      signer.KeyId,
+		IsLast:     true,
+	}
+	opsSize, err := countBytes(ops.Serialize)
+	if err != nil {
+		return 0, err
+	}
+	// The size of the signature is computed from the signing key, which is
+	// not used to sign anything.
+	sig := createSignaturePacket(&signer.PublicKey, packet.SigTypeBinary, config)
+	sig.Hash = hash
+	h, _, err := hashForSignature(hash, packet.SigTypeBinary)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = sig.PrepareSign(h, &signer.PublicKey); err != nil {
+		return 0, err
+	}
+	sigSize, err := sig.MaxSerializedLength(&signer.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	p.Packets = append(p.Packets,
+		PlannedPacket{Tag: TagOnePassSignature, Version: 3, Depth: depth, Key: &signer.PublicKey},
+		PlannedPacket{Tag: TagLiteralData, Depth: depth},
+		PlannedPacket{Tag: TagSignature, Version: sig.Version, Depth: depth, Key: &signer.PublicKey},
+	)
+	return opsSize + literalSize + int64(sigSize), nil
+}
+
+// add appends a packet of the given size to p.
+func (p *MessagePlan) add(tag uint8, version, depth int, key *packet.PublicKey, size int64) {
+	p.Packets = append(p.Packets, PlannedPacket{Tag: tag, Version: version, Depth: depth, Key: key})
+	p.EstimatedSize += size
+}
+
+// packetSize returns the size of a packet with a body of the given length.
+func packetSize(length int64) int64 {
+	switch {
+	case length < 192:
+		return 2 + length
+	case length < 8384:
+		return 3 + length
+	default:
+		return 6 + length
+	}
+}
+
+// partialPacketSize returns an upper bound of the size of a packet with a
+// body of the given length written with partial lengths, whose chunks are
+// at least 512 octets long, except for the last one.
+func partialPacketSize(length int64) int64 {
+	return 1 + length + length/512 + 5
+}
+
+// compressedSize returns an upper bound of the size of incompressible data
+// of the given length compressed with algo.
+func compressedSize(algo packet.CompressionAlgo, length int64) int64 {
+	// Stored deflate blocks have a five octet header and hold at most
+	// 65535 octets.
+	size := length + 5*(length/65535+1)
+	if algo == packet.CompressionZLIB {
+		size += 2 + 4
+	}
+	return size
+}
+
+// countBytes returns the number of octets written by serialize.
+func countBytes(serialize func(io.Writer) error) (int64, error) {
+	w := &countingWriter{w: ioutil.Discard}
+	err := serialize(w)
+	return w.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
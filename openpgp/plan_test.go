@@ -0,0 +1,255 @@
+package openpgp
+
+import (
+	"bytes"
+	"crypto"
+	goecdsa "crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestPlanEncrypt(t *testing.T) {
+	for _, aead := range []bool{false, true} {
+		config := &packet.Config{
+			Algorithm:              packet.PubKeyAlgoEdDSA,
+			DefaultCompressionAlgo: packet.CompressionZLIB,
+			MaxPaddingLength:       100,
+		}
+		if aead {
+			config.AEADConfig = &packet.AEADConfig{}
+		}
+		recipient, err := NewEntity("Golang Gopher", "Recipient", "recipient@golang.com", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := NewEntity("Golang Gopher", "Signer", "signer@golang.com", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		message := bytes.Repeat([]byte{0x42}, 100000)
+		hints := &FileHints{IsBinary: true, FileName: "message.bin", Size: uint64(len(message))}
+		plan, err := PlanEncrypt([]*Entity{recipient}, signer, hints, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		version := 1
+		if aead {
+			version = 2
+		}
+		want := []PlannedPacket{
+			{Tag: TagEncryptedKey, Version: 3, Depth: 0},
+			{Tag: TagSymmetricallyEncryptedIntegrityProtected, Version: version, Depth: 0},
+			{Tag: TagCompressed, Depth: 1},
+			{Tag: TagOnePassSignature, Version: 3, Depth: 2},
+			{Tag: TagLiteralData, Depth: 2},
+			{Tag: TagSignature, Version: 4, Depth: 2},
+			{Tag: TagPadding, Depth: 1},
+		}
+		if len(plan.Packets) != len(want) {
+			t.Fatalf("got %d packets, want %d", len(plan.Packets), len(want))
+		}
+		for i, p := range plan.Packets {
+			if p.Tag != want[i].Tag || p.Version != want[i].Version || p.Depth != want[i].Depth {
+				t.Errorf("packet %d: got %+v, want %+v", i, p, want[i])
+			}
+		}
+		encryptionKey, _ := recipient.EncryptionKey(config.Now())
+		if plan.Packets[0].Key.KeyId != encryptionKey.PublicKey.KeyId || plan.RecipientKeys[0].PublicKey.KeyId != encryptionKey.PublicKey.KeyId {
+			t.Error("unexpected recipient key")
+		}
+		if plan.SigningKey == nil || plan.SigningKey.PublicKey.KeyId != signer.PrimaryKey.KeyId || plan.Hash == 0 {
+			t.Error("unexpected signing key")
+		}
+		if plan.Negotiation.AEAD != aead {
+			t.Errorf("got AEAD %v, want %v", plan.Negotiation.AEAD, aead)
+		}
+
+		// Without compression, the estimate is close to the actual size.
+		config.DefaultCompressionAlgo = packet.CompressionNone
+		plan, err = PlanEncrypt([]*Entity{recipient}, signer, hints, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		w, err := Encrypt(buf, []*Entity{recipient}, signer, hints, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write(message); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if size := int64(buf.Len()); plan.EstimatedSize < size || plan.EstimatedSize > size+size/100+128 {
+			t.Errorf("estimated size %d, actual size %d", plan.EstimatedSize, size)
+		}
+
+		// A repeated recipient gets a single encrypted session key.
+		repeated, err := PlanEncrypt([]*Entity{recipient, recipient}, signer, hints, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(repeated.Packets) != len(plan.Packets) || repeated.EstimatedSize != plan.EstimatedSize {
+			t.Errorf("repeated recipient: got %d packets and size %d, want %d and %d", len(repeated.Packets), repeated.EstimatedSize, len(plan.Packets), plan.EstimatedSize)
+		}
+		if len(repeated.RecipientKeys) != 2 {
+			t.Errorf("got %d recipient keys, want 2", len(repeated.RecipientKeys))
+		}
+	}
+}
+
+func TestPlanSign(t *testing.T) {
+	signer, err := NewEntity("Golang Gopher", "Signer", "signer@golang.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hints := &FileHints{IsBinary: true, Size: 1000}
+	plan, err := PlanSign(signer, hints, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Packets) != 3 || plan.Packets[0].Tag != TagOnePassSignature || plan.Packets[1].Tag != TagLiteralData || plan.Packets[2].Tag != TagSignature {
+		t.Errorf("unexpected packets: %+v", plan.Packets)
+	}
+	if plan.Negotiation != nil || len(plan.RecipientKeys) != 0 {
+		t.Error("unexpected encryption in a signed message")
+	}
+
+	buf := new(bytes.Buffer)
+	w, err := Sign(buf, signer, hints, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(make([]byte, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if size := int64(buf.Len()); plan.EstimatedSize < size || plan.EstimatedSize > size+32 {
+		t.Errorf("estimated size %d, actual size %d", plan.EstimatedSize, size)
+	}
+
+	if _, err = PlanSign(nil, nil, nil); err == nil {
+		t.Error("expected an error without signer")
+	}
+}
+
+// countingSigner counts the signatures it makes.
+type countingSigner struct {
+	crypto.Signer
+	count int
+}
+
+func (s *countingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.count++
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func TestPlanSignWithoutSigning(t *testing.T) {
+	ecdsaKey, err := goecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	external := &countingSigner{Signer: ecdsaKey}
+	externalEntity, err := NewEntityWithOptions(nil,
+		WithUserId("Golang Gopher", "", "no-reply@golang.com"),
+		WithPrimarySigner(external),
+		WithoutEncryptionSubkey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	external.count = 0
+	if _, err = PlanSign(externalEntity, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if external.count != 0 {
+		t.Errorf("the external signer was called %d times", external.count)
+	}
+
+	// The estimated size of the signature is an upper bound for every
+	// algorithm.
+	signers := []*Entity{externalEntity}
+	for _, config := range []*packet.Config{
+		{Algorithm: packet.PubKeyAlgoRSA, RSABits: 2048},
+		{Algorithm: packet.PubKeyAlgoECDSA, Curve: packet.CurveNistP384},
+		{Algorithm: packet.PubKeyAlgoEdDSA},
+		{Algorithm: packet.PubKeyAlgoEdDSA, Curve: packet.Curve448},
+	} {
+		signer, err := NewEntity("Golang Gopher", "Signer", "signer@golang.com", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, signer)
+	}
+	for i, signer := range signers {
+		plan, err := PlanSign(signer, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		w, err := Sign(buf, signer, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if size := int64(buf.Len()); plan.EstimatedSize < size || plan.EstimatedSize > size+32 {
+			t.Errorf("#%d: estimated size %d, actual size %d", i, plan.EstimatedSize, size)
+		}
+	}
+}
+
+func TestEstimateEncryptedSize(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, AEADConfig: &packet.AEADConfig{}}
+	recipient, err := NewEntity("Golang Gopher", "Recipient", "recipient@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{0, 100, 1 << 20} {
+		estimate, err := EstimateEncryptedSize(int64(n), []*Entity{recipient}, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		buf := new(bytes.Buffer)
+		a, err := armor.Encode(buf, "PGP MESSAGE", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		binary := &countingWriter{w: a}
+		w, err := Encrypt(binary, []*Entity{recipient}, nil, &FileHints{IsBinary: true, Size: uint64(n)}, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = w.Write(make([]byte, n)); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err = a.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if estimate < binary.n || estimate > binary.n+binary.n/100+64 {
+			t.Errorf("estimated size %d for %d octets, actual size %d", estimate, n, binary.n)
+		}
+		armored := armor.EncodedLen(estimate, "PGP MESSAGE", nil)
+		if armored < int64(buf.Len()) || armored > int64(buf.Len())+int64(buf.Len())/100+96 {
+			t.Errorf("estimated armored size %d for %d octets, actual size %d", armored, n, buf.Len())
+		}
+	}
+	if _, err = EstimateEncryptedSize(-1, []*Entity{recipient}, config); err == nil {
+		t.Error("expected an error for a negative length")
+	}
+}
@@ -0,0 +1,62 @@
+package openpgp
+
+import (
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Preferences are the algorithm preferences and features that an Entity
+// advertises in its self-signatures. Empty lists mean that no preference is
+// stated, in which case only the algorithms that every implementation must
+// support should be used.
+type Preferences struct {
+	// Hashes, Ciphers and Compression are the preferred hash, symmetric
+	// cipher and compression algorithm IDs, most preferred first.
+	Hashes      []uint8
+	Ciphers     []uint8
+	Compression []uint8
+	// CipherSuites are the preferred pairs of symmetric cipher and AEAD mode
+	// IDs for SEIPDv2 messages, most preferred first.
+	CipherSuites [][2]uint8
+	// SEIPDv1 and SEIPDv2 are the supported encrypted data packet versions.
+	SEIPDv1, SEIPDv2 bool
+}
+
+// Preferences returns the preferences of e that are effective at time now.
+// Following the crypto refresh of OpenPGP, each preference is taken from the
+// self-signature of the primary identity if it states it, and otherwise from
+// the direct-key self-signature. Self-signatures of revoked identities, and
+// self-signatures that are expired at time now, are ignored.
+func (e *Entity) Preferences(now time.Time) *Preferences {
+	var sigs []*packet.Signature
+	if i := e.PrimaryIdentity(); i != nil && i.SelfSignature != nil &&
+		!i.Revoked(now) && !i.SelfSignature.SigExpired(now) {
+		sigs = append(sigs, i.SelfSignature)
+	}
+	if e.SelfSignature != nil && !e.SelfSignature.SigExpired(now) {
+		sigs = append(sigs, e.SelfSignature)
+	}
+
+	p := new(Preferences)
+	var haveFeatures bool
+	for _, sig := range sigs {
+		if len(p.Hashes) == 0 {
+			p.Hashes = sig.PreferredHash
+		}
+		if len(p.Ciphers) == 0 {
+			p.Ciphers = sig.PreferredSymmetric
+		}
+		if len(p.Compression) == 0 {
+			p.Compression = sig.PreferredCompression
+		}
+		if len(p.CipherSuites) == 0 {
+			p.CipherSuites = sig.PreferredCipherSuites
+		}
+		if !haveFeatures && (sig.SEIPDv1 || sig.SEIPDv2) {
+			p.SEIPDv1, p.SEIPDv2 = sig.SEIPDv1, sig.SEIPDv2
+			haveFeatures = true
+		}
+	}
+	return p
+}
@@ -0,0 +1,167 @@
+package openpgp
+
+import (
+	"bytes"
+	"crypto"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestPreferences(t *testing.T) {
+	config := &packet.Config{
+		Algorithm:              packet.PubKeyAlgoEdDSA,
+		DefaultCipher:          packet.CipherAES256,
+		DefaultCompressionAlgo: packet.CompressionZLIB,
+		AEADConfig:             &packet.AEADConfig{DefaultMode: packet.AEADModeGCM},
+	}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	selfSig := entity.PrimaryIdentity().SelfSignature
+	prefs := entity.Preferences(now)
+	want := &Preferences{
+		Hashes:       selfSig.PreferredHash,
+		Ciphers:      selfSig.PreferredSymmetric,
+		Compression:  selfSig.PreferredCompression,
+		CipherSuites: selfSig.PreferredCipherSuites,
+		SEIPDv1:      true,
+		SEIPDv2:      true,
+	}
+	if !reflect.DeepEqual(prefs, want) {
+		t.Errorf("got %+v, want %+v", prefs, want)
+	}
+
+	// Preferences missing from the primary identity are taken from the
+	// direct-key self-signature.
+	entity.SelfSignature = &packet.Signature{
+		CreationTime:       now,
+		PreferredSymmetric: []uint8{uint8(packet.CipherAES128)},
+		PreferredHash:      []uint8{hashToHashId(crypto.SHA512)},
+	}
+	selfSig.PreferredSymmetric = nil
+	prefs = entity.Preferences(now)
+	if !reflect.DeepEqual(prefs.Ciphers, []uint8{uint8(packet.CipherAES128)}) {
+		t.Errorf("expected the ciphers of the direct-key signature, got %v", prefs.Ciphers)
+	}
+	if !reflect.DeepEqual(prefs.Hashes, selfSig.PreferredHash) {
+		t.Errorf("expected the hashes of the primary identity, got %v", prefs.Hashes)
+	}
+
+	// The self-signature of a revoked identity is ignored.
+	entity.PrimaryIdentity().Revocations = []*packet.Signature{{CreationTime: now}}
+	prefs = entity.Preferences(now)
+	if !reflect.DeepEqual(prefs.Hashes, []uint8{hashToHashId(crypto.SHA512)}) || len(prefs.Compression) != 0 || prefs.SEIPDv2 {
+		t.Errorf("unexpected preferences of a revoked identity: %+v", prefs)
+	}
+}
+
+func TestDirectKeySignaturePreferences(t *testing.T) {
+	config := &packet.Config{
+		Algorithm:     packet.PubKeyAlgoEdDSA,
+		DefaultCipher: packet.CipherAES256,
+		AEADConfig:    &packet.AEADConfig{DefaultMode: packet.AEADModeOCB},
+	}
+	entity, err := NewEntityWithOptions(config, WithUserId("Golang Gopher", "", "no-reply@golang.com"), WithDirectKeySignature())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entity.SelfSignature == nil || entity.SelfSignature.SigType != packet.SigTypeDirectSignature {
+		t.Fatal("expected a direct-key self-signature")
+	}
+	uidSig := entity.PrimaryIdentity().SelfSignature
+	if len(uidSig.PreferredSymmetric) != 0 || len(uidSig.PreferredCipherSuites) != 0 || uidSig.SEIPDv2 {
+		t.Error("expected no preferences on the user ID self-signature")
+	}
+	if !uidSig.FlagsValid || !uidSig.FlagSign || !uidSig.FlagCertify {
+		t.Error("expected key flags on the user ID self-signature")
+	}
+
+	// The preferences are read back from the direct-key self-signature.
+	var buf bytes.Buffer
+	if err = entity.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEntity(packet.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefs := read.Preferences(time.Now())
+	if len(prefs.Ciphers) == 0 || prefs.Ciphers[0] != uint8(packet.CipherAES256) {
+		t.Errorf("unexpected ciphers %v", prefs.Ciphers)
+	}
+	if len(prefs.CipherSuites) == 0 || prefs.CipherSuites[0] != [2]uint8{uint8(packet.CipherAES256), uint8(packet.AEADModeOCB)} {
+		t.Errorf("unexpected cipher suites %v", prefs.CipherSuites)
+	}
+	if !prefs.SEIPDv1 || !prefs.SEIPDv2 {
+		t.Errorf("unexpected features %+v", prefs)
+	}
+}
+
+func TestAddUserIdWithDirectKeySignature(t *testing.T) {
+	config := &packet.Config{
+		Algorithm:  packet.PubKeyAlgoEdDSA,
+		AEADConfig: &packet.AEADConfig{},
+	}
+	entity, err := NewEntityWithOptions(config, WithUserId("Golang Gopher", "", "no-reply@golang.com"), WithDirectKeySignature())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = entity.SerializePrivate(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEntity(packet.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.SelfSignature == nil {
+		t.Fatal("expected a direct-key self-signature")
+	}
+
+	// User IDs added later to a parsed key carry their own preferences.
+	if err = read.AddUserId("Golang Gopher", "", "added@golang.com", config); err != nil {
+		t.Fatal(err)
+	}
+	uidSig := read.Identities["Golang Gopher <added@golang.com>"].SelfSignature
+	if len(uidSig.PreferredSymmetric) == 0 || len(uidSig.PreferredHash) == 0 || len(uidSig.PreferredCompression) == 0 {
+		t.Errorf("expected preferences on the user ID self-signature: %+v", uidSig)
+	}
+	if !uidSig.SEIPDv1 || !uidSig.SEIPDv2 {
+		t.Error("expected features on the user ID self-signature")
+	}
+}
+
+func TestConfiguredPreferences(t *testing.T) {
+	config := &packet.Config{
+		Algorithm:                 packet.PubKeyAlgoEdDSA,
+		PreferredHashes:           []crypto.Hash{crypto.SHA512, crypto.SHA384},
+		PreferredSymmetric:        []packet.CipherFunction{packet.CipherAES256},
+		PreferredAEADCiphersuites: []packet.CipherSuite{{Cipher: packet.CipherAES256, Mode: packet.AEADModeGCM}},
+		PreferredCompression:      []packet.CompressionAlgo{packet.CompressionZLIB, packet.CompressionNone},
+	}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Preferences{
+		Hashes:       []uint8{hashToHashId(crypto.SHA512), hashToHashId(crypto.SHA384)},
+		Ciphers:      []uint8{uint8(packet.CipherAES256)},
+		Compression:  []uint8{uint8(packet.CompressionZLIB), uint8(packet.CompressionNone)},
+		CipherSuites: [][2]uint8{{uint8(packet.CipherAES256), uint8(packet.AEADModeGCM)}},
+		SEIPDv1:      true,
+		SEIPDv2:      true,
+	}
+	if prefs := entity.Preferences(time.Now()); !reflect.DeepEqual(prefs, want) {
+		t.Errorf("got %+v, want %+v", prefs, want)
+	}
+
+	config.PreferredSymmetric = []packet.CipherFunction{packet.CipherAES256, packet.CipherAES256}
+	if _, err = NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config); err == nil {
+		t.Error("expected an error for duplicate preferences")
+	}
+}
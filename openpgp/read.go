@@ -6,11 +6,14 @@
 package openpgp // import "github.com/ProtonMail/go-crypto/openpgp"
 
 import (
+	"bytes"
+	"context"
 	"crypto"
 	_ "crypto/sha256"
 	_ "crypto/sha512"
 	"hash"
 	"io"
+	"io/ioutil"
 	"strconv"
 
 	"github.com/ProtonMail/go-crypto/openpgp/armor"
@@ -40,15 +43,17 @@ func readArmored(r io.Reader, expectedType string) (body io.Reader, err error) {
 // MessageDetails contains the result of parsing an OpenPGP encrypted and/or
 // signed message.
 type MessageDetails struct {
-	IsEncrypted              bool                // true if the message was encrypted.
-	EncryptedToKeyIds        []uint64            // the list of recipient key ids.
-	IsSymmetricallyEncrypted bool                // true if a passphrase could have decrypted the message.
-	DecryptedWith            Key                 // the private key used to decrypt the message, if any.
-	IsSigned                 bool                // true if the message is signed.
-	SignedByKeyId            uint64              // the key id of the signer, if any.
-	SignedBy                 *Key                // the key of the signer, if available.
-	LiteralData              *packet.LiteralData // the metadata of the contents
-	UnverifiedBody           io.Reader           // the contents of the message.
+	IsEncrypted              bool                   // true if the message was encrypted.
+	EncryptedToKeyIds        []uint64               // the list of recipient key ids.
+	IsSymmetricallyEncrypted bool                   // true if a passphrase could have decrypted the message.
+	DecryptedWith            Key                    // the private key used to decrypt the message, if any.
+	IsSigned                 bool                   // true if the message is signed.
+	SignedByKeyId            uint64                 // the key id of the signer, if any.
+	SignedBy                 *Key                   // the key of the signer, if available.
+	IsCompressed             bool                   // true if the contents were compressed.
+	CompressionAlgo          packet.CompressionAlgo // the compression algorithm of the contents, if compressed.
+	LiteralData              *packet.LiteralData    // the metadata of the contents, available before UnverifiedBody is read.
+	UnverifiedBody           io.Reader              // the contents of the message.
 
 	// If IsSigned is true and SignedBy is non-zero then the signature will
 	// be verified as UnverifiedBody is read. The signature cannot be
@@ -63,7 +68,16 @@ type MessageDetails struct {
 	SignatureError       error               // nil if the signature is good.
 	UnverifiedSignatures []*packet.Signature // all other unverified signature packets.
 
+	// UnknownPackets holds the packets of unknown types found before the
+	// literal data, if config.PreserveUnknownPackets is set.
+	UnknownPackets []*packet.OpaquePacket
+
 	decrypted io.ReadCloser
+	// integrityProtected is true if the message is encrypted with an MDC or
+	// AEAD, and chunkAuthenticated if each of its chunks is authenticated,
+	// for SalvageMessage.
+	integrityProtected bool
+	chunkAuthenticated bool
 }
 
 // A PromptFunction is used as a callback by functions that may need to decrypt
@@ -80,6 +94,7 @@ type PromptFunction func(keys []Key, symmetric bool) ([]byte, error)
 type keyEnvelopePair struct {
 	key          Key
 	encryptedKey *packet.EncryptedKey
+	failed       bool // decrypting encryptedKey with key was tried and failed
 }
 
 // ReadMessage parses an OpenPGP message that may be signed and/or encrypted.
@@ -87,14 +102,20 @@ type keyEnvelopePair struct {
 // verification) and, possibly encrypted, private keys for decrypting.
 // If config is nil, sensible defaults will be used.
 func ReadMessage(r io.Reader, keyring KeyRing, prompt PromptFunction, config *packet.Config) (md *MessageDetails, err error) {
+	return DecryptMessage(context.Background(), r, DecryptOptions{KeyRing: keyring, Prompt: prompt, Config: config})
+}
+
+// readMessage parses an OpenPGP message, as by ReadMessage.
+func readMessage(r io.Reader, keyring KeyRing, prompt PromptFunction, config *packet.Config) (md *MessageDetails, err error) {
 	var p packet.Packet
 
 	var symKeys []*packet.SymmetricKeyEncrypted
+	var encryptedKeys []*packet.EncryptedKey
 	var pubKeys []keyEnvelopePair
 	// Integrity protected encrypted packet: SymmetricallyEncrypted or AEADEncrypted
 	var edp packet.EncryptedDataPacket
 
-	packets := packet.NewReader(r)
+	packets := packet.NewReaderWithConfig(r, config)
 	md = new(MessageDetails)
 	md.IsEncrypted = true
 
@@ -116,6 +137,7 @@ ParsePackets:
 		case *packet.EncryptedKey:
 			// This packet contains the decryption key encrypted to a public key.
 			md.EncryptedToKeyIds = append(md.EncryptedToKeyIds, p.KeyId)
+			encryptedKeys = append(encryptedKeys, p)
 			switch p.Algo {
 			case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSAEncryptOnly, packet.PubKeyAlgoElGamal, packet.PubKeyAlgoECDH:
 				break
@@ -130,18 +152,24 @@ ParsePackets:
 					keys = keyring.KeysById(p.KeyId)
 				}
 				for _, k := range keys {
-					pubKeys = append(pubKeys, keyEnvelopePair{k, p})
+					pubKeys = append(pubKeys, keyEnvelopePair{key: k, encryptedKey: p})
 				}
 			}
 		case *packet.SymmetricallyEncrypted:
 			if !p.IntegrityProtected && !config.AllowUnauthenticatedMessages() {
 				return nil, errors.UnsupportedError("message is not integrity protected")
 			}
+			md.integrityProtected = p.IntegrityProtected
+			md.chunkAuthenticated = p.Version == 2
 			edp = p
 			break ParsePackets
 		case *packet.AEADEncrypted:
+			md.integrityProtected = true
+			md.chunkAuthenticated = true
 			edp = p
 			break ParsePackets
+		case *packet.OpaquePacket:
+			md.UnknownPackets = append(md.UnknownPackets, p)
 		case *packet.Compressed, *packet.LiteralData, *packet.OnePassSignature:
 			// This message isn't encrypted.
 			if len(symKeys) != 0 || len(pubKeys) != 0 {
@@ -155,23 +183,53 @@ ParsePackets:
 	var candidates []Key
 	var decrypted io.ReadCloser
 
+	if config != nil && config.SessionKeyHook != nil {
+		cipherFunc, key, err := config.SessionKeyHook(encryptedKeys, symKeys)
+		if err != nil {
+			return nil, err
+		}
+		if key != nil {
+			decrypted, err = edp.Decrypt(cipherFunc, key)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// Now that we have the list of encrypted keys we need to decrypt at
 	// least one of them or, if we cannot, we need to call the prompt
 	// function so that it can decrypt a key or give us a passphrase.
 FindKey:
-	for {
+	for decrypted == nil {
 		// See if any of the keys already have a private key available
 		candidates = candidates[:0]
 		candidateFingerprints := make(map[string]bool)
 
+		if workers := config.DecryptionConcurrency(); workers > 1 {
+			var key Key
+			decrypted, key, err = decryptConcurrently(pubKeys, edp, workers, config)
+			if err != nil {
+				return nil, err
+			}
+			if decrypted != nil {
+				md.DecryptedWith = key
+				break FindKey
+			}
+		}
+
 		for _, pk := range pubKeys {
-			if pk.key.PrivateKey == nil {
+			if pk.key.PrivateKey == nil || pk.failed {
 				continue
 			}
 			if !pk.key.PrivateKey.Encrypted {
 				if len(pk.encryptedKey.Key) == 0 {
 					errDec := pk.encryptedKey.Decrypt(pk.key.PrivateKey, config)
 					if errDec != nil {
+						config.Warn(packet.Warning{
+							Kind:  packet.WarningSessionKeyDecryption,
+							Err:   errDec,
+							KeyId: pk.key.PublicKey.KeyId,
+						})
 						continue
 					}
 				}
@@ -209,18 +267,22 @@ FindKey:
 
 		// Try the symmetric passphrase first
 		if len(symKeys) != 0 && passphrase != nil {
+			var sessionKeys []sessionKey
 			for _, s := range symKeys {
 				key, cipherFunc, err := s.Decrypt(passphrase)
 				// In v4, on wrong passphrase, session key decryption is very likely to result in an invalid cipherFunc:
 				// only for < 5% of cases we will proceed to decrypt the data
 				if err == nil {
-					decrypted, err = edp.Decrypt(cipherFunc, key)
-					if err != nil {
-						return nil, err
-					}
-					if decrypted != nil {
-						break FindKey
-					}
+					sessionKeys = append(sessionKeys, sessionKey{cipherFunc, key})
+				}
+			}
+			if len(sessionKeys) != 0 {
+				decrypted, err = decryptWithSessionKeys(edp, sessionKeys)
+				if err != nil {
+					return nil, err
+				}
+				if decrypted != nil {
+					break FindKey
 				}
 			}
 		}
@@ -237,6 +299,126 @@ FindKey:
 	return mdFinal, nil
 }
 
+// sessionKey is a session key decrypted from a symmetric-key encrypted
+// session key packet.
+type sessionKey struct {
+	cipherFunc packet.CipherFunction
+	key        []byte
+}
+
+// decryptWithSessionKeys decrypts edp with the first of the given session keys
+// that works. A wrong passphrase can decrypt a v4 symmetric-key encrypted
+// session key packet to a plausible session key, which, for SEIPDv1 data, is
+// only detected by the MDC at the end of the data. If several session keys are
+// plausible, the data is therefore read into memory and decrypted with each of
+// them until the MDC matches.
+func decryptWithSessionKeys(edp packet.EncryptedDataPacket, sessionKeys []sessionKey) (io.ReadCloser, error) {
+	se, ok := edp.(*packet.SymmetricallyEncrypted)
+	if len(sessionKeys) == 1 || !ok || !se.IntegrityProtected || se.Version != 1 {
+		return edp.Decrypt(sessionKeys[0].cipherFunc, sessionKeys[0].key)
+	}
+
+	// The first call to Decrypt reads the prefix of the data, which the
+	// packet keeps for later calls, so the rest of the data is read after it.
+	if _, err := se.Decrypt(sessionKeys[0].cipherFunc, sessionKeys[0].key); err != nil {
+		return nil, err
+	}
+	contents, err := ioutil.ReadAll(se.Contents)
+	if err != nil {
+		return nil, err
+	}
+	for _, sk := range sessionKeys {
+		se.Contents = bytes.NewReader(contents)
+		var decrypted io.ReadCloser
+		decrypted, err = se.Decrypt(sk.cipherFunc, sk.key)
+		if err != nil {
+			continue
+		}
+		var plaintext []byte
+		plaintext, err = ioutil.ReadAll(decrypted)
+		if err == nil {
+			err = decrypted.Close()
+		}
+		if err == nil {
+			return ioutil.NopCloser(bytes.NewReader(plaintext)), nil
+		}
+	}
+	return nil, err
+}
+
+// decryptConcurrently decrypts the session keys encrypted to the unlocked
+// private keys of pubKeys, using up to workers goroutines, and returns the
+// encrypted data decrypted with the first session key that works. The pairs
+// that could not be used are marked as failed. It returns a nil ReadCloser if
+// none of the pairs could be used.
+func decryptConcurrently(pubKeys []keyEnvelopePair, edp packet.EncryptedDataPacket, workers int, config *packet.Config) (io.ReadCloser, Key, error) {
+	type job struct {
+		index        int
+		encryptedKey packet.EncryptedKey
+		err          error
+	}
+	// Each job decrypts its own copy of the EncryptedKey, as the same packet
+	// may be paired with several private keys.
+	var jobs []*job
+	for i, pk := range pubKeys {
+		if pk.failed || pk.key.PrivateKey == nil || pk.key.PrivateKey.Encrypted || len(pk.encryptedKey.Key) != 0 {
+			continue
+		}
+		jobs = append(jobs, &job{index: i, encryptedKey: *pk.encryptedKey})
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	pending := make(chan *job)
+	results := make(chan *job, len(jobs))
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(pending)
+		for _, j := range jobs {
+			select {
+			case pending <- j:
+			case <-done:
+				return
+			}
+		}
+	}()
+	for w := 0; w < workers; w++ {
+		go func() {
+			for j := range pending {
+				j.err = j.encryptedKey.Decrypt(pubKeys[j.index].key.PrivateKey, config)
+				results <- j
+			}
+		}()
+	}
+
+	for range jobs {
+		j := <-results
+		pk := &pubKeys[j.index]
+		if j.err != nil {
+			config.Warn(packet.Warning{
+				Kind:  packet.WarningSessionKeyDecryption,
+				Err:   j.err,
+				KeyId: pk.key.PublicKey.KeyId,
+			})
+			pk.failed = true
+			continue
+		}
+		pk.encryptedKey.CipherFunc = j.encryptedKey.CipherFunc
+		pk.encryptedKey.Key = j.encryptedKey.Key
+		decrypted, err := edp.Decrypt(pk.encryptedKey.CipherFunc, pk.encryptedKey.Key)
+		if err != nil && err != errors.ErrKeyIncorrect {
+			return nil, Key{}, err
+		}
+		if decrypted != nil {
+			return decrypted, pk.key, nil
+		}
+		pk.failed = true
+	}
+	return nil, Key{}, nil
+}
+
 // readSignedMessage reads a possibly signed message if mdin is non-zero then
 // that structure is updated and returned. Otherwise a fresh MessageDetails is
 // used.
@@ -258,6 +440,8 @@ FindLiteralData:
 		}
 		switch p := p.(type) {
 		case *packet.Compressed:
+			md.IsCompressed = true
+			md.CompressionAlgo = p.Algo
 			if err := packets.Push(p.Body); err != nil {
 				return nil, err
 			}
@@ -273,6 +457,9 @@ FindLiteralData:
 			h, wrappedHash, err = hashForSignature(p.Hash, p.SigType)
 			if err != nil {
 				md.SignatureError = err
+			} else if p.Version == 6 {
+				// Version 6 signatures hash their salt first.
+				h.Write(p.Salt)
 			}
 
 			md.IsSigned = true
@@ -285,17 +472,25 @@ FindLiteralData:
 			}
 		case *packet.LiteralData:
 			md.LiteralData = p
+			if config != nil && config.LiteralDataHook != nil {
+				config.LiteralDataHook(p)
+			}
 			break FindLiteralData
+		case *packet.OpaquePacket:
+			md.UnknownPackets = append(md.UnknownPackets, p)
 		}
 	}
 
 	if md.IsSigned && md.SignatureError == nil {
 		md.UnverifiedBody = &signatureCheckReader{packets, h, wrappedHash, md, config}
 	} else if md.decrypted != nil {
-		md.UnverifiedBody = checkReader{md}
+		md.UnverifiedBody = checkReader{packets, md}
 	} else {
 		md.UnverifiedBody = md.LiteralData.Body
 	}
+	if config != nil && config.NormalizeLineEndings && md.LiteralData.IsText() {
+		md.UnverifiedBody = newLFTextReader(md.UnverifiedBody)
+	}
 
 	return md, nil
 }
@@ -312,7 +507,7 @@ func hashForSignature(hashFunc crypto.Hash, sigType packet.SignatureType) (hash.
 	if !hashFunc.Available() {
 		return nil, nil, errors.UnsupportedError("hash not available: " + strconv.Itoa(int(hashFunc)))
 	}
-	h := hashFunc.New()
+	h := algorithm.NewHash(hashFunc)
 
 	switch sigType {
 	case packet.SigTypeBinary:
@@ -325,15 +520,23 @@ func hashForSignature(hashFunc crypto.Hash, sigType packet.SignatureType) (hash.
 }
 
 // checkReader wraps an io.Reader from a LiteralData packet. When it sees EOF
-// it closes the ReadCloser from any SymmetricallyEncrypted packet to trigger
-// MDC checks.
+// it skips any trailing packet, such as padding, and closes the ReadCloser
+// from any SymmetricallyEncrypted packet to trigger MDC checks.
 type checkReader struct {
-	md *MessageDetails
+	packets *packet.Reader
+	md      *MessageDetails
 }
 
 func (cr checkReader) Read(buf []byte) (int, error) {
 	n, sensitiveParsingError := cr.md.LiteralData.Body.Read(buf)
 	if sensitiveParsingError == io.EOF {
+		var readError error
+		for readError == nil {
+			_, readError = cr.packets.Next()
+		}
+		if readError != io.EOF {
+			return n, readError
+		}
 		mdcErr := cr.md.decrypted.Close()
 		if mdcErr != nil {
 			return n, mdcErr
@@ -429,13 +632,17 @@ func (scr *signatureCheckReader) Read(buf []byte) (int, error) {
 // If the signer isn't known, ErrUnknownIssuer is returned.
 func VerifyDetachedSignature(keyring KeyRing, signed, signature io.Reader, config *packet.Config) (sig *packet.Signature, signer *Entity, err error) {
 	var expectedHashes []crypto.Hash
-	return verifyDetachedSignature(keyring, signed, signature, expectedHashes, config)
+	return VerifyDetachedSignatureAndHash(keyring, signed, signature, expectedHashes, config)
 }
 
 // VerifyDetachedSignatureAndHash performs the same actions as
 // VerifyDetachedSignature and checks that the expected hash functions were used.
 func VerifyDetachedSignatureAndHash(keyring KeyRing, signed, signature io.Reader, expectedHashes []crypto.Hash, config *packet.Config) (sig *packet.Signature, signer *Entity, err error) {
-	return verifyDetachedSignature(keyring, signed, signature, expectedHashes, config)
+	result, err := VerifyDetached(context.Background(), signed, signature, VerifyOptions{KeyRing: keyring, ExpectedHashes: expectedHashes, Config: config})
+	if result == nil {
+		return nil, nil, err
+	}
+	return result.Signature, result.Signer, err
 }
 
 // CheckDetachedSignature takes a signed file and a detached signature and
@@ -450,19 +657,36 @@ func CheckDetachedSignature(keyring KeyRing, signed, signature io.Reader, config
 // CheckDetachedSignatureAndHash performs the same actions as
 // CheckDetachedSignature and checks that the expected hash functions were used.
 func CheckDetachedSignatureAndHash(keyring KeyRing, signed, signature io.Reader, expectedHashes []crypto.Hash, config *packet.Config) (signer *Entity, err error) {
-	_, signer, err = verifyDetachedSignature(keyring, signed, signature, expectedHashes, config)
+	_, signer, err = VerifyDetachedSignatureAndHash(keyring, signed, signature, expectedHashes, config)
 	return
 }
 
 func verifyDetachedSignature(keyring KeyRing, signed, signature io.Reader, expectedHashes []crypto.Hash, config *packet.Config) (sig *packet.Signature, signer *Entity, err error) {
-	var issuerKeyId uint64
-	var hashFunc crypto.Hash
-	var sigType packet.SignatureType
-	var keys []Key
+	sig, keys, err := readDetachedSignature(keyring, signature, expectedHashes, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h, wrappedHash, err := hashForSignature(sig.Hash, sig.SigType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := io.Copy(wrappedHash, signed); err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	return verifyHashedSignature(keys, h, sig, config)
+}
+
+// readDetachedSignature returns the first signature packet read from
+// signature that was issued by a signing key of keyring, and the keys that
+// could have issued it.
+func readDetachedSignature(keyring KeyRing, signature io.Reader, expectedHashes []crypto.Hash, config *packet.Config) (sig *packet.Signature, keys []Key, err error) {
 	var p packet.Packet
 
 	expectedHashesLen := len(expectedHashes)
-	packets := packet.NewReader(signature)
+	packets := packet.NewReaderWithConfig(signature, config)
 	for {
 		p, err = packets.Next()
 		if err == io.EOF {
@@ -472,6 +696,10 @@ func verifyDetachedSignature(keyring KeyRing, signed, signature io.Reader, expec
 			return nil, nil, err
 		}
 
+		if _, ok := p.(*packet.OpaquePacket); ok {
+			continue
+		}
+
 		var ok bool
 		sig, ok = p.(*packet.Signature)
 		if !ok {
@@ -480,12 +708,9 @@ func verifyDetachedSignature(keyring KeyRing, signed, signature io.Reader, expec
 		if sig.IssuerKeyId == nil {
 			return nil, nil, errors.StructuralError("signature doesn't have an issuer")
 		}
-		issuerKeyId = *sig.IssuerKeyId
-		hashFunc = sig.Hash
-		sigType = sig.SigType
 
 		for i, expectedHash := range expectedHashes {
-			if hashFunc == expectedHash {
+			if sig.Hash == expectedHash {
 				break
 			}
 			if i+1 == expectedHashesLen {
@@ -493,25 +718,17 @@ func verifyDetachedSignature(keyring KeyRing, signed, signature io.Reader, expec
 			}
 		}
 
-		keys = keyring.KeysByIdUsage(issuerKeyId, packet.KeyFlagSign)
+		keys = keyring.KeysByIdUsage(*sig.IssuerKeyId, packet.KeyFlagSign)
 		if len(keys) > 0 {
-			break
+			return sig, keys, nil
 		}
 	}
+}
 
-	if len(keys) == 0 {
-		panic("unreachable")
-	}
-
-	h, wrappedHash, err := hashForSignature(hashFunc, sigType)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	if _, err := io.Copy(wrappedHash, signed); err != nil && err != io.EOF {
-		return nil, nil, err
-	}
-
+// verifyHashedSignature verifies sig, issued by one of keys, given the hash
+// h of the signed data.
+func verifyHashedSignature(keys []Key, h hash.Hash, sig *packet.Signature, config *packet.Config) (*packet.Signature, *Entity, error) {
+	var err error
 	for _, key := range keys {
 		err = key.PublicKey.VerifySignature(h, sig)
 		if err == nil {
@@ -525,12 +742,11 @@ func verifyDetachedSignature(keyring KeyRing, signed, signature io.Reader, expec
 // CheckArmoredDetachedSignature performs the same actions as
 // CheckDetachedSignature but expects the signature to be armored.
 func CheckArmoredDetachedSignature(keyring KeyRing, signed, signature io.Reader, config *packet.Config) (signer *Entity, err error) {
-	body, err := readArmored(signature, SignatureType)
-	if err != nil {
-		return
+	result, err := VerifyDetached(context.Background(), signed, signature, VerifyOptions{KeyRing: keyring, Armor: true, Config: config})
+	if result == nil {
+		return nil, err
 	}
-
-	return CheckDetachedSignature(keyring, signed, body, config)
+	return result.Signer, err
 }
 
 // checkSignatureDetails returns an error if:
@@ -557,9 +773,9 @@ func CheckArmoredDetachedSignature(keyring KeyRing, signed, signature io.Reader,
 // - (For V5 keys only:) The direct-key signature (exists and) is expired
 func checkSignatureDetails(key *Key, signature *packet.Signature, config *packet.Config) error {
 	now := config.Now()
-	primaryIdentity := key.Entity.PrimaryIdentity()
+	primarySelfSignature, primaryIdentity := key.Entity.primarySelfSignature()
 	signedBySubKey := key.PublicKey != key.Entity.PrimaryKey
-	sigsToCheck := []*packet.Signature{signature, primaryIdentity.SelfSignature}
+	sigsToCheck := []*packet.Signature{signature, primarySelfSignature}
 	if signedBySubKey {
 		sigsToCheck = append(sigsToCheck, key.SelfSignature, key.SelfSignature.EmbeddedSignature)
 	}
@@ -572,10 +788,10 @@ func checkSignatureDetails(key *Key, signature *packet.Signature, config *packet
 	}
 	if key.Entity.Revoked(now) || // primary key is revoked
 		(signedBySubKey && key.Revoked(now)) || // subkey is revoked
-		primaryIdentity.Revoked(now) { // primary identity is revoked
+		(primaryIdentity != nil && primaryIdentity.Revoked(now)) { // primary identity is revoked
 		return errors.ErrKeyRevoked
 	}
-	if key.Entity.PrimaryKey.KeyExpired(primaryIdentity.SelfSignature, now) { // primary key is expired
+	if key.Entity.PrimaryKey.KeyExpired(primarySelfSignature, now) { // primary key is expired
 		return errors.ErrKeyExpired
 	}
 	if signedBySubKey {
@@ -12,6 +12,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -340,6 +341,126 @@ func TestSymmetricallyEncrypted(t *testing.T) {
 	}
 }
 
+func TestLiteralDataHook(t *testing.T) {
+	var hooked *packet.LiteralData
+	config := &packet.Config{
+		LiteralDataHook: func(literalData *packet.LiteralData) {
+			hooked = literalData
+		},
+	}
+	prompt := func(keys []Key, symmetric bool) ([]byte, error) {
+		return []byte("password"), nil
+	}
+	md, err := ReadMessage(readerFromHex(symmetricallyEncryptedCompressedHex), nil, prompt, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hooked == nil || hooked != md.LiteralData {
+		t.Fatal("hook not called with the literal data of the message")
+	}
+	if hooked.Time != 1555107469 {
+		t.Errorf("LiteralData.Time is %d, want %d", hooked.Time, 1555107469)
+	}
+	if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionKeyHook(t *testing.T) {
+	entity, err := NewEntity("Golang Gopher", "", "no-reply@golang.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const message = "hello world"
+	buf := new(bytes.Buffer)
+	w, err := Encrypt(buf, []*Entity{entity}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The session key is unwrapped outside of ReadMessage, which is given
+	// no private keys.
+	config := &packet.Config{
+		SessionKeyHook: func(encryptedKeys []*packet.EncryptedKey, symmetricKeys []*packet.SymmetricKeyEncrypted) (packet.CipherFunction, []byte, error) {
+			if len(encryptedKeys) != 1 || len(symmetricKeys) != 0 {
+				t.Fatalf("hook called with %d and %d session key packets", len(encryptedKeys), len(symmetricKeys))
+			}
+			if err := encryptedKeys[0].Decrypt(entity.Subkeys[0].PrivateKey, nil); err != nil {
+				return 0, nil, err
+			}
+			return encryptedKeys[0].CipherFunc, encryptedKeys[0].Key, nil
+		},
+	}
+	md, err := ReadMessage(bytes.NewReader(buf.Bytes()), nil, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != message {
+		t.Errorf("got %q, want %q", contents, message)
+	}
+
+	// Without a session key, the message is decrypted with the key ring.
+	config.SessionKeyHook = func([]*packet.EncryptedKey, []*packet.SymmetricKeyEncrypted) (packet.CipherFunction, []byte, error) {
+		return 0, nil, nil
+	}
+	md, err = ReadMessage(bytes.NewReader(buf.Bytes()), EntityList{entity}, nil, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.DecryptedWith.Entity != entity {
+		t.Error("message not decrypted with the key ring")
+	}
+	if _, err := ioutil.ReadAll(md.UnverifiedBody); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionKeyHookWrongKey(t *testing.T) {
+	for _, aeadConfig := range []*packet.AEADConfig{nil, {}} {
+		config := &packet.Config{AEADConfig: aeadConfig}
+		entity, err := NewEntity("Golang Gopher", "", "no-reply@golang.com", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := new(bytes.Buffer)
+		w, err := Encrypt(buf, []*Entity{entity}, nil, nil, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte("hello world")); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// A wrong session key from the hook is final, even though the
+		// key ring could decrypt the message.
+		for _, keySize := range []int{16, 32} {
+			config.SessionKeyHook = func([]*packet.EncryptedKey, []*packet.SymmetricKeyEncrypted) (packet.CipherFunction, []byte, error) {
+				return packet.CipherAES256, make([]byte, keySize), nil
+			}
+			md, err := ReadMessage(bytes.NewReader(buf.Bytes()), EntityList{entity}, nil, config)
+			if err == nil {
+				_, err = ioutil.ReadAll(md.UnverifiedBody)
+			}
+			if err == nil {
+				t.Errorf("expected an error for a wrong %d-byte session key (AEAD: %t)", keySize, aeadConfig != nil)
+			}
+		}
+	}
+}
+
 func testDetachedSignature(t *testing.T, kring KeyRing, signature io.Reader, sigInput, tag string, expectedSignerKeyId uint64) {
 	signed := bytes.NewBufferString(sigInput)
 	config := &packet.Config{}
@@ -833,3 +954,140 @@ func TestMessageWithoutMdc(t *testing.T) {
 		}
 	})
 }
+
+func TestReadMessageConcurrentDecryption(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	var recipients []*Entity
+	for i := 0; i < 4; i++ {
+		entity, err := NewEntity("Golang Gopher", strconv.Itoa(i), "no-reply@golang.com", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		recipients = append(recipients, entity)
+	}
+
+	buf := new(bytes.Buffer)
+	w, err := Encrypt(buf, recipients, nil, nil /* no hints */, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const message = "testing"
+	if _, err = w.Write([]byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the private key of the last recipient matches its public key.
+	for i := 0; i < 3; i++ {
+		recipients[i].Subkeys[0].PrivateKey = recipients[(i+1)%3].Subkeys[0].PrivateKey
+	}
+
+	collector := new(packet.WarningCollector)
+	readConfig := &packet.Config{DecryptionWorkers: 4, Warnings: collector}
+	md, err := ReadMessage(buf, EntityList(recipients), nil /* no prompt */, readConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != message {
+		t.Errorf("got: %s, want: %s", string(plaintext), message)
+	}
+	if md.DecryptedWith.Entity != recipients[3] {
+		t.Error("message decrypted with the wrong key")
+	}
+	for _, warning := range collector.Warnings() {
+		if warning.Kind != packet.WarningSessionKeyDecryption || warning.KeyId == recipients[3].Subkeys[0].PublicKey.KeyId {
+			t.Errorf("unexpected warning: %s", warning)
+		}
+	}
+}
+
+func TestReadMessagePreserveUnknownPackets(t *testing.T) {
+	buf := new(bytes.Buffer)
+	unknown := &packet.OpaquePacket{Tag: 60, Contents: []byte("experimental packet")}
+	if err := unknown.Serialize(buf); err != nil {
+		t.Fatal(err)
+	}
+	w, err := SymmetricallyEncrypt(buf, []byte("password"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const message = "testing"
+	if _, err = w.Write([]byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	prompt := func(keys []Key, symmetric bool) ([]byte, error) {
+		return []byte("password"), nil
+	}
+	config := &packet.Config{PreserveUnknownPackets: true}
+	md, err := ReadMessage(bytes.NewReader(buf.Bytes()), nil, prompt, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != message {
+		t.Errorf("got: %s, want: %s", plaintext, message)
+	}
+	if len(md.UnknownPackets) != 1 || md.UnknownPackets[0].Tag != 60 ||
+		!bytes.Equal(md.UnknownPackets[0].Contents, unknown.Contents) {
+		t.Errorf("unknown packet not preserved: %v", md.UnknownPackets)
+	}
+}
+
+func TestDecryptWithSessionKeys(t *testing.T) {
+	wrongKey := make([]byte, packet.CipherAES128.KeySize())
+	key := bytes.Repeat([]byte{1}, packet.CipherAES128.KeySize())
+	const message = "testing"
+
+	buf := new(bytes.Buffer)
+	w, err := packet.SerializeSymmetricallyEncrypted(buf, packet.CipherAES128, false, packet.CipherSuite{}, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A wrong session key is only detected by the MDC, after which the
+	// next session key must still be usable.
+	p, err := packet.Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionKeys := []sessionKey{{packet.CipherAES128, wrongKey}, {packet.CipherAES128, key}}
+	decrypted, err := decryptWithSessionKeys(p.(*packet.SymmetricallyEncrypted), sessionKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := ioutil.ReadAll(decrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != message {
+		t.Errorf("got: %s, want: %s", plaintext, message)
+	}
+
+	p, err = packet.Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionKeys = []sessionKey{{packet.CipherAES128, wrongKey}, {packet.CipherAES128, wrongKey}}
+	if _, err = decryptWithSessionKeys(p.(*packet.SymmetricallyEncrypted), sessionKeys); err != errors.ErrMDCHashMismatch {
+		t.Errorf("got: %v, want: %v", err, errors.ErrMDCHashMismatch)
+	}
+}
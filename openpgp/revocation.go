@@ -0,0 +1,247 @@
+package openpgp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// revocationCertificateComment is the armor comment of the revocation
+// certificates generated by GenerateRevocationCertificate.
+const revocationCertificateComment = "This is a revocation certificate"
+
+// GenerateRevocationCertificate returns an armored revocation certificate
+// for e: a standalone key revocation signature with the specified reason code
+// and text. Unlike RevokeKey, the signature is not added to e: the
+// certificate is meant to be stored offline, and applied with
+// ApplyRevocationCertificate if the key is lost or compromised.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) GenerateRevocationCertificate(reason packet.ReasonForRevocation, reasonText string, config *packet.Config) ([]byte, error) {
+	if err := checkPrimaryPrivateKey(e); err != nil {
+		return nil, err
+	}
+	revSig := createSignaturePacket(e.PrimaryKey, packet.SigTypeKeyRevocation, config)
+	revSig.RevocationReason = &reason
+	revSig.RevocationReasonText = reasonText
+	if err := revSig.RevokeKey(e.PrimaryKey, e.PrivateKey, config); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, PublicKeyType, map[string]string{"Comment": revocationCertificateComment})
+	if err != nil {
+		return nil, err
+	}
+	if err = revSig.Serialize(w); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gnupgRevocationCertificateNotice is the explanation following the
+// description of the key in the revocation certificates generated by GnuPG.
+const gnupgRevocationCertificateNotice = `A revocation certificate is a kind of "kill switch" to publicly
+declare that a key shall not anymore be used.  It is not possible
+to retract such a revocation certificate once it has been published.
+
+Use it to revoke this key in case of a compromise or loss of
+the secret key.  However, if the secret key is still accessible,
+it is better to generate a new revocation certificate and give
+reason for the revocation.  For details see the description of
+of the gpg command "--generate-revocation" in the GnuPG manual.
+
+To avoid an accidental use of this file, a colon has been inserted
+before the 5 dashes below.  Remove this colon with a text editor
+before importing and publishing this revocation certificate.
+
+`
+
+// GenerateGnuPGRevocationCertificate returns a revocation certificate for e,
+// like GenerateRevocationCertificate, in the format of the certificates
+// generated by GnuPG: the armored block is preceded by a comment describing
+// the key, and a colon is inserted before its first line to prevent
+// accidental imports. It can be stored alongside the certificates generated
+// by GnuPG, and applied with ApplyRevocationCertificate.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) GenerateGnuPGRevocationCertificate(reason packet.ReasonForRevocation, reasonText string, config *packet.Config) ([]byte, error) {
+	cert, err := e.GenerateRevocationCertificate(reason, reasonText, config)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("This is a revocation certificate for the OpenPGP key:\n\n")
+	buf.WriteString("pub   " + gnupgAlgorithmName(e.PrimaryKey) + " " + e.PrimaryKey.CreationTime.UTC().Format("2006-01-02"))
+	if selfSig, _ := e.primarySelfSignature(); selfSig != nil && selfSig.FlagsValid {
+		buf.WriteString(" [" + gnupgKeyUsage(selfSig) + "]")
+	}
+	buf.WriteString("\n      " + strings.ToUpper(hex.EncodeToString(e.PrimaryKey.Fingerprint)) + "\n")
+	names := make([]string, 0, len(e.Identities))
+	for name := range e.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buf.WriteString("uid                      " + name + "\n")
+	}
+	buf.WriteString("\n" + gnupgRevocationCertificateNotice + ":")
+	buf.Write(cert)
+	return buf.Bytes(), nil
+}
+
+// gnupgCurveNames maps curves to their names in GnuPG key listings.
+var gnupgCurveNames = map[packet.Curve]string{
+	packet.CurveNistP256:      "nistp256",
+	packet.CurveNistP384:      "nistp384",
+	packet.CurveNistP521:      "nistp521",
+	packet.CurveSecP256k1:     "secp256k1",
+	packet.CurveBrainpoolP256: "brainpoolP256r1",
+	packet.CurveBrainpoolP384: "brainpoolP384r1",
+	packet.CurveBrainpoolP512: "brainpoolP512r1",
+}
+
+// gnupgAlgorithmName returns the name of the algorithm of pk in GnuPG key
+// listings, such as "rsa3072" or "ed25519".
+func gnupgAlgorithmName(pk *packet.PublicKey) string {
+	var prefix string
+	switch pk.PubKeyAlgo {
+	case packet.PubKeyAlgoRSA, packet.PubKeyAlgoRSASignOnly, packet.PubKeyAlgoRSAEncryptOnly:
+		prefix = "rsa"
+	case packet.PubKeyAlgoDSA:
+		prefix = "dsa"
+	case packet.PubKeyAlgoElGamal:
+		prefix = "elg"
+	case packet.PubKeyAlgoEdDSA:
+		if pk.Curve() == packet.Curve448 {
+			return "ed448"
+		}
+		return "ed25519"
+	default:
+		switch curve := pk.Curve(); curve {
+		case packet.Curve25519:
+			return "cv25519"
+		case packet.Curve448:
+			return "cv448"
+		default:
+			if name, ok := gnupgCurveNames[curve]; ok {
+				return name
+			}
+			return strings.ToLower(string(curve))
+		}
+	}
+	bits, err := pk.BitLength()
+	if err != nil {
+		return prefix
+	}
+	return prefix + strconv.Itoa(int(bits))
+}
+
+// gnupgKeyUsage returns the usages of a key, as abbreviated in GnuPG key
+// listings.
+func gnupgKeyUsage(sig *packet.Signature) string {
+	var usage string
+	if sig.FlagSign {
+		usage += "S"
+	}
+	if sig.FlagCertify {
+		usage += "C"
+	}
+	if sig.FlagEncryptCommunications || sig.FlagEncryptStorage {
+		usage += "E"
+	}
+	if sig.FlagAuthenticate {
+		usage += "A"
+	}
+	return usage
+}
+
+// uncommentArmor removes the colon that GnuPG inserts before the armor
+// header lines of revocation certificates.
+func uncommentArmor(data []byte) []byte {
+	commented := []byte(":-----BEGIN ")
+	if bytes.HasPrefix(data, commented) {
+		data = data[1:]
+	}
+	return bytes.Replace(data, append([]byte("\n"), commented...), []byte("\n-----BEGIN "), -1)
+}
+
+// ApplyRevocationCertificate reads an armored revocation certificate of e
+// from r, as generated by GenerateRevocationCertificate or
+// GenerateGnuPGRevocationCertificate, and adds its key revocation signatures
+// to e. The colon inserted by GnuPG before the armored block is ignored. It
+// returns ErrUnknownIssuer if a signature was not issued by the primary key
+// of e, and a SignatureError if a signature is invalid. Revocations that e
+// already has are not added again.
+func (e *Entity) ApplyRevocationCertificate(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	block, err := armor.Decode(bytes.NewReader(uncommentArmor(data)))
+	if err != nil {
+		return err
+	}
+	if block.Type != PublicKeyType && block.Type != SignatureType {
+		return errors.InvalidArgumentError("expected a revocation certificate, got: " + block.Type)
+	}
+
+	var revocations []*packet.Signature
+	packets := packet.NewReader(block.Body)
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		sig, ok := p.(*packet.Signature)
+		if !ok || sig.SigType != packet.SigTypeKeyRevocation {
+			return errors.StructuralError("revocation certificate contains a packet that is not a key revocation")
+		}
+		if !sig.CheckKeyIdOrFingerprint(e.PrimaryKey) {
+			return errors.ErrUnknownIssuer
+		}
+		if err = e.PrimaryKey.VerifyRevocationSignature(sig); err != nil {
+			return errors.SignatureError("invalid revocation certificate: " + err.Error())
+		}
+		revocations = append(revocations, sig)
+	}
+	if len(revocations) == 0 {
+		return errors.StructuralError("empty revocation certificate")
+	}
+
+	for _, sig := range revocations {
+		if !containsSignature(e.Revocations, sig) {
+			e.Revocations = append(e.Revocations, sig)
+		}
+	}
+	return nil
+}
+
+// containsSignature returns whether sigs contains a signature serialized
+// identically to sig.
+func containsSignature(sigs []*packet.Signature, sig *packet.Signature) bool {
+	var serialized bytes.Buffer
+	if err := sig.Serialize(&serialized); err != nil {
+		return false
+	}
+	for _, s := range sigs {
+		var buf bytes.Buffer
+		if err := s.Serialize(&buf); err == nil && bytes.Equal(buf.Bytes(), serialized.Bytes()) {
+			return true
+		}
+	}
+	return false
+}
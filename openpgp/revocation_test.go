@@ -0,0 +1,102 @@
+package openpgp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestRevocationCertificate(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewEntity("Golang Gopher", "Other Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := entity.GenerateRevocationCertificate(packet.KeyCompromised, "lost laptop", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(cert), "Comment: "+revocationCertificateComment) {
+		t.Error("missing revocation certificate comment")
+	}
+	if len(entity.Revocations) != 0 || entity.Revoked(time.Now()) {
+		t.Fatal("generating a revocation certificate revoked the entity")
+	}
+
+	// Apply the certificate to a public copy of the entity.
+	var serialized bytes.Buffer
+	if err = entity.Serialize(&serialized); err != nil {
+		t.Fatal(err)
+	}
+	public, err := ReadEntity(packet.NewReader(&serialized))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err = public.ApplyRevocationCertificate(bytes.NewReader(cert)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(public.Revocations) != 1 {
+		t.Fatalf("expected a single revocation, got %d", len(public.Revocations))
+	}
+	if !public.Revoked(time.Now()) {
+		t.Error("entity not revoked by the certificate")
+	}
+	if reason := public.Revocations[0].RevocationReason; reason == nil || *reason != packet.KeyCompromised ||
+		public.Revocations[0].RevocationReasonText != "lost laptop" {
+		t.Error("unexpected revocation reason")
+	}
+
+	if err = other.ApplyRevocationCertificate(bytes.NewReader(cert)); err != errors.ErrUnknownIssuer {
+		t.Errorf("expected ErrUnknownIssuer for a certificate of another key, got %v", err)
+	}
+	if len(other.Revocations) != 0 {
+		t.Error("certificate of another key applied")
+	}
+}
+
+func TestGnuPGRevocationCertificate(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := entity.GenerateGnuPGRevocationCertificate(packet.KeySuperseded, "", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPrefix := "This is a revocation certificate for the OpenPGP key:\n\n" +
+		"pub   ed25519 " + entity.PrimaryKey.CreationTime.UTC().Format("2006-01-02") + " [SC]\n" +
+		"      " + strings.ToUpper(hex.EncodeToString(entity.PrimaryKey.Fingerprint)) + "\n" +
+		"uid                      Golang Gopher (Test Key) <no-reply@golang.com>\n\n"
+	if !strings.HasPrefix(string(cert), wantPrefix) {
+		t.Errorf("unexpected key description:\n%s", cert)
+	}
+	if !strings.Contains(string(cert), "\n:-----BEGIN PGP PUBLIC KEY BLOCK-----\n") {
+		t.Error("armor header not commented out")
+	}
+
+	// Certificates in the GnuPG format can be applied, with or without
+	// the colon.
+	for _, c := range [][]byte{cert, bytes.Replace(cert, []byte(":-----BEGIN"), []byte("-----BEGIN"), 1)} {
+		public := *entity
+		public.Revocations = nil
+		if err = public.ApplyRevocationCertificate(bytes.NewReader(c)); err != nil {
+			t.Fatal(err)
+		}
+		if !public.Revoked(time.Now()) {
+			t.Error("entity not revoked by the certificate")
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package openpgp
+
+import (
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// A RotationSummary describes the changes made to an Entity by Rotate.
+type RotationSummary struct {
+	// Added lists the key IDs of the generated subkeys.
+	Added []uint64
+	// Revoked lists the key IDs of the superseded subkeys, which were
+	// revoked with the packet.KeySuperseded reason.
+	Revoked []uint64
+}
+
+// Rotate generates a fresh signing subkey and a fresh encryption subkey, and
+// revokes the signing and encryption subkeys they supersede with the
+// packet.KeySuperseded reason. Authentication-only subkeys, and subkeys that
+// are already revoked or expired, are left untouched. An entity without a
+// valid encryption subkey, such as one created with NewSigningEntity, does
+// not get one. The new subkeys have the KeyLifetimeSecs of the config. The
+// private primary key must be decrypted; on error, the entity is left
+// unchanged.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) Rotate(config *packet.Config) (*RotationSummary, error) {
+	if err := checkPrimaryPrivateKey(e); err != nil {
+		return nil, err
+	}
+
+	const encryptFlags = packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage
+	now := config.Now()
+	var superseded []int
+	var canEncrypt bool
+	for i, subkey := range e.Subkeys {
+		if subkey.Revoked(now) ||
+			subkey.PublicKey.KeyExpired(subkey.Sig, now) ||
+			subkey.Sig.SigExpired(now) {
+			continue
+		}
+		encrypt := subkey.Sig.FlagsValid && (subkey.Sig.FlagEncryptCommunications || subkey.Sig.FlagEncryptStorage)
+		if encrypt || subkey.Sig.FlagSign {
+			superseded = append(superseded, i)
+		}
+		canEncrypt = canEncrypt || encrypt
+	}
+
+	n := len(e.Subkeys)
+	keyLifetimeSecs := addedSubkeyLifetime(config)
+	err := e.generateSubkey(config, now, keyLifetimeSecs, packet.KeyFlagSign)
+	if err == nil && canEncrypt {
+		err = e.generateSubkey(config, now, keyLifetimeSecs, encryptFlags)
+	}
+	if err != nil {
+		e.Subkeys = e.Subkeys[:n]
+		return nil, err
+	}
+
+	revocations := make([]*packet.Signature, len(superseded))
+	for j, i := range superseded {
+		reason := packet.KeySuperseded
+		revSig := createSignaturePacket(e.PrimaryKey, packet.SigTypeSubkeyRevocation, config)
+		revSig.RevocationReason = &reason
+		revSig.RevocationReasonText = "superseded by key rotation"
+		if err := revSig.RevokeSubkey(e.Subkeys[i].PublicKey, e.PrivateKey, config); err != nil {
+			e.Subkeys = e.Subkeys[:n]
+			return nil, err
+		}
+		revocations[j] = revSig
+	}
+
+	summary := new(RotationSummary)
+	for _, subkey := range e.Subkeys[n:] {
+		summary.Added = append(summary.Added, subkey.PublicKey.KeyId)
+	}
+	for j, i := range superseded {
+		e.Subkeys[i].Revocations = append(e.Subkeys[i].Revocations, revocations[j])
+		summary.Revoked = append(summary.Revoked, e.Subkeys[i].PublicKey.KeyId)
+	}
+	return summary, nil
+}
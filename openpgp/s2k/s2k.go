@@ -33,6 +33,19 @@ const (
 
 const Argon2SaltSize int = 16
 
+// GNU S2K extension modes, stored after the "GNU" marker of a GnuS2K
+// specifier. They are shown by GnuPG as S2K modes 1001 and 1002.
+const (
+	// GnuDummyMode marks a secret key as missing.
+	GnuDummyMode = 1
+	// GnuDivertToCardMode marks a secret key as stored on a smart card.
+	GnuDivertToCardMode = 2
+)
+
+// MaxCardSerialSize is the maximum length of the card serial number stored
+// in a divert-to-card S2K specifier.
+const MaxCardSerialSize = 16
+
 // Params contains all the parameters of the s2k packet
 type Params struct {
 	// mode is the mode of s2k function.
@@ -56,6 +69,12 @@ type Params struct {
 	// i.e., 2 ** memoryExp kibibytes
 	// See RFC the crypto refresh Section 3.7.1.4.
 	memoryExp byte
+	// gnuMode is the GNU extension mode of a GnuS2K, e.g. GnuDummyMode.
+	gnuMode byte
+	// cardSerial holds the serial number of the card holding the secret
+	// key, for GnuDivertToCardMode. Its length is cardSerialLen.
+	cardSerial    [MaxCardSerialSize]byte
+	cardSerialLen byte
 }
 
 // encodeCount converts an iterative "count" in the range 1024 to
@@ -291,7 +310,24 @@ func ParseIntoParams(r io.Reader) (params *Params, err error) {
 			return nil, err
 		}
 		params.hashId = buf[0]
-		if buf[1] == 'G' && buf[2] == 'N' && buf[3] == 'U' && buf[4] == 1 {
+		if buf[1] != 'G' || buf[2] != 'N' || buf[3] != 'U' {
+			return nil, errors.UnsupportedError("GNU S2K extension")
+		}
+		params.gnuMode = buf[4]
+		switch params.gnuMode {
+		case GnuDummyMode:
+			return params, nil
+		case GnuDivertToCardMode:
+			if _, err = io.ReadFull(r, buf[:1]); err != nil {
+				return nil, err
+			}
+			if buf[0] > MaxCardSerialSize {
+				return nil, errors.StructuralError("card serial number too long")
+			}
+			params.cardSerialLen = buf[0]
+			if _, err = io.ReadFull(r, params.cardSerial[:params.cardSerialLen]); err != nil {
+				return nil, err
+			}
 			return params, nil
 		}
 		return nil, errors.UnsupportedError("GNU S2K extension")
@@ -300,10 +336,47 @@ func ParseIntoParams(r io.Reader) (params *Params, err error) {
 	return nil, errors.UnsupportedError("S2K function")
 }
 
+// NewGnuDummyParams returns the parameters of the GNU dummy S2K extension
+// (mode 101, GNU mode 1), which marks a secret key as missing.
+func NewGnuDummyParams() *Params {
+	return &Params{mode: GnuS2K, gnuMode: GnuDummyMode}
+}
+
+// NewGnuDivertToCardParams returns the parameters of the GNU divert-to-card
+// S2K extension (mode 101, GNU mode 2), which marks a secret key as stored on
+// the smart card with the given serial number. The serial number may be
+// empty, and is at most MaxCardSerialSize bytes long.
+func NewGnuDivertToCardParams(serial []byte) (*Params, error) {
+	if len(serial) > MaxCardSerialSize {
+		return nil, errors.InvalidArgumentError("card serial number too long")
+	}
+	params := &Params{mode: GnuS2K, gnuMode: GnuDivertToCardMode, cardSerialLen: byte(len(serial))}
+	copy(params.cardSerial[:], serial)
+	return params, nil
+}
+
+// Dummy returns true if the parameters are a GNU extension indicating that
+// the secret key is not available, either because it is missing or because
+// it is stored on a smart card.
 func (params *Params) Dummy() bool {
 	return params != nil && params.mode == GnuS2K
 }
 
+// DivertToCard returns true if the parameters are the GNU divert-to-card
+// extension.
+func (params *Params) DivertToCard() bool {
+	return params.Dummy() && params.gnuMode == GnuDivertToCardMode
+}
+
+// CardSerial returns a copy of the card serial number of a divert-to-card
+// S2K, or nil for other S2Ks.
+func (params *Params) CardSerial() []byte {
+	if !params.DivertToCard() {
+		return nil
+	}
+	return append([]byte{}, params.cardSerial[:params.cardSerialLen]...)
+}
+
 func (params *Params) salt() []byte {
 	switch params.mode {
 		case SaltedS2K, IteratedSaltedS2K: return params.saltBytes[:8]
@@ -331,19 +404,19 @@ func (params *Params) Function() (f func(out, in []byte), err error) {
 	switch params.mode {
 	case SimpleS2K:
 		f := func(out, in []byte) {
-			Simple(out, hashObj.New(), in)
+			Simple(out, algorithm.NewHash(hashObj), in)
 		}
 
 		return f, nil
 	case SaltedS2K:
 		f := func(out, in []byte) {
-			Salted(out, hashObj.New(), in, params.salt())
+			Salted(out, algorithm.NewHash(hashObj), in, params.salt())
 		}
 
 		return f, nil
 	case IteratedSaltedS2K:
 		f := func(out, in []byte) {
-			Iterated(out, hashObj.New(), in, params.salt(), decodeCount(params.countByte))
+			Iterated(out, algorithm.NewHash(hashObj), in, params.salt(), decodeCount(params.countByte))
 		}
 
 		return f, nil
@@ -367,7 +440,12 @@ func (params *Params) Serialize(w io.Writer) (err error) {
 		}
 	}
 	if params.Dummy() {
-		_, err = w.Write(append([]byte("GNU"), 1))
+		if _, err = w.Write([]byte{'G', 'N', 'U', params.gnuMode}); err != nil {
+			return
+		}
+		if params.gnuMode == GnuDivertToCardMode {
+			_, err = w.Write(append([]byte{params.cardSerialLen}, params.cardSerial[:params.cardSerialLen]...))
+		}
 		return
 	}
 	if params.mode > 0 {
@@ -0,0 +1,208 @@
+package s2k
+
+import (
+	"bytes"
+	"crypto"
+	"strconv"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/internal/algorithm"
+)
+
+// NewSimpleParams returns the parameters of a Simple S2K (RFC 4880, section
+// 3.7.1.1) using the given hash. Simple S2K should only be used to read
+// existing data.
+func NewSimpleParams(hash crypto.Hash) (*Params, error) {
+	hashId, ok := algorithm.HashToHashId(hash)
+	if !ok {
+		return nil, errors.UnsupportedError("no such hash")
+	}
+	params := &Params{mode: SimpleS2K, hashId: hashId}
+	return params, params.Validate()
+}
+
+// NewSaltedParams returns the parameters of a Salted S2K (RFC 4880, section
+// 3.7.1.2) using the given hash and 8-byte salt.
+func NewSaltedParams(hash crypto.Hash, salt []byte) (*Params, error) {
+	hashId, ok := algorithm.HashToHashId(hash)
+	if !ok {
+		return nil, errors.UnsupportedError("no such hash")
+	}
+	params := &Params{mode: SaltedS2K, hashId: hashId}
+	if err := params.setSalt(salt); err != nil {
+		return nil, err
+	}
+	return params, params.Validate()
+}
+
+// NewIteratedParams returns the parameters of an Iterated and Salted S2K
+// (RFC 4880, section 3.7.1.3) using the given hash and 8-byte salt. count is
+// the number of bytes to hash, in the range 65536 to 65011712; it is rounded
+// up to the next encodable value.
+func NewIteratedParams(hash crypto.Hash, salt []byte, count int) (*Params, error) {
+	hashId, ok := algorithm.HashToHashId(hash)
+	if !ok {
+		return nil, errors.UnsupportedError("no such hash")
+	}
+	if count < 65536 || count > 65011712 {
+		return nil, errors.InvalidArgumentError("S2K count out of range: " + strconv.Itoa(count))
+	}
+	params := &Params{mode: IteratedSaltedS2K, hashId: hashId, countByte: encodeCount(count)}
+	if err := params.setSalt(salt); err != nil {
+		return nil, err
+	}
+	return params, params.Validate()
+}
+
+// NewArgon2Params returns the parameters of an Argon2 S2K (RFC 9580, section
+// 3.7.1.4) using the given 16-byte salt, number of passes, degree of
+// parallelism and memory exponent. The memory used is 2**memoryExp KiB.
+func NewArgon2Params(salt []byte, passes, parallelism, memoryExp uint8) (*Params, error) {
+	params := &Params{
+		mode:        Argon2S2K,
+		passes:      passes,
+		parallelism: parallelism,
+		memoryExp:   memoryExp,
+	}
+	if err := params.setSalt(salt); err != nil {
+		return nil, err
+	}
+	return params, params.Validate()
+}
+
+func (params *Params) setSalt(salt []byte) error {
+	if len(salt) != len(params.salt()) {
+		return errors.InvalidArgumentError("S2K salt has wrong length: " + strconv.Itoa(len(salt)))
+	}
+	copy(params.salt(), salt)
+	return nil
+}
+
+// Mode returns the mode of the S2K.
+func (params *Params) Mode() Mode {
+	return params.mode
+}
+
+// Hash returns the hash function used by the S2K. It returns false for
+// Argon2, which does not use a hash function, and for unknown hash IDs.
+func (params *Params) Hash() (crypto.Hash, bool) {
+	if params.mode == Argon2S2K {
+		return 0, false
+	}
+	return algorithm.HashIdToHashWithSha1(params.hashId)
+}
+
+// Salt returns a copy of the salt of the S2K, or nil for modes without salt.
+func (params *Params) Salt() []byte {
+	salt := params.salt()
+	if salt == nil {
+		return nil
+	}
+	return append([]byte(nil), salt...)
+}
+
+// EncodedCount returns the encoded iteration count of an Iterated and Salted
+// S2K, as stored in the S2K specifier, or 0 for other modes.
+func (params *Params) EncodedCount() uint8 {
+	if params.mode != IteratedSaltedS2K {
+		return 0
+	}
+	return params.countByte
+}
+
+// Count returns the number of bytes hashed by an Iterated and Salted S2K, or
+// 0 for other modes.
+func (params *Params) Count() int {
+	if params.mode != IteratedSaltedS2K {
+		return 0
+	}
+	return decodeCount(params.countByte)
+}
+
+// Passes returns the number of Argon2 passes, or 0 for other modes.
+func (params *Params) Passes() uint8 {
+	if params.mode != Argon2S2K {
+		return 0
+	}
+	return params.passes
+}
+
+// Parallelism returns the Argon2 degree of parallelism, or 0 for other modes.
+func (params *Params) Parallelism() uint8 {
+	if params.mode != Argon2S2K {
+		return 0
+	}
+	return params.parallelism
+}
+
+// MemoryExponent returns the encoded Argon2 memory size, i.e. the memory in
+// KiB is 2**MemoryExponent, or 0 for other modes.
+func (params *Params) MemoryExponent() uint8 {
+	if params.mode != Argon2S2K {
+		return 0
+	}
+	return params.memoryExp
+}
+
+// Memory returns the Argon2 memory size in KiB, or 0 for other modes.
+func (params *Params) Memory() uint32 {
+	if params.mode != Argon2S2K || params.memoryExp > 31 {
+		return 0
+	}
+	return decodeMemory(params.memoryExp)
+}
+
+// Validate checks that the parameters describe a well-formed S2K that this
+// package can compute. GNU dummy parameters are valid, although they
+// cannot derive a key.
+func (params *Params) Validate() error {
+	switch params.mode {
+	case SimpleS2K, SaltedS2K, IteratedSaltedS2K:
+		hash, ok := algorithm.HashIdToHashWithSha1(params.hashId)
+		if !ok {
+			return errors.UnsupportedError("hash for S2K function: " + strconv.Itoa(int(params.hashId)))
+		}
+		if !hash.Available() {
+			return errors.UnsupportedError("hash not available: " + strconv.Itoa(int(hash)))
+		}
+	case Argon2S2K:
+		// RFC 9580, section 3.7.1.4.
+		if params.passes == 0 {
+			return errors.StructuralError("Argon2 S2K with zero passes")
+		}
+		if params.parallelism == 0 {
+			return errors.StructuralError("Argon2 S2K with zero parallelism")
+		}
+		if params.memoryExp > 31 || decodeMemory(params.memoryExp) < 8*uint32(params.parallelism) {
+			return errors.StructuralError("Argon2 S2K memory out of range")
+		}
+	case GnuS2K:
+	default:
+		return errors.UnsupportedError("S2K function")
+	}
+	return nil
+}
+
+// MarshalBinary returns the S2K specifier described by params.
+func (params *Params) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := params.Serialize(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary parses the S2K specifier in data into params. data must
+// hold exactly one specifier.
+func (params *Params) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	parsed, err := ParseIntoParams(r)
+	if err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return errors.StructuralError("trailing data after S2K specifier")
+	}
+	*params = *parsed
+	return nil
+}
@@ -126,19 +126,22 @@ var parseTests = []struct {
 }{
 	/* Simple with SHA1 */
 	{"0002", "hello", "aaf4c61d", false,
-		Params{SimpleS2K, 0x02, [16]byte{}, 0, 0, 0, 0}},
+		Params{mode: SimpleS2K, hashId: 0x02, saltBytes: [16]byte{}, countByte: 0, passes: 0, parallelism: 0, memoryExp: 0}},
 	/* Salted with SHA1 */
 	{"01020102030405060708", "hello", "f4f7d67e", false,
-		Params{SaltedS2K, 0x02, [16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, 0, 0, 0, 0}},
+		Params{mode: SaltedS2K, hashId: 0x02, saltBytes: [16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, countByte: 0, passes: 0, parallelism: 0, memoryExp: 0}},
 	/* Iterated with SHA1 */
 	{"03020102030405060708f1", "hello", "f2a57b7c", false,
-		Params{IteratedSaltedS2K, 0x02, [16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, 0xf1, 0, 0, 0}},
+		Params{mode: IteratedSaltedS2K, hashId: 0x02, saltBytes: [16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, countByte: 0xf1, passes: 0, parallelism: 0, memoryExp: 0}},
 	/* Argon2 */
 	{"0401020304050607080102030405060708030410", "hello", "dabc018a", false,
-		Params{Argon2S2K, 0x00, [16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, 0, 0x03, 0x04, 0x10}},
+		Params{mode: Argon2S2K, hashId: 0x00, saltBytes: [16]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}, countByte: 0, passes: 0x03, parallelism: 0x04, memoryExp: 0x10}},
 	/* GNU dummy S2K */
 	{"6502474e5501", "", "", true,
-		Params{GnuS2K, 0x02, [16]byte{}, 0, 0, 0, 0}},
+		Params{mode: GnuS2K, hashId: 0x02, saltBytes: [16]byte{}, countByte: 0, passes: 0, parallelism: 0, memoryExp: 0, gnuMode: GnuDummyMode}},
+	/* GNU divert-to-card S2K */
+	{"6502474e550208d276000124010200", "", "", true,
+		Params{mode: GnuS2K, hashId: 0x02, gnuMode: GnuDivertToCardMode, cardSerial: [16]byte{0xd2, 0x76, 0x00, 0x01, 0x24, 0x01, 0x02, 0x00}, cardSerialLen: 8}},
 }
 
 func TestParseIntoParams(t *testing.T) {
@@ -156,6 +159,10 @@ func TestParseIntoParams(t *testing.T) {
 			t.Errorf("%d: Wrong config, got: %+v want: %+v", i, params, test.params)
 		}
 
+		if !bytes.Equal(test.params.CardSerial(), params.CardSerial()) {
+			t.Errorf("%d: Wrong card serial got: %x want: %x", i, params.CardSerial(), test.params.CardSerial())
+		}
+
 		if params.Dummy() != test.dummyKey {
 			t.Errorf("%d: Got GNU dummy %v, expected %v", i, params.Dummy(), test.dummyKey)
 		}
@@ -277,3 +284,71 @@ func testSerializeConfigOK(t *testing.T, c *Config) *Params {
 
 	return params
 }
+
+func TestParamsConstructors(t *testing.T) {
+	salt := []byte("12345678")
+	argonSalt := []byte("0123456789abcdef")
+
+	simple, err := NewSimpleParams(crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salted, err := NewSaltedParams(crypto.SHA256, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iterated, err := NewIteratedParams(crypto.SHA256, salt, 65536)
+	if err != nil {
+		t.Fatal(err)
+	}
+	argon, err := NewArgon2Params(argonSalt, 3, 4, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, params := range []*Params{simple, salted, iterated, argon, NewGnuDummyParams()} {
+		data, err := params.MarshalBinary()
+		if err != nil {
+			t.Fatalf("%d: MarshalBinary returned error: %s", i, err)
+		}
+		parsed := new(Params)
+		if err = parsed.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%d: UnmarshalBinary returned error: %s", i, err)
+		}
+		if *parsed != *params {
+			t.Errorf("%d: got %+v, want %+v", i, parsed, params)
+		}
+		if err = parsed.UnmarshalBinary(append(data, 0)); err == nil {
+			t.Errorf("%d: expected an error for trailing data", i)
+		}
+	}
+
+	if h, ok := iterated.Hash(); !ok || h != crypto.SHA256 {
+		t.Errorf("wrong hash: %v", h)
+	}
+	if iterated.Count() != 65536 || iterated.EncodedCount() != 96 {
+		t.Errorf("wrong count: %d (%d)", iterated.Count(), iterated.EncodedCount())
+	}
+	if !bytes.Equal(salted.Salt(), salt) || !bytes.Equal(argon.Salt(), argonSalt) {
+		t.Error("wrong salt")
+	}
+	if argon.Passes() != 3 || argon.Parallelism() != 4 || argon.MemoryExponent() != 16 || argon.Memory() != 65536 {
+		t.Errorf("wrong Argon2 parameters: %+v", argon)
+	}
+	if _, ok := argon.Hash(); ok {
+		t.Error("Argon2 S2K should not have a hash")
+	}
+
+	if _, err = NewSaltedParams(crypto.SHA256, salt[:4]); err == nil {
+		t.Error("expected an error for a short salt")
+	}
+	if _, err = NewIteratedParams(crypto.SHA256, salt, 1024); err == nil {
+		t.Error("expected an error for a low count")
+	}
+	if _, err = NewArgon2Params(argonSalt, 0, 4, 16); err == nil {
+		t.Error("expected an error for zero passes")
+	}
+	if _, err = NewArgon2Params(argonSalt, 1, 4, 4); err == nil {
+		t.Error("expected an error for too little memory")
+	}
+}
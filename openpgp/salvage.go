@@ -0,0 +1,71 @@
+package openpgp
+
+import (
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// A SalvageReport describes the outcome of SalvageMessage.
+type SalvageReport struct {
+	// Recovered is the number of octets of the contents of the message that
+	// were written to the output.
+	Recovered int64
+	// Authenticated is true if the recovered octets were authenticated. The
+	// chunks of AEAD encrypted messages are authenticated independently, so
+	// the recovered prefix of a damaged message is authenticated. The MDC of
+	// other encrypted messages only covers the whole message: the recovered
+	// octets of a damaged message may have been modified by an attacker.
+	Authenticated bool
+	// Damaged is true if the message could not be read to its end. The
+	// damaged region starts after the Recovered octets, and extends to the
+	// end of the message.
+	Damaged bool
+	// Err is the error that stopped reading the message, if Damaged.
+	Err error
+}
+
+// SalvageMessage decrypts the message read from r like ReadMessage, and
+// writes as much of its contents as possible to w, for data recovery from
+// partially corrupted messages. Unlike reading from the UnverifiedBody of
+// ReadMessage, a damaged message is not an error: it is described by the
+// returned report. An error is returned if the message cannot be decrypted
+// at all, or if writing to w fails.
+//
+// This is dangerous: unless the report states that they are authenticated,
+// the recovered contents must not be trusted nor processed as if the message
+// were intact. Signatures of damaged messages are not verified.
+// If config is nil, sensible defaults will be used.
+func SalvageMessage(w io.Writer, r io.Reader, keyring KeyRing, prompt PromptFunction, config *packet.Config) (md *MessageDetails, report *SalvageReport, err error) {
+	md, err = ReadMessage(r, keyring, prompt, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	body := &salvageReader{r: md.UnverifiedBody}
+	n, err := io.Copy(w, body)
+	if err != nil && err != body.err {
+		return nil, nil, err
+	}
+	report = &SalvageReport{
+		Recovered: n,
+		Damaged:   body.err != nil,
+		Err:       body.err,
+	}
+	report.Authenticated = md.chunkAuthenticated || (md.integrityProtected && !report.Damaged)
+	return md, report, nil
+}
+
+// salvageReader records the error returned by the reader it wraps, to tell
+// it apart from write errors.
+type salvageReader struct {
+	r   io.Reader
+	err error
+}
+
+func (sr *salvageReader) Read(buf []byte) (int, error) {
+	n, err := sr.r.Read(buf)
+	if err != nil && err != io.EOF {
+		sr.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,68 @@
+package openpgp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestSalvageMessage(t *testing.T) {
+	message := bytes.Repeat([]byte("0123456789abcdef"), 64)
+	passphrase := []byte("testing")
+	prompt := func(keys []Key, symmetric bool) ([]byte, error) {
+		return passphrase, nil
+	}
+
+	for _, test := range []struct {
+		name   string
+		config *packet.Config
+	}{
+		{"SEIPDv1", &packet.Config{}},
+		{"SEIPDv2", &packet.Config{AEADConfig: &packet.AEADConfig{ChunkSize: 64}}},
+	} {
+		buf := new(bytes.Buffer)
+		plaintext, err := SymmetricallyEncrypt(buf, passphrase, &FileHints{IsBinary: true}, test.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = plaintext.Write(message); err != nil {
+			t.Fatal(err)
+		}
+		if err = plaintext.Close(); err != nil {
+			t.Fatal(err)
+		}
+		ciphertext := buf.Bytes()
+
+		out := new(bytes.Buffer)
+		_, report, err := SalvageMessage(out, bytes.NewReader(ciphertext), nil, prompt, test.config)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if report.Damaged || !report.Authenticated || report.Recovered != int64(len(message)) || !bytes.Equal(out.Bytes(), message) {
+			t.Errorf("%s: unexpected report for an intact message: %+v", test.name, report)
+		}
+
+		damaged := append([]byte(nil), ciphertext...)
+		damaged[len(damaged)-len(message)/2] ^= 0xff
+		out.Reset()
+		_, report, err = SalvageMessage(out, bytes.NewReader(damaged), nil, prompt, test.config)
+		if err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if !report.Damaged || report.Err == nil {
+			t.Errorf("%s: damage not reported: %+v", test.name, report)
+		}
+		if report.Recovered != int64(out.Len()) {
+			t.Errorf("%s: got %d recovered octets, reported %d", test.name, out.Len(), report.Recovered)
+		}
+		if test.config.AEADConfig != nil {
+			if !report.Authenticated || report.Recovered == 0 || report.Recovered >= int64(len(message)) ||
+				!bytes.Equal(out.Bytes(), message[:report.Recovered]) {
+				t.Errorf("%s: expected an authenticated prefix: %+v", test.name, report)
+			}
+		} else if report.Authenticated {
+			t.Errorf("%s: recovered contents of a damaged SEIPDv1 message reported as authenticated", test.name)
+		}
+	}
+}
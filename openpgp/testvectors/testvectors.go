@@ -0,0 +1,364 @@
+// Package testvectors generates canonical OpenPGP artifacts, such as keys,
+// signatures and encrypted messages, from a fixed seed. The same seed and
+// options always produce the same artifacts, byte for byte, so that
+// downstream projects and other implementations can pin interoperability
+// fixtures against the exact output of this library, and detect when it
+// changes.
+//
+// Only the algorithms that this library can run deterministically from its
+// Config.Rand reader are covered: Ed25519 and Curve25519 keys, Ed448 and X448
+// keys, and RSA keys whose primes are derived from the seed. ECDSA keys and
+// signatures, and RSA encryption, use the randomness of the Go crypto
+// packages, which cannot be seeded, and are not generated.
+package testvectors
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+	"golang.org/x/crypto/chacha20"
+)
+
+const (
+	// Passphrase encrypts the encrypted private keys and the
+	// passphrase-encrypted messages.
+	Passphrase = "password"
+	// Plaintext is the contents of the signed and encrypted messages.
+	Plaintext = "Hello, world!\nThis is a test message.\n"
+
+	// The user ID of the keys is "Test Vector <test-vector@example.org>".
+	userName  = "Test Vector"
+	userEmail = "test-vector@example.org"
+
+	messageType = "PGP MESSAGE"
+	rsaBits     = 2048
+)
+
+// DefaultTime is the creation time of the artifacts if Options.Time is not
+// set.
+var DefaultTime = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// A Vector is an armored artifact.
+type Vector struct {
+	// Name identifies the artifact, as a slash-separated path such as
+	// "v4/ed25519/public-key.asc". Its first element is the key version,
+	// and its second element the key algorithm, if any.
+	Name string
+	// Data is the armored artifact.
+	Data []byte
+}
+
+// Options configures Generate.
+type Options struct {
+	// Seed is the seed from which all the randomness is derived.
+	Seed []byte
+	// Time is the creation time of the keys, signatures and messages. If
+	// zero, DefaultTime is used.
+	Time time.Time
+}
+
+// keyProfile describes the keys of generated entities.
+type keyProfile struct {
+	name    string
+	primary openpgp.KeySpec
+	subkey  openpgp.KeySpec
+	// encrypt is true if messages can be deterministically encrypted to
+	// the entity.
+	encrypt bool
+}
+
+var keyProfiles = []keyProfile{
+	{
+		name:    "ed25519",
+		primary: openpgp.KeySpec{Algorithm: packet.PubKeyAlgoEdDSA, Curve: packet.Curve25519},
+		subkey:  openpgp.KeySpec{Algorithm: packet.PubKeyAlgoECDH, Curve: packet.Curve25519, Flags: packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage},
+		encrypt: true,
+	},
+	{
+		name:    "curve448",
+		primary: openpgp.KeySpec{Algorithm: packet.PubKeyAlgoEdDSA, Curve: packet.Curve448},
+		subkey:  openpgp.KeySpec{Algorithm: packet.PubKeyAlgoECDH, Curve: packet.Curve448, Flags: packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage},
+		encrypt: true,
+	},
+	{
+		name:    "rsa" + strconv.Itoa(rsaBits),
+		primary: openpgp.KeySpec{Algorithm: packet.PubKeyAlgoRSA, RSABits: rsaBits},
+		subkey:  openpgp.KeySpec{Algorithm: packet.PubKeyAlgoRSA, RSABits: rsaBits, Flags: packet.KeyFlagEncryptCommunications | packet.KeyFlagEncryptStorage},
+	},
+}
+
+// generator derives the configs of the artifacts from the options.
+type generator struct {
+	seed    []byte
+	time    time.Time
+	vectors []Vector
+}
+
+// Generate returns the artifacts generated from opts: for version 4 and 5
+// keys of each supported algorithm, the public and private keys, a private
+// key encrypted with Passphrase, detached, inline and cleartext signatures of
+// Plaintext and, if messages can be encrypted to the key, messages encrypted
+// to it with SEIPDv1 and SEIPDv2 packets, each uncompressed and compressed
+// with ZIP and ZLIB, and unsigned and signed by the key. Messages encrypted
+// with Passphrase are generated as well, under "symmetric".
+func Generate(opts Options) ([]Vector, error) {
+	if len(opts.Seed) == 0 {
+		return nil, errors.InvalidArgumentError("empty seed")
+	}
+	g := &generator{seed: opts.Seed, time: opts.Time}
+	if g.time.IsZero() {
+		g.time = DefaultTime
+	}
+
+	for _, version := range []int{4, 5} {
+		for _, profile := range keyProfiles {
+			if err := g.keyVectors(version, profile); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, encryption := range []packet.EncryptionVersion{packet.ForceSEIPDv1, packet.ForceSEIPDv2} {
+		name := "symmetric/" + encryptionName(encryption) + ".asc"
+		config := g.config(name)
+		config.EncryptionVersion = encryption
+		if encryption == packet.ForceSEIPDv2 {
+			config.AEADConfig = new(packet.AEADConfig)
+		}
+		err := g.add(name, messageType, func(w io.Writer) error {
+			plaintext, err := openpgp.SymmetricallyEncrypt(w, []byte(Passphrase), nil, config)
+			if err != nil {
+				return err
+			}
+			return writePlaintext(plaintext)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return g.vectors, nil
+}
+
+// keyVectors generates the artifacts of the keys of the given version and
+// profile.
+func (g *generator) keyVectors(version int, profile keyProfile) error {
+	dir := "v" + strconv.Itoa(version) + "/" + profile.name + "/"
+	config := g.config(dir + "private-key.asc")
+	config.V5Keys = version == 5
+	config.AEADConfig = new(packet.AEADConfig)
+	if profile.primary.Algorithm == packet.PubKeyAlgoRSA {
+		primes, err := derivePrimes(config.Rand, 4, rsaBits)
+		if err != nil {
+			return err
+		}
+		config.RSAPrimes = primes
+	}
+	entity, err := openpgp.NewEntityWithOptions(config,
+		openpgp.WithUserId(userName, "", userEmail),
+		openpgp.WithPrimaryKeySpec(profile.primary),
+		openpgp.WithSubkeySpec(profile.subkey),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := g.add(dir+"private-key.asc", openpgp.PrivateKeyType, func(w io.Writer) error {
+		return entity.SerializePrivateWithoutSigning(w, nil)
+	}); err != nil {
+		return err
+	}
+	if err := g.add(dir+"public-key.asc", openpgp.PublicKeyType, entity.Serialize); err != nil {
+		return err
+	}
+	name := dir + "private-key-encrypted.asc"
+	encrypted := entity.Clone()
+	if err := encrypted.EncryptPrivateKeys([]byte(Passphrase), g.config(name)); err != nil {
+		return err
+	}
+	if err := g.add(name, openpgp.PrivateKeyType, func(w io.Writer) error {
+		return encrypted.SerializePrivateWithoutSigning(w, nil)
+	}); err != nil {
+		return err
+	}
+
+	name = dir + "detached-signature.asc"
+	if err := g.add(name, openpgp.SignatureType, func(w io.Writer) error {
+		return openpgp.DetachSign(w, entity, bytes.NewBufferString(Plaintext), g.config(name))
+	}); err != nil {
+		return err
+	}
+	name = dir + "detached-text-signature.asc"
+	if err := g.add(name, openpgp.SignatureType, func(w io.Writer) error {
+		return openpgp.DetachSignText(w, entity, bytes.NewBufferString(Plaintext), g.config(name))
+	}); err != nil {
+		return err
+	}
+	name = dir + "signed-message.asc"
+	if err := g.add(name, messageType, func(w io.Writer) error {
+		plaintext, err := openpgp.Sign(w, entity, nil, g.config(name))
+		if err != nil {
+			return err
+		}
+		return writePlaintext(plaintext)
+	}); err != nil {
+		return err
+	}
+	name = dir + "cleartext-signed.asc"
+	var clearsigned bytes.Buffer
+	plaintext, err := clearsign.Encode(&clearsigned, entity.PrivateKey, g.config(name))
+	if err != nil {
+		return err
+	}
+	if err := writePlaintext(plaintext); err != nil {
+		return err
+	}
+	g.vectors = append(g.vectors, Vector{Name: name, Data: clearsigned.Bytes()})
+
+	if !profile.encrypt {
+		return nil
+	}
+	for _, encryption := range []packet.EncryptionVersion{packet.ForceSEIPDv1, packet.ForceSEIPDv2} {
+		for _, compression := range []packet.CompressionAlgo{packet.CompressionNone, packet.CompressionZIP, packet.CompressionZLIB} {
+			for _, signed := range []*openpgp.Entity{nil, entity} {
+				name := dir + "encrypted-" + encryptionName(encryption) + "-" + compressionName(compression)
+				if signed != nil {
+					name += "-signed"
+				}
+				name += ".asc"
+				config := g.config(name)
+				config.EncryptionVersion = encryption
+				config.DefaultCompressionAlgo = compression
+				if err := g.add(name, messageType, func(w io.Writer) error {
+					plaintext, err := openpgp.Encrypt(w, []*openpgp.Entity{entity}, signed, nil, config)
+					if err != nil {
+						return err
+					}
+					return writePlaintext(plaintext)
+				}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// config returns the config of the artifact of the given name, whose
+// randomness is derived from the seed and the name, so that artifacts do not
+// depend on each other.
+func (g *generator) config(name string) *packet.Config {
+	key := sha256.New()
+	key.Write([]byte("go-crypto test vector\x00"))
+	key.Write([]byte(strconv.Itoa(len(g.seed))))
+	key.Write([]byte{0})
+	key.Write(g.seed)
+	key.Write([]byte(name))
+	stream, err := chacha20.NewUnauthenticatedCipher(key.Sum(nil), make([]byte, chacha20.NonceSize))
+	if err != nil {
+		panic(err)
+	}
+	return &packet.Config{
+		Rand: &streamReader{stream},
+		Time: func() time.Time { return g.time },
+	}
+}
+
+// add armors the artifact written by write and adds it to the vectors.
+func (g *generator) add(name, blockType string, write func(w io.Writer) error) error {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, blockType, nil)
+	if err != nil {
+		return err
+	}
+	if err := write(w); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	g.vectors = append(g.vectors, Vector{Name: name, Data: buf.Bytes()})
+	return nil
+}
+
+func writePlaintext(plaintext io.WriteCloser) error {
+	if _, err := io.WriteString(plaintext, Plaintext); err != nil {
+		return err
+	}
+	return plaintext.Close()
+}
+
+func encryptionName(version packet.EncryptionVersion) string {
+	if version == packet.ForceSEIPDv2 {
+		return "seipdv2"
+	}
+	return "seipdv1"
+}
+
+func compressionName(algo packet.CompressionAlgo) string {
+	switch algo {
+	case packet.CompressionZIP:
+		return "zip"
+	case packet.CompressionZLIB:
+		return "zlib"
+	}
+	return "uncompressed"
+}
+
+// derivePrimes returns count primes of bits/2 bits for RSA keys of the given
+// size, derived from r. Unlike crypto/rand.Prime, it only depends on the
+// bytes read from r. The primes have their two top bits set, so that the
+// product of two of them has exactly bits bits, and are suitable for the
+// public exponent 65537.
+func derivePrimes(r io.Reader, count, bits int) ([]*big.Int, error) {
+	e := big.NewInt(65537)
+	one := big.NewInt(1)
+	two := big.NewInt(2)
+	size := bits / 2
+	buf := make([]byte, (size+7)/8)
+	var primes []*big.Int
+	for len(primes) < count {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		buf[0] &= byte(0xff >> uint(len(buf)*8-size))
+		buf[0] |= byte(0xc0 >> uint(len(buf)*8-size))
+		buf[len(buf)-1] |= 1
+		p := new(big.Int).SetBytes(buf)
+		mod := new(big.Int)
+	Search:
+		for ; p.BitLen() == size; p.Add(p, two) {
+			if mod.Mod(p, e).Cmp(one) == 0 || !p.ProbablyPrime(20) {
+				continue
+			}
+			for _, q := range primes {
+				if q.Cmp(p) == 0 {
+					break Search
+				}
+			}
+			primes = append(primes, p)
+			break
+		}
+	}
+	return primes, nil
+}
+
+// streamReader reads the key stream of a cipher.
+type streamReader struct {
+	stream *chacha20.Cipher
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	s.stream.XORKeyStream(p, p)
+	return len(p), nil
+}
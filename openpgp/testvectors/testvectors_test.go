@@ -0,0 +1,134 @@
+package testvectors
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+)
+
+func TestGenerate(t *testing.T) {
+	opts := Options{Seed: []byte("seed")}
+	vectors, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Generate(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != len(vectors) {
+		t.Fatalf("generated %d and %d vectors from the same seed", len(vectors), len(again))
+	}
+	for i := range vectors {
+		if again[i].Name != vectors[i].Name || !bytes.Equal(again[i].Data, vectors[i].Data) {
+			t.Errorf("vector %s differs between generations from the same seed", vectors[i].Name)
+		}
+	}
+	other, err := Generate(Options{Seed: []byte("other seed")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(other[0].Data, vectors[0].Data) {
+		t.Errorf("vector %s does not depend on the seed", vectors[0].Name)
+	}
+
+	byName := make(map[string][]byte)
+	for _, v := range vectors {
+		if _, ok := byName[v.Name]; ok {
+			t.Errorf("duplicate vector %s", v.Name)
+		}
+		byName[v.Name] = v.Data
+	}
+	for _, v := range vectors {
+		dir := v.Name[:strings.LastIndex(v.Name, "/")+1]
+		if dir == "symmetric/" {
+			checkMessage(t, v, nil)
+			continue
+		}
+		keys, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(byName[dir+"private-key.asc"]))
+		if err != nil {
+			t.Fatalf("%s: %s", v.Name, err)
+		}
+		switch {
+		case strings.HasSuffix(v.Name, "-key-encrypted.asc"):
+			encrypted, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(v.Data))
+			if err != nil {
+				t.Fatalf("%s: %s", v.Name, err)
+			}
+			if err := encrypted[0].DecryptPrivateKeys([]byte(Passphrase)); err != nil {
+				t.Errorf("%s: %s", v.Name, err)
+			}
+		case strings.HasSuffix(v.Name, "-key.asc"):
+			if _, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(v.Data)); err != nil {
+				t.Errorf("%s: %s", v.Name, err)
+			}
+		case strings.Contains(v.Name, "detached"):
+			if _, err := openpgp.CheckArmoredDetachedSignature(keys, strings.NewReader(Plaintext), bytes.NewReader(v.Data), nil); err != nil {
+				t.Errorf("%s: %s", v.Name, err)
+			}
+		case strings.Contains(v.Name, "cleartext"):
+			b, _ := clearsign.Decode(v.Data)
+			if b == nil {
+				t.Fatalf("%s: no cleartext signed message found", v.Name)
+			}
+			if _, err := b.VerifySignature(keys, nil); err != nil {
+				t.Errorf("%s: %s", v.Name, err)
+			}
+		default:
+			checkMessage(t, v, keys)
+		}
+	}
+}
+
+// goldenDigest is the SHA-256 digest of the names and contents of the
+// vectors generated from the seed "seed". It must only change along with
+// a deliberate change of the output of the library.
+const goldenDigest = "a9427c31eafe168989897c7b0fb1b8ac6ab654b6d76a85631d3fb96b9a0f66b8"
+
+func TestGenerateGolden(t *testing.T) {
+	vectors, err := Generate(Options{Seed: []byte("seed")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha256.New()
+	for _, v := range vectors {
+		h.Write([]byte(v.Name))
+		h.Write([]byte{0})
+		h.Write(v.Data)
+	}
+	if digest := hex.EncodeToString(h.Sum(nil)); digest != goldenDigest {
+		t.Errorf("got digest %s, want %s", digest, goldenDigest)
+	}
+}
+
+func checkMessage(t *testing.T, v Vector, keys openpgp.EntityList) {
+	block, err := armor.Decode(bytes.NewReader(v.Data))
+	if err != nil {
+		t.Fatalf("%s: %s", v.Name, err)
+	}
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		return []byte(Passphrase), nil
+	}
+	md, err := openpgp.ReadMessage(block.Body, keys, prompt, nil)
+	if err != nil {
+		t.Fatalf("%s: %s", v.Name, err)
+	}
+	contents, err := ioutil.ReadAll(md.UnverifiedBody)
+	if err != nil {
+		t.Fatalf("%s: %s", v.Name, err)
+	}
+	if string(contents) != Plaintext {
+		t.Errorf("%s: got %q, want %q", v.Name, contents, Plaintext)
+	}
+	signed := strings.HasSuffix(v.Name, "-signed.asc") || strings.HasSuffix(v.Name, "signed-message.asc")
+	if md.IsSigned != signed || (signed && md.SignatureError != nil) {
+		t.Errorf("%s: signed %t, signature error %v", v.Name, md.IsSigned, md.SignatureError)
+	}
+}
@@ -0,0 +1,173 @@
+package openpgp
+
+import (
+	"bytes"
+	"io"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// A UserAttribute represents a user attribute, such as a photo ID, claimed
+// by an Entity and zero or more assertions by other entities about that
+// claim.
+type UserAttribute struct {
+	UserAttribute *packet.UserAttribute
+	SelfSignature *packet.Signature
+	Revocations   []*packet.Signature
+	Signatures    []*packet.Signature // all (potentially unverified) self-signatures, revocations, and third-party signatures
+}
+
+// AddPhoto adds a photo ID, holding the given JPEG image, to the entity and
+// certifies it with the primary key. The image is stored as given. The
+// primary private key must be available and decrypted.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AddPhoto(jpeg []byte, config *packet.Config) error {
+	uat, err := packet.NewUserAttributeJPEG(jpeg)
+	if err != nil {
+		return err
+	}
+	return e.AddUserAttribute(uat, config)
+}
+
+// AddUserAttribute adds the given user attribute to the entity and certifies
+// it with the primary key. The primary private key must be available and
+// decrypted.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) AddUserAttribute(uat *packet.UserAttribute, config *packet.Config) error {
+	if err := checkPrimaryPrivateKey(e); err != nil {
+		return err
+	}
+	if len(uat.Contents) == 0 {
+		return errors.InvalidArgumentError("user attribute without subpackets")
+	}
+
+	selfSignature := createSignaturePacket(e.PrimaryKey, packet.SigTypePositiveCert, config)
+	if err := selfSignature.SignUserAttribute(uat, e.PrimaryKey, e.PrivateKey, config); err != nil {
+		return err
+	}
+	e.UserAttributes = append(e.UserAttributes, &UserAttribute{
+		UserAttribute: uat,
+		SelfSignature: selfSignature,
+		Signatures:    []*packet.Signature{selfSignature},
+	})
+	return nil
+}
+
+// Verify checks the self-signature of the user attribute, and returns nil iff
+// it is a valid, unrevoked and unexpired certification by primary at the
+// given time.
+func (ua *UserAttribute) Verify(primary *packet.PublicKey, now time.Time) error {
+	if ua.SelfSignature == nil {
+		return errors.StructuralError("user attribute without self-signature")
+	}
+	if err := primary.VerifyUserAttributeSignature(ua.UserAttribute, primary, ua.SelfSignature); err != nil {
+		return err
+	}
+	if ua.SelfSignature.SigExpired(now) {
+		return errors.ErrSignatureExpired
+	}
+	for _, revocation := range ua.Revocations {
+		if !revocation.CreationTime.After(now) {
+			return errors.ErrKeyRevoked
+		}
+	}
+	return nil
+}
+
+// findUserAttribute returns the user attribute of e with the same contents as
+// uat, or nil if there is none.
+func (e *Entity) findUserAttribute(uat *packet.UserAttribute) *UserAttribute {
+	var want bytes.Buffer
+	if err := uat.Serialize(&want); err != nil {
+		return nil
+	}
+	for _, ua := range e.UserAttributes {
+		var got bytes.Buffer
+		if err := ua.UserAttribute.Serialize(&got); err == nil && bytes.Equal(got.Bytes(), want.Bytes()) {
+			return ua
+		}
+	}
+	return nil
+}
+
+// addUserAttribute reads the signatures following the user attribute pkt and
+// adds it to e if it carries a valid self-signature.
+func addUserAttribute(e *Entity, packets *packet.Reader, pkt *packet.UserAttribute) error {
+	// Like identities, user attributes are only kept if they carry a valid
+	// self-signature. Signatures of the wrong type and invalid
+	// self-signatures are skipped, so that a broken user attribute does not
+	// make the whole entity unreadable.
+	ua := &UserAttribute{UserAttribute: pkt}
+	added := false
+
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		sig, ok := p.(*packet.Signature)
+		if !ok {
+			packets.Unread(p)
+			break
+		}
+
+		if sig.SigType != packet.SigTypeGenericCert &&
+			sig.SigType != packet.SigTypePersonaCert &&
+			sig.SigType != packet.SigTypeCasualCert &&
+			sig.SigType != packet.SigTypePositiveCert &&
+			sig.SigType != packet.SigTypeCertificationRevocation {
+			continue
+		}
+
+		if sig.CheckKeyIdOrFingerprint(e.PrimaryKey) {
+			if err = e.PrimaryKey.VerifyUserAttributeSignature(pkt, e.PrimaryKey, sig); err != nil {
+				continue
+			}
+			if sig.SigType == packet.SigTypeCertificationRevocation {
+				ua.Revocations = append(ua.Revocations, sig)
+			} else if ua.SelfSignature == nil || sig.CreationTime.After(ua.SelfSignature.CreationTime) {
+				ua.SelfSignature = sig
+			}
+			ua.Signatures = append(ua.Signatures, sig)
+			if !added {
+				e.UserAttributes = append(e.UserAttributes, ua)
+				added = true
+			}
+		} else {
+			ua.Signatures = append(ua.Signatures, sig)
+		}
+	}
+
+	return nil
+}
+
+// serializeUserAttributes writes the user attributes of e and their
+// signatures to w. If reSign is true, the self-signatures are re-issued with
+// the primary private key first.
+func (e *Entity) serializeUserAttributes(w io.Writer, config *packet.Config, reSign bool) error {
+	for _, ua := range e.UserAttributes {
+		if err := ua.UserAttribute.Serialize(w); err != nil {
+			return err
+		}
+		if reSign {
+			if ua.SelfSignature == nil {
+				return errors.InvalidArgumentError("can't re-sign user attribute without valid self-signature")
+			}
+			err := ua.SelfSignature.SignUserAttribute(ua.UserAttribute, e.PrimaryKey, e.PrivateKey, config)
+			if err != nil {
+				return err
+			}
+		}
+		for _, sig := range ua.Signatures {
+			if err := sig.Serialize(w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
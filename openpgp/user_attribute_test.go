@@ -0,0 +1,111 @@
+package openpgp
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestAddPhoto(t *testing.T) {
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var img bytes.Buffer
+	if err = jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.AddPhoto(img.Bytes(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.AddPhoto([]byte("not a jpeg"), nil); err == nil {
+		t.Error("expected an error when adding non-JPEG data")
+	}
+
+	for _, private := range []bool{false, true} {
+		var buf bytes.Buffer
+		if private {
+			err = entity.SerializePrivate(&buf, nil)
+		} else {
+			err = entity.Serialize(&buf)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		read, err := ReadEntity(packet.NewReader(&buf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(read.UserAttributes) != 1 {
+			t.Fatalf("expected 1 user attribute, got %d", len(read.UserAttributes))
+		}
+		ua := read.UserAttributes[0]
+		images := ua.UserAttribute.ImageData()
+		if len(images) != 1 || !bytes.Equal(images[0], img.Bytes()) {
+			t.Error("photo was not preserved")
+		}
+		if err = ua.Verify(read.PrimaryKey, time.Now()); err != nil {
+			t.Errorf("photo self-signature did not verify: %s", err)
+		}
+		if len(read.Identities) != 1 {
+			t.Errorf("expected 1 identity, got %d", len(read.Identities))
+		}
+	}
+}
+
+func TestReadInvalidUserAttributes(t *testing.T) {
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var img bytes.Buffer
+	if err = jpeg.Encode(&img, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = entity.AddPhoto(img.Bytes(), nil); err != nil {
+		t.Fatal(err)
+	}
+	valid := entity.UserAttributes[0]
+
+	// A user attribute whose only signature has the wrong type, and one whose
+	// self-signature was made over another user attribute, are dropped.
+	var other bytes.Buffer
+	if err = jpeg.Encode(&other, image.NewGray(image.Rect(0, 0, 4, 4)), nil); err != nil {
+		t.Fatal(err)
+	}
+	uat, err := packet.NewUserAttributeJPEG(other.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entity.UserAttributes = append(entity.UserAttributes, &UserAttribute{
+		UserAttribute: uat,
+		Signatures:    []*packet.Signature{entity.Subkeys[0].Sig},
+	}, &UserAttribute{
+		UserAttribute: uat,
+		Signatures:    []*packet.Signature{valid.SelfSignature},
+	})
+
+	var buf bytes.Buffer
+	if err = entity.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadEntity(packet.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.UserAttributes) != 1 {
+		t.Fatalf("expected 1 user attribute, got %d", len(read.UserAttributes))
+	}
+	if images := read.UserAttributes[0].UserAttribute.ImageData(); len(images) != 1 || !bytes.Equal(images[0], img.Bytes()) {
+		t.Error("the valid photo was not preserved")
+	}
+	if len(read.Identities) != 1 || len(read.Subkeys) != 1 {
+		t.Errorf("expected 1 identity and 1 subkey, got %d and %d", len(read.Identities), len(read.Subkeys))
+	}
+}
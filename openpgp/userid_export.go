@@ -0,0 +1,165 @@
+package openpgp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// UserIdExportMode selects how identities are exported by
+// SerializeWithoutUserIds.
+type UserIdExportMode uint8
+
+const (
+	// StripUserIds removes all the identities. The properties of the
+	// primary key are then carried by a direct-key self-signature.
+	StripUserIds UserIdExportMode = iota
+	// HashUserIds replaces each identity with a token derived from it, see
+	// HashUserId, certified by a new self-signature.
+	HashUserIds
+)
+
+// HashUserId returns the token replacing the given user ID in exports made
+// with the HashUserIds mode: "sha256:" followed by the hexadecimal SHA-256
+// hash of the user ID.
+func HashUserId(id string) string {
+	h := sha256.Sum256([]byte(id))
+	return "sha256:" + hex.EncodeToString(h[:])
+}
+
+// SerializeWithoutUserIds writes the public part of e to w, like Serialize,
+// but without the personal data of its identities, for distribution channels
+// that do not accept it. The exported key remains valid: if e has no
+// direct-key self-signature, or in the HashUserIds mode, new self-signatures
+// are made, which requires the private key of e to be decrypted. These
+// signatures are not added to e. The identities can be re-attached to an
+// exported key with MergeUserIds.
+// If config is nil, sensible defaults will be used.
+func (e *Entity) SerializeWithoutUserIds(w io.Writer, mode UserIdExportMode, config *packet.Config) error {
+	exported := *e
+	exported.Identities = make(map[string]*Identity)
+	switch mode {
+	case StripUserIds:
+		if e.SelfSignature == nil {
+			selfSignature, err := e.directKeySelfSignatureFromIdentity(config)
+			if err != nil {
+				return err
+			}
+			exported.SelfSignature = selfSignature
+			exported.Signatures = append([]*packet.Signature{selfSignature}, e.Signatures...)
+		}
+	case HashUserIds:
+		for name, ident := range e.Identities {
+			hashed, err := e.hashedIdentity(ident, config)
+			if err != nil {
+				return err
+			}
+			exported.Identities[name] = hashed
+		}
+	default:
+		return errors.InvalidArgumentError("unknown user ID export mode")
+	}
+	return exported.Serialize(w)
+}
+
+// directKeySelfSignatureFromIdentity returns a new direct-key self-signature
+// carrying the key properties of the primary self-signature of e.
+func (e *Entity) directKeySelfSignatureFromIdentity(config *packet.Config) (*packet.Signature, error) {
+	primary, _ := e.primarySelfSignature()
+	if primary == nil {
+		return nil, errors.InvalidArgumentError("entity without self-signature")
+	}
+	if err := e.checkExportSigningKey(); err != nil {
+		return nil, err
+	}
+	sig := createSignaturePacket(e.PrimaryKey, packet.SigTypeDirectSignature, config)
+	copyKeyProperties(sig, primary)
+	if err := sig.SignDirectKeySignature(e.PrimaryKey, e.PrivateKey, config); err != nil {
+		return nil, err
+	}
+	return sig, nil
+}
+
+// hashedIdentity returns the identity replacing ident in exports made with
+// the HashUserIds mode.
+func (e *Entity) hashedIdentity(ident *Identity, config *packet.Config) (*Identity, error) {
+	if ident.SelfSignature == nil {
+		return nil, errors.InvalidArgumentError("identity without self-signature")
+	}
+	if err := e.checkExportSigningKey(); err != nil {
+		return nil, err
+	}
+	token := HashUserId(ident.Name)
+	uid := packet.NewUserId(token, "", "")
+	if uid == nil {
+		return nil, errors.InvalidArgumentError("invalid hashed user ID")
+	}
+	sig := createSignaturePacket(e.PrimaryKey, ident.SelfSignature.SigType, config)
+	copyKeyProperties(sig, ident.SelfSignature)
+	sig.IsPrimaryId = ident.SelfSignature.IsPrimaryId
+	if err := sig.SignUserId(token, e.PrimaryKey, e.PrivateKey, config); err != nil {
+		return nil, err
+	}
+	return &Identity{
+		Name:          token,
+		UserId:        uid,
+		SelfSignature: sig,
+		Signatures:    []*packet.Signature{sig},
+	}, nil
+}
+
+func (e *Entity) checkExportSigningKey() error {
+	if e.PrivateKey == nil {
+		return errors.InvalidArgumentError("private key is required to export the key without user IDs")
+	}
+	if e.PrivateKey.Dummy() {
+		return errors.ErrDummyPrivateKey("dummy private key cannot create self-signatures")
+	}
+	if e.PrivateKey.Encrypted {
+		return errors.InvalidArgumentError("private key must be decrypted to export the key without user IDs")
+	}
+	return nil
+}
+
+// copyKeyProperties copies the properties of the primary key carried by the
+// self-signature from to sig: key flags, expiration, preferences and
+// features.
+func copyKeyProperties(sig, from *packet.Signature) {
+	sig.KeyLifetimeSecs = from.KeyLifetimeSecs
+	sig.FlagsValid = from.FlagsValid
+	sig.FlagCertify = from.FlagCertify
+	sig.FlagSign = from.FlagSign
+	sig.FlagEncryptCommunications = from.FlagEncryptCommunications
+	sig.FlagEncryptStorage = from.FlagEncryptStorage
+	sig.FlagSplitKey = from.FlagSplitKey
+	sig.FlagAuthenticate = from.FlagAuthenticate
+	sig.FlagGroupKey = from.FlagGroupKey
+	sig.PreferredSymmetric = from.PreferredSymmetric
+	sig.PreferredHash = from.PreferredHash
+	sig.PreferredCompression = from.PreferredCompression
+	sig.PreferredCipherSuites = from.PreferredCipherSuites
+	sig.SEIPDv1 = from.SEIPDv1
+	sig.SEIPDv2 = from.SEIPDv2
+}
+
+// MergeUserIds re-attaches to e the identities of from, a local copy of the
+// same key, for instance after e was fetched from a distribution channel that
+// only carries keys exported with SerializeWithoutUserIds. Identities of e
+// that are the hashed token of an identity of from are replaced by it, and
+// identities that e already has are left untouched.
+func (e *Entity) MergeUserIds(from *Entity) error {
+	if !bytes.Equal(e.PrimaryKey.Fingerprint, from.PrimaryKey.Fingerprint) {
+		return errors.InvalidArgumentError("cannot merge user IDs of a different key")
+	}
+	for name, ident := range from.Identities {
+		delete(e.Identities, HashUserId(name))
+		if _, ok := e.Identities[name]; !ok {
+			e.Identities[name] = ident
+		}
+	}
+	return nil
+}
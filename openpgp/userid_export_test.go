@@ -0,0 +1,75 @@
+package openpgp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestSerializeWithoutUserIds(t *testing.T) {
+	const name = "Golang Gopher (Test) <no-reply@golang.com>"
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA, KeyLifetimeSecs: 3600}
+	entity, err := NewEntity("Golang Gopher", "Test", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		mode     UserIdExportMode
+		wantName string
+	}{
+		{StripUserIds, ""},
+		{HashUserIds, HashUserId(name)},
+	} {
+		buf := new(bytes.Buffer)
+		if err = entity.SerializeWithoutUserIds(buf, test.mode, nil); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(buf.Bytes(), []byte("no-reply@golang.com")) {
+			t.Fatalf("mode %d: user ID exported", test.mode)
+		}
+		if len(entity.Identities) != 1 || entity.Identities[name] == nil {
+			t.Fatalf("mode %d: entity modified", test.mode)
+		}
+
+		read, err := ReadEntity(packet.NewReader(buf))
+		if err != nil {
+			t.Fatalf("mode %d: %s", test.mode, err)
+		}
+		selfSig, ident := read.primarySelfSignature()
+		if test.wantName == "" {
+			if len(read.Identities) != 0 || ident != nil {
+				t.Errorf("mode %d: unexpected identities", test.mode)
+			}
+		} else if len(read.Identities) != 1 || ident == nil || ident.Name != test.wantName {
+			t.Errorf("mode %d: unexpected identities", test.mode)
+		}
+		if selfSig == nil || !selfSig.FlagSign || selfSig.KeyLifetimeSecs == nil || *selfSig.KeyLifetimeSecs != 3600 {
+			t.Errorf("mode %d: key properties not preserved", test.mode)
+		}
+		if _, ok := read.EncryptionKey(config.Now()); !ok {
+			t.Errorf("mode %d: no encryption key", test.mode)
+		}
+
+		if err = read.MergeUserIds(entity); err != nil {
+			t.Fatal(err)
+		}
+		if len(read.Identities) != 1 || read.Identities[name] == nil {
+			t.Errorf("mode %d: user IDs not merged", test.mode)
+		}
+	}
+
+	other, err := NewEntity("Golang Gopher", "Other", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = other.MergeUserIds(entity); err == nil {
+		t.Error("expected an error when merging the user IDs of another key")
+	}
+
+	entity.PrivateKey = nil
+	if err = entity.SerializeWithoutUserIds(new(bytes.Buffer), StripUserIds, nil); err == nil {
+		t.Error("expected an error without private key")
+	}
+}
@@ -0,0 +1,154 @@
+package openpgp
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+)
+
+// zBase32Alphabet is the alphabet of the z-base-32 encoding used for the
+// hashed local parts of the Web Key Directory.
+const zBase32Alphabet = "ybndrfg8ejkmcpqxot1uwisza345h769"
+
+// WKDHash returns the hashed form of the local part of an email address, as
+// used in Web Key Directory URLs: the z-base-32 encoding of the SHA-1 hash of
+// the local part, with ASCII upper case letters mapped to lower case. See
+// https://datatracker.ietf.org/doc/html/draft-koch-openpgp-webkey-service#section-3.1.
+func WKDHash(localPart string) string {
+	h := sha1.Sum([]byte(asciiToLower(localPart)))
+	var b strings.Builder
+	var buffer uint32
+	var bits uint
+	for _, c := range h {
+		buffer = buffer<<8 | uint32(c)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			b.WriteByte(zBase32Alphabet[(buffer>>bits)&0x1f])
+		}
+	}
+	if bits > 0 {
+		b.WriteByte(zBase32Alphabet[(buffer<<(5-bits))&0x1f])
+	}
+	return b.String()
+}
+
+func asciiToLower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if 'A' <= r && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+// SerializeWKD writes the Web Key Directory of the given domain for the
+// entities in el. For every email address of the domain found in the
+// identities of the entities, a file named after the hashed local part holds
+// the entities claiming that address, each stripped of its other identities.
+// A policy file, empty, is written as well.
+//
+// create is called with the slash-separated path of each file, relative to
+// the ".well-known/openpgpkey" directory: "hu/<hash>" and "policy" for the
+// direct method, or "<domain>/hu/<hash>" and "<domain>/policy" for the
+// advanced method. The returned file is closed once written.
+func (el EntityList) SerializeWKD(domain string, advanced bool, create func(path string) (io.WriteCloser, error)) error {
+	domain = asciiToLower(domain)
+	if domain == "" || strings.ContainsAny(domain, "/\\") {
+		return errors.InvalidArgumentError("invalid WKD domain: " + domain)
+	}
+	prefix := ""
+	if advanced {
+		prefix = domain + "/"
+	}
+
+	byHash := make(map[string][]*Entity)
+	for _, e := range el {
+		filtered := make(map[string]*Entity)
+		for name, ident := range e.Identities {
+			localPart, ok := wkdLocalPart(ident, domain)
+			if !ok {
+				continue
+			}
+			hash := WKDHash(localPart)
+			stripped, ok := filtered[hash]
+			if !ok {
+				stripped = stripIdentities(e)
+				filtered[hash] = stripped
+				byHash[hash] = append(byHash[hash], stripped)
+			}
+			stripped.Identities[name] = ident
+		}
+	}
+
+	hashes := make([]string, 0, len(byHash))
+	for hash := range byHash {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	for _, hash := range hashes {
+		if err := writeWKDFile(create, prefix+"hu/"+hash, byHash[hash]); err != nil {
+			return err
+		}
+	}
+	return writeWKDFile(create, prefix+"policy", nil)
+}
+
+// WriteWKDDirectory writes the Web Key Directory of the given domain for the
+// entities in el to dir, the local directory served as ".well-known/openpgpkey",
+// creating the subdirectories as needed. See SerializeWKD.
+func (el EntityList) WriteWKDDirectory(dir, domain string, advanced bool) error {
+	return el.SerializeWKD(domain, advanced, func(path string) (io.WriteCloser, error) {
+		name := filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return nil, err
+		}
+		return os.Create(name)
+	})
+}
+
+// wkdLocalPart returns the local part of the email address of ident, if it
+// belongs to domain.
+func wkdLocalPart(ident *Identity, domain string) (string, bool) {
+	if ident.UserId == nil {
+		return "", false
+	}
+	at := strings.LastIndexByte(ident.UserId.Email, '@')
+	if at <= 0 || asciiToLower(ident.UserId.Email[at+1:]) != domain {
+		return "", false
+	}
+	return ident.UserId.Email[:at], true
+}
+
+// stripIdentities returns a shallow copy of e without any identity.
+func stripIdentities(e *Entity) *Entity {
+	stripped := *e
+	stripped.PrivateKey = nil
+	stripped.Identities = make(map[string]*Identity)
+	return &stripped
+}
+
+func writeWKDFile(create func(path string) (io.WriteCloser, error), path string, entities []*Entity) error {
+	f, err := create(path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	for _, e := range entities {
+		if err = e.Serialize(bw); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err = bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,82 @@
+package openpgp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+func TestWKDHash(t *testing.T) {
+	// Example from draft-koch-openpgp-webkey-service, section 3.1.
+	if got, want := WKDHash("Joe.Doe"), "iy9q119eutrkn8s1mk4r39qejnbu3n5q"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestWriteWKDDirectory(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	alice, err := NewEntity("Alice", "", "alice@example.org", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = alice.AddUserId("Alice", "elsewhere", "alice@example.com", config); err != nil {
+		t.Fatal(err)
+	}
+	bob, err := NewEntity("Bob", "", "Bob@Example.ORG", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	carol, err := NewEntity("Carol", "", "carol@example.net", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "wkd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err = (EntityList{alice, bob, carol}).WriteWKDDirectory(dir, "example.org", true); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(filepath.Join(dir, "example.org", "policy")); err != nil {
+		t.Errorf("missing policy file: %s", err)
+	}
+	files, err := ioutil.ReadDir(filepath.Join(dir, "example.org", "hu"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d keys, want 2", len(files))
+	}
+
+	for _, test := range []struct {
+		localPart string
+		entity    *Entity
+		identity  string
+	}{
+		{"alice", alice, "Alice <alice@example.org>"},
+		{"bob", bob, "Bob <Bob@Example.ORG>"},
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "example.org", "hu", WKDHash(test.localPart)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		el, err := ReadKeyRing(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(el) != 1 || !bytes.Equal(el[0].PrimaryKey.Fingerprint, test.entity.PrimaryKey.Fingerprint) {
+			t.Fatalf("%s: unexpected keys in WKD file", test.localPart)
+		}
+		if len(el[0].Identities) != 1 || el[0].Identities[test.identity] == nil {
+			t.Errorf("%s: unexpected identities %v", test.localPart, el[0].Identities)
+		}
+	}
+}
@@ -5,6 +5,8 @@
 package openpgp
 
 import (
+	"bytes"
+	"context"
 	"crypto"
 	"hash"
 	"io"
@@ -21,14 +23,16 @@ import (
 // already have been decrypted) and writes the signature to w.
 // If config is nil, sensible defaults will be used.
 func DetachSign(w io.Writer, signer *Entity, message io.Reader, config *packet.Config) error {
-	return detachSign(w, signer, message, packet.SigTypeBinary, config)
+	_, err := SignDetached(context.Background(), w, message, SignOptions{Signer: signer, Config: config})
+	return err
 }
 
 // ArmoredDetachSign signs message with the private key from signer (which
 // must already have been decrypted) and writes an armored signature to w.
 // If config is nil, sensible defaults will be used.
 func ArmoredDetachSign(w io.Writer, signer *Entity, message io.Reader, config *packet.Config) (err error) {
-	return armoredDetachSign(w, signer, message, packet.SigTypeBinary, config)
+	_, err = SignDetached(context.Background(), w, message, SignOptions{Signer: signer, Armor: true, Config: config})
+	return
 }
 
 // DetachSignText signs message (after canonicalising the line endings) with
@@ -36,7 +40,8 @@ func ArmoredDetachSign(w io.Writer, signer *Entity, message io.Reader, config *p
 // writes the signature to w.
 // If config is nil, sensible defaults will be used.
 func DetachSignText(w io.Writer, signer *Entity, message io.Reader, config *packet.Config) error {
-	return detachSign(w, signer, message, packet.SigTypeText, config)
+	_, err := SignDetached(context.Background(), w, message, SignOptions{Signer: signer, Text: true, Config: config})
+	return err
 }
 
 // ArmoredDetachSignText signs message (after canonicalising the line endings)
@@ -44,52 +49,56 @@ func DetachSignText(w io.Writer, signer *Entity, message io.Reader, config *pack
 // and writes an armored signature to w.
 // If config is nil, sensible defaults will be used.
 func ArmoredDetachSignText(w io.Writer, signer *Entity, message io.Reader, config *packet.Config) error {
-	return armoredDetachSign(w, signer, message, packet.SigTypeText, config)
+	_, err := SignDetached(context.Background(), w, message, SignOptions{Signer: signer, Text: true, Armor: true, Config: config})
+	return err
 }
 
-func armoredDetachSign(w io.Writer, signer *Entity, message io.Reader, sigType packet.SignatureType, config *packet.Config) (err error) {
+func armoredDetachSign(w io.Writer, signer *Entity, message io.Reader, sigType packet.SignatureType, config *packet.Config) (sig *packet.Signature, err error) {
 	out, err := armor.Encode(w, SignatureType, nil)
 	if err != nil {
 		return
 	}
-	err = detachSign(out, signer, message, sigType, config)
+	sig, err = detachSign(out, signer, message, sigType, config)
 	if err != nil {
 		return
 	}
-	return out.Close()
+	return sig, out.Close()
 }
 
-func detachSign(w io.Writer, signer *Entity, message io.Reader, sigType packet.SignatureType, config *packet.Config) (err error) {
+// detachSign writes a detached signature of message to w, and returns it.
+func detachSign(w io.Writer, signer *Entity, message io.Reader, sigType packet.SignatureType, config *packet.Config) (sig *packet.Signature, err error) {
 	signingKey, ok := signer.SigningKeyById(config.Now(), config.SigningKey())
 	if !ok {
-		return errors.InvalidArgumentError("no valid signing keys")
+		return nil, errors.InvalidArgumentError("no valid signing keys")
 	}
 	if signingKey.PrivateKey == nil {
-		return errors.InvalidArgumentError("signing key doesn't have a private key")
+		return nil, errors.InvalidArgumentError("signing key doesn't have a private key")
+	}
+	if signingKey.PrivateKey.Dummy() {
+		return nil, errors.ErrDummyPrivateKey("dummy signing key cannot sign")
 	}
 	if signingKey.PrivateKey.Encrypted {
-		return errors.InvalidArgumentError("signing key is encrypted")
+		return nil, errors.InvalidArgumentError("signing key is encrypted")
 	}
-	if _, ok := algorithm.HashToHashId(config.Hash()); !ok {
-		return errors.InvalidArgumentError("invalid hash function")
+	sig = createSignaturePacket(signingKey.PublicKey, sigType, config)
+	if _, ok := algorithm.HashToHashId(sig.Hash); !ok {
+		return nil, errors.InvalidArgumentError("invalid hash function")
 	}
 
-	sig := createSignaturePacket(signingKey.PublicKey, sigType, config)
-
 	h, wrappedHash, err := hashForSignature(sig.Hash, sig.SigType)
 	if err != nil {
-		return
+		return nil, err
 	}
 	if _, err = io.Copy(wrappedHash, message); err != nil {
-		return err
+		return nil, err
 	}
 
 	err = sig.Sign(h, signingKey.PrivateKey, config)
 	if err != nil {
-		return
+		return nil, err
 	}
 
-	return sig.Serialize(w)
+	return sig, sig.Serialize(w)
 }
 
 // FileHints contains metadata about encrypted files. This metadata is, itself,
@@ -104,6 +113,62 @@ type FileHints struct {
 	FileName string
 	// ModTime contains the modification time of the file, or the zero time if not applicable.
 	ModTime time.Time
+	// Size hints at the size of the file in octets, or is zero if unknown.
+	// It is not part of the message: it selects the chunk size of AEAD
+	// encrypted messages when the config does not set one, see
+	// packet.AEADConfig.ChunkSizeFor.
+	Size uint64
+	// Format, if not zero, is the format of the literal data, one of the
+	// packet.LiteralFormat* constants, overriding IsBinary. Mail software
+	// can use packet.LiteralFormatUTF8 for UTF-8 text, and
+	// packet.LiteralFormatMIME for MIME messages.
+	Format uint8
+	// NormalizeLineEndings, if set, converts the LF line endings of text
+	// contents to CRLF, as stored in the text formats. It has no effect on
+	// binary contents.
+	NormalizeLineEndings bool
+	// ContentType hints at the MIME type of the contents, such as
+	// "image/jpeg". It is not part of the message: it lets the adaptive
+	// compression mode skip the compression of already compressed contents,
+	// see packet.CompressionConfig.Adaptive.
+	ContentType string
+}
+
+// literalFormat returns the format of the literal data hinted at by hints.
+func (hints *FileHints) literalFormat() (uint8, error) {
+	switch hints.Format {
+	case 0:
+		if hints.IsBinary {
+			return packet.LiteralFormatBinary, nil
+		}
+		return packet.LiteralFormatText, nil
+	case packet.LiteralFormatBinary, packet.LiteralFormatText, packet.LiteralFormatUTF8, packet.LiteralFormatMIME:
+		return hints.Format, nil
+	}
+	return 0, errors.InvalidArgumentError("unsupported literal data format " + strconv.Itoa(int(hints.Format)))
+}
+
+// normalizeLineEndings returns plaintext, or a writer converting the line
+// endings of the text written to it to CRLF if hints ask for it.
+func normalizeLineEndings(plaintext io.WriteCloser, hints *FileHints, format uint8) io.WriteCloser {
+	if hints.NormalizeLineEndings && format != packet.LiteralFormatBinary {
+		return &canonicalTextWriter{w: plaintext}
+	}
+	return plaintext
+}
+
+// chunkSizeConfig returns config, or a copy of it setting the AEAD chunk size
+// selected for the size hinted at by hints.
+func chunkSizeConfig(config *packet.Config, hints *FileHints) *packet.Config {
+	aeadConfig := config.AEAD()
+	if aeadConfig == nil || aeadConfig.ChunkSize != 0 || hints == nil || hints.Size == 0 {
+		return config
+	}
+	sizedConfig := *aeadConfig
+	sizedConfig.ChunkSize = aeadConfig.ChunkSizeFor(hints.Size)
+	c := copyConfig(config)
+	c.AEADConfig = &sizedConfig
+	return c
 }
 
 // SymmetricallyEncrypt acts like gpg -c: it encrypts a file with a passphrase.
@@ -114,6 +179,10 @@ func SymmetricallyEncrypt(ciphertext io.Writer, passphrase []byte, hints *FileHi
 	if hints == nil {
 		hints = &FileHints{}
 	}
+	format, err := hints.literalFormat()
+	if err != nil {
+		return nil, err
+	}
 
 	key, err := packet.SerializeSymmetricKeyEncrypted(ciphertext, passphrase, config)
 	if err != nil {
@@ -125,28 +194,29 @@ func SymmetricallyEncrypt(ciphertext io.Writer, passphrase []byte, hints *FileHi
 		Cipher: config.Cipher(),
 		Mode:   config.AEAD().Mode(),
 	}
-	w, err = packet.SerializeSymmetricallyEncrypted(ciphertext, config.Cipher(), config.AEAD() != nil, cipherSuite, key, config)
+	w, err = packet.SerializeSymmetricallyEncrypted(ciphertext, config.Cipher(), config.AEAD() != nil, cipherSuite, key, chunkSizeConfig(config, hints))
+	if err != nil {
+		return
+	}
+	w, err = handlePadding(w, config)
 	if err != nil {
 		return
 	}
 
-	literalData := w
-	if algo := config.Compression(); algo != packet.CompressionNone {
-		var compConfig *packet.CompressionConfig
-		if config != nil {
-			compConfig = config.CompressionConfig
-		}
-		literalData, err = packet.SerializeCompressed(w, algo, compConfig)
-		if err != nil {
-			return
-		}
+	literalData, err := handleCompression(w, config.Compression(), hints, config)
+	if err != nil {
+		return
 	}
 
 	var epochSeconds uint32
 	if !hints.ModTime.IsZero() {
 		epochSeconds = uint32(hints.ModTime.Unix())
 	}
-	return packet.SerializeLiteral(literalData, hints.IsBinary, hints.FileName, epochSeconds)
+	plaintext, err = packet.SerializeLiteralFormat(literalData, format, hints.FileName, epochSeconds)
+	if err != nil {
+		return
+	}
+	return normalizeLineEndings(sampleCompression(plaintext, literalData), hints, format), nil
 }
 
 // intersectPreferences mutates and returns a prefix of a that contains only
@@ -197,7 +267,7 @@ func hashToHashId(h crypto.Hash) uint8 {
 // must be closed after the contents of the file have been written. If config
 // is nil, sensible defaults will be used. The signing is done in text mode.
 func EncryptText(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
-	return encrypt(ciphertext, ciphertext, to, signed, hints, packet.SigTypeText, config)
+	return encryptWithOptions(ciphertext, EncryptOptions{Recipients: to, Signer: signed, TextSignature: true, Hints: hints, Config: config})
 }
 
 // Encrypt encrypts a message to a number of recipients and, optionally, signs
@@ -206,7 +276,19 @@ func EncryptText(ciphertext io.Writer, to []*Entity, signed *Entity, hints *File
 // be closed after the contents of the file have been written.
 // If config is nil, sensible defaults will be used.
 func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
-	return encrypt(ciphertext, ciphertext, to, signed, hints, packet.SigTypeBinary, config)
+	return encryptWithOptions(ciphertext, EncryptOptions{Recipients: to, Signer: signed, Hints: hints, Config: config})
+}
+
+// EncryptWithPassphrases encrypts a message to a number of recipients and
+// passphrases and, optionally, signs it. The message can be decrypted either
+// with the private key of any recipient or with any of the passphrases, as
+// the session key is encrypted to each of them. hints contains optional
+// information, that is also encrypted, that aids the recipients in processing
+// the message. The resulting WriteCloser must be closed after the contents of
+// the file have been written.
+// If config is nil, sensible defaults will be used.
+func EncryptWithPassphrases(ciphertext io.Writer, to []*Entity, passphrases [][]byte, signed *Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
+	return encryptWithOptions(ciphertext, EncryptOptions{Recipients: to, Passphrases: passphrases, Signer: signed, Hints: hints, Config: config})
 }
 
 // EncryptSplit encrypts a message to a number of recipients and, optionally, signs
@@ -215,7 +297,7 @@ func Encrypt(ciphertext io.Writer, to []*Entity, signed *Entity, hints *FileHint
 // be closed after the contents of the file have been written.
 // If config is nil, sensible defaults will be used.
 func EncryptSplit(keyWriter io.Writer, dataWriter io.Writer, to []*Entity, signed *Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
-	return encrypt(keyWriter, dataWriter, to, signed, hints, packet.SigTypeBinary, config)
+	return encryptWithOptions(dataWriter, EncryptOptions{Recipients: to, Signer: signed, Hints: hints, KeyWriter: keyWriter, Config: config})
 }
 
 // EncryptTextSplit encrypts a message to a number of recipients and, optionally, signs
@@ -224,7 +306,17 @@ func EncryptSplit(keyWriter io.Writer, dataWriter io.Writer, to []*Entity, signe
 // be closed after the contents of the file have been written.
 // If config is nil, sensible defaults will be used.
 func EncryptTextSplit(keyWriter io.Writer, dataWriter io.Writer, to []*Entity, signed *Entity, hints *FileHints, config *packet.Config) (plaintext io.WriteCloser, err error) {
-	return encrypt(keyWriter, dataWriter, to, signed, hints, packet.SigTypeText, config)
+	return encryptWithOptions(dataWriter, EncryptOptions{Recipients: to, Signer: signed, TextSignature: true, Hints: hints, KeyWriter: keyWriter, Config: config})
+}
+
+// encryptWithOptions encrypts a message as by EncryptMessage, without a
+// context.
+func encryptWithOptions(ciphertext io.Writer, opts EncryptOptions) (io.WriteCloser, error) {
+	mw, err := EncryptMessage(context.Background(), ciphertext, opts)
+	if err != nil {
+		return nil, err
+	}
+	return mw, nil
 }
 
 // writeAndSign writes the data as a payload package and, optionally, signs
@@ -232,47 +324,18 @@ func EncryptTextSplit(keyWriter io.Writer, dataWriter io.Writer, to []*Entity, s
 // that aids the recipients in processing the message. The resulting
 // WriteCloser must be closed after the contents of the file have been
 // written. If config is nil, sensible defaults will be used.
-func writeAndSign(payload io.WriteCloser, candidateHashes []uint8, signed *Entity, hints *FileHints, sigType packet.SignatureType, config *packet.Config) (plaintext io.WriteCloser, err error) {
-	var signer *packet.PrivateKey
-	if signed != nil {
-		signKey, ok := signed.SigningKeyById(config.Now(), config.SigningKey())
-		if !ok {
-			return nil, errors.InvalidArgumentError("no valid signing keys")
-		}
-		signer = signKey.PrivateKey
-		if signer == nil {
-			return nil, errors.InvalidArgumentError("no private key in signing key")
-		}
-		if signer.Encrypted {
-			return nil, errors.InvalidArgumentError("signing key must be decrypted")
-		}
-	}
-
-	var hash crypto.Hash
-	for _, hashId := range candidateHashes {
-		if h, ok := algorithm.HashIdToHash(hashId); ok && h.Available() {
-			hash = h
-			break
-		}
+func writeAndSign(payload io.WriteCloser, candidateHashes []uint8, signer *packet.PrivateKey, hints *FileHints, sigType packet.SignatureType, config *packet.Config) (plaintext io.WriteCloser, err error) {
+	if hints == nil {
+		hints = &FileHints{}
 	}
-
-	// If the hash specified by config is a candidate, we'll use that.
-	if configuredHash := config.Hash(); configuredHash.Available() {
-		for _, hashId := range candidateHashes {
-			if h, ok := algorithm.HashIdToHash(hashId); ok && h == configuredHash {
-				hash = h
-				break
-			}
-		}
+	format, err := hints.literalFormat()
+	if err != nil {
+		return nil, err
 	}
 
-	if hash == 0 {
-		hashId := candidateHashes[0]
-		name, ok := algorithm.HashIdToString(hashId)
-		if !ok {
-			name = "#" + strconv.Itoa(int(hashId))
-		}
-		return nil, errors.InvalidArgumentError("cannot encrypt because no candidate hash functions are compiled in. (Wanted " + name + " in this case.)")
+	hash, err := selectSignatureHash(candidateHashes, signer, config)
+	if err != nil {
+		return nil, err
 	}
 
 	if signer != nil {
@@ -288,10 +351,6 @@ func writeAndSign(payload io.WriteCloser, candidateHashes []uint8, signed *Entit
 		}
 	}
 
-	if hints == nil {
-		hints = &FileHints{}
-	}
-
 	w := payload
 	if signer != nil {
 		// If we need to write a signature packet after the literal
@@ -304,7 +363,7 @@ func writeAndSign(payload io.WriteCloser, candidateHashes []uint8, signed *Entit
 	if !hints.ModTime.IsZero() {
 		epochSeconds = uint32(hints.ModTime.Unix())
 	}
-	literalData, err := packet.SerializeLiteral(w, hints.IsBinary, hints.FileName, epochSeconds)
+	literalData, err := packet.SerializeLiteralFormat(w, format, hints.FileName, epochSeconds)
 	if err != nil {
 		return nil, err
 	}
@@ -315,136 +374,252 @@ func writeAndSign(payload io.WriteCloser, candidateHashes []uint8, signed *Entit
 			return nil, err
 		}
 		metadata := &packet.LiteralData{
-			Format:   't',
+			Format:   format,
+			IsBinary: format == packet.LiteralFormatBinary,
 			FileName: hints.FileName,
 			Time:     epochSeconds,
 		}
-		if hints.IsBinary {
-			metadata.Format = 'b'
-		}
-		return signatureWriter{payload, literalData, hash, wrappedHash, h, signer, sigType, config, metadata}, nil
+		return normalizeLineEndings(signatureWriter{payload, literalData, hash, wrappedHash, h, signer, sigType, config, metadata}, hints, format), nil
 	}
-	return literalData, nil
+	return normalizeLineEndings(literalData, hints, format), nil
 }
 
-// encrypt encrypts a message to a number of recipients and, optionally, signs
-// it. hints contains optional information, that is also encrypted, that aids
-// the recipients in processing the message. The resulting WriteCloser must
-// be closed after the contents of the file have been written.
-// If config is nil, sensible defaults will be used.
-func encrypt(keyWriter io.Writer, dataWriter io.Writer, to []*Entity, signed *Entity, hints *FileHints, sigType packet.SignatureType, config *packet.Config) (plaintext io.WriteCloser, err error) {
-	if len(to) == 0 {
-		return nil, errors.InvalidArgumentError("no encryption recipient provided")
+// messageSigner returns the private key of signed used to sign messages.
+func messageSigner(signed *Entity, config *packet.Config) (*packet.PrivateKey, error) {
+	signKey, err := messageSigningKey(signed, config)
+	if err != nil {
+		return nil, err
 	}
+	return signKey.PrivateKey, nil
+}
 
-	// These are the possible ciphers that we'll use for the message.
-	candidateCiphers := []uint8{
-		uint8(packet.CipherAES256),
-		uint8(packet.CipherAES128),
+// messageSigningKey returns the key of signed used to sign messages.
+func messageSigningKey(signed *Entity, config *packet.Config) (Key, error) {
+	signKey, ok := signed.SigningKeyById(config.Now(), config.SigningKey())
+	if !ok {
+		return Key{}, errors.InvalidArgumentError("no valid signing keys")
 	}
-
-	// These are the possible hash functions that we'll use for the signature.
-	candidateHashes := []uint8{
-		hashToHashId(crypto.SHA256),
-		hashToHashId(crypto.SHA384),
-		hashToHashId(crypto.SHA512),
-		hashToHashId(crypto.SHA3_256),
-		hashToHashId(crypto.SHA3_512),
+	signer := signKey.PrivateKey
+	if signer == nil {
+		return Key{}, errors.InvalidArgumentError("no private key in signing key")
 	}
-
-	// Prefer GCM if everyone supports it
-	candidateCipherSuites := [][2]uint8{
-		{uint8(packet.CipherAES256), uint8(packet.AEADModeGCM)},
-		{uint8(packet.CipherAES256), uint8(packet.AEADModeEAX)},
-		{uint8(packet.CipherAES256), uint8(packet.AEADModeOCB)},
-		{uint8(packet.CipherAES128), uint8(packet.AEADModeGCM)},
-		{uint8(packet.CipherAES128), uint8(packet.AEADModeEAX)},
-		{uint8(packet.CipherAES128), uint8(packet.AEADModeOCB)},
+	if signer.Dummy() {
+		return Key{}, errors.ErrDummyPrivateKey("dummy signing key cannot sign")
 	}
-
-	candidateCompression := []uint8{
-		uint8(packet.CompressionNone),
-		uint8(packet.CompressionZIP),
-		uint8(packet.CompressionZLIB),
+	if signer.Encrypted {
+		return Key{}, errors.InvalidArgumentError("signing key must be decrypted")
 	}
+	return signKey, nil
+}
 
-	encryptKeys := make([]Key, len(to))
-
-	// AEAD is used only if config enables it and every key supports it
-	aeadSupported := config.AEAD() != nil
+// selectSignatureHash returns the hash function of the signature of a message
+// made by signer, which may be nil, among candidateHashes.
+func selectSignatureHash(candidateHashes []uint8, signer *packet.PrivateKey, config *packet.Config) (crypto.Hash, error) {
+	configuredHash := config.Hash()
+	var minHashSize int
+	if signer != nil {
+		configuredHash = config.HashForSigner(&signer.PublicKey)
+		minHashSize = signer.PublicKey.DefaultSignatureHash().Size()
+	}
 
-	for i := range to {
-		var ok bool
-		encryptKeys[i], ok = to[i].EncryptionKey(config.Now())
-		if !ok {
-			return nil, errors.InvalidArgumentError("cannot encrypt a message to key id " + strconv.FormatUint(to[i].PrimaryKey.KeyId, 16) + " because it has no valid encryption keys")
+	// Use the first available candidate, preferably one that is strong
+	// enough for the signing key.
+	var hash crypto.Hash
+	for _, hashId := range candidateHashes {
+		h, ok := algorithm.HashIdToHash(hashId)
+		if !ok || !h.Available() {
+			continue
 		}
-
-		sig := to[i].PrimaryIdentity().SelfSignature
-		if !sig.SEIPDv2 {
-			aeadSupported = false
+		if hash == 0 {
+			hash = h
+		}
+		if h.Size() >= minHashSize {
+			hash = h
+			break
 		}
+	}
 
-		candidateCiphers = intersectPreferences(candidateCiphers, sig.PreferredSymmetric)
-		candidateHashes = intersectPreferences(candidateHashes, sig.PreferredHash)
-		candidateCipherSuites = intersectCipherSuites(candidateCipherSuites, sig.PreferredCipherSuites)
-		candidateCompression = intersectPreferences(candidateCompression, sig.PreferredCompression)
+	// If the hash specified by config is a candidate, we'll use that.
+	if configuredHash.Available() {
+		for _, hashId := range candidateHashes {
+			if h, ok := algorithm.HashIdToHash(hashId); ok && h == configuredHash {
+				hash = h
+				break
+			}
+		}
 	}
 
-	// In the event that the intersection of supported algorithms is empty we use the ones
-	// labelled as MUST that every implementation supports.
-	if len(candidateCiphers) == 0 {
-		// https://www.ietf.org/archive/id/draft-ietf-openpgp-crypto-refresh-07.html#section-9.3
-		candidateCiphers = []uint8{uint8(packet.CipherAES128)}
+	if hash == 0 {
+		hashId := candidateHashes[0]
+		name, ok := algorithm.HashIdToString(hashId)
+		if !ok {
+			name = "#" + strconv.Itoa(int(hashId))
+		}
+		return 0, errors.InvalidArgumentError("cannot encrypt because no candidate hash functions are compiled in. (Wanted " + name + " in this case.)")
 	}
-	if len(candidateHashes) == 0 {
-		// https://www.ietf.org/archive/id/draft-ietf-openpgp-crypto-refresh-07.html#hash-algos
-		candidateHashes = []uint8{hashToHashId(crypto.SHA256)}
+	return hash, nil
+}
+
+// encrypt encrypts a message to a number of recipients and, optionally, signs
+// it. hints contains optional information, that is also encrypted, that aids
+// the recipients in processing the message. The resulting WriteCloser must
+// be closed after the contents of the file have been written. The algorithms
+// and keys used for the message are returned in result.
+// If config is nil, sensible defaults will be used.
+func encrypt(keyWriter io.Writer, dataWriter io.Writer, to []*Entity, passphrases [][]byte, signed *Entity, hints *FileHints, sigType packet.SignatureType, config *packet.Config) (plaintext io.WriteCloser, result *EncryptResult, err error) {
+	if len(to) == 0 && len(passphrases) == 0 {
+		return nil, nil, errors.InvalidArgumentError("no encryption recipient provided")
 	}
-	if len(candidateCipherSuites) == 0 {
-		// https://www.ietf.org/archive/id/draft-ietf-openpgp-crypto-refresh-07.html#section-9.6
-		candidateCipherSuites = [][2]uint8{{uint8(packet.CipherAES128), uint8(packet.AEADModeOCB)}}
+
+	negotiation, err := NegotiateAlgorithms(to, config)
+	if err != nil {
+		return nil, nil, err
 	}
+	cipher := negotiation.Cipher
+	aeadSupported := negotiation.AEAD
 
-	cipher := packet.CipherFunction(candidateCiphers[0])
-	aeadCipherSuite := packet.CipherSuite{
-		Cipher: packet.CipherFunction(candidateCipherSuites[0][0]),
-		Mode:   packet.AEADMode(candidateCipherSuites[0][1]),
+	encryptKeys := make([]Key, len(to))
+	for i := range to {
+		var ok bool
+		encryptKeys[i], ok = to[i].EncryptionKey(config.Now())
+		if !ok {
+			return nil, nil, errors.InvalidArgumentError("cannot encrypt a message to key id " + strconv.FormatUint(to[i].PrimaryKey.KeyId, 16) + " because it has no valid encryption keys")
+		}
 	}
+	result = &EncryptResult{Negotiation: negotiation, RecipientKeys: encryptKeys}
 
-	// If the cipher specified by config is a candidate, we'll use that.
-	configuredCipher := config.Cipher()
-	for _, c := range candidateCiphers {
-		cipherFunc := packet.CipherFunction(c)
-		if cipherFunc == configuredCipher {
-			cipher = cipherFunc
-			break
+	var signer *packet.PrivateKey
+	if signed != nil {
+		signingKey, err := messageSigningKey(signed, config)
+		if err != nil {
+			return nil, nil, err
 		}
+		signer = signingKey.PrivateKey
+		result.SigningKey = &signingKey
 	}
 
 	symKey := make([]byte, cipher.KeySize())
 	if _, err := io.ReadFull(config.Random(), symKey); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	for _, key := range encryptKeys {
-		if err := packet.SerializeEncryptedKey(keyWriter, key.PublicKey, cipher, symKey, config); err != nil {
-			return nil, err
+	if len(encryptKeys) > 0 {
+		pubs := make([]*packet.PublicKey, len(encryptKeys))
+		for i, key := range encryptKeys {
+			pubs[i] = key.PublicKey
+		}
+		if err := packet.SerializeEncryptedKeysReuseKey(keyWriter, pubs, cipher, symKey, config); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(passphrases) > 0 {
+		// The session key is encrypted with each passphrase for the cipher
+		// negotiated with the recipients, in AEAD-protected packets only if
+		// the message is.
+		skeskConfig := copyConfig(config)
+		skeskConfig.DefaultCipher = cipher
+		if !aeadSupported {
+			skeskConfig.AEADConfig = nil
+		} else if skeskConfig.AEADConfig == nil {
+			skeskConfig.AEADConfig = &packet.AEADConfig{}
+		}
+		for _, passphrase := range passphrases {
+			if err := packet.SerializeSymmetricKeyEncryptedReuseKey(keyWriter, symKey, passphrase, skeskConfig); err != nil {
+				return nil, nil, err
+			}
 		}
 	}
 
 	var payload io.WriteCloser
-	payload, err = packet.SerializeSymmetricallyEncrypted(dataWriter, cipher, aeadSupported, aeadCipherSuite, symKey, config)
+	payload, err = packet.SerializeSymmetricallyEncrypted(dataWriter, cipher, aeadSupported, negotiation.CipherSuite, symKey, chunkSizeConfig(config, hints))
 	if err != nil {
-		return
+		return nil, nil, err
+	}
+	payload, err = handlePadding(payload, config)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	payload, err = handleCompression(payload, candidateCompression, config)
+	payload, err = handleCompression(payload, negotiation.Compression, hints, config)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return writeAndSign(payload, candidateHashes, signed, hints, sigType, config)
+	plaintext, err = writeAndSign(payload, negotiation.candidateHashes, signer, hints, sigType, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sampleCompression(plaintext, payload), result, nil
+}
+
+// AddRecipients copies the encrypted message read from message to w, adding
+// an encrypted session key packet for each of the entities in to. The
+// session key of the message, and the cipher it is used with as found in
+// the encrypted session key packets, must be given, e.g. as obtained with
+// packet.EncryptedKey.Decrypt. The existing encrypted session key packets
+// and the encrypted data are copied verbatim, without being re-encrypted.
+// Whether sessionKey actually decrypts the message is not checked.
+// If config is nil, sensible defaults will be used.
+func AddRecipients(w io.Writer, message io.Reader, to []*Entity, cipher packet.CipherFunction, sessionKey []byte, config *packet.Config) error {
+	if len(to) == 0 {
+		return errors.InvalidArgumentError("no encryption recipient provided")
+	}
+	if len(sessionKey) != cipher.KeySize() {
+		return errors.InvalidArgumentError("session key size does not match the cipher")
+	}
+	encryptKeys := make([]Key, len(to))
+	for i := range to {
+		var ok bool
+		encryptKeys[i], ok = to[i].EncryptionKey(config.Now())
+		if !ok {
+			return errors.InvalidArgumentError("cannot encrypt a message to key id " + strconv.FormatUint(to[i].PrimaryKey.KeyId, 16) + " because it has no valid encryption keys")
+		}
+	}
+
+	// Each packet is buffered while it is parsed, and then copied to w.
+	var raw bytes.Buffer
+	tee := io.TeeReader(message, &raw)
+	for {
+		raw.Reset()
+		p, err := packet.Read(tee)
+		if err == io.EOF {
+			return errors.StructuralError("key material not followed by encrypted message")
+		}
+		if err != nil {
+			switch err.(type) {
+			case errors.UnknownPacketTypeError, errors.UnsupportedError:
+				// Packets that cannot be parsed, such as Marker packets
+				// or encrypted session keys of unsupported versions, are
+				// copied as well.
+				if _, err := raw.WriteTo(w); err != nil {
+					return err
+				}
+				continue
+			}
+			return err
+		}
+
+		switch p.(type) {
+		case *packet.EncryptedKey, *packet.SymmetricKeyEncrypted:
+			if _, err := raw.WriteTo(w); err != nil {
+				return err
+			}
+		case *packet.SymmetricallyEncrypted, *packet.AEADEncrypted:
+			for _, key := range encryptKeys {
+				if err := packet.SerializeEncryptedKey(w, key.PublicKey, cipher, sessionKey, config); err != nil {
+					return err
+				}
+			}
+			// Only the header of the encrypted data packet has been read.
+			if _, err := raw.WriteTo(w); err != nil {
+				return err
+			}
+			_, err := io.Copy(w, message)
+			return err
+		default:
+			return errors.InvalidArgumentError("message is not encrypted")
+		}
+	}
 }
 
 // Sign signs a message. The resulting WriteCloser must be closed after the
@@ -456,6 +631,21 @@ func Sign(output io.Writer, signed *Entity, hints *FileHints, config *packet.Con
 		return nil, errors.InvalidArgumentError("no signer provided")
 	}
 
+	candidateHashes, err := signingCandidateHashes(signed, config)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := messageSigner(signed, config)
+	if err != nil {
+		return nil, err
+	}
+	return writeAndSign(noOpCloser{output}, candidateHashes, signer, hints, packet.SigTypeBinary, config)
+}
+
+// signingCandidateHashes returns the hash functions that can be used by Sign
+// for a signature of signed, according to its preferences.
+func signingCandidateHashes(signed *Entity, config *packet.Config) ([]uint8, error) {
 	// These are the possible hash functions that we'll use for the signature.
 	candidateHashes := []uint8{
 		hashToHashId(crypto.SHA256),
@@ -465,7 +655,7 @@ func Sign(output io.Writer, signed *Entity, hints *FileHints, config *packet.Con
 		hashToHashId(crypto.SHA3_512),
 	}
 	defaultHashes := candidateHashes[0:1]
-	preferredHashes := signed.PrimaryIdentity().SelfSignature.PreferredHash
+	preferredHashes := signed.Preferences(config.Now()).Hashes
 	if len(preferredHashes) == 0 {
 		preferredHashes = defaultHashes
 	}
@@ -473,8 +663,7 @@ func Sign(output io.Writer, signed *Entity, hints *FileHints, config *packet.Con
 	if len(candidateHashes) == 0 {
 		return nil, errors.InvalidArgumentError("cannot sign because signing key shares no common algorithms with candidate hashes")
 	}
-
-	return writeAndSign(noOpCloser{output}, candidateHashes, signed, hints, packet.SigTypeBinary, config)
+	return candidateHashes, nil
 }
 
 // signatureWriter hashes the contents of a message while passing it along to
@@ -527,11 +716,12 @@ func createSignaturePacket(signer *packet.PublicKey, sigType packet.SignatureTyp
 		Version:           signer.Version,
 		SigType:           sigType,
 		PubKeyAlgo:        signer.PubKeyAlgo,
-		Hash:              config.Hash(),
+		Hash:              config.HashForSigner(signer),
 		CreationTime:      config.Now(),
 		IssuerKeyId:       &signer.KeyId,
 		IssuerFingerprint: signer.Fingerprint,
 		Notations:         config.Notations(),
+		PolicyURI:         config.PolicyURI(),
 		SigLifetimeSecs:   &sigLifetimeSecs,
 	}
 }
@@ -551,33 +741,64 @@ func (c noOpCloser) Close() error {
 	return nil
 }
 
-func handleCompression(compressed io.WriteCloser, candidateCompression []uint8, config *packet.Config) (data io.WriteCloser, err error) {
+// handleCompression returns the writer of the compressed layer of a message
+// written to compressed, if algo is not CompressionNone. In adaptive mode,
+// the compressed layer is skipped if hints or, with sampleCompression, the
+// start of the plaintext show that it is already compressed.
+func handleCompression(compressed io.WriteCloser, algo packet.CompressionAlgo, hints *FileHints, config *packet.Config) (data io.WriteCloser, err error) {
 	data = compressed
-	confAlgo := config.Compression()
-	if confAlgo == packet.CompressionNone {
-		return
-	}
-
-	// Set algorithm labelled as MUST as fallback
-	// https://www.ietf.org/archive/id/draft-ietf-openpgp-crypto-refresh-07.html#section-9.4
-	finalAlgo := packet.CompressionNone
-	// if compression specified by config available we will use it
-	for _, c := range candidateCompression {
-		if uint8(confAlgo) == c {
-			finalAlgo = confAlgo
-			break
-		}
-	}
-
-	if finalAlgo != packet.CompressionNone {
+	if algo != packet.CompressionNone {
 		var compConfig *packet.CompressionConfig
 		if config != nil {
 			compConfig = config.CompressionConfig
 		}
-		data, err = packet.SerializeCompressed(compressed, finalAlgo, compConfig)
+		if compConfig != nil && compConfig.Adaptive {
+			var contentType string
+			if hints != nil {
+				contentType = hints.ContentType
+			}
+			compressible, known := compressibleContentType(contentType)
+			if !known {
+				return &adaptiveCompressor{payload: compressed, algo: algo, config: compConfig}, nil
+			}
+			if !compressible {
+				return compressed, nil
+			}
+		}
+		data, err = packet.SerializeCompressed(compressed, algo, compConfig)
 		if err != nil {
 			return
 		}
 	}
 	return data, nil
 }
+
+// paddingWriter writes a Padding packet of the given length to the encrypted
+// data when closed, before closing it.
+type paddingWriter struct {
+	encryptedData io.WriteCloser
+	length        int
+	config        *packet.Config
+}
+
+func (p paddingWriter) Write(data []byte) (int, error) {
+	return p.encryptedData.Write(data)
+}
+
+func (p paddingWriter) Close() error {
+	if err := packet.SerializePadding(p.encryptedData, p.length, p.config.Random()); err != nil {
+		return err
+	}
+	return p.encryptedData.Close()
+}
+
+func handlePadding(encryptedData io.WriteCloser, config *packet.Config) (io.WriteCloser, error) {
+	length, err := config.PaddingLength()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || config.MaxPaddingLength == 0 {
+		return encryptedData, nil
+	}
+	return paddingWriter{encryptedData, length, config}, nil
+}
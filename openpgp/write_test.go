@@ -10,6 +10,7 @@ import (
 	"io"
 	"io/ioutil"
 	mathrand "math/rand"
+	"strconv"
 	"testing"
 	"time"
 
@@ -281,7 +282,7 @@ func TestEncryptWithCompression(t *testing.T) {
 	buf := new(bytes.Buffer)
 	var config = &packet.Config{
 		DefaultCompressionAlgo: packet.CompressionZIP,
-		CompressionConfig:      &packet.CompressionConfig{-1},
+		CompressionConfig:      &packet.CompressionConfig{Level: -1},
 	}
 	w, err := Encrypt(buf, kring[:1], nil, nil /* no hints */, config)
 	if err != nil {
@@ -350,6 +351,172 @@ func TestSymmetricEncryption(t *testing.T) {
 	}
 }
 
+func TestSymmetricEncryptionCompressionLevel(t *testing.T) {
+	for _, algo := range []packet.CompressionAlgo{packet.CompressionNone, packet.CompressionZIP, packet.CompressionZLIB} {
+		config := &packet.Config{
+			DefaultCompressionAlgo: algo,
+			CompressionConfig:      &packet.CompressionConfig{Level: packet.BestSpeed},
+		}
+		buf := new(bytes.Buffer)
+		plaintext, err := SymmetricallyEncrypt(buf, []byte("testing"), nil, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		message := bytes.Repeat([]byte("hello world\n"), 100)
+		if _, err = plaintext.Write(message); err != nil {
+			t.Fatal(err)
+		}
+		if err = plaintext.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		md, err := ReadMessage(buf, nil, func(keys []Key, symmetric bool) ([]byte, error) {
+			return []byte("testing"), nil
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if md.IsCompressed != (algo != packet.CompressionNone) || md.CompressionAlgo != algo {
+			t.Errorf("got compression %t, %d, want %d", md.IsCompressed, md.CompressionAlgo, algo)
+		}
+		contents, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(contents, message) {
+			t.Error("recovered message incorrect")
+		}
+	}
+}
+
+func TestAdaptiveCompression(t *testing.T) {
+	config := &packet.Config{
+		DefaultCompressionAlgo: packet.CompressionZLIB,
+		CompressionConfig:      &packet.CompressionConfig{Level: packet.DefaultCompression, Adaptive: true},
+	}
+	entity, err := NewEntity("Golang Gopher", "", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := bytes.Repeat([]byte("hello world\n"), 1000)
+	random := make([]byte, 10000)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	jpeg := append([]byte("\xff\xd8\xff\xe0\x00\x10JFIF"), text...)
+
+	for i, test := range []struct {
+		message     []byte
+		contentType string
+		compressed  bool
+	}{
+		{text, "", true},
+		{text[:100], "", true},
+		{random, "", false},
+		{jpeg, "", false},
+		{text, "image/png", false},
+		{random, "text/plain; charset=utf-8", true},
+		{random, "application/x-unknown", false},
+	} {
+		for _, signed := range []*Entity{nil, entity} {
+			hints := &FileHints{IsBinary: true, ContentType: test.contentType}
+			buf := new(bytes.Buffer)
+			plaintext, err := Encrypt(buf, []*Entity{entity}, signed, hints, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for message := test.message; len(message) > 0; {
+				n := 1000
+				if n > len(message) {
+					n = len(message)
+				}
+				if _, err := plaintext.Write(message[:n]); err != nil {
+					t.Fatal(err)
+				}
+				message = message[n:]
+			}
+			if err := plaintext.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			md, err := ReadMessage(buf, EntityList{entity}, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if md.IsCompressed != test.compressed {
+				t.Errorf("#%d: got compression %t, want %t", i, md.IsCompressed, test.compressed)
+			}
+			contents, err := ioutil.ReadAll(md.UnverifiedBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(contents, test.message) {
+				t.Errorf("#%d: recovered message incorrect", i)
+			}
+			if signed != nil && md.SignatureError != nil {
+				t.Errorf("#%d: signature error: %s", i, md.SignatureError)
+			}
+		}
+	}
+}
+
+func TestLiteralDataFormats(t *testing.T) {
+	entity, err := NewEntity("Golang Gopher", "", "no-reply@golang.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := []byte("Subject: hello\n\nhello\r\nworld\n")
+	canonical := []byte("Subject: hello\r\n\r\nhello\r\nworld\r\n")
+	normalized := []byte("Subject: hello\n\nhello\nworld\n")
+
+	for _, format := range []uint8{packet.LiteralFormatBinary, packet.LiteralFormatText, packet.LiteralFormatUTF8, packet.LiteralFormatMIME} {
+		for _, normalize := range []bool{false, true} {
+			buf := new(bytes.Buffer)
+			hints := &FileHints{Format: format, NormalizeLineEndings: true}
+			plaintext, err := Encrypt(buf, []*Entity{entity}, entity, hints, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := plaintext.Write(message); err != nil {
+				t.Fatal(err)
+			}
+			if err := plaintext.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			config := &packet.Config{NormalizeLineEndings: normalize}
+			md, err := ReadMessage(buf, EntityList{entity}, nil, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if md.LiteralData.Format != format || md.LiteralData.IsText() == (format == packet.LiteralFormatBinary) {
+				t.Errorf("got format %q, want %q", md.LiteralData.Format, format)
+			}
+			contents, err := ioutil.ReadAll(md.UnverifiedBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := message
+			if format != packet.LiteralFormatBinary {
+				want = canonical
+				if normalize {
+					want = normalized
+				}
+			}
+			if !bytes.Equal(contents, want) {
+				t.Errorf("format %q, normalize %t: got %q, want %q", format, normalize, contents, want)
+			}
+			if md.SignatureError != nil {
+				t.Errorf("format %q: signature error: %s", format, md.SignatureError)
+			}
+		}
+	}
+
+	if _, err := Encrypt(new(bytes.Buffer), []*Entity{entity}, nil, &FileHints{Format: 'x'}, nil); err == nil {
+		t.Error("expected an error writing an unknown literal data format")
+	}
+}
+
 func TestSymmetricEncryptionV5RandomizeSlow(t *testing.T) {
 	modesS2K := map[int]s2k.Mode{
 		0: s2k.IteratedSaltedS2K,
@@ -483,7 +650,7 @@ func TestEncryption(t *testing.T) {
 		}
 		compAlgo := compAlgos[mathrand.Intn(len(compAlgos))]
 		level := mathrand.Intn(11) - 1
-		compConf := &packet.CompressionConfig{level}
+		compConf := &packet.CompressionConfig{Level: level}
 		var config = &packet.Config{
 			DefaultCompressionAlgo: compAlgo,
 			CompressionConfig:      compConf,
@@ -686,7 +853,7 @@ ParsePackets:
 				keys = keyring.KeysById(p.KeyId)
 			}
 			for _, k := range keys {
-				pubKeys = append(pubKeys, keyEnvelopePair{k, p})
+				pubKeys = append(pubKeys, keyEnvelopePair{key: k, encryptedKey: p})
 			}
 		case *packet.SymmetricallyEncrypted, *packet.AEADEncrypted:
 			edp = p.(packet.EncryptedDataPacket)
@@ -750,3 +917,470 @@ FindKey:
 	}
 	return nil
 }
+
+func TestEncryptWithPadding(t *testing.T) {
+	entity, err := NewEntity("Golang Gopher", "Test Key", "no-reply@golang.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const message = "testing"
+	encrypt := func(signed *Entity, config *packet.Config) []byte {
+		buf := new(bytes.Buffer)
+		w, err := Encrypt(buf, []*Entity{entity}, signed, nil /* no hints */, config)
+		if err != nil {
+			t.Fatalf("error in Encrypt: %s", err)
+		}
+		if _, err = w.Write([]byte(message)); err != nil {
+			t.Fatalf("error writing plaintext: %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("error closing WriteCloser: %s", err)
+		}
+		return buf.Bytes()
+	}
+
+	for _, aeadConfig := range []*packet.AEADConfig{nil, {}} {
+		for _, signed := range []*Entity{nil, entity} {
+			config := &packet.Config{AEADConfig: aeadConfig}
+			unpadded := encrypt(signed, config)
+			config.MinPaddingLength, config.MaxPaddingLength = 100, 100
+			padded := encrypt(signed, config)
+			if len(padded) < len(unpadded)+100 {
+				t.Errorf("padded message too short: %d bytes, unpadded %d bytes", len(padded), len(unpadded))
+			}
+
+			md, err := ReadMessage(bytes.NewReader(padded), EntityList{entity}, nil /* no prompt */, nil)
+			if err != nil {
+				t.Fatalf("error reading message: %s", err)
+			}
+			plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+			if err != nil {
+				t.Fatalf("error reading encrypted contents: %s", err)
+			}
+			if string(plaintext) != message {
+				t.Errorf("got: %s, want: %s", string(plaintext), message)
+			}
+			if signed != nil && md.SignatureError != nil {
+				t.Errorf("signature error: %s", md.SignatureError)
+			}
+		}
+	}
+
+	config := &packet.Config{MinPaddingLength: 10, MaxPaddingLength: 5}
+	if _, err := Encrypt(new(bytes.Buffer), []*Entity{entity}, nil, nil, config); err == nil {
+		t.Error("expected an error for an invalid padding length range")
+	}
+}
+
+func TestAddRecipients(t *testing.T) {
+	config := &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA}
+	sender, err := NewEntity("Golang Gopher", "Sender", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipient, err := NewEntity("Golang Gopher", "Recipient", "no-reply@golang.com", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, aeadConfig := range []*packet.AEADConfig{nil, {}} {
+		buf := new(bytes.Buffer)
+		w, err := Encrypt(buf, []*Entity{sender}, nil, nil /* no hints */, &packet.Config{AEADConfig: aeadConfig})
+		if err != nil {
+			t.Fatal(err)
+		}
+		const message = "testing"
+		if _, err = w.Write([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		encrypted := buf.Bytes()
+
+		r := bytes.NewReader(encrypted)
+		p, err := packet.Read(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encryptedKeyLen := len(encrypted) - r.Len()
+		encryptedKey, ok := p.(*packet.EncryptedKey)
+		if !ok {
+			t.Fatalf("expected an encrypted session key, got %#v", p)
+		}
+		if err := encryptedKey.Decrypt(sender.Subkeys[0].PrivateKey, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		out := new(bytes.Buffer)
+		err = AddRecipients(out, bytes.NewReader(encrypted), []*Entity{recipient}, encryptedKey.CipherFunc, encryptedKey.Key, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(out.Bytes(), encrypted[:encryptedKeyLen]) {
+			t.Error("existing encrypted session key not copied")
+		}
+		if !bytes.HasSuffix(out.Bytes(), encrypted[encryptedKeyLen:]) {
+			t.Error("encrypted data not copied verbatim")
+		}
+
+		for _, entity := range []*Entity{sender, recipient} {
+			md, err := ReadMessage(bytes.NewReader(out.Bytes()), EntityList{entity}, nil /* no prompt */, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(plaintext) != message {
+				t.Errorf("got: %s, want: %s", string(plaintext), message)
+			}
+			if md.DecryptedWith.Entity != entity {
+				t.Error("message decrypted with the wrong key")
+			}
+		}
+	}
+
+	if err := AddRecipients(new(bytes.Buffer), bytes.NewReader(nil), []*Entity{recipient}, packet.CipherAES128, make([]byte, 32), nil); err == nil {
+		t.Error("expected an error for a session key of the wrong size")
+	}
+}
+
+func TestSymmetricEncryptionV6SKESK(t *testing.T) {
+	config := &packet.Config{
+		AEADConfig: &packet.AEADConfig{},
+		V6SKESK:    true,
+		S2KConfig: &s2k.Config{
+			S2KMode:      s2k.Argon2S2K,
+			Argon2Config: &s2k.Argon2Config{NumberOfPasses: 1, DegreeOfParallelism: 4, Memory: 2 << 10},
+		},
+	}
+	buf := new(bytes.Buffer)
+	plaintext, err := SymmetricallyEncrypt(buf, []byte("testing"), nil, config)
+	if err != nil {
+		t.Fatalf("error writing headers: %s", err)
+	}
+	message := []byte("hello world\n")
+	if _, err = plaintext.Write(message); err != nil {
+		t.Fatalf("error writing to plaintext writer: %s", err)
+	}
+	if err = plaintext.Close(); err != nil {
+		t.Fatalf("error closing plaintext writer: %s", err)
+	}
+
+	p, err := packet.Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ske, ok := p.(*packet.SymmetricKeyEncrypted); !ok || ske.Version != 6 {
+		t.Fatalf("expected a v6 SymmetricKeyEncrypted packet, got %#v", p)
+	}
+
+	md, err := ReadMessage(buf, nil, func(keys []Key, symmetric bool) ([]byte, error) {
+		return []byte("testing"), nil
+	}, nil)
+	if err != nil {
+		t.Fatalf("error rereading message: %s", err)
+	}
+	messageBuf := bytes.NewBuffer(nil)
+	if _, err = io.Copy(messageBuf, md.UnverifiedBody); err != nil {
+		t.Fatalf("error rereading message: %s", err)
+	}
+	if !bytes.Equal(message, messageBuf.Bytes()) {
+		t.Errorf("recovered message incorrect got '%s', want '%s'", messageBuf.Bytes(), message)
+	}
+}
+
+func TestSymmetricEncryptionChunkSizeHint(t *testing.T) {
+	message := []byte("hello world\n")
+	for _, test := range []struct {
+		config        *packet.Config
+		hints         *FileHints
+		wantChunkByte byte
+	}{
+		{&packet.Config{AEADConfig: &packet.AEADConfig{}}, nil, 12},
+		{&packet.Config{AEADConfig: &packet.AEADConfig{}}, &FileHints{Size: uint64(len(message))}, 8},
+		{&packet.Config{AEADConfig: &packet.AEADConfig{}}, &FileHints{Size: 1 << 30}, 16},
+		{&packet.Config{AEADConfig: &packet.AEADConfig{ChunkSize: 1 << 10}}, &FileHints{Size: 1 << 30}, 4},
+	} {
+		configuredChunkSize := test.config.AEADConfig.ChunkSize
+		buf := new(bytes.Buffer)
+		plaintext, err := SymmetricallyEncrypt(buf, []byte("testing"), test.hints, test.config)
+		if err != nil {
+			t.Fatalf("error writing headers: %s", err)
+		}
+		if _, err = plaintext.Write(message); err != nil {
+			t.Fatalf("error writing to plaintext writer: %s", err)
+		}
+		if err = plaintext.Close(); err != nil {
+			t.Fatalf("error closing plaintext writer: %s", err)
+		}
+
+		packets := packet.NewReader(bytes.NewReader(buf.Bytes()))
+		var chunkSizeByte byte
+		for {
+			p, err := packets.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if se, ok := p.(*packet.SymmetricallyEncrypted); ok {
+				chunkSizeByte = se.ChunkSizeByte
+				break
+			}
+		}
+		if chunkSizeByte != test.wantChunkByte {
+			t.Errorf("got chunk size byte %d, want %d", chunkSizeByte, test.wantChunkByte)
+		}
+		if test.config.AEADConfig.ChunkSize != configuredChunkSize {
+			t.Error("config was modified")
+		}
+
+		md, err := ReadMessage(buf, nil, func(keys []Key, symmetric bool) ([]byte, error) {
+			return []byte("testing"), nil
+		}, nil)
+		if err != nil {
+			t.Fatalf("error rereading message: %s", err)
+		}
+		messageBuf := bytes.NewBuffer(nil)
+		if _, err = io.Copy(messageBuf, md.UnverifiedBody); err != nil {
+			t.Fatalf("error rereading message: %s", err)
+		}
+		if !bytes.Equal(message, messageBuf.Bytes()) {
+			t.Errorf("recovered message incorrect got '%s', want '%s'", messageBuf.Bytes(), message)
+		}
+	}
+}
+
+func TestEncryptionAEADMode(t *testing.T) {
+	recipient, err := NewEntity("Golang Gopher", "Test", "no-reply@golang.com", &packet.Config{
+		Algorithm:     packet.PubKeyAlgoEdDSA,
+		DefaultCipher: packet.CipherAES256,
+		AEADConfig:    &packet.AEADConfig{DefaultMode: packet.AEADModeGCM},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []packet.AEADMode{packet.AEADModeEAX, packet.AEADModeOCB, packet.AEADModeGCM} {
+		config := &packet.Config{
+			DefaultCipher: packet.CipherAES128,
+			AEADConfig:    &packet.AEADConfig{DefaultMode: mode},
+		}
+		buf := new(bytes.Buffer)
+		w, err := Encrypt(buf, []*Entity{recipient}, nil, nil, config)
+		if err != nil {
+			t.Fatalf("error in encrypting plaintext: %s", err)
+		}
+		message := "message for mode " + strconv.Itoa(int(mode))
+		if _, err = w.Write([]byte(message)); err != nil {
+			t.Fatalf("error writing plaintext: %s", err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("error closing WriteCloser: %s", err)
+		}
+
+		// The recipient prefers (AES256, GCM), but the configured mode and
+		// cipher are used when the recipient supports them.
+		wantMode, wantCipher := mode, packet.CipherAES128
+		if mode == packet.AEADModeEAX {
+			wantMode, wantCipher = packet.AEADModeGCM, packet.CipherAES256
+		}
+		packets := packet.NewReader(bytes.NewReader(buf.Bytes()))
+		for {
+			p, err := packets.Next()
+			if err != nil {
+				t.Fatalf("error reading packets: %s", err)
+			}
+			if se, ok := p.(*packet.SymmetricallyEncrypted); ok {
+				if se.Version != 2 || se.Mode != wantMode || se.Cipher != wantCipher {
+					t.Errorf("got version %d, mode %d, cipher %d; want version 2, mode %d, cipher %d", se.Version, se.Mode, se.Cipher, wantMode, wantCipher)
+				}
+				break
+			}
+		}
+
+		md, err := ReadMessage(bytes.NewReader(buf.Bytes()), EntityList{recipient}, nil /* no prompt */, nil)
+		if err != nil {
+			t.Fatalf("error reading message: %s", err)
+		}
+		plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatalf("error reading encrypted contents: %s", err)
+		}
+		if string(plaintext) != message {
+			t.Errorf("got: %s, want: %s", string(plaintext), message)
+		}
+	}
+}
+
+func TestEncryptWithPassphrases(t *testing.T) {
+	recipient, err := NewEntity("Golang Gopher", "Test", "no-reply@golang.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphrases := [][]byte{[]byte("first passphrase"), []byte("second passphrase")}
+	const message = "testing"
+
+	for _, aeadConfig := range []*packet.AEADConfig{nil, {}} {
+		config := &packet.Config{AEADConfig: aeadConfig}
+		for _, to := range [][]*Entity{{recipient}, nil} {
+			buf := new(bytes.Buffer)
+			w, err := EncryptWithPassphrases(buf, to, passphrases, nil, nil, config)
+			if err != nil {
+				t.Fatalf("error in encrypting plaintext: %s", err)
+			}
+			if _, err = w.Write([]byte(message)); err != nil {
+				t.Fatalf("error writing plaintext: %s", err)
+			}
+			if err = w.Close(); err != nil {
+				t.Fatalf("error closing WriteCloser: %s", err)
+			}
+
+			// SEIPDv1 data must be preceded by v4 symmetric-key encrypted
+			// session key packets only.
+			var skeskVersions []int
+			packets := packet.NewReader(bytes.NewReader(buf.Bytes()))
+			for {
+				p, err := packets.Next()
+				if err != nil {
+					t.Fatalf("error reading packets: %s", err)
+				}
+				if se, ok := p.(*packet.SymmetricallyEncrypted); ok {
+					if len(skeskVersions) != len(passphrases) {
+						t.Errorf("got %d symmetric-key encrypted session keys, want %d", len(skeskVersions), len(passphrases))
+					}
+					for _, version := range skeskVersions {
+						if (version == 4) != (se.Version == 1) {
+							t.Errorf("got v%d symmetric-key encrypted session key with v%d encrypted data", version, se.Version)
+						}
+					}
+					if aeadConfig == nil && se.Version != 1 {
+						t.Errorf("got v%d encrypted data with AEAD config %v", se.Version, aeadConfig)
+					}
+					break
+				}
+				if ske, ok := p.(*packet.SymmetricKeyEncrypted); ok {
+					skeskVersions = append(skeskVersions, ske.Version)
+				}
+			}
+
+			var keyrings []EntityList
+			if to != nil {
+				keyrings = append(keyrings, EntityList{recipient})
+			}
+			keyrings = append(keyrings, nil)
+			for _, keyring := range keyrings {
+				for _, passphrase := range passphrases {
+					prompt := func(keys []Key, symmetric bool) ([]byte, error) {
+						if !symmetric {
+							t.Fatal("passphrase not usable")
+						}
+						return passphrase, nil
+					}
+					md, err := ReadMessage(bytes.NewReader(buf.Bytes()), keyring, prompt, nil)
+					if err != nil {
+						t.Fatalf("error reading message: %s", err)
+					}
+					plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+					if err != nil {
+						t.Fatalf("error reading encrypted contents: %s", err)
+					}
+					if string(plaintext) != message {
+						t.Errorf("got: %s, want: %s", plaintext, message)
+					}
+					if keyring != nil && md.DecryptedWith.Entity != recipient {
+						t.Error("message not decrypted with the private key")
+					}
+				}
+			}
+		}
+	}
+
+	if _, err = EncryptWithPassphrases(new(bytes.Buffer), nil, nil, nil, nil, nil); err == nil {
+		t.Error("expected an error without recipients nor passphrases")
+	}
+}
+
+func TestEncryptionForcedVersion(t *testing.T) {
+	v2Recipient, err := NewEntity("Golang Gopher", "Test", "no-reply@golang.com", &packet.Config{
+		Algorithm:  packet.PubKeyAlgoEdDSA,
+		AEADConfig: &packet.AEADConfig{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1Recipient, err := NewEntity("Golang Gopher", "Test", "no-reply@golang.com", &packet.Config{
+		Algorithm: packet.PubKeyAlgoEdDSA,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		recipient   *Entity
+		config      *packet.Config
+		wantVersion int
+	}{
+		{v2Recipient, &packet.Config{AEADConfig: &packet.AEADConfig{}}, 2},
+		{v2Recipient, &packet.Config{AEADConfig: &packet.AEADConfig{}, EncryptionVersion: packet.ForceSEIPDv1}, 1},
+		{v1Recipient, nil, 1},
+		{v1Recipient, &packet.Config{EncryptionVersion: packet.ForceSEIPDv2}, 2},
+	}
+	for i, test := range tests {
+		buf := new(bytes.Buffer)
+		w, err := EncryptWithPassphrases(buf, []*Entity{test.recipient}, [][]byte{[]byte("password")}, nil, nil, test.config)
+		if err != nil {
+			t.Fatalf("#%d: error in encrypting plaintext: %s", i, err)
+		}
+		const message = "forced version"
+		if _, err = w.Write([]byte(message)); err != nil {
+			t.Fatalf("#%d: error writing plaintext: %s", i, err)
+		}
+		if err = w.Close(); err != nil {
+			t.Fatalf("#%d: error closing WriteCloser: %s", i, err)
+		}
+
+		packets := packet.NewReader(bytes.NewReader(buf.Bytes()))
+		for {
+			p, err := packets.Next()
+			if err != nil {
+				t.Fatalf("#%d: error reading packets: %s", i, err)
+			}
+			if se, ok := p.(*packet.SymmetricallyEncrypted); ok {
+				if se.Version != test.wantVersion {
+					t.Errorf("#%d: got version %d, want %d", i, se.Version, test.wantVersion)
+				}
+				break
+			}
+		}
+
+		md, err := ReadMessage(bytes.NewReader(buf.Bytes()), EntityList{test.recipient}, nil /* no prompt */, nil)
+		if err != nil {
+			t.Fatalf("#%d: error reading message: %s", i, err)
+		}
+		plaintext, err := ioutil.ReadAll(md.UnverifiedBody)
+		if err != nil {
+			t.Fatalf("#%d: error reading encrypted contents: %s", i, err)
+		}
+		if string(plaintext) != message {
+			t.Errorf("#%d: got: %s, want: %s", i, string(plaintext), message)
+		}
+
+		prompt := func(keys []Key, symmetric bool) ([]byte, error) {
+			return []byte("password"), nil
+		}
+		md, err = ReadMessage(bytes.NewReader(buf.Bytes()), nil, prompt, nil)
+		if err != nil {
+			t.Fatalf("#%d: error reading message with passphrase: %s", i, err)
+		}
+		if plaintext, err = ioutil.ReadAll(md.UnverifiedBody); err != nil || string(plaintext) != message {
+			t.Errorf("#%d: error decrypting with passphrase: %v", i, err)
+		}
+	}
+
+	config := &packet.Config{EncryptionVersion: packet.ForceSEIPDv2 + 1}
+	if _, ok := config.Validate().(errors.InvalidConfigurationError); !ok {
+		t.Error("expected an InvalidConfigurationError for an unknown encryption version")
+	}
+}
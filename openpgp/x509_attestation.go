@@ -0,0 +1,140 @@
+package openpgp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// The notations of X.509 attestations. They are not critical, so that
+// implementations unaware of them can still verify the signatures.
+const (
+	// X509CertificateNotation holds the SHA-256 digest of the DER encoding
+	// of the attested certificate.
+	X509CertificateNotation = "x509-certificate-sha256@protonmail.com"
+	// X509CrossSignatureNotation holds a signature, made by the key of the
+	// attested certificate, of the fingerprint of the OpenPGP primary key.
+	X509CrossSignatureNotation = "x509-cross-signature@protonmail.com"
+)
+
+// x509CrossSignaturePrefix separates the messages signed by certificate keys
+// for X.509 attestations from other uses of these keys.
+const x509CrossSignaturePrefix = "OpenPGP X.509 attestation\x00"
+
+// An X509Attestation binds an OpenPGP key to an X.509 certificate.
+type X509Attestation struct {
+	// Signature is the detached signature, made by the OpenPGP key, of the
+	// DER encoding of the certificate.
+	Signature *packet.Signature
+	// Signer is the entity of the OpenPGP key.
+	Signer *Entity
+	// CrossSigned is true if the key of the certificate attests the
+	// OpenPGP key in turn, binding them in both directions.
+	CrossSigned bool
+}
+
+// AttestX509Certificate writes to w a detached signature, made by signer, of
+// the DER encoding of cert, which attests that the holder of the OpenPGP key
+// of signer vouches for the certificate. If certKey is not nil, it must be
+// the private key of cert, and the attestation carries its signature of the
+// fingerprint of the primary key of signer, attesting the OpenPGP key in
+// return. If config is nil, sensible defaults will be used.
+func AttestX509Certificate(w io.Writer, signer *Entity, cert *x509.Certificate, certKey crypto.Signer, config *packet.Config) (*packet.Signature, error) {
+	digest := sha256.Sum256(cert.Raw)
+	notations := append([]*packet.Notation(nil), config.Notations()...)
+	notations = append(notations, &packet.Notation{
+		Name:  X509CertificateNotation,
+		Value: digest[:],
+	})
+	if certKey != nil {
+		crossSignature, err := signX509CrossSignature(certKey, cert, signer.PrimaryKey.Fingerprint, config)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkX509CrossSignature(cert, signer.PrimaryKey.Fingerprint, crossSignature); err != nil {
+			return nil, errors.InvalidArgumentError("certificate key does not match the certificate")
+		}
+		notations = append(notations, &packet.Notation{
+			Name:  X509CrossSignatureNotation,
+			Value: crossSignature,
+		})
+	}
+	config = copyConfig(config)
+	config.SignatureNotations = notations
+	return detachSign(w, signer, bytes.NewReader(cert.Raw), packet.SigTypeBinary, config)
+}
+
+// VerifyX509Attestation verifies an X.509 attestation, read from signature,
+// of cert by a key of keyring. If the attestation carries a cross signature,
+// it must be valid as well.
+func VerifyX509Attestation(keyring KeyRing, cert *x509.Certificate, signature io.Reader, config *packet.Config) (*X509Attestation, error) {
+	sig, signer, err := verifyDetachedSignature(keyring, bytes.NewReader(cert.Raw), signature, nil, config)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(cert.Raw)
+	attestation := &X509Attestation{Signature: sig, Signer: signer}
+	attested := false
+	for _, notation := range sig.Notations {
+		switch notation.Name {
+		case X509CertificateNotation:
+			if !bytes.Equal(notation.Value, digest[:]) {
+				return nil, errors.SignatureError("X.509 attestation of another certificate")
+			}
+			attested = true
+		case X509CrossSignatureNotation:
+			if err := checkX509CrossSignature(cert, signer.PrimaryKey.Fingerprint, notation.Value); err != nil {
+				return nil, errors.SignatureError("invalid X.509 cross signature: " + err.Error())
+			}
+			attestation.CrossSigned = true
+		}
+	}
+	if !attested {
+		return nil, errors.SignatureError("signature is not an X.509 attestation")
+	}
+	return attestation, nil
+}
+
+// x509CrossSignatureAlgorithm returns the algorithm of the cross signatures
+// made with the key of cert.
+func x509CrossSignatureAlgorithm(cert *x509.Certificate) (x509.SignatureAlgorithm, error) {
+	switch cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return x509.SHA256WithRSA, nil
+	case *ecdsa.PublicKey:
+		return x509.ECDSAWithSHA256, nil
+	case ed25519.PublicKey:
+		return x509.PureEd25519, nil
+	}
+	return x509.UnknownSignatureAlgorithm, errors.UnsupportedError("X.509 certificate key algorithm")
+}
+
+func signX509CrossSignature(certKey crypto.Signer, cert *x509.Certificate, fingerprint []byte, config *packet.Config) ([]byte, error) {
+	algo, err := x509CrossSignatureAlgorithm(cert)
+	if err != nil {
+		return nil, err
+	}
+	message := append([]byte(x509CrossSignaturePrefix), fingerprint...)
+	if algo == x509.PureEd25519 {
+		return certKey.Sign(config.Random(), message, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(message)
+	return certKey.Sign(config.Random(), digest[:], crypto.SHA256)
+}
+
+func checkX509CrossSignature(cert *x509.Certificate, fingerprint, signature []byte) error {
+	algo, err := x509CrossSignatureAlgorithm(cert)
+	if err != nil {
+		return err
+	}
+	message := append([]byte(x509CrossSignaturePrefix), fingerprint...)
+	return cert.CheckSignature(algo, message, signature)
+}
@@ -0,0 +1,71 @@
+package openpgp
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Golang Gopher"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func TestX509Attestation(t *testing.T) {
+	entity, err := NewEntity("Golang Gopher", "", "no-reply@golang.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, certKey := newTestCertificate(t)
+	other, otherKey := newTestCertificate(t)
+
+	for _, crossSign := range []bool{false, true} {
+		buf := new(bytes.Buffer)
+		var err error
+		if crossSign {
+			_, err = AttestX509Certificate(buf, entity, cert, certKey, nil)
+		} else {
+			_, err = AttestX509Certificate(buf, entity, cert, nil, nil)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		attestation, err := VerifyX509Attestation(EntityList{entity}, cert, bytes.NewReader(buf.Bytes()), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if attestation.Signer != entity || attestation.CrossSigned != crossSign {
+			t.Errorf("unexpected attestation: signer %v, cross signed %t", attestation.Signer, attestation.CrossSigned)
+		}
+		if _, err := VerifyX509Attestation(EntityList{entity}, other, bytes.NewReader(buf.Bytes()), nil); err == nil {
+			t.Error("attestation of another certificate verified")
+		}
+	}
+
+	if _, err := AttestX509Certificate(new(bytes.Buffer), entity, cert, otherKey, nil); err == nil {
+		t.Error("expected an error cross signing with the key of another certificate")
+	}
+}